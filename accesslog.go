@@ -0,0 +1,148 @@
+package zapang
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats for WithAccessLogFormat.
+const (
+	// AccessLogCombined is the Apache/NCSA combined log format.
+	AccessLogCombined = "combined"
+	// AccessLogJSON is one JSON object per request with a fixed access-log schema.
+	AccessLogJSON = "json"
+)
+
+// accessLogger writes one access log line per request to a dedicated sink.
+type accessLogger struct {
+	format string
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// accessRecord is the JSON access-log schema.
+type accessRecord struct {
+	Timestamp  string  `json:"timestamp"`
+	RemoteAddr string  `json:"remote_addr"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Protocol   string  `json:"protocol"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	LatencyMs  float64 `json:"latency_ms"`
+}
+
+// WithAccessLogFormat writes an access log line per request to w, independent of
+// the application log. Format is AccessLogCombined or AccessLogJSON.
+func WithAccessLogFormat(format string, w io.Writer) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.accessLog = &accessLogger{format: format, w: w}
+	}
+}
+
+// accessIdentity returns the client address and user for the access log,
+// hashed as the logger's Config.Pseudonymize hashes client_ip and user_id.
+func (c *middlewareConfig) accessIdentity(clientIP, user string) (string, string) {
+	p := c.pseudonymize
+	if p == nil {
+		return clientIP, user
+	}
+	if clientIP != "" && slices.Contains(p.fields(), "client_ip") {
+		clientIP = pseudonymize(p.Key, clientIP)
+	}
+	if user != "" && slices.Contains(p.fields(), "user_id") {
+		user = pseudonymize(p.Key, user)
+	}
+	return clientIP, user
+}
+
+func (a *accessLogger) log(r *http.Request, clientIP, user string, status, size int, start time.Time, latency time.Duration) {
+	var line []byte
+	if a.format == AccessLogJSON {
+		line, _ = json.Marshal(accessRecord{
+			Timestamp:  start.Format(time.RFC3339Nano),
+			RemoteAddr: clientIP,
+			User:       user,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Protocol:   r.Proto,
+			Status:     status,
+			Bytes:      size,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			LatencyMs:  float64(latency.Nanoseconds()) / 1e6,
+		})
+		line = append(line, '\n')
+	} else {
+		line = combinedLine(r, clientIP, user, status, size, start)
+	}
+
+	a.mu.Lock()
+	_, _ = a.w.Write(line)
+	a.mu.Unlock()
+}
+
+// combinedLine renders: host ident user [time] "request" status bytes "referer" "user-agent".
+func combinedLine(r *http.Request, clientIP, user string, status, size int, start time.Time) []byte {
+	var b strings.Builder
+	b.WriteString(dashIfEmpty(clientIP))
+	b.WriteString(" - ")
+	b.WriteString(dashIfEmpty(user))
+	b.WriteString(" [")
+	b.WriteString(start.Format("02/Jan/2006:15:04:05 -0700"))
+	b.WriteString("] \"")
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.RequestURI)
+	b.WriteByte(' ')
+	b.WriteString(r.Proto)
+	b.WriteString("\" ")
+	b.WriteString(strconv.Itoa(status))
+	b.WriteByte(' ')
+	if size > 0 {
+		b.WriteString(strconv.Itoa(size))
+	} else {
+		b.WriteByte('-')
+	}
+	b.WriteString(" ")
+	b.WriteString(strconv.Quote(dashIfEmpty(r.Referer())))
+	b.WriteString(" ")
+	b.WriteString(strconv.Quote(dashIfEmpty(r.UserAgent())))
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+func requestUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if r.URL.User != nil {
+		return r.URL.User.Username()
+	}
+	return ""
+}
+
+// hostOnly strips the port from a host:port address.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrNoAckSink is delivered by Critical when no acknowledged sink received the entry
+// because the context logger has no Config.CriticalSink.
+var ErrNoAckSink = errors.New("zapang: critical entry not routed to an acknowledged sink")
+
+// AckSink is a sink that confirms durable delivery, e.g. a Kafka producer waiting
+// for acks or an HTTP client expecting a 2xx response.
+type AckSink interface {
+	// WriteAck delivers one JSON-encoded entry and returns once it is durably
+	// stored, or with the delivery error.
+	WriteAck(ctx context.Context, p []byte) error
+}
+
+// ackRequest travels with a Critical entry as a skipped field, so encoders
+// ignore it while ackCore can find it.
+type ackRequest struct {
+	ctx     context.Context
+	result  chan error
+	claimed atomic.Bool
+}
+
+// Critical logs msg at Info level, bypassing sampling, and routes it through
+// Config.CriticalSink. The returned channel receives exactly one value: nil once
+// the sink acknowledged the entry, or the delivery error. Use it for must-not-lose
+// events such as financial audit records.
+//
+// The CriticalSink receives the entry whatever the logger's level and filters;
+// the regular sinks only if they would log it at Info.
+func Critical(ctx context.Context, msg string, fields ...zap.Field) <-chan error {
+	req := &ackRequest{ctx: ctx, result: make(chan error, 1)}
+
+	log := WithCallerSkip(FromContext(ctx), 1).WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		if ack := ackOf(c); ack != nil {
+			return zapcore.NewTee(bypassSampling(c), ack)
+		}
+		return bypassSampling(c)
+	}))
+	if ce := log.Check(zapcore.InfoLevel, msg); ce != nil {
+		ce.Write(slices.Concat(fields, []zap.Field{{Type: zapcore.SkipType, Interface: req}})...)
+	}
+
+	if !req.claimed.Load() {
+		req.result <- ErrNoAckSink
+	}
+	return req.result
+}
+
+// bypassSampling unwraps the sampling and throughput layers so critical
+// entries are never dropped.
+func bypassSampling(c zapcore.Core) zapcore.Core {
+	if lc, ok := c.(*lastWordsCore); ok {
+		c = lc.Core
+	}
+	if sc, ok := c.(*sampleCore); ok {
+		c = sc.Core
+	}
+	if tc, ok := c.(*throughputCore); ok {
+		c = tc.Core
+	}
+	return c
+}
+
+// criticalCore carries the logger's acknowledged sink beside its regular
+// sinks. Only Critical writes to ack, so the sink is outside the level gate
+// of ordinary entries.
+type criticalCore struct {
+	zapcore.Core
+	ack zapcore.Core
+}
+
+func (c *criticalCore) With(fields []zapcore.Field) zapcore.Core {
+	return &criticalCore{Core: c.Core.With(fields), ack: c.ack.With(fields)}
+}
+
+// ackOf returns the acknowledged sink of a logger built by New, or nil.
+func ackOf(c zapcore.Core) zapcore.Core {
+	for {
+		switch core := c.(type) {
+		case *criticalCore:
+			return core.ack
+		case *sampleCore:
+			c = core.Core
+		case *throughputCore:
+			c = core.Core
+		case interface{ unwrap() zapcore.Core }:
+			c = core.unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// ackCore encodes Critical entries and hands them to an AckSink. Other entries are ignored.
+type ackCore struct {
+	enc  zapcore.Encoder
+	sink AckSink
+}
+
+func newAckCore(cfg Config) *ackCore {
+	return &ackCore{enc: newEncoder(EncodingJSON, cfg), sink: cfg.CriticalSink}
+}
+
+func (c *ackCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *ackCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &ackCore{enc: c.enc.Clone(), sink: c.sink}
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *ackCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *ackCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var req *ackRequest
+	for _, f := range fields {
+		if r, ok := f.Interface.(*ackRequest); ok && f.Type == zapcore.SkipType {
+			req = r
+			break
+		}
+	}
+	if req == nil || !req.claimed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		req.result <- err
+		return err
+	}
+	data := slices.Clone(buf.Bytes())
+	buf.Free()
+
+	go func() {
+		req.result <- c.sink.WriteAck(req.ctx, data)
+	}()
+	return nil
+}
+
+func (c *ackCore) Sync() error {
+	return nil
+}
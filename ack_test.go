@@ -0,0 +1,81 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type ackFunc func(ctx context.Context, p []byte) error
+
+func (f ackFunc) WriteAck(ctx context.Context, p []byte) error { return f(ctx, p) }
+
+func TestCritical(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := make(chan string, 1)
+	l, _ := NewWithLevel(ctx, "serviceName", Config{
+		Level:    "info",
+		Sampling: &SamplingConfig{Initial: 1, Thereafter: 1000},
+		CriticalSink: ackFunc(func(_ context.Context, p []byte) error {
+			got <- string(p)
+			return nil
+		}),
+	}, nil)
+	ctx = WithContext(ctx, l.With(UserID("u1")))
+
+	// Exhaust the sampler for this message; Critical must bypass it.
+	l.Info("audit")
+	l.Info("audit")
+
+	if err := <-Critical(ctx, "audit", zapFieldAmount()); err != nil {
+		t.Fatal(err)
+	}
+	line := <-got
+	if !strings.Contains(line, `"user_id":"u1"`) || !strings.Contains(line, `"amount":100`) {
+		t.Fatalf("unexpected critical entry: %s", line)
+	}
+
+	noSink, _ := NewWithLevel(ctx, "serviceName", Config{Level: "info"}, nil)
+	if err := <-Critical(WithContext(ctx, noSink), "audit"); !errors.Is(err, ErrNoAckSink) {
+		t.Fatalf("expected ErrNoAckSink, got %v", err)
+	}
+}
+
+func TestCriticalBelowLevel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := make(chan string, 1)
+	var out bytes.Buffer
+	l, _ := NewWithLevel(ctx, "serviceName", Config{
+		Level: "warn",
+		CriticalSink: ackFunc(func(_ context.Context, p []byte) error {
+			got <- string(p)
+			return nil
+		}),
+	}, &out)
+	ctx = WithContext(ctx, l.With(UserID("u1")).Named("billing"))
+
+	// The sink receives the entry although Info is disabled.
+	if err := <-Critical(ctx, "audit"); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-got; !strings.Contains(line, `"user_id":"u1"`) {
+		t.Fatalf("unexpected critical entry: %s", line)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected the regular sinks to keep their level, got %s", out.String())
+	}
+	if l.Core().Enabled(zapcore.InfoLevel) {
+		t.Fatal("expected the critical sink not to enable Info for ordinary entries")
+	}
+}
+
+func zapFieldAmount() zap.Field { return zap.Int("amount", 100) }
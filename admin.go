@@ -0,0 +1,202 @@
+package zapang
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AdminOption configures AdminHandler.
+type AdminOption func(*adminConfig)
+
+type adminConfig struct {
+	tokens    []adminToken
+	allowlist []netip.Prefix
+}
+
+type adminToken struct {
+	name  string
+	token []byte
+}
+
+// WithAdminToken requires an "Authorization: Bearer <token>" header on every
+// admin request. It may be given several times, one per caller; name
+// identifies the caller in level change audit entries.
+func WithAdminToken(name, token string) AdminOption {
+	return func(c *adminConfig) {
+		c.tokens = append(c.tokens, adminToken{name: name, token: []byte(token)})
+	}
+}
+
+// WithAdminAllowlist only admits requests whose peer address is in one of
+// prefixes, e.g. the loopback or cluster network. Forwarding headers are not
+// consulted.
+func WithAdminAllowlist(prefixes ...netip.Prefix) AdminOption {
+	return func(c *adminConfig) {
+		c.allowlist = append(c.allowlist, prefixes...)
+	}
+}
+
+// AdminHandler returns an http.Handler exposing the global logger's runtime state:
+//
+//	GET  /loglevel   current level as {"level":"info"}
+//	PUT  /loglevel   change level with {"level":"debug"} (POST is accepted too)
+//	GET  /logconfig  effective configuration
+//	GET  /logstats   emitted/dropped entry counters
+//
+// Mount it under a prefix with http.StripPrefix. Without options every caller
+// is admitted; protect production endpoints with WithAdminToken and/or
+// WithAdminAllowlist. Level changes are logged as "log level changed" audit
+// entries with the previous and new level and the caller.
+func AdminHandler(opts ...AdminOption) http.Handler {
+	var cfg adminConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loglevel", handleLogLevel)
+	mux.HandleFunc("GET /logconfig", handleLogConfig)
+	mux.HandleFunc("GET /logstats", handleLogStats)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.allowed(r) {
+			writeJSONError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		name, ok := cfg.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if name != "" {
+			r = r.WithContext(contextWithAdminCaller(r.Context(), name))
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// allowed reports whether the peer address passes the allowlist.
+func (c *adminConfig) allowed(r *http.Request) bool {
+	if len(c.allowlist) == 0 {
+		return true
+	}
+	ip, err := netip.ParseAddr(hostOnly(r.RemoteAddr))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range c.allowlist {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate checks the bearer token and returns the matching caller name.
+// Every configured token is compared, in constant time, so timing reveals
+// neither the token nor which one matched.
+func (c *adminConfig) authenticate(r *http.Request) (string, bool) {
+	if len(c.tokens) == 0 {
+		return "", true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	name, found := "", false
+	for _, t := range c.tokens {
+		if subtle.ConstantTimeCompare([]byte(got), t.token) == 1 && !found {
+			name, found = t.name, true
+		}
+	}
+	return name, found
+}
+
+type adminCallerKey struct{}
+
+func contextWithAdminCaller(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, adminCallerKey{}, name)
+}
+
+type levelPayload struct {
+	Level string `json:"level"`
+}
+
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req levelPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		var lvl zapcore.Level
+		if err := lvl.UnmarshalText([]byte(req.Level)); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "unknown level "+req.Level)
+			return
+		}
+		from := GlobalLevel().Level()
+		SetGlobalLevel(lvl.String())
+		auditLevelChange(r, from, lvl)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, levelPayload{Level: GlobalLevel().Level().String()})
+}
+
+// auditLevelChange logs who changed the global level, from what and to what.
+// The Info entry bypasses the global level, so raising it to error does not
+// hide its own audit trail from the sinks that follow it.
+func auditLevelChange(r *http.Request, from, to zapcore.Level) {
+	fields := []zap.Field{
+		zap.String("level_from", from.String()),
+		zap.String("level_to", to.String()),
+		ClientIP(hostOnly(r.RemoteAddr)),
+		UserAgent(r.UserAgent()),
+	}
+	if name, ok := r.Context().Value(adminCallerKey{}).(string); ok {
+		fields = append(fields, zap.String("admin_caller", name))
+	}
+	audit := Global().WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return newLevelOverrideCore(c, zapcore.InfoLevel)
+	}))
+	audit.Info("log level changed", fields...)
+}
+
+func handleLogConfig(w http.ResponseWriter, _ *http.Request) {
+	globalMu.RLock()
+	live := globalLive
+	globalMu.RUnlock()
+
+	if live == nil {
+		writeJSONError(w, http.StatusNotFound, "no logger configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, live.effective())
+}
+
+func handleLogStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, ReadStats())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,126 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	New(ctx, "serviceName", Config{Level: "info"}, nil)
+	h := AdminHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"DEBUG"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"debug"`) {
+		t.Fatalf("level change failed: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"loud"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown level, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logconfig", nil))
+	var cfg Config
+	if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil || cfg.Level != "debug" {
+		t.Fatalf("unexpected config: %v %s", err, rec.Body)
+	}
+
+	Global().Info("counted")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logstats", nil))
+	var stats Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Emitted["info"] == 0 {
+		t.Fatalf("unexpected stats: %v %s", err, rec.Body)
+	}
+}
+
+func TestOnLevelChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	New(ctx, "serviceName", Config{Level: "info"}, nil)
+	var mu sync.Mutex
+	var changes []string
+	unregister := OnLevelChange(func(old, new zapcore.Level) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, old.String()+">"+new.String())
+	})
+
+	SetGlobalLevel("debug")
+	SetGlobalLevel("debug") // unchanged: no notification
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"error"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("level change failed: %d %s", rec.Code, rec.Body)
+	}
+
+	unregister()
+	SetGlobalLevel("warn")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(changes, ","); got != "info>debug,debug>error" {
+		t.Fatalf("unexpected level changes: %s", got)
+	}
+}
+
+func TestAdminHandlerAccessControl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	New(ctx, "serviceName", Config{Level: "info", ConsoleLevel: "error", WriterEncoding: EncodingJSON}, &buf)
+	h := AdminHandler(
+		WithAdminToken("oncall", "s3cret"),
+		WithAdminAllowlist(netip.MustParsePrefix("10.0.0.0/8")),
+	)
+
+	serve := func(remote, token string) int {
+		req := httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"error"}`))
+		req.RemoteAddr = remote
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("203.0.113.1:1234", "s3cret"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 outside the allowlist, got %d", code)
+	}
+	if code := serve("10.0.0.5:1234", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad token, got %d", code)
+	}
+	if GlobalLevel().Level() != zapcore.InfoLevel {
+		t.Fatalf("rejected requests changed the level to %v", GlobalLevel().Level())
+	}
+	if code := serve("10.0.0.5:1234", "s3cret"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// The audit entry is written at Info although the level is now error.
+	audit, err := QueryEntries(&buf, EntryQuery{Message: "log level changed"})
+	if err != nil || len(audit) != 1 {
+		t.Fatalf("expected one audit entry, got %d (%v)", len(audit), err)
+	}
+	m := audit[0].Fields
+	if m["level_from"] != "info" || m["level_to"] != "error" || m["admin_caller"] != "oncall" || m["client_ip"] != "10.0.0.5" {
+		t.Fatalf("unexpected audit entry: %v", m)
+	}
+}
@@ -0,0 +1,355 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// archiveStampLayout names rolled segments, e.g. export-20240102T150405Z.jsonl.
+const archiveStampLayout = "20060102T150405Z"
+
+// archiveCheckInterval is how often the archiver checks whether the current
+// segment is due, at most.
+const archiveCheckInterval = 10 * time.Second
+
+// archiveTimeout bounds each upload and retention pass, and the final upload
+// on shutdown.
+const archiveTimeout = time.Minute
+
+// ArchiveClient is the subset of an S3-compatible object storage API used by
+// the archiver. Adapt your AWS SDK, GCS or MinIO client to this interface.
+type ArchiveClient interface {
+	PutObject(ctx context.Context, in *ArchivePutInput) error
+	ListObjects(ctx context.Context, bucket, prefix string) ([]ArchiveObject, error)
+	DeleteObject(ctx context.Context, bucket, key string) error
+}
+
+// ArchivePutInput mirrors the PutObject request.
+type ArchivePutInput struct {
+	Bucket          string
+	Key             string
+	Body            io.Reader
+	ContentLength   int64
+	ContentType     string
+	ContentEncoding string
+
+	// ServerSideEncryption and SSEKMSKeyID are ArchiveConfig's settings.
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+}
+
+// ArchiveObject is an object returned by ListObjects.
+type ArchiveObject struct {
+	Key          string
+	LastModified time.Time
+}
+
+// ArchiveConfig configures archival of ExportPath to object storage.
+type ArchiveConfig struct {
+	// Bucket is the destination bucket.
+	Bucket string `yaml:"bucket" json:"bucket" mapstructure:"bucket"`
+
+	// Prefix is prepended to object keys, e.g. "logs/billing/host-1/". Give
+	// every instance its own prefix; keys are the rolled file names.
+	Prefix string `yaml:"prefix" json:"prefix" mapstructure:"prefix"`
+
+	// SegmentSize rolls the export file once it holds this many bytes.
+	// Default: 64 MiB.
+	SegmentSize int64 `yaml:"segment_size" json:"segment_size" mapstructure:"segment_size"`
+
+	// SegmentInterval rolls the export file once it is this old. Default: 1h.
+	SegmentInterval time.Duration `yaml:"segment_interval" json:"segment_interval" mapstructure:"segment_interval"`
+
+	// Retention deletes archived objects under Prefix older than this. Zero
+	// keeps them, e.g. to leave expiry to a bucket lifecycle rule.
+	Retention time.Duration `yaml:"retention" json:"retention" mapstructure:"retention"`
+
+	// ServerSideEncryption requests encryption at rest, e.g. "AES256" or
+	// "aws:kms" with SSEKMSKeyID.
+	ServerSideEncryption string `yaml:"server_side_encryption" json:"server_side_encryption" mapstructure:"server_side_encryption"`
+	SSEKMSKeyID          string `yaml:"sse_kms_key_id" json:"sse_kms_key_id" mapstructure:"sse_kms_key_id"`
+
+	// Client uploads, lists and deletes objects.
+	Client ArchiveClient `yaml:"-" json:"-" mapstructure:"-"`
+}
+
+func (c ArchiveConfig) validate() error {
+	if c.SegmentSize < 0 || c.SegmentInterval < 0 || c.Retention < 0 {
+		return errors.New("segment_size, segment_interval and retention must not be negative")
+	}
+	return nil
+}
+
+// archiver rolls an export file into segments and uploads them.
+type archiver struct {
+	cfg         ArchiveConfig
+	sink        *fileSink
+	ws          zapcore.WriteSyncer
+	errs        *errorOutput
+	contentType string
+	encoding    string
+
+	done     <-chan struct{} // the logger's context is done
+	stopped  chan struct{}   // the background loop has returned
+	closed   sync.Once
+	closeErr error
+
+	mu         sync.Mutex
+	opened     time.Time
+	lastExpiry time.Time
+}
+
+// archiveSyncer is the export sink with the archiver hooked into Sync: once
+// the logger's context is done, Sync rolls and uploads the last segment and
+// returns when it is stored, so the logger's shutdown and a caller's final
+// Sync wait for it.
+type archiveSyncer struct {
+	zapcore.WriteSyncer
+	a *archiver
+}
+
+func (s archiveSyncer) Sync() error {
+	err := s.WriteSyncer.Sync()
+	select {
+	case <-s.a.done:
+		ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+		defer cancel()
+		err = errors.Join(err, s.a.Close(ctx))
+	default:
+	}
+	return err
+}
+
+// startArchiver archives the file behind sink until ctx is done and returns
+// ws, the sink as the core writes to it, with the final roll and upload hooked
+// into its Sync. ws is synced before a roll so buffered entries land in the
+// segment.
+func startArchiver(ctx context.Context, cfg Config, sink *fileSink, ws zapcore.WriteSyncer) zapcore.WriteSyncer {
+	ac := *cfg.Archive
+	if ac.SegmentSize <= 0 {
+		ac.SegmentSize = 64 << 20
+	}
+	if ac.SegmentInterval <= 0 {
+		ac.SegmentInterval = time.Hour
+	}
+	a := &archiver{
+		cfg:         ac,
+		sink:        sink,
+		ws:          ws,
+		errs:        internalErrors(ctx),
+		contentType: "application/x-ndjson",
+		done:        ctx.Done(),
+		stopped:     make(chan struct{}),
+		opened:      time.Now(),
+	}
+	if exportEncoding(cfg) == EncodingMsgpack {
+		a.contentType = "application/msgpack"
+	}
+	switch {
+	case cfg.ExportEncryption != nil:
+		a.contentType = "text/plain" // encrypted lines, see DecryptExport
+	case cfg.ExportCompression != nil:
+		a.encoding = "gzip"
+	}
+
+	go func() {
+		defer close(a.stopped)
+
+		// Segments left behind by an earlier run, e.g. after a failed upload.
+		a.uploadPending(context.Background())
+		a.expire()
+
+		ticker := time.NewTicker(min(ac.SegmentInterval, archiveCheckInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if a.due() {
+					a.roll()
+					a.uploadPending(context.Background())
+				}
+				a.expire()
+			}
+		}
+	}()
+	return archiveSyncer{WriteSyncer: ws, a: a}
+}
+
+// Close stops archiving, then rolls and uploads the current segment within
+// ctx. Only the first call does the work; later ones return its result once
+// it is done. Call it after the logger's context is done.
+func (a *archiver) Close(ctx context.Context) error {
+	a.closed.Do(func() {
+		select {
+		case <-a.stopped:
+		case <-ctx.Done():
+			a.closeErr = fmt.Errorf("archive: %w", ctx.Err())
+			return
+		}
+		a.roll()
+		a.closeErr = a.uploadPending(ctx)
+	})
+	return a.closeErr
+}
+
+// due reports whether the current segment is big or old enough to roll.
+func (a *archiver) due() bool {
+	a.mu.Lock()
+	opened := a.opened
+	a.mu.Unlock()
+
+	info, err := os.Stat(a.sink.path)
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	return info.Size() >= a.cfg.SegmentSize || time.Since(opened) >= a.cfg.SegmentInterval
+}
+
+// roll moves the current export file aside as a segment; the sink reopens
+// the export path on its next write.
+func (a *archiver) roll() {
+	if err := a.ws.Sync(); err != nil {
+		a.errs.report(fmt.Errorf("archive: sync: %w", err))
+	}
+	a.mu.Lock()
+	a.opened = time.Now()
+	a.mu.Unlock()
+
+	info, err := os.Stat(a.sink.path)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	if err := a.sink.rollTo(a.segmentPath(time.Now())); err != nil {
+		a.errs.report(fmt.Errorf("archive: roll %s: %w", a.sink.path, err))
+	}
+}
+
+// segmentPath returns a free segment name for the export path at t, with the
+// timestamp before the extensions: export.jsonl.gz becomes
+// export-20240102T150405Z.jsonl.gz.
+func (a *archiver) segmentPath(t time.Time) string {
+	stem, ext := splitExt(a.sink.path)
+	base := stem + "-" + t.UTC().Format(archiveStampLayout)
+	path := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// segments returns the rolled segments of the export path, oldest first.
+func (a *archiver) segments() []string {
+	stem, ext := splitExt(a.sink.path)
+	entries, _ := os.ReadDir(filepath.Dir(stem))
+	prefix := filepath.Base(stem) + "-"
+	var out []string
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() || !strings.HasSuffix(stamp, ext) || len(stamp) < len(archiveStampLayout) {
+			continue
+		}
+		if _, err := time.Parse(archiveStampLayout, stamp[:len(archiveStampLayout)]); err == nil {
+			out = append(out, filepath.Join(filepath.Dir(stem), e.Name()))
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// uploadPending uploads every rolled segment and deletes the uploaded ones.
+// Failed segments stay on disk and are retried on the next roll. Each upload
+// is bounded by archiveTimeout.
+func (a *archiver) uploadPending(ctx context.Context) error {
+	for _, path := range a.segments() {
+		if err := a.upload(ctx, path); err != nil {
+			err = fmt.Errorf("archive: upload %s: %w", path, err)
+			a.errs.report(err)
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			a.errs.report(fmt.Errorf("archive: %w", err))
+		}
+	}
+	return nil
+}
+
+func (a *archiver) upload(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, archiveTimeout)
+	defer cancel()
+	return a.cfg.Client.PutObject(ctx, &ArchivePutInput{
+		Bucket:               a.cfg.Bucket,
+		Key:                  a.cfg.Prefix + filepath.Base(path),
+		Body:                 f,
+		ContentLength:        info.Size(),
+		ContentType:          a.contentType,
+		ContentEncoding:      a.encoding,
+		ServerSideEncryption: a.cfg.ServerSideEncryption,
+		SSEKMSKeyID:          a.cfg.SSEKMSKeyID,
+	})
+}
+
+// expire deletes objects under Prefix older than Retention, at most hourly,
+// within archiveTimeout.
+func (a *archiver) expire() {
+	if a.cfg.Retention <= 0 {
+		return
+	}
+	a.mu.Lock()
+	if !a.lastExpiry.IsZero() && time.Since(a.lastExpiry) < time.Hour {
+		a.mu.Unlock()
+		return
+	}
+	a.lastExpiry = time.Now()
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+	objects, err := a.cfg.Client.ListObjects(ctx, a.cfg.Bucket, a.cfg.Prefix)
+	if err != nil {
+		a.errs.report(fmt.Errorf("archive: list: %w", err))
+		return
+	}
+	cutoff := time.Now().Add(-a.cfg.Retention)
+	for _, obj := range objects {
+		if !obj.LastModified.Before(cutoff) {
+			continue
+		}
+		if err := a.cfg.Client.DeleteObject(ctx, a.cfg.Bucket, obj.Key); err != nil {
+			a.errs.report(fmt.Errorf("archive: delete %s: %w", obj.Key, err))
+		}
+	}
+}
+
+// splitExt splits path before the first dot of its file name:
+// "/var/log/export.jsonl.gz" becomes "/var/log/export" and ".jsonl.gz".
+func splitExt(path string) (string, string) {
+	dir, file := filepath.Split(path)
+	if i := strings.IndexByte(file, '.'); i > 0 {
+		return dir + file[:i], file[i:]
+	}
+	return path, ""
+}
@@ -0,0 +1,308 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Ordering modes for async sinks.
+const (
+	// OrderingStrict delivers entries one at a time in the order they were logged.
+	OrderingStrict = "strict"
+
+	// OrderingRelaxed delivers entries with parallel workers for higher throughput;
+	// entries may reach the sink out of order.
+	OrderingRelaxed = "relaxed"
+)
+
+// AsyncConfig configures asynchronous delivery to a sink.
+//
+// Defaults per sink type: custom writers and CloudWatch use OrderingStrict,
+// since consumers of both usually expect entries in log order.
+type AsyncConfig struct {
+	// Ordering is OrderingStrict (default) or OrderingRelaxed.
+	Ordering string `yaml:"ordering" json:"ordering" mapstructure:"ordering"`
+
+	// Workers is the number of parallel flush workers with OrderingRelaxed. Default: 4.
+	// OrderingStrict always uses a single writer.
+	Workers int `yaml:"workers" json:"workers" mapstructure:"workers"`
+
+	// QueueSize is the number of entries buffered before Write blocks. Default: 1024.
+	QueueSize int `yaml:"queue_size" json:"queue_size" mapstructure:"queue_size"`
+
+	// NonBlocking drops entries instead of blocking when the queue is full,
+	// so a stuck sink never stalls the caller.
+	NonBlocking bool `yaml:"non_blocking" json:"non_blocking" mapstructure:"non_blocking"`
+
+	// BlockTimeout bounds how long Write blocks on a full queue before it drops
+	// the entry. Once it expires, the sink counts as stalled and Write drops
+	// without blocking until the sink writes again, so a burst only waits for
+	// a sink that keeps up. 0 blocks indefinitely. Ignored with NonBlocking.
+	BlockTimeout time.Duration `yaml:"block_timeout" json:"block_timeout" mapstructure:"block_timeout"`
+
+	// SyncTimeout bounds how long Sync waits for the queue to drain. 0 waits indefinitely.
+	SyncTimeout time.Duration `yaml:"sync_timeout" json:"sync_timeout" mapstructure:"sync_timeout"`
+}
+
+// SinkStats reports delivery through an asynchronous sink.
+type SinkStats struct {
+	// Written counts entries the sink accepted.
+	Written uint64 `json:"written"`
+
+	// Failed counts entries the sink returned an error for.
+	Failed uint64 `json:"failed"`
+
+	// Dropped counts entries discarded because the queue was full.
+	Dropped uint64 `json:"dropped"`
+
+	// Queued is the number of entries waiting for delivery.
+	Queued int `json:"queued"`
+}
+
+// errSyncTimeout is returned by Sync when the queue does not drain within SyncTimeout.
+var errSyncTimeout = errors.New("zapang: async sink sync timed out")
+
+// workers returns the effective worker count for the ordering mode.
+func (c AsyncConfig) workers() int {
+	if c.Ordering != OrderingRelaxed {
+		return 1
+	}
+	if c.Workers <= 0 {
+		return 4
+	}
+	return c.Workers
+}
+
+// AsyncWriteSyncer moves writes to a slow sink off the logging goroutine.
+// Write copies the entry into a queue and blocks only when the queue is full,
+// so entries are never dropped unless NonBlocking or BlockTimeout is set. Sync waits until
+// every entry queued before it has been written. Write errors are reported as
+// internal errors since the caller has moved on.
+type AsyncWriteSyncer struct {
+	next  zapcore.WriteSyncer
+	cfg   AsyncConfig
+	queue chan queuedWrite
+	errs  *errorOutput
+
+	written atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+	stalled atomic.Bool
+
+	// Entries are numbered as they are accepted; every entry up to done has
+	// been written or dropped, and finished holds those above done. progress is
+	// closed when done advances, once a Sync or Close waits for it.
+	mu       sync.Mutex
+	seq      uint64
+	done     uint64
+	finished map[uint64]struct{}
+	progress chan struct{}
+	closed   bool
+	workers  sync.WaitGroup
+}
+
+type queuedWrite struct {
+	p   []byte
+	seq uint64
+}
+
+// NewAsyncWriteSyncer starts the workers delivering to next. Call Close to stop them.
+func NewAsyncWriteSyncer(next zapcore.WriteSyncer, cfg AsyncConfig) *AsyncWriteSyncer {
+	return newAsyncWriteSyncer(next, cfg, nil)
+}
+
+// newAsyncWriteSyncer is NewAsyncWriteSyncer reporting write errors to errs.
+func newAsyncWriteSyncer(next zapcore.WriteSyncer, cfg AsyncConfig, errs *errorOutput) *AsyncWriteSyncer {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	a := &AsyncWriteSyncer{
+		next:     next,
+		cfg:      cfg,
+		queue:    make(chan queuedWrite, cfg.QueueSize),
+		finished: make(map[uint64]struct{}),
+		errs:     errs,
+	}
+
+	for range cfg.workers() {
+		a.workers.Add(1)
+		go a.run()
+	}
+	return a
+}
+
+func (a *AsyncWriteSyncer) run() {
+	defer a.workers.Done()
+	for w := range a.queue {
+		if _, err := a.next.Write(w.p); err != nil {
+			a.failed.Add(1)
+			a.errs.report(fmt.Errorf("async sink write: %w", err))
+		} else {
+			a.written.Add(1)
+		}
+		a.stalled.Store(false)
+		a.release(w.seq)
+	}
+}
+
+// release marks entry seq as written or dropped.
+func (a *AsyncWriteSyncer) release(seq uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if seq != a.done+1 {
+		a.finished[seq] = struct{}{}
+		return
+	}
+	a.done = seq
+	for {
+		if _, ok := a.finished[a.done+1]; !ok {
+			break
+		}
+		delete(a.finished, a.done+1)
+		a.done++
+	}
+	if a.progress != nil {
+		close(a.progress)
+		a.progress = nil
+	}
+}
+
+// wait blocks until every entry up to seq has been written or dropped, or
+// for at most timeout if it is positive.
+func (a *AsyncWriteSyncer) wait(seq uint64, timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	a.mu.Lock()
+	for a.done < seq {
+		if a.progress == nil {
+			a.progress = make(chan struct{})
+		}
+		progress := a.progress
+		a.mu.Unlock()
+		select {
+		case <-progress:
+		case <-expired:
+			return errSyncTimeout
+		}
+		a.mu.Lock()
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// Stats returns delivery counters for this sink.
+func (a *AsyncWriteSyncer) Stats() SinkStats {
+	return SinkStats{
+		Written: a.written.Load(),
+		Failed:  a.failed.Load(),
+		Dropped: a.dropped.Load(),
+		Queued:  len(a.queue),
+	}
+}
+
+func (a *AsyncWriteSyncer) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return a.next.Write(p)
+	}
+	a.seq++
+	// zap reuses the buffer after Write returns.
+	w := queuedWrite{p: slices.Clone(p), seq: a.seq}
+	a.mu.Unlock()
+
+	if !a.send(w) {
+		a.dropped.Add(1)
+		a.release(w.seq)
+	}
+	return len(p), nil
+}
+
+// send queues w, blocking as NonBlocking and BlockTimeout allow, and reports
+// whether it was queued.
+func (a *AsyncWriteSyncer) send(w queuedWrite) bool {
+	if !a.cfg.NonBlocking && a.cfg.BlockTimeout <= 0 {
+		a.queue <- w
+		return true
+	}
+	select {
+	case a.queue <- w:
+		return true
+	default:
+	}
+	if a.cfg.NonBlocking || a.stalled.Load() {
+		return false
+	}
+	timer := time.NewTimer(a.cfg.BlockTimeout)
+	defer timer.Stop()
+	select {
+	case a.queue <- w:
+		return true
+	case <-timer.C:
+		a.stalled.Store(true)
+		return false
+	}
+}
+
+// Sync waits for the entries queued before it to be written, then syncs the
+// sink. Entries queued meanwhile do not hold it up. With SyncTimeout set it
+// gives up after that long and returns an error.
+func (a *AsyncWriteSyncer) Sync() error {
+	a.mu.Lock()
+	seq := a.seq
+	a.mu.Unlock()
+	if err := a.wait(seq, a.cfg.SyncTimeout); err != nil {
+		return err
+	}
+	return a.next.Sync()
+}
+
+// Close drains the queue and stops the workers. Later writes go to the sink directly.
+func (a *AsyncWriteSyncer) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	seq := a.seq
+	a.mu.Unlock()
+
+	// Writers that passed the closed check may still be sending; drain before closing.
+	_ = a.wait(seq, 0)
+	close(a.queue)
+	a.workers.Wait()
+	return a.next.Sync()
+}
+
+// isolatedSinkConfig is used for sinks without their own AsyncConfig when
+// Config.IsolateSinks is set: a sink that keeps up blocks a burst briefly and
+// loses nothing, a stuck one drops its own entries rather than stalling the
+// caller, and cannot hang Sync at shutdown.
+var isolatedSinkConfig = AsyncConfig{BlockTimeout: 100 * time.Millisecond, SyncTimeout: 5 * time.Second}
+
+// sinkQueue optionally wraps a sink's writer in an AsyncWriteSyncer.
+// async is the sink's own configuration and may be nil.
+type sinkQueue func(ws zapcore.WriteSyncer, async *AsyncConfig) zapcore.WriteSyncer
+
+// startAsyncWriteSyncer starts an AsyncWriteSyncer that is closed once ctx is done.
+func startAsyncWriteSyncer(ctx context.Context, ws zapcore.WriteSyncer, cfg AsyncConfig) *AsyncWriteSyncer {
+	a := newAsyncWriteSyncer(ws, cfg, internalErrors(ctx))
+	go func() {
+		<-ctx.Done()
+		_ = a.Close()
+	}()
+	return a
+}
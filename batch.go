@@ -0,0 +1,127 @@
+package zapang
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultBatchSamples is the number of error messages kept for the summary.
+const defaultBatchSamples = 5
+
+// BatchLogger accumulates per-item outcomes of a batch operation and logs a
+// single summary instead of one entry per failed item. It is safe for
+// concurrent use.
+type BatchLogger struct {
+	log        *zap.Logger
+	start      time.Time
+	maxSamples int
+	itemDebug  bool
+
+	mu      sync.Mutex
+	items   int
+	failed  int
+	byType  map[string]int
+	samples []string
+}
+
+// BatchOption configures a BatchLogger.
+type BatchOption func(*BatchLogger)
+
+// WithBatchSamples keeps up to n error messages for the summary. Default: 5.
+func WithBatchSamples(n int) BatchOption {
+	return func(b *BatchLogger) {
+		b.maxSamples = n
+	}
+}
+
+// WithItemDebug also logs every item at Debug level as it is recorded.
+func WithItemDebug() BatchOption {
+	return func(b *BatchLogger) {
+		b.itemDebug = true
+	}
+}
+
+// NewBatchLogger starts a batch named name; call Finish when it is done.
+func NewBatchLogger(log *zap.Logger, name string, opts ...BatchOption) *BatchLogger {
+	b := &BatchLogger{
+		log:        log.With(zap.String("batch_name", name)),
+		start:      time.Now(),
+		maxSamples: defaultBatchSamples,
+		byType:     make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Item records the outcome of one item; a nil err counts as success.
+func (b *BatchLogger) Item(id string, err error) {
+	if b.itemDebug {
+		if err != nil {
+			b.log.Debug("batch item failed", zap.String("batch_item", id), Error(err))
+		} else {
+			b.log.Debug("batch item processed", zap.String("batch_item", id))
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items++
+	if err == nil {
+		return
+	}
+	b.failed++
+	b.byType[batchErrorType(err)]++
+	if len(b.samples) < b.maxSamples {
+		b.samples = append(b.samples, id+": "+err.Error())
+	}
+}
+
+// Finish logs the summary: item and failure counts, failures by error type,
+// sample errors and duration_ms. It logs at Warn when any item failed.
+func (b *BatchLogger) Finish() {
+	b.mu.Lock()
+	items, failed, samples := b.items, b.failed, slices.Clone(b.samples)
+	byType := maps.Clone(b.byType)
+	b.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.Int("items", items),
+		zap.Int("failed", failed),
+		DurationMs(time.Since(b.start)),
+	}
+	if failed == 0 {
+		b.log.Info("batch finished", fields...)
+		return
+	}
+	fields = append(fields,
+		zap.Object("errors_by_type", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for _, k := range slices.Sorted(maps.Keys(byType)) {
+				enc.AddInt(k, byType[k])
+			}
+			return nil
+		})),
+		zap.Strings("error_samples", samples),
+	)
+	b.log.Warn("batch finished", fields...)
+}
+
+// batchErrorType names the root cause of err: its type, or its message for
+// plain errors.New values, which are usually sentinels.
+func batchErrorType(err error) string {
+	for next := errors.Unwrap(err); next != nil; next = errors.Unwrap(next) {
+		err = next
+	}
+	if typ := fmt.Sprintf("%T", err); typ != "*errors.errorString" {
+		return typ
+	}
+	return err.Error()
+}
@@ -0,0 +1,108 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// benchFields is a typical request entry: eight fields of common types.
+func benchFields() []zap.Field {
+	return []zap.Field{
+		RequestID("0190b6c2-8f3a-7c4e-9d2b-5a1e3f6c7d8e"),
+		Method("GET"),
+		Path("/api/v1/orders"),
+		StatusCode(200),
+		LatencyMs(1234 * time.Microsecond),
+		ResponseSize(512),
+		zap.Bool("cache_hit", true),
+		zap.Duration("db_time", 830*time.Microsecond),
+	}
+}
+
+func benchEntry() zapcore.Entry {
+	return zapcore.Entry{
+		Level:      zapcore.InfoLevel,
+		Time:       time.Now(),
+		LoggerName: "api",
+		Message:    "request completed",
+		Caller:     zapcore.NewEntryCaller(0x4a1b2c, projectRoot+"/middleware.go", 214, true),
+	}
+}
+
+func benchmarkEncoder(b *testing.B, enc zapcore.Encoder) {
+	enc = enc.Clone()
+	zap.String("service", "bench").AddTo(enc)
+	ent, fields := benchEntry(), benchFields()
+	b.ReportAllocs()
+	for b.Loop() {
+		buf, err := enc.EncodeEntry(ent, fields)
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf.Free()
+	}
+}
+
+func BenchmarkConsoleEncoder(b *testing.B) {
+	benchmarkEncoder(b, newConsoleEncoder(Config{}))
+}
+
+func BenchmarkPlainEncoder(b *testing.B) {
+	benchmarkEncoder(b, newPlainEncoder(Config{}))
+}
+
+func BenchmarkJSONEncoder(b *testing.B) {
+	benchmarkEncoder(b, newEncoder(EncodingJSON, Config{}))
+}
+
+func BenchmarkConsoleEncoderError(b *testing.B) {
+	enc := newPlainEncoder(Config{})
+	ent := benchEntry()
+	fields := append(benchFields()[:7], zap.Error(errors.New("connection reset")))
+	b.ReportAllocs()
+	for b.Loop() {
+		buf, _ := enc.EncodeEntry(ent, fields)
+		buf.Free()
+	}
+}
+
+func benchmarkPipeline(b *testing.B, encoding string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log := New(ctx, "bench", Config{
+		Level:          "info",
+		ConsoleLevel:   "fatal", // keep stdout quiet
+		WriterEncoding: encoding,
+	}, discard{})
+	fields := benchFields()
+	b.ReportAllocs()
+	for b.Loop() {
+		log.Info("request completed", fields...)
+	}
+}
+
+func BenchmarkPipelineConsole(b *testing.B) {
+	benchmarkPipeline(b, EncodingPlain)
+}
+
+func BenchmarkPipelineJSON(b *testing.B) {
+	benchmarkPipeline(b, EncodingJSON)
+}
+
+func BenchmarkPipelineDisabled(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log := New(ctx, "bench", Config{Level: "info", ConsoleLevel: "fatal"}, discard{})
+	fields := benchFields()
+	b.ReportAllocs()
+	for b.Loop() {
+		log.Debug("request completed", fields...)
+	}
+}
@@ -0,0 +1,77 @@
+package zapang
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// WithMaxBodySize limits request bodies to n bytes with http.MaxBytesReader:
+// reads past the limit fail and the request is logged with body_too_large.
+func WithMaxBodySize(n int64) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.maxBodySize = n
+	}
+}
+
+// countingBody counts the bytes a handler reads from a request body and
+// records how reading ended.
+type countingBody struct {
+	io.ReadCloser
+	n   int64
+	eof bool
+	err error // first read error other than io.EOF
+}
+
+// wrapBody replaces r's body with a countingBody, limited to maxSize bytes if
+// positive. Requests without a body are left alone.
+func wrapBody(w http.ResponseWriter, r *http.Request, maxSize int64) *countingBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := r.Body
+	if maxSize > 0 {
+		body = http.MaxBytesReader(w, body, maxSize)
+	}
+	b := &countingBody{ReadCloser: body}
+	r.Body = b
+	return b
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	switch {
+	case err == io.EOF:
+		b.eof = true
+	case err != nil && b.err == nil:
+		b.err = err
+	}
+	return n, err
+}
+
+// addFields adds request_body_bytes and any body problems to buf:
+// body_too_large past WithMaxBodySize, body_truncated when the body ended
+// before Content-Length (a client or proxy cut it off), and
+// content_length_mismatch when it ended at a different length. It reports
+// whether there was a problem.
+func (b *countingBody) addFields(buf *FieldBuffer, contentLength int64) bool {
+	buf.Add(zap.Int64("request_body_bytes", b.n))
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(b.err, &tooLarge):
+		buf.Add(zap.Bool("body_too_large", true))
+	case errors.Is(b.err, io.ErrUnexpectedEOF):
+		buf.Add(zap.Bool("body_truncated", true), zap.NamedError("body_error", b.err))
+	case b.err != nil:
+		buf.Add(zap.NamedError("body_error", b.err))
+	case b.eof && contentLength >= 0 && b.n != contentLength:
+		buf.Add(zap.Bool("content_length_mismatch", true))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package zapang
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrorBudgetConfig configures per-component error budgets.
+type ErrorBudgetConfig struct {
+	// Targets maps a component name to the number of Error+ entries allowed per Window.
+	Targets map[string]uint64 `yaml:"targets" json:"targets" mapstructure:"targets"`
+
+	// Window is the budget period. Default: 1h.
+	Window time.Duration `yaml:"window" json:"window" mapstructure:"window"`
+
+	// ReportInterval is how often budget consumption is logged. Default: 1m.
+	ReportInterval time.Duration `yaml:"report_interval" json:"report_interval" mapstructure:"report_interval"`
+}
+
+// componentErrorCount returns the Error+ entries counted for a component since start.
+func componentErrorCount(component string) uint64 {
+	if v, ok := componentErrors.Load(component); ok {
+		return v.(*atomic.Uint64).Load()
+	}
+	return 0
+}
+
+// runErrorBudgets logs budget consumption per component every ReportInterval
+// until ctx is done. Entries are Info below 100% and Warn once the budget is spent.
+func runErrorBudgets(ctx context.Context, log *zap.Logger, cfg ErrorBudgetConfig) {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Hour
+	}
+	if cfg.ReportInterval <= 0 {
+		cfg.ReportInterval = time.Minute
+	}
+
+	log = log.WithOptions(zap.WithCaller(false))
+	baseline := make(map[string]uint64, len(cfg.Targets))
+	resetBaseline := func() {
+		for component := range cfg.Targets {
+			baseline[component] = componentErrorCount(component)
+		}
+	}
+	resetBaseline()
+	windowStart := time.Now()
+
+	ticker := time.NewTicker(cfg.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for component, target := range cfg.Targets {
+			if target == 0 {
+				continue
+			}
+			used := componentErrorCount(component) - baseline[component]
+			pct := float64(used) * 100 / float64(target)
+
+			logf := log.Info
+			if used >= target {
+				logf = log.Warn
+			}
+			logf("error budget",
+				Component(component),
+				zap.Uint64("budget_errors", used),
+				zap.Uint64("budget_target", target),
+				zap.String("budget_used", formatPercent(pct)),
+				zap.Duration("budget_window", cfg.Window),
+			)
+		}
+
+		if time.Since(windowStart) >= cfg.Window {
+			resetBaseline()
+			windowStart = time.Now()
+		}
+	}
+}
+
+func formatPercent(pct float64) string {
+	return strconv.FormatFloat(pct, 'f', 0, 64) + "%"
+}
@@ -0,0 +1,64 @@
+package zapang
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// BytesOption adds a preview to a Bytes field.
+type BytesOption func(*bytesField)
+
+// HexPreview adds the first n bytes of the value, hex-encoded, as "hex".
+func HexPreview(n int) BytesOption {
+	return func(f *bytesField) { f.preview, f.encoding = n, "hex" }
+}
+
+// Base64Preview adds the first n bytes of the value, standard base64-encoded,
+// as "base64".
+func Base64Preview(n int) BytesOption {
+	return func(f *bytesField) { f.preview, f.encoding = n, "base64" }
+}
+
+// bytesField describes binary data without dumping it.
+type bytesField struct {
+	b        []byte
+	preview  int
+	encoding string
+}
+
+// Bytes logs binary data such as a protobuf message as a nested object with
+// its length ("len") and a SHA-256 prefix ("sha256", 16 hex digits) instead
+// of the raw bytes, so blobs neither garble the console nor bloat entries:
+//
+//	log.Debug("publish", zapang.Bytes("payload", msg, zapang.HexPreview(16)))
+//
+// With HexPreview or Base64Preview, the first n bytes are added too. The
+// value is read when the entry is encoded; do not modify it until then.
+func Bytes(key string, b []byte, opts ...BytesOption) zap.Field {
+	f := &bytesField{b: b}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return zap.Object(key, f)
+}
+
+func (f *bytesField) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("len", len(f.b))
+	sum := sha256.Sum256(f.b)
+	enc.AddString("sha256", hex.EncodeToString(sum[:8]))
+	if f.preview <= 0 {
+		return nil
+	}
+	head := f.b[:min(f.preview, len(f.b))]
+	switch f.encoding {
+	case "hex":
+		enc.AddString("hex", hex.EncodeToString(head))
+	case "base64":
+		enc.AddString("base64", base64.StdEncoding.EncodeToString(head))
+	}
+	return nil
+}
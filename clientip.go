@@ -0,0 +1,174 @@
+package zapang
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// AnonymizeIP truncates an address so it no longer identifies a host: the last
+// octet of an IPv4 address and the last 80 bits of an IPv6 address are zeroed
+// (192.0.2.17 becomes 192.0.2.0, 2001:db8:1:2::5 becomes 2001:db8:1::). Values
+// that are not IP addresses are returned unchanged.
+func AnonymizeIP(addr string) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return addr
+	}
+	ip = ip.Unmap().WithZone("")
+	bits := 48
+	if ip.Is4() {
+		bits = 24
+	}
+	return netip.PrefixFrom(ip, bits).Masked().Addr().String()
+}
+
+// clientIPCore truncates client_ip values, in context added with With and in
+// entry fields, with AnonymizeIP before its sink sees them.
+type clientIPCore struct {
+	zapcore.Core
+}
+
+// applyAnonymizeClientIP wraps each core with client_ip truncation.
+func applyAnonymizeClientIP(cores []zapcore.Core) []zapcore.Core {
+	for i, c := range cores {
+		cores[i] = &clientIPCore{Core: c}
+	}
+	return cores
+}
+
+func (c *clientIPCore) With(fields []zapcore.Field) zapcore.Core {
+	return &clientIPCore{Core: c.Core.With(anonymizeClientIPs(fields))}
+}
+
+func (c *clientIPCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *clientIPCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return writeChecked(c.Core, ent, anonymizeClientIPs(fields))
+}
+
+// anonymizeClientIPs returns fields with client_ip strings truncated, copying
+// them only if one is.
+func anonymizeClientIPs(fields []zapcore.Field) []zapcore.Field {
+	i := slices.IndexFunc(fields, isClientIP)
+	if i < 0 {
+		return fields
+	}
+	out := slices.Clone(fields)
+	for j := i; j < len(out); j++ {
+		if isClientIP(out[j]) {
+			out[j].String = AnonymizeIP(out[j].String)
+		}
+	}
+	return out
+}
+
+func isClientIP(f zapcore.Field) bool {
+	return f.Key == "client_ip" && f.Type == zapcore.StringType
+}
+
+// WithTrustedProxies sets the proxies whose forwarding headers are believed.
+// Forwarded (RFC 7239), X-Forwarded-For and X-Real-IP are only read when the
+// direct peer is in one of the prefixes, and the forwarding chain is walked
+// right to left past trusted hops, so clients cannot spoof client_ip by
+// sending the headers themselves. Without trusted proxies the peer address is
+// logged.
+func WithTrustedProxies(prefixes ...netip.Prefix) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.trustedProxies = append(c.trustedProxies, prefixes...)
+	}
+}
+
+// clientIP returns the address of the client that sent r: the peer unless it
+// is a trusted proxy, otherwise the rightmost untrusted hop of the forwarding
+// chain (or the leftmost one when every hop is trusted).
+func (c *middlewareConfig) clientIP(r *http.Request) string {
+	ip := c.clientAddr(r)
+	if c.anonymizeIP {
+		return AnonymizeIP(ip)
+	}
+	return ip
+}
+
+// clientAddr returns the untruncated client address for clientIP.
+func (c *middlewareConfig) clientAddr(r *http.Request) string {
+	peer := hostOnly(r.RemoteAddr)
+	if !c.trusted(peer) {
+		return peer
+	}
+
+	chain := forwardedFor(r.Header.Values("Forwarded"))
+	if chain == nil {
+		for _, xff := range r.Header.Values("X-Forwarded-For") {
+			for hop := range strings.SplitSeq(xff, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					chain = append(chain, hop)
+				}
+			}
+		}
+	}
+	if chain == nil {
+		if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+			return xri
+		}
+		return peer
+	}
+
+	for i := len(chain) - 1; i > 0; i-- {
+		if !c.trusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+// trusted reports whether addr is inside a trusted proxy prefix.
+func (c *middlewareConfig) trusted(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range c.trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor extracts the for= nodes of RFC 7239 Forwarded headers in order,
+// without quotes, brackets and ports. Obfuscated identifiers ("unknown",
+// "_hidden") are kept as-is and are never trusted.
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, v := range values {
+		for elem := range strings.SplitSeq(v, ",") {
+			for pair := range strings.SplitSeq(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				chain = append(chain, forwardedNode(strings.Trim(value, `"`)))
+			}
+		}
+	}
+	return chain
+}
+
+// forwardedNode strips the port and IPv6 brackets from a Forwarded node.
+func forwardedNode(node string) string {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+}
@@ -0,0 +1,90 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFixedClockGoldenOutput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	l, _ := NewWithLevel(ctx, "svc", Config{
+		Level:          "info",
+		DisableCaller:  true,
+		WriterEncoding: EncodingJSON,
+		Clock:          FixedClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)),
+	}, &buf)
+	l.Info("order placed", UserID("u1"))
+
+	want := `{"level":"info","timestamp":"2024-03-01T12:00:00Z","message":"order placed","service":"svc","user_id":"u1"}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("got  %s\nwant %s", buf.String(), want)
+	}
+}
+
+func TestVirtualClockDrivesSampling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	clock := NewVirtualClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	l, _ := NewWithLevel(ctx, "svc", Config{
+		Level:          "info",
+		WriterEncoding: EncodingJSON,
+		Sampling:       &SamplingConfig{Initial: 1, Thereafter: 0},
+		Clock:          clock,
+	}, &buf)
+
+	l.Info("tick")
+	l.Info("tick") // same second: sampled out
+	clock.Advance(time.Second)
+	l.Info("tick") // new second: logged again
+
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 2 {
+		t.Fatalf("expected 2 entries, got %d:\n%s", n, buf.String())
+	}
+}
+
+func TestVirtualClockAndAsOf(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+	l, _ := NewWithLevel(ctx, "svc", Config{
+		Level:          "info",
+		DisableCaller:  true,
+		WriterEncoding: EncodingJSON,
+		Clock:          clock,
+	}, &buf)
+
+	l.Info("open")
+	clock.Advance(90 * time.Minute)
+	l.Info("fill")
+	clock.Set(start.AddDate(0, 0, 1))
+	l.Info("close")
+	AsOf(l, time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC)).Info("restated")
+	l.Info("after")
+
+	var stamps []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry struct {
+			Timestamp string `json:"timestamp"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		stamps = append(stamps, entry.Timestamp)
+	}
+	want := []string{"2024-03-01T12:00:00Z", "2024-03-01T13:30:00Z", "2024-03-02T12:00:00Z", "2023-12-31T23:59:59Z", "2024-03-02T12:00:00Z"}
+	if !slices.Equal(stamps, want) {
+		t.Fatalf("got  %v\nwant %v", stamps, want)
+	}
+}
@@ -0,0 +1,365 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// CloudWatch Logs PutLogEvents API limits.
+const (
+	cloudWatchMaxBatchEvents = 10000
+	cloudWatchMaxBatchBytes  = 1048576
+	cloudWatchEventOverhead  = 26
+	cloudWatchMaxEventBytes  = 256*1024 - cloudWatchEventOverhead
+)
+
+// CloudWatchClient is the subset of the CloudWatch Logs API used by the exporter.
+// Adapt your AWS SDK client to this interface; when the service rejects a call
+// with InvalidSequenceTokenException, return a *CloudWatchSequenceTokenError.
+type CloudWatchClient interface {
+	PutLogEvents(ctx context.Context, in *CloudWatchPutInput) (*CloudWatchPutOutput, error)
+}
+
+// CloudWatchEvent is a single log event sent to CloudWatch Logs.
+type CloudWatchEvent struct {
+	// Timestamp in milliseconds since the Unix epoch.
+	Timestamp int64
+	Message   string
+}
+
+// CloudWatchPutInput mirrors the PutLogEvents request.
+type CloudWatchPutInput struct {
+	LogGroup      string
+	LogStream     string
+	Events        []CloudWatchEvent
+	SequenceToken *string
+}
+
+// CloudWatchPutOutput mirrors the PutLogEvents response.
+type CloudWatchPutOutput struct {
+	NextSequenceToken *string
+}
+
+// CloudWatchSequenceTokenError reports that the sequence token was rejected.
+// The exporter retries the batch with ExpectedToken.
+type CloudWatchSequenceTokenError struct {
+	ExpectedToken *string
+}
+
+func (e *CloudWatchSequenceTokenError) Error() string {
+	return "cloudwatch: invalid sequence token"
+}
+
+// CloudWatchConfig configures the CloudWatch Logs exporter.
+type CloudWatchConfig struct {
+	// LogGroup is the destination log group name.
+	LogGroup string `yaml:"log_group" json:"log_group" mapstructure:"log_group"`
+
+	// LogStream is the destination log stream name.
+	LogStream string `yaml:"log_stream" json:"log_stream" mapstructure:"log_stream"`
+
+	// FlushInterval is how often buffered events are sent. Default: 5s.
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval" mapstructure:"flush_interval"`
+
+	// MaxRetries is the number of retries for a failed batch. Default: 3.
+	MaxRetries int `yaml:"max_retries" json:"max_retries" mapstructure:"max_retries"`
+
+	// Timeout bounds each PutLogEvents call. Default: 30s.
+	Timeout time.Duration `yaml:"timeout" json:"timeout" mapstructure:"timeout"`
+
+	// Ordering is OrderingStrict (default): batches are sent one at a time with
+	// sequence tokens. OrderingRelaxed sends up to Workers batches concurrently
+	// without sequence tokens, which CloudWatch Logs no longer requires; batches
+	// may then arrive out of order.
+	Ordering string `yaml:"ordering" json:"ordering" mapstructure:"ordering"`
+
+	// Workers is the number of concurrent PutLogEvents calls with OrderingRelaxed. Default: 4.
+	Workers int `yaml:"workers" json:"workers" mapstructure:"workers"`
+
+	// Client sends batches to CloudWatch Logs.
+	Client CloudWatchClient `yaml:"-" json:"-" mapstructure:"-"`
+}
+
+func (c CloudWatchConfig) validate() error {
+	if c.LogGroup == "" || c.LogStream == "" {
+		return errors.New("log_group and log_stream are required")
+	}
+	if c.FlushInterval < 0 || c.MaxRetries < 0 || c.Timeout < 0 || c.Workers < 0 {
+		return errors.New("flush_interval, max_retries, timeout and workers must not be negative")
+	}
+	return nil
+}
+
+// cloudWatchTimeout is the default CloudWatchConfig.Timeout.
+const cloudWatchTimeout = 30 * time.Second
+
+// cloudWatchMaxPendingBatches caps the full batches waiting to be sent while
+// CloudWatch Logs is slow or unavailable; beyond it the oldest is dropped.
+const cloudWatchMaxPendingBatches = 8
+
+// cloudWatchWriter batches encoded entries and ships them with PutLogEvents
+// from a background goroutine, so logging never waits for the service.
+type cloudWatchWriter struct {
+	cfg  CloudWatchConfig
+	errs *errorOutput
+	done <-chan struct{} // the logger's context is done: no more retries
+
+	mu      sync.Mutex
+	events  []CloudWatchEvent
+	size    int
+	pending [][]CloudWatchEvent // full batches waiting to be sent
+	kick    chan struct{}       // a batch is full
+
+	// flushMu orders flushes, so batches are sent in the order they filled.
+	flushMu sync.Mutex
+	token   *string
+
+	// sendSlots bounds concurrent PutLogEvents calls: one with strict
+	// ordering, so sequence tokens stay ordered, Workers with relaxed.
+	sendSlots chan struct{}
+}
+
+// newCloudWatchWriter starts sending batches every FlushInterval and as they
+// fill, until ctx is done; buffered events are then sent a last time.
+func newCloudWatchWriter(ctx context.Context, cfg CloudWatchConfig) *cloudWatchWriter {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cloudWatchTimeout
+	}
+
+	workers := AsyncConfig{Ordering: cfg.Ordering, Workers: cfg.Workers}.workers()
+	w := &cloudWatchWriter{
+		cfg:       cfg,
+		errs:      internalErrors(ctx),
+		done:      ctx.Done(),
+		kick:      make(chan struct{}, 1),
+		sendSlots: make(chan struct{}, workers),
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				w.flushAndReport()
+				return
+			case <-ticker.C:
+				w.flushAndReport()
+			case <-w.kick:
+				w.flushAndReport()
+			}
+		}
+	}()
+
+	return w
+}
+
+// add buffers an entry with the time it was logged. It never blocks on
+// CloudWatch Logs: a full batch is handed to the background sender.
+func (w *cloudWatchWriter) add(t time.Time, p []byte) {
+	msg := truncateUTF8(string(trimNewline(p)), cloudWatchMaxEventBytes)
+	ev := CloudWatchEvent{Timestamp: t.UnixMilli(), Message: msg}
+	evSize := len(msg) + cloudWatchEventOverhead
+
+	dropped := 0
+	w.mu.Lock()
+	if len(w.events)+1 > cloudWatchMaxBatchEvents || w.size+evSize > cloudWatchMaxBatchBytes {
+		w.pending = append(w.pending, w.takeLocked())
+		if len(w.pending) > cloudWatchMaxPendingBatches {
+			dropped = len(w.pending[0])
+			w.pending = w.pending[1:]
+		}
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+	w.events = append(w.events, ev)
+	w.size += evSize
+	w.mu.Unlock()
+
+	if dropped > 0 {
+		w.errs.report(fmt.Errorf("cloudwatch: %d batches pending, dropped %d oldest events", cloudWatchMaxPendingBatches, dropped))
+	}
+}
+
+// Sync sends all buffered events and returns once they are delivered.
+func (w *cloudWatchWriter) Sync() error {
+	return w.flush()
+}
+
+func (w *cloudWatchWriter) flushAndReport() {
+	if err := w.flush(); err != nil {
+		w.errs.report(fmt.Errorf("cloudwatch: %w", err))
+	}
+}
+
+// flush sends the pending batches and the buffered events: one after another
+// with strict ordering, concurrently with relaxed.
+func (w *cloudWatchWriter) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batches := w.pending
+	w.pending = nil
+	if len(w.events) > 0 {
+		batches = append(batches, w.takeLocked())
+	}
+	w.mu.Unlock()
+
+	errs := make([]error, len(batches))
+	if w.cfg.Ordering != OrderingRelaxed {
+		for i, batch := range batches {
+			errs[i] = w.send(batch)
+		}
+		return errors.Join(errs...)
+	}
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Go(func() { errs[i] = w.send(batch) })
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (w *cloudWatchWriter) takeLocked() []CloudWatchEvent {
+	batch := w.events
+	w.events = nil
+	w.size = 0
+	return batch
+}
+
+// send delivers a batch, following sequence token hints and retrying with
+// exponential backoff. Each call is bounded by Timeout; once the logger's
+// context is done, as for the final flush, the batch is tried only once.
+func (w *cloudWatchWriter) send(batch []CloudWatchEvent) error {
+	// PutLogEvents requires events in chronological order.
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].Timestamp < batch[j].Timestamp })
+
+	w.sendSlots <- struct{}{}
+	defer func() { <-w.sendSlots }()
+	strict := w.cfg.Ordering != OrderingRelaxed
+
+	backoff := 100 * time.Millisecond
+	var err error
+	for attempt := 0; attempt <= w.cfg.MaxRetries; attempt++ {
+		in := &CloudWatchPutInput{
+			LogGroup:  w.cfg.LogGroup,
+			LogStream: w.cfg.LogStream,
+			Events:    batch,
+		}
+		if strict {
+			in.SequenceToken = w.token
+		}
+		var out *CloudWatchPutOutput
+		out, err = w.put(in)
+		if err == nil {
+			if out != nil && strict {
+				w.token = out.NextSequenceToken
+			}
+			return nil
+		}
+
+		select {
+		case <-w.done:
+			return err
+		default:
+		}
+		var tokenErr *CloudWatchSequenceTokenError
+		if strict && errors.As(err, &tokenErr) {
+			w.token = tokenErr.ExpectedToken
+			continue
+		}
+
+		if attempt < w.cfg.MaxRetries {
+			select {
+			case <-time.After(backoff):
+			case <-w.done:
+				return err
+			}
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+func (w *cloudWatchWriter) put(in *CloudWatchPutInput) (*CloudWatchPutOutput, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+	defer cancel()
+	return w.cfg.Client.PutLogEvents(ctx, in)
+}
+
+func trimNewline(p []byte) []byte {
+	if n := len(p); n > 0 && p[n-1] == '\n' {
+		return p[:n-1]
+	}
+	return p
+}
+
+// cloudWatchCore encodes entries as JSON and hands them to a cloudWatchWriter
+// with the entry's own time, which CloudWatch Logs indexes them by.
+type cloudWatchCore struct {
+	enc zapcore.Encoder
+	w   *cloudWatchWriter
+}
+
+func (c *cloudWatchCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *cloudWatchCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &cloudWatchCore{enc: c.enc.Clone(), w: c.w}
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *cloudWatchCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *cloudWatchCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	c.w.add(ent.Time, buf.Bytes())
+	buf.Free()
+	if ent.Level > zapcore.ErrorLevel {
+		// The process may exit after a panic or fatal entry.
+		return c.w.Sync()
+	}
+	return nil
+}
+
+func (c *cloudWatchCore) Sync() error {
+	return c.w.Sync()
+}
+
+// buildCloudWatchCore creates a JSON core that ships entries to CloudWatch Logs.
+// The writer queues batches itself, so the core is never put behind an
+// AsyncWriteSyncer. An exporter without a client, log group or stream is an
+// error rather than a sink that drops everything.
+func buildCloudWatchCore(ctx context.Context, cfg Config) (zapcore.Core, error) {
+	if cfg.CloudWatch.Client == nil {
+		return nil, errors.New("zapang: cloudwatch: no client")
+	}
+	if err := cfg.CloudWatch.validate(); err != nil {
+		return nil, fmt.Errorf("zapang: cloudwatch: %w", err)
+	}
+	return &cloudWatchCore{enc: newEncoder(EncodingJSON, cfg), w: newCloudWatchWriter(ctx, *cfg.CloudWatch)}, nil
+}
@@ -0,0 +1,238 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type fakeCloudWatch struct {
+	mu       sync.Mutex
+	batches  [][]CloudWatchEvent
+	tokens   []*string
+	rejectAt int
+
+	// block, if set, holds every call until it is closed.
+	block chan struct{}
+
+	// hang makes every call wait for its context and fail.
+	hang  bool
+	calls int
+}
+
+func (f *fakeCloudWatch) PutLogEvents(ctx context.Context, in *CloudWatchPutInput) (*CloudWatchPutOutput, error) {
+	if f.block != nil {
+		<-f.block
+	}
+	if f.hang {
+		<-ctx.Done()
+		f.mu.Lock()
+		f.calls++
+		f.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tokens = append(f.tokens, in.SequenceToken)
+	if f.rejectAt > 0 && len(f.tokens) == f.rejectAt {
+		expected := "expected"
+		return nil, &CloudWatchSequenceTokenError{ExpectedToken: &expected}
+	}
+
+	f.batches = append(f.batches, in.Events)
+	next := "next"
+	return &CloudWatchPutOutput{NextSequenceToken: &next}, nil
+}
+
+func TestCloudWatchBatching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeCloudWatch{}
+	w := newCloudWatchWriter(ctx, CloudWatchConfig{LogGroup: "g", LogStream: "s", Client: client})
+
+	big := strings.Repeat("x", 200*1024)
+	for range 6 {
+		w.add(time.Now(), []byte(big+"\n"))
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(client.batches))
+	}
+	if client.tokens[1] == nil || *client.tokens[1] != "next" {
+		t.Fatalf("sequence token not propagated: %v", client.tokens[1])
+	}
+}
+
+func TestCloudWatchSequenceTokenRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeCloudWatch{rejectAt: 1}
+	w := newCloudWatchWriter(ctx, CloudWatchConfig{Client: client})
+
+	w.add(time.Now(), []byte("entry\n"))
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.batches) != 1 {
+		t.Fatalf("expected 1 delivered batch, got %d", len(client.batches))
+	}
+	if client.tokens[1] == nil || *client.tokens[1] != "expected" {
+		t.Fatalf("expected retry with server token, got %v", client.tokens[1])
+	}
+}
+
+func (f *fakeCloudWatch) events() []CloudWatchEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []CloudWatchEvent
+	for _, b := range f.batches {
+		out = append(out, b...)
+	}
+	return out
+}
+
+func TestCloudWatchTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A hung client is cut off after Timeout and retried.
+	client := &fakeCloudWatch{hang: true}
+	w := newCloudWatchWriter(ctx, CloudWatchConfig{LogGroup: "g", LogStream: "s", Client: client,
+		Timeout: 20 * time.Millisecond, MaxRetries: 1, FlushInterval: time.Hour})
+	w.add(time.Now(), []byte("entry\n"))
+	if err := w.Sync(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if client.calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", client.calls)
+	}
+
+	// Once the logger's context is done, the final flush tries a batch only once.
+	newCloudWatchWriter(ctx, CloudWatchConfig{LogGroup: "g", LogStream: "s", Client: client,
+		Timeout: 20 * time.Millisecond, MaxRetries: 5, FlushInterval: time.Hour}).add(time.Now(), []byte("entry\n"))
+	cancel()
+	callsNow := func() int {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.calls
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for callsNow() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("final flush did not send")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond) // past the first backoff and timeout
+	if n := callsNow(); n != 3 {
+		t.Fatalf("retried after the context was done: %d calls", n-2)
+	}
+}
+
+func TestCloudWatchCore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeCloudWatch{}
+	core, err := buildCloudWatchCore(ctx, Config{CloudWatch: &CloudWatchConfig{LogGroup: "g", LogStream: "s", Client: client}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events carry the entry's time, not the time they were buffered.
+	logged := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := core.Write(zapcore.Entry{Time: logged, Message: "late"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Oversized messages are cut on a character boundary.
+	if err := core.Write(zapcore.Entry{Time: logged, Message: strings.Repeat("é", cloudWatchMaxEventBytes)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := client.events()
+	if len(events) != 2 || events[0].Timestamp != logged.UnixMilli() || !strings.Contains(events[0].Message, `"message":"late"`) {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	if msg := events[1].Message; len(msg) > cloudWatchMaxEventBytes || !utf8.ValidString(msg) {
+		t.Fatalf("expected a valid message of at most %d bytes, got %d bytes", cloudWatchMaxEventBytes, len(msg))
+	}
+}
+
+func TestCloudWatchConfigErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, c := range []struct {
+		cfg  CloudWatchConfig
+		want string
+	}{
+		{CloudWatchConfig{LogGroup: "g", LogStream: "s"}, "no client"},
+		{CloudWatchConfig{LogStream: "s", Client: &fakeCloudWatch{}}, "log_group and log_stream are required"},
+		{CloudWatchConfig{LogGroup: "g", Client: &fakeCloudWatch{}}, "log_group and log_stream are required"},
+		{CloudWatchConfig{LogGroup: "g", LogStream: "s", Timeout: -1, Client: &fakeCloudWatch{}}, "must not be negative"},
+	} {
+		l, err := NewE(ctx, "serviceName", Config{Level: "info", CloudWatch: &c.cfg}, io.Discard)
+		if l != nil || err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%+v: expected %q, got logger=%v err=%v", c.cfg, c.want, l, err)
+		}
+	}
+
+	// Validate checks what a config source can set; the client is set in code.
+	if err := (Config{CloudWatch: &CloudWatchConfig{LogGroup: "g"}}).Validate(); err == nil {
+		t.Fatal("expected an error for a missing log stream")
+	}
+	if err := (Config{CloudWatch: &CloudWatchConfig{LogGroup: "g", LogStream: "s"}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloudWatchBackground(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &fakeCloudWatch{block: make(chan struct{})}
+	w := newCloudWatchWriter(ctx, CloudWatchConfig{FlushInterval: time.Hour, Client: client})
+
+	// Filling batches does not wait for the blocked service.
+	big := strings.Repeat("x", 200*1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 12 {
+			w.add(time.Now(), []byte(big+"\n"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("add blocked on PutLogEvents")
+	}
+	close(client.block)
+
+	// Buffered events are sent when the context is done, without a Sync.
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(client.events()) != 12 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 12 events after shutdown, got %d", len(client.events()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
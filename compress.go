@@ -0,0 +1,152 @@
+package zapang
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// CompressionGzip is the CompressionConfig.Algorithm for gzip.
+const CompressionGzip = "gzip"
+
+// compressionMaxPending is the compressed size at which a member is written
+// out before its flush interval ends.
+const compressionMaxPending = 1 << 20
+
+// CompressionConfig configures streaming compression of the JSON export.
+type CompressionConfig struct {
+	// Algorithm is the compression format: gzip (default). zstd is not
+	// available in this build.
+	Algorithm string `yaml:"algorithm" json:"algorithm" mapstructure:"algorithm"`
+
+	// Level is the gzip level from 1 (fastest) to 9 (smallest). Default:
+	// gzip.DefaultCompression.
+	Level int `yaml:"level" json:"level" mapstructure:"level"`
+
+	// FlushInterval is how often buffered entries are written out as a
+	// complete gzip member. Default: 1s.
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval" mapstructure:"flush_interval"`
+}
+
+func (c CompressionConfig) validate() error {
+	switch c.Algorithm {
+	case "", CompressionGzip:
+	case "zstd":
+		return fmt.Errorf("compression algorithm zstd is not supported, use gzip")
+	default:
+		return fmt.Errorf("unknown compression algorithm %q", c.Algorithm)
+	}
+	if c.Level != 0 && (c.Level < gzip.BestSpeed || c.Level > gzip.BestCompression) {
+		return fmt.Errorf("gzip level %d out of range [1, 9]", c.Level)
+	}
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("compression flush interval must not be negative")
+	}
+	return nil
+}
+
+// CompressingWriteSyncer gzips entries before passing them on. Entries are
+// compressed into memory and written to the next WriteSyncer as one complete
+// gzip member per flush, so the output is always a valid multi-member gzip
+// stream: a crash loses at most one flush interval, and files reopened by
+// ReopenFiles start with a fresh member. Read it back with gzip.NewReader or
+// zcat.
+type CompressingWriteSyncer struct {
+	next zapcore.WriteSyncer
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	zw      *gzip.Writer
+	pending bool
+}
+
+// NewCompressingWriteSyncer returns a WriteSyncer that gzips entries and
+// writes them to next every cfg.FlushInterval, on Sync, and when ctx is done.
+func NewCompressingWriteSyncer(ctx context.Context, next zapcore.WriteSyncer, cfg CompressionConfig) (*CompressingWriteSyncer, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("zapang: %w", err)
+	}
+	if cfg.Level == 0 {
+		cfg.Level = gzip.DefaultCompression
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	c := &CompressingWriteSyncer{next: next}
+	zw, err := gzip.NewWriterLevel(&c.buf, cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	c.zw = zw
+
+	errs := internalErrors(ctx)
+	go func() {
+		ticker := time.NewTicker(cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = c.Sync()
+				return
+			case <-ticker.C:
+				c.mu.Lock()
+				if err := c.flushLocked(); err != nil {
+					errs.report(fmt.Errorf("compressed export: %w", err))
+				}
+				c.mu.Unlock()
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+func (c *CompressingWriteSyncer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.zw.Write(p); err != nil {
+		return 0, err
+	}
+	c.pending = true
+	if c.buf.Len() >= compressionMaxPending {
+		if err := c.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Sync writes buffered entries out as a gzip member and syncs the next
+// WriteSyncer.
+func (c *CompressingWriteSyncer) Sync() error {
+	c.mu.Lock()
+	err := c.flushLocked()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.next.Sync()
+}
+
+// flushLocked closes the current gzip member, writes it to next and starts a
+// new one. Entries of a failed write are dropped, so later members stay valid.
+func (c *CompressingWriteSyncer) flushLocked() error {
+	if !c.pending {
+		return nil
+	}
+	err := c.zw.Close()
+	if err == nil {
+		_, err = c.next.Write(c.buf.Bytes())
+	}
+	c.buf.Reset()
+	c.zw.Reset(&c.buf)
+	c.pending = false
+	return err
+}
@@ -1,6 +1,11 @@
 package zapang
 
-import "io"
+import (
+	"io"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
 
 // Config holds configuration for the application logger.
 type Config struct {
@@ -8,34 +13,280 @@ type Config struct {
 	// Valid values: debug, info, warn, error, dpanic, panic, fatal
 	Level string `yaml:"level" json:"level" mapstructure:"level"`
 
+	// ConsoleLevel and ExportLevel give stdout and the JSON exporters (ExportPath,
+	// ExportWriter, CloudWatch, Fluent) their own minimum level, e.g. a quiet
+	// terminal at info with full debug detail in the export. If empty, the
+	// logger's dynamic Level applies. Fixed levels do not follow SetLevel.
+	ConsoleLevel string `yaml:"console_level" json:"console_level" mapstructure:"console_level"`
+	ExportLevel  string `yaml:"export_level" json:"export_level" mapstructure:"export_level"`
+
+	// NamedLevels sets the levels of the loggers returned by Get, by name, as
+	// SetNamedLevel does, e.g. {"billing": "debug"}. New applies them to the
+	// global logger, and WatchConfig reapplies them on change.
+	NamedLevels map[string]string `yaml:"named_levels,omitempty" json:"named_levels" mapstructure:"named_levels"`
+
 	// Environment controls logger behavior.
 	// "local" - only human-readable console output
 	// "dev", "prod" - human-readable console + optional JSON export
+	// Other names use presets added with RegisterEnvironment.
 	Environment string `yaml:"environment" json:"environment" mapstructure:"environment"`
 
-	// ExportPath is an optional path for JSON log export (only for dev/prod).
-	// Can be a file path or "stdout"/"stderr".
+	// ExportPath is an optional path for JSON log export (only for environments
+	// that export: dev, prod or a registered preset with Export set).
+	// Can be a file path, "stdout"/"stderr", or a collector socket:
+	// "tcp://host:port", "tcps://host:port" (TLS) or "udp://host:port".
 	// If empty, JSON export is disabled.
 	ExportPath string `yaml:"export_path" json:"export_path" mapstructure:"export_path"`
 
+	// ExportFallback is used when ExportPath cannot be opened or keeps failing
+	// (full disk, bad permissions): "stderr", "stdout" or a spool file path.
+	// The export path is probed periodically and used again once it recovers.
+	ExportFallback string `yaml:"export_fallback" json:"export_fallback" mapstructure:"export_fallback"`
+
+	// ReopenOnSIGHUP reopens file export sinks (ExportPath, ExportFallback) on
+	// SIGHUP, for logrotate's move-and-signal workflow. Without it, a rotated file
+	// keeps receiving writes through the old handle. See also ReopenFiles.
+	ReopenOnSIGHUP bool `yaml:"reopen_on_sighup" json:"reopen_on_sighup" mapstructure:"reopen_on_sighup"`
+
 	// ExportWriter is an optional writer for JSON log export.
 	// When set, JSON-encoded logs are written here in addition to console output.
 	// Use this to pipe logs directly into ClickHouse, Loki, Kafka, etc.
 	// Takes precedence over ExportPath. Works in any environment.
 	ExportWriter io.Writer `yaml:"-" json:"-" mapstructure:"-"`
 
+	// ExportEncoding selects the encoding of ExportWriter and ExportPath: json
+	// (default) or msgpack, one MessagePack map per entry with the same fields,
+	// for high-volume exports. Read msgpack exports with NewMsgpackReader.
+	ExportEncoding string `yaml:"export_encoding" json:"export_encoding" mapstructure:"export_encoding"`
+
+	// StdoutEncoding selects the stdout encoding: console, plain or json. If empty
+	// and Environment is unset, stdout gets console output on a terminal and JSON
+	// otherwise (systemd/journald, container log drivers, pipes).
+	StdoutEncoding string `yaml:"stdout_encoding" json:"stdout_encoding" mapstructure:"stdout_encoding"`
+
+	// Color controls ANSI colors on stdout: auto (default) colors only a terminal
+	// with NO_COLOR unset, always, or never.
+	Color string `yaml:"color" json:"color" mapstructure:"color"`
+
+	// ConsoleFormat overrides the timestamp, duration and level rendering of
+	// console and plain output. Epoch timestamps are printed as text.
+	ConsoleFormat *FormatConfig `yaml:"console_format,omitempty" json:"console_format" mapstructure:"console_format"`
+
+	// ExportFormat overrides the timestamp, duration and level rendering of JSON
+	// output (export sinks, JSON stdout and writers), e.g. epoch_millis
+	// timestamps for ingestion pipelines. Defaults: rfc3339nano, ms, lowercase.
+	ExportFormat *FormatConfig `yaml:"export_format,omitempty" json:"export_format" mapstructure:"export_format"`
+
+	// ConsoleErrors selects how console and plain output render Error and higher
+	// entries: line (one line, the default) or report, a multi-line block with
+	// the error chain, the fields as a table and the trimmed stack between
+	// dividers. The local environment defaults to report.
+	ConsoleErrors string `yaml:"console_errors" json:"console_errors" mapstructure:"console_errors"`
+
+	// Theme customizes console colors. If nil, DefaultTheme is used.
+	Theme *Theme `yaml:"theme,omitempty" json:"theme" mapstructure:"theme"`
+
+	// WriterEncoding selects the encoding for the writer passed to New.
+	// Valid values: console (default, colored), plain (no colors), json
+	WriterEncoding string `yaml:"writer_encoding" json:"writer_encoding" mapstructure:"writer_encoding"`
+
+	// Writers attaches additional custom writers, each with its own encoding and level.
+	// The writer passed to New is shorthand for a single WriterSpec using WriterEncoding.
+	Writers []WriterSpec `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Cores are user-supplied cores added beside the built-in sinks, e.g. a
+	// vendor SDK core. Each keeps its own level and sampling, as applied by
+	// its Check, and sees entries that pass the logger's sampling and filters.
+	Cores []zapcore.Core `yaml:"-" json:"-" mapstructure:"-"`
+
+	// ExportEncryption encrypts every JSON export entry (ExportPath or ExportWriter)
+	// with AES-GCM, for exports on shared volumes. Read them back with DecryptExport
+	// and switch keys at runtime with RotateExportKey.
+	ExportEncryption *EncryptionKey `yaml:"-" json:"-" mapstructure:"-"`
+
+	// ExportCompression gzips the JSON export (ExportPath or ExportWriter) as it
+	// is written, flushing a complete gzip member every FlushInterval, so
+	// archived files need no separate compression step.
+	ExportCompression *CompressionConfig `yaml:"export_compression,omitempty" json:"export_compression" mapstructure:"export_compression"`
+
+	// Archive rolls the ExportPath file into segments and uploads them to
+	// S3-compatible object storage, deleting the local copies. It requires
+	// ExportPath to be a file.
+	Archive *ArchiveConfig `yaml:"archive,omitempty" json:"archive" mapstructure:"archive"`
+
+	// CloudWatch enables JSON export to Amazon CloudWatch Logs. Works in any environment.
+	CloudWatch *CloudWatchConfig `yaml:"cloudwatch,omitempty" json:"cloudwatch" mapstructure:"cloudwatch"`
+
+	// Fluent enables JSON export to Fluentd or Fluent Bit over the forward protocol.
+	// Works in any environment.
+	Fluent *FluentConfig `yaml:"fluent,omitempty" json:"fluent" mapstructure:"fluent"`
+
+	// ReplaceGlobals makes New install the logger as zap's global (zap.L/zap.S)
+	// and redirect the standard library logger through it.
+	ReplaceGlobals bool `yaml:"replace_globals" json:"replace_globals" mapstructure:"replace_globals"`
+
+	// ContextExtractors add fields from the context in FromContext and
+	// FromOtelContext, e.g. BaggageExtractor("tenant") or
+	// ContextKeyExtractor(userKey{}, "user_id").
+	ContextExtractors []ContextExtractor `yaml:"-" json:"-" mapstructure:"-"`
+
+	// SpanEvents makes loggers bound to a span (WithOtelContext, FromOtelContext,
+	// LoggerWithSpan) also record their Warn and higher entries as events on the
+	// span, with fields as attributes, so trace viewers show errors inline.
+	SpanEvents bool `yaml:"span_events" json:"span_events" mapstructure:"span_events"`
+
+	// ErrorFingerprint adds error_fingerprint to Error and higher entries: a hash
+	// of the error types along the Unwrap chain and the top stack frames, for grouping identical
+	// errors whose messages differ.
+	ErrorFingerprint bool `yaml:"error_fingerprint" json:"error_fingerprint" mapstructure:"error_fingerprint"`
+
+	// DebugEnrichment adds goroutine_id to every entry and the context's pprof
+	// labels (as pprof_labels) to loggers returned by FromContext, to correlate
+	// logs with CPU profiles during incident analysis. It costs a stack walk per
+	// entry, so keep it off outside debugging.
+	DebugEnrichment bool `yaml:"debug_enrichment" json:"debug_enrichment" mapstructure:"debug_enrichment"`
+
+	// Schema checks field types against declared expectations and flags or drops
+	// mismatched entries, e.g. user_id logged as both number and string.
+	Schema *Schema `yaml:"schema,omitempty" json:"schema" mapstructure:"schema"`
+
+	// Pseudonymize replaces the values of user_id, session_id and client_ip (or
+	// the configured fields) with keyed hashes before any sink sees them, so
+	// entries stay correlatable without identifying anyone.
+	Pseudonymize *PseudonymizeConfig `yaml:"pseudonymize,omitempty" json:"pseudonymize" mapstructure:"pseudonymize"`
+
+	// MaxFieldLength caps string, byte, stringer and error values at this many
+	// bytes; longer values are cut and end in "...". Nested objects are not
+	// inspected. 0 means no limit.
+	MaxFieldLength int `yaml:"max_field_length" json:"max_field_length" mapstructure:"max_field_length"`
+
+	// MaxEntrySize caps the encoded size of an entry in bytes. Oversized entries
+	// lose their largest fields, listed in truncated_fields, then the end of
+	// their message; context fields added with With are kept. 0 means no limit.
+	// Entries shortened by either cap carry truncated=true.
+	MaxEntrySize int `yaml:"max_entry_size" json:"max_entry_size" mapstructure:"max_entry_size"`
+
+	// Filters drop entries by field value before they are encoded.
+	Filters []FilterRule `yaml:"filters,omitempty" json:"filters" mapstructure:"filters"`
+
+	// CloudMetadata queries the EC2/GCE/Azure instance metadata service at startup and
+	// attaches cloud_region, cloud_zone, instance_id and instance_type to every entry.
+	CloudMetadata bool `yaml:"cloud_metadata" json:"cloud_metadata" mapstructure:"cloud_metadata"`
+
+	// CloudMetadataTimeout bounds the metadata lookup. Default: 1s.
+	CloudMetadataTimeout time.Duration `yaml:"cloud_metadata_timeout" json:"cloud_metadata_timeout" mapstructure:"cloud_metadata_timeout"`
+
+	// ContainerMetadata detects Docker/containerd and attaches container_id
+	// (and container_image from the CONTAINER_IMAGE env var) to every entry.
+	ContainerMetadata bool `yaml:"container_metadata" json:"container_metadata" mapstructure:"container_metadata"`
+
+	// NestedFields writes the fields of the domain helpers (Method, Path, DBTable,
+	// GRPCCode, ...) as nested objects, e.g. "http":{"method":"GET","status":200}
+	// instead of http_method and http_status, for backends that index nested
+	// objects (Elasticsearch, OpenSearch).
+	NestedFields bool `yaml:"nested_fields" json:"nested_fields" mapstructure:"nested_fields"`
+
+	// AnonymizeClientIP truncates client_ip in HTTPMiddleware entries, access logs
+	// and the ClientIP helper with AnonymizeIP: the last IPv4 octet and the last
+	// 80 bits of IPv6 addresses are zeroed.
+	AnonymizeClientIP bool `yaml:"anonymize_client_ip" json:"anonymize_client_ip" mapstructure:"anonymize_client_ip"`
+
+	// SlowQueryThreshold promotes LogQuery entries for slower queries to Warn
+	// with slow_query=true. Zero disables it.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" json:"slow_query_threshold" mapstructure:"slow_query_threshold"`
+
+	// QueryArgs makes LogQuery log the query parameters as db_args. They often
+	// hold passwords, emails or tokens, so they are left out by default.
+	QueryArgs bool `yaml:"query_args" json:"query_args" mapstructure:"query_args"`
+
+	// ErrorBudget periodically logs per-component error budget consumption,
+	// based on Error+ entries carrying a "component" field.
+	ErrorBudget *ErrorBudgetConfig `yaml:"error_budget,omitempty" json:"error_budget" mapstructure:"error_budget"`
+
+	// ErrorRate periodically logs one "error rate" summary of Error+ entries by
+	// component and error_code, and can cap how many are written per window.
+	ErrorRate *ErrorRateConfig `yaml:"error_rate,omitempty" json:"error_rate" mapstructure:"error_rate"`
+
+	// ErrorOutputPaths receive the logger's internal errors (failed sink writes,
+	// Sync failures, export failover): "stderr" (default), "stdout" or file
+	// paths. Files are closed once the logger's context is done. See
+	// OnInternalError to handle them in code.
+	ErrorOutputPaths []string `yaml:"error_output_paths" json:"error_output_paths" mapstructure:"error_output_paths"`
+
+	// IsolateSinks gives every sink its own queue and goroutine, so a blocked or
+	// failing sink (e.g. a stuck file) cannot delay or fail writes to the others.
+	// A sink whose queue stays full for 100ms drops its own entries until it
+	// writes again; ReadStats reports written, failed and dropped entries per
+	// sink.
+	IsolateSinks bool `yaml:"isolate_sinks" json:"isolate_sinks" mapstructure:"isolate_sinks"`
+
+	// Throughput caps bytes or entries per second across all sinks. Past the cap,
+	// lower levels are shed first and one summary entry per second reports
+	// what was shed. Nil disables it.
+	Throughput *ThroughputConfig `yaml:"throughput,omitempty" json:"throughput" mapstructure:"throughput"`
+
+	// LastWords keeps the most recent entries down to its own level, including
+	// those below Level, and dumps them when a Panic or Fatal entry is logged (or
+	// on DumpLastWords / DumpOnPanic). Recording costs a caller lookup per
+	// below-level call. Nil disables it.
+	LastWords *LastWordsConfig `yaml:"last_words,omitempty" json:"last_words" mapstructure:"last_words"`
+
+	// CriticalSink receives entries logged with Critical and acknowledges durable
+	// delivery (Kafka acks, HTTP 2xx). Other entries are not sent to it.
+	CriticalSink AckSink `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Clock supplies entry timestamps and drives sampling. Use FixedClock for
+	// golden-output tests and VirtualClock for simulations. If nil, the system
+	// clock is used.
+	Clock Clock `yaml:"-" json:"-" mapstructure:"-"`
+
 	// Sampling configures log sampling for high-throughput applications.
 	Sampling *SamplingConfig `yaml:"sampling,omitempty" json:"sampling" mapstructure:"sampling"`
 
 	// DisableCaller stops annotating logs with the calling function's file name and line number.
 	DisableCaller bool `yaml:"disable_caller" json:"disable_caller" mapstructure:"disable_caller"`
 
+	// ConsoleFunction adds the calling function, as pkg.Func or pkg.(*T).Method,
+	// after the caller on console and plain lines. JSON export always has it
+	// as "function".
+	ConsoleFunction bool `yaml:"console_function" json:"console_function" mapstructure:"console_function"`
+
+	// CallerFallback controls caller paths that cannot be made relative to the project root
+	// (trimpath builds, binaries deployed without sources).
+	// Valid values: package (default, import-path qualified), short (dir/file.go), full
+	CallerFallback string `yaml:"caller_fallback" json:"caller_fallback" mapstructure:"caller_fallback"`
+
 	// DisableStacktrace disables automatic stacktrace capturing.
 	DisableStacktrace bool `yaml:"disable_stacktrace" json:"disable_stacktrace" mapstructure:"disable_stacktrace"`
 
 	// StacktraceLevel is the minimum level at which stacktraces are captured.
 	// Valid values: debug, info, warn, error, dpanic, panic, fatal
 	StacktraceLevel string `yaml:"stacktrace_level" json:"stacktrace_level" mapstructure:"stacktrace_level"`
+
+	// StacktraceTrim drops runtime, zap, net/http and middleware frames from
+	// stacktraces (entry stacks and zap.Stack fields), makes file paths relative
+	// to the project root and optionally caps the depth. Fingerprints are then
+	// computed from the trimmed stack.
+	StacktraceTrim *StacktraceTrimConfig `yaml:"stacktrace_trim,omitempty" json:"stacktrace_trim" mapstructure:"stacktrace_trim"`
+}
+
+// WriterSpec describes a custom output writer.
+type WriterSpec struct {
+	// Writer receives encoded entries.
+	Writer io.Writer
+
+	// Encoding is one of console (default), plain, json.
+	Encoding string
+
+	// Level is the minimum level for this writer.
+	// If empty, the logger's (dynamic) level is used.
+	Level string
+
+	// Spool buffers entries on disk while Writer fails, for network exporters.
+	Spool *SpoolConfig
+
+	// Async moves writes off the logging goroutine. Default ordering: strict.
+	Async *AsyncConfig
 }
 
 // SamplingConfig sets a sampling policy for repeated log entries.
@@ -45,6 +296,9 @@ type SamplingConfig struct {
 
 	// Thereafter is the number of entries to drop for each duplicate after Initial.
 	Thereafter int `yaml:"thereafter"`
+
+	// OnDrop is called for every entry discarded by the sampler.
+	OnDrop func(zapcore.Entry) `yaml:"-" json:"-" mapstructure:"-"`
 }
 
 // DefaultLoggerConfig returns a sensible default configuration.
@@ -0,0 +1,346 @@
+package zapang
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigGetter reads a configuration value by dotted key. *viper.Viper and
+// *koanf.Koanf implement it.
+type ConfigGetter interface {
+	Get(key string) any
+}
+
+// ConfigFromViper decodes the logger config under key (e.g. "logging") from a
+// *viper.Viper, over DefaultLoggerConfig, and validates it:
+//
+//	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+//	v.AutomaticEnv()
+//	cfg, err := zapang.ConfigFromViper(v, "logging")
+//
+// Every known key is read with Get, so viper's environment variables, flags
+// and defaults override the file: LOGGING_LEVEL=debug above sets Level. Keys
+// match the mapstructure tags, case-insensitively; unknown keys are errors.
+// Strings from the environment are converted to the field types, with
+// durations such as "1s" and comma-separated lists.
+func ConfigFromViper(v ConfigGetter, key string) (Config, error) {
+	cfg := DefaultLoggerConfig()
+	dst := reflect.ValueOf(&cfg).Elem()
+	if err := decodeConfigValue(dst, v.Get(key), key); err != nil {
+		return Config{}, err
+	}
+	// Viper resolves environment overrides only for keys asked for by name.
+	if err := decodeConfigValue(dst, configLeaves(v, key, dst.Type()), key); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// ConfigFromKoanf decodes the logger config under key from a *koanf.Koanf,
+// over DefaultLoggerConfig, and validates it, like ConfigFromViper. Load the
+// environment with koanf's env provider to override file values:
+//
+//	k.Load(env.Provider("APP_", ".", func(s string) string {
+//		return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(s, "APP_")), "_", ".")
+//	}), nil)
+//	cfg, err := zapang.ConfigFromKoanf(k, "logging")
+func ConfigFromKoanf(k ConfigGetter, key string) (Config, error) {
+	cfg := DefaultLoggerConfig()
+	if err := decodeConfigValue(reflect.ValueOf(&cfg).Elem(), k.Get(key), key); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports values of c that the logger would otherwise silently
+// replace with defaults: unknown levels, encodings, color modes, console error
+// styles and caller fallbacks, negative sampling settings, size limits and
+// archive segments, unsupported export compression, and a CloudWatch exporter
+// without a log group or stream.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(key, val string, valid ...string) {
+		if val != "" && !slices.Contains(valid, val) {
+			errs = append(errs, fmt.Errorf("zapang: config %s: invalid value %q, want one of %s", key, val, strings.Join(valid, ", ")))
+		}
+	}
+	levels := []string{"debug", "info", "warn", "warning", "error", "dpanic", "panic", "fatal"}
+	encodings := encodingNames()
+	check("level", c.Level, levels...)
+	check("console_level", c.ConsoleLevel, levels...)
+	check("export_level", c.ExportLevel, levels...)
+	check("stacktrace_level", c.StacktraceLevel, levels...)
+	check("stdout_encoding", c.StdoutEncoding, encodings...)
+	check("writer_encoding", c.WriterEncoding, encodings...)
+	check("export_encoding", c.ExportEncoding, encodings...)
+	check("color", c.Color, ColorAuto, ColorAlways, ColorNever)
+	check("console_errors", c.ConsoleErrors, ConsoleErrorsLine, ConsoleErrorsReport)
+	check("caller_fallback", c.CallerFallback, CallerFallbackPackage, CallerFallbackShort, CallerFallbackFull)
+	if s := c.Sampling; s != nil && (s.Initial < 0 || s.Thereafter < 0) {
+		errs = append(errs, errors.New("zapang: config sampling: initial and thereafter must not be negative"))
+	}
+	if c.MaxFieldLength < 0 || c.MaxEntrySize < 0 {
+		errs = append(errs, errors.New("zapang: config max_field_length and max_entry_size must not be negative"))
+	}
+	if c.Archive != nil {
+		if err := c.Archive.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("zapang: config archive: %w", err))
+		}
+	}
+	if c.ExportCompression != nil {
+		if err := c.ExportCompression.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("zapang: config export_compression: %w", err))
+		}
+	}
+	if c.CloudWatch != nil {
+		if err := c.CloudWatch.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("zapang: config cloudwatch: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// configLeaves returns the values of every non-struct key of t under prefix,
+// as a tree for decodeConfigValue; keys without a value are left out.
+func configLeaves(g ConfigGetter, prefix string, t reflect.Type) map[string]any {
+	tree := make(map[string]any)
+	for key, i := range configKeys(t) {
+		full := joinConfigKey(prefix, key)
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			if sub := configLeaves(g, full, ft); len(sub) > 0 {
+				tree[key] = sub
+			}
+			continue
+		}
+		if v := g.Get(full); v != nil {
+			tree[key] = v
+		}
+	}
+	return tree
+}
+
+// configKeys maps the lowercase config keys of struct type t to field indexes.
+// A key is the mapstructure tag, else the yaml tag, else the field name.
+func configKeys(t reflect.Type) map[string]int {
+	keys := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("mapstructure")
+		if !ok {
+			tag = f.Tag.Get("yaml")
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		keys[strings.ToLower(name)] = i
+	}
+	return keys
+}
+
+func joinConfigKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// decodeConfigValue sets dst from src, a value as viper and koanf return it:
+// nested map[string]any objects, []any lists and scalars, with strings for
+// values that came from the environment. A nil src leaves dst unchanged.
+func decodeConfigValue(dst reflect.Value, src any, key string) error {
+	if src == nil {
+		return nil
+	}
+	invalid := func() error {
+		return fmt.Errorf("zapang: config %s: cannot use %T value %v as %s", key, src, src, dst.Type())
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeConfigValue(dst.Elem(), src, key)
+
+	case reflect.Struct:
+		m, ok := configMap(src)
+		if !ok {
+			return invalid()
+		}
+		keys := configKeys(dst.Type())
+		for k, v := range m {
+			i, ok := keys[strings.ToLower(k)]
+			if !ok {
+				return fmt.Errorf("zapang: config %s: unknown key", joinConfigKey(key, k))
+			}
+			if err := decodeConfigValue(dst.Field(i), v, joinConfigKey(key, k)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		m, ok := configMap(src)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return invalid()
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, v := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeConfigValue(elem, v, joinConfigKey(key, k)); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(out)
+
+	case reflect.Slice:
+		var items []any
+		switch s := src.(type) {
+		case []any:
+			items = s
+		case []string:
+			for _, item := range s {
+				items = append(items, item)
+			}
+		case string: // comma-separated, from the environment
+			for item := range strings.SplitSeq(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		default:
+			return invalid()
+		}
+		out := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeConfigValue(out.Index(i), item, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(out)
+
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			dst.SetString(s)
+		case bool, int, int64, float64:
+			dst.SetString(fmt.Sprint(s))
+		default:
+			return invalid()
+		}
+
+	case reflect.Bool:
+		switch b := src.(type) {
+		case bool:
+			dst.SetBool(b)
+		case string:
+			v, err := strconv.ParseBool(b)
+			if err != nil {
+				return invalid()
+			}
+			dst.SetBool(v)
+		default:
+			return invalid()
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s, ok := src.(string); ok && dst.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return invalid()
+			}
+			dst.SetInt(int64(d))
+			return nil
+		}
+		n, ok := configInt(src)
+		if !ok || dst.OverflowInt(n) {
+			return invalid()
+		}
+		dst.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := configInt(src)
+		if !ok || n < 0 || dst.OverflowUint(uint64(n)) {
+			return invalid()
+		}
+		dst.SetUint(uint64(n))
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := configNumber(src)
+		if !ok {
+			return invalid()
+		}
+		dst.SetFloat(n)
+
+	default:
+		return invalid()
+	}
+	return nil
+}
+
+// configMap returns src as a map with string keys.
+func configMap(src any) (map[string]any, bool) {
+	switch m := src.(type) {
+	case map[string]any:
+		return m, true
+	case map[any]any:
+		out := make(map[string]any, len(m))
+		for k, v := range m {
+			out[fmt.Sprint(k)] = v
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// configInt returns src as an int64 if it is a whole number, parsing strings.
+func configInt(src any) (int64, bool) {
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), v.Uint() <= math.MaxInt64
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		return int64(f), f == math.Trunc(f) && math.Abs(f) < 1<<63
+	case reflect.String:
+		n, err := strconv.ParseInt(strings.TrimSpace(v.String()), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// configNumber returns src as a float64, parsing strings.
+func configNumber(src any) (float64, bool) {
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
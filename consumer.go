@@ -0,0 +1,141 @@
+package zapang
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Message handling outcomes logged by WrapMessageHandler.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomePanic   = "panic"
+)
+
+// QueueMessage describes a consumed message. Adapt Kafka records, NATS
+// messages or AMQP deliveries to it in your consumer loop.
+type QueueMessage struct {
+	// Queue is the topic, subject or queue the message came from.
+	Queue string
+
+	// ID is the message ID, if the broker or producer sets one.
+	ID string
+
+	// Position is the partition and offset for partitioned logs such as Kafka; nil otherwise.
+	Position *QueuePosition
+
+	// Headers are the message headers. Trace context is read from traceparent
+	// (W3C) or X-Trace-ID; header names are matched case-insensitively.
+	Headers map[string]string
+
+	// Body is the message payload. It is not logged.
+	Body []byte
+}
+
+// QueuePosition locates a message in a partitioned log.
+type QueuePosition struct {
+	Partition int32
+	Offset    int64
+}
+
+// MessageHandler processes one consumed message.
+type MessageHandler func(ctx context.Context, msg QueueMessage) error
+
+// WrapMessageHandler is the consumer-side counterpart of HTTPMiddleware. For each
+// message it derives a logger with queue_name, message_id and partition/offset,
+// continues the producer's trace from the headers, injects the logger into the
+// handler's context and logs the outcome with latency_ms. Panics are recovered,
+// reported to OnPanic hooks and returned as errors so the consumer can nack.
+func WrapMessageHandler(log *zap.Logger, handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, msg QueueMessage) (err error) {
+		start := time.Now()
+
+		msgLogger := log.With(QueueName(msg.Queue))
+		if msg.ID != "" {
+			msgLogger = msgLogger.With(MessageID(msg.ID))
+		}
+		if msg.Position != nil {
+			msgLogger = msgLogger.With(Partition(msg.Position.Partition), Offset(msg.Position.Offset))
+		}
+		var traceFields []zap.Field
+		if sc, ok := traceparent(headerValue(msg.Headers, "traceparent")); ok {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+			traceFields = []zap.Field{TraceID(sc.TraceID().String()), ParentSpanID(sc.SpanID().String())}
+		} else if traceID := headerValue(msg.Headers, "X-Trace-ID"); traceID != "" {
+			traceFields = []zap.Field{TraceID(traceID)}
+		}
+		// The handler's logger gets the trace fields from the context, so a
+		// StartSpan span in the handler replaces them.
+		ctx = contextWithTraceFields(WithContext(ctx, msgLogger), traceFields...)
+		msgLogger = msgLogger.With(traceFields...)
+
+		defer func() {
+			outcome := OutcomeSuccess
+			if rec := recover(); rec != nil {
+				outcome = OutcomePanic
+				msgLogger.Error("panic recovered", zap.Any("panic", rec), zap.Stack("stacktrace"))
+				notifyPanic(PanicInfo{
+					Value:   rec,
+					Stack:   debug.Stack(),
+					Time:    time.Now(),
+					Context: ctx,
+				})
+				err = fmt.Errorf("zapang: message handler panicked: %v", rec)
+			} else if err != nil {
+				outcome = OutcomeError
+			}
+
+			if err != nil {
+				msgLogger.Error("message failed", LatencyMs(time.Since(start)), Outcome(outcome), Error(err))
+				return
+			}
+			msgLogger.Info("message handled", LatencyMs(time.Since(start)), Outcome(outcome))
+		}()
+
+		return handler(ctx, msg)
+	}
+}
+
+func headerValue(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// traceparent parses a W3C traceparent header: version-traceid-parentid-flags.
+func traceparent(h string) (trace.SpanContext, bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[3]) != 2 {
+		return trace.SpanContext{}, false
+	}
+	traceID, err := trace.TraceIDFromHex(parts[1])
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(parts[2])
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var flags trace.TraceFlags
+	if parts[3] == "01" {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	}), true
+}
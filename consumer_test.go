@@ -0,0 +1,46 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWrapMessageHandler(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+
+	var spanCtx trace.SpanContext
+	h := WrapMessageHandler(zap.New(obs), func(ctx context.Context, msg QueueMessage) error {
+		spanCtx = trace.SpanContextFromContext(ctx)
+		FromContext(ctx).Info("charging")
+		return errors.New("card declined")
+	})
+
+	err := h(context.Background(), QueueMessage{
+		Queue:    "payments",
+		ID:       "m-1",
+		Position: &QueuePosition{Partition: 3, Offset: 42},
+		Headers:  map[string]string{"Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	if err == nil {
+		t.Fatal("expected handler error")
+	}
+	if spanCtx.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !spanCtx.IsRemote() {
+		t.Fatalf("trace context not propagated: %v", spanCtx)
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 || entries[0].Message != "charging" || entries[1].Message != "message failed" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	fields := entries[1].ContextMap()
+	if fields["queue_name"] != "payments" || fields["message_id"] != "m-1" || fields["partition"] != int32(3) ||
+		fields["offset"] != int64(42) || fields["outcome"] != OutcomeError || fields["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+}
@@ -0,0 +1,147 @@
+package zapang
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FieldType is the JSON type of an exported field.
+type FieldType string
+
+// Field types for contracts.
+const (
+	TypeString FieldType = "string"
+	TypeNumber FieldType = "number"
+	TypeBool   FieldType = "bool"
+	TypeObject FieldType = "object"
+	TypeArray  FieldType = "array"
+	TypeNull   FieldType = "null"
+	// TypeAny accepts any type; use it to assert presence only.
+	TypeAny FieldType = "any"
+)
+
+// FieldExpectation describes a field a consumer relies on.
+type FieldExpectation struct {
+	// Key is the field key. Dotted keys ("http.status") also match nested objects.
+	Key string
+
+	// Type is the expected JSON type. Empty means TypeAny.
+	Type FieldType
+
+	// Optional allows the field to be absent; if present its type is still checked.
+	Optional bool
+}
+
+// Contract describes the fields a consumer expects on entries with a given message.
+type Contract struct {
+	// Message selects the entries the contract applies to. Empty matches all entries.
+	Message string
+
+	Fields []FieldExpectation
+}
+
+// ContractViolation describes a single mismatch between an entry and a contract.
+type ContractViolation struct {
+	Message string
+	Key     string
+	Problem string
+}
+
+func (v ContractViolation) String() string {
+	return fmt.Sprintf("%q: field %q %s", v.Message, v.Key, v.Problem)
+}
+
+// Check returns the violations of the contract in e, or nil if e does not
+// match the contract's Message or satisfies it.
+func (c Contract) Check(e Entry) []ContractViolation {
+	if c.Message != "" && e.Message != c.Message {
+		return nil
+	}
+
+	var violations []ContractViolation
+	for _, exp := range c.Fields {
+		v, ok := lookupField(e.Fields, exp.Key)
+		if !ok {
+			if !exp.Optional {
+				violations = append(violations, ContractViolation{e.Message, exp.Key, "is missing"})
+			}
+			continue
+		}
+		if exp.Type == "" || exp.Type == TypeAny {
+			continue
+		}
+		if got := jsonType(v); got != exp.Type {
+			violations = append(violations, ContractViolation{e.Message, exp.Key, fmt.Sprintf("is %s, want %s", got, exp.Type)})
+		}
+	}
+	return violations
+}
+
+// CheckContracts validates entries against contracts. It also reports contracts
+// with a Message that matched no entry, since a renamed message breaks consumers too.
+func CheckContracts(entries []Entry, contracts ...Contract) []ContractViolation {
+	var violations []ContractViolation
+	for _, c := range contracts {
+		matched := false
+		for _, e := range entries {
+			if c.Message == "" || e.Message == c.Message {
+				matched = true
+				violations = append(violations, c.Check(e)...)
+			}
+		}
+		if !matched && c.Message != "" {
+			violations = append(violations, ContractViolation{c.Message, "", "no entry with this message"})
+		}
+	}
+	return violations
+}
+
+// TB is the subset of testing.TB used by AssertContracts.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertContracts reports every contract violation as a test error.
+func AssertContracts(t TB, entries []Entry, contracts ...Contract) {
+	t.Helper()
+	for _, v := range CheckContracts(entries, contracts...) {
+		t.Errorf("log contract violation: %s", v)
+	}
+}
+
+// lookupField finds key literally or by walking nested objects along its dots.
+func lookupField(fields map[string]any, key string) (any, bool) {
+	if v, ok := fields[key]; ok {
+		return v, true
+	}
+	head, rest, found := strings.Cut(key, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := fields[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupField(nested, rest)
+}
+
+func jsonType(v any) FieldType {
+	switch v.(type) {
+	case nil:
+		return TypeNull
+	case string:
+		return TypeString
+	case json.Number, float64:
+		return TypeNumber
+	case bool:
+		return TypeBool
+	case map[string]any:
+		return TypeObject
+	case []any:
+		return TypeArray
+	default:
+		return TypeAny
+	}
+}
@@ -1,10 +1,18 @@
 package zapang
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"sort"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/buffer"
@@ -13,20 +21,57 @@ import (
 
 // --- Console encoder: human-readable fields + verbose error block ---
 
-// consoleEncoder wraps a zapcore.Encoder to:
-//   - intercept "errorVerbose" and render it as a colored multi-line block
-//   - reformat JSON fields blob as key=value pairs
+// consoleEncoder encodes entries as a tab-separated line of time, level,
+// name, caller and message followed by key=value fields, and:
+//   - intercepts "errorVerbose" and renders it as a colored multi-line block
+//   - writes fields sorted by key, the last value of a repeated key winning
+//   - optionally renders Error and higher entries as multi-line error reports
+//
+// Fields are encoded by an embedded JSON encoder and rewritten from its
+// output, so every zap field type renders; the line is assembled in pooled
+// buffers without allocating for entries of scalar fields.
 type consoleEncoder struct {
-	zapcore.Encoder
-	verbose string
+	zapcore.Encoder // JSON encoder for the fields only
+	cfg             *zapcore.EncoderConfig
+	verbose         string
+	plain           bool
+	report          bool // Error+ entries as error reports
+	durations       bool // *_ms fields as durations
+	theme           *Theme
+}
+
+// newConsoleEncoder returns a colored console encoder using cfg.Theme, or the default theme.
+func newConsoleEncoder(cfg Config) *consoleEncoder {
+	theme := DefaultTheme()
+	if cfg.Theme != nil {
+		theme = *cfg.Theme
+	}
+	ec := consoleEncoderConfig(cfg)
+	ec.EncodeLevel = consoleLevelEncoder(cfg.ConsoleFormat, theme.Levels)
+	ec.EncodeTime = consoleTimeEncoder(cfg.ConsoleFormat, theme.Time)
+	enc := newConsoleEncoderConfig(ec, &theme, false)
+	enc.report = cfg.ConsoleErrors == ConsoleErrorsReport
+	enc.durations = humanDurations(cfg.ConsoleFormat)
+	return enc
 }
 
-func newConsoleEncoder(inner zapcore.Encoder) *consoleEncoder {
-	return &consoleEncoder{Encoder: inner}
+// newPlainEncoder returns a console encoder without ANSI colors.
+func newPlainEncoder(cfg Config) *consoleEncoder {
+	enc := newConsoleEncoderConfig(consoleEncoderConfig(cfg), nil, true)
+	enc.report = cfg.ConsoleErrors == ConsoleErrorsReport
+	enc.durations = humanDurations(cfg.ConsoleFormat)
+	return enc
+}
+
+func newConsoleEncoderConfig(ec zapcore.EncoderConfig, theme *Theme, plain bool) *consoleEncoder {
+	fc := ec
+	fc.TimeKey, fc.LevelKey, fc.NameKey, fc.CallerKey = "", "", "", ""
+	fc.FunctionKey, fc.MessageKey, fc.StacktraceKey = "", "", ""
+	return &consoleEncoder{Encoder: zapcore.NewJSONEncoder(fc), cfg: &ec, plain: plain, theme: theme}
 }
 
 func (e *consoleEncoder) Clone() zapcore.Encoder {
-	return &consoleEncoder{Encoder: e.Encoder.Clone()}
+	return &consoleEncoder{Encoder: e.Encoder.Clone(), cfg: e.cfg, plain: e.plain, report: e.report, durations: e.durations, theme: e.theme}
 }
 
 func (e *consoleEncoder) AddString(key, val string) {
@@ -38,22 +83,37 @@ func (e *consoleEncoder) AddString(key, val string) {
 }
 
 func (e *consoleEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	if e.report && entry.Level >= zapcore.ErrorLevel {
+		return e.encodeReport(entry, fields)
+	}
+
 	var verbose string
+	depth := 0
 
 	// Replace ErrorType fields with plain strings to prevent inline errorVerbose.
-	modified := make([]zapcore.Field, 0, len(fields))
-	for _, f := range fields {
-		if f.Type == zapcore.ErrorType {
-			if err, ok := f.Interface.(error); ok {
-				modified = append(modified, zap.String(f.Key, err.Error()))
-				v := fmt.Sprintf("%+v", err)
-				if v != err.Error() {
-					verbose = v
-				}
+	// Step nesting is shown as indentation instead of a field. The fields are
+	// only copied when there is something to replace.
+	if i := slices.IndexFunc(fields, consoleRewrites); i >= 0 {
+		modified := make([]zapcore.Field, i, len(fields))
+		copy(modified, fields)
+		for _, f := range fields[i:] {
+			if isStepDepth(f) {
+				depth = int(min(max(f.Integer, 0), maxStepIndent))
 				continue
 			}
+			if f.Type == zapcore.ErrorType {
+				if err, ok := f.Interface.(error); ok {
+					modified = append(modified, zap.String(f.Key, err.Error()))
+					v := fmt.Sprintf("%+v", err)
+					if v != err.Error() {
+						verbose = v
+					}
+					continue
+				}
+			}
+			modified = append(modified, f)
 		}
-		modified = append(modified, f)
+		fields = modified
 	}
 
 	if e.verbose != "" {
@@ -61,69 +121,377 @@ func (e *consoleEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field
 		e.verbose = ""
 	}
 
-	buf, err := e.Encoder.EncodeEntry(entry, modified)
+	js, err := e.Encoder.EncodeEntry(zapcore.Entry{}, fields)
 	if err != nil {
-		return buf, err
+		return nil, err
 	}
+	defer js.Free()
 
-	data := buf.String()
-	buf.Reset()
+	s := consoleScratchPool.Get().(*consoleScratch)
+	defer consoleScratchPool.Put(s)
 
-	// Reformat JSON fields blob as key=value pairs.
-	data = reformatJSONFields(data)
+	line := consoleBufferPool.Get()
+	e.writePrefix(line, entry, s)
+	if line.Len() > 0 {
+		line.AppendByte('\t')
+	}
+	for range depth {
+		line.AppendString("  ")
+	}
+	line.AppendString(entry.Message)
+	if obj := bytes.TrimRight(js.Bytes(), "\n"); len(obj) > 2 {
+		var highlight map[string]string
+		if !e.plain {
+			highlight = e.theme.Fields
+		}
+		s.writeFields(line, obj, highlight, e.durations)
+	}
+	if entry.Stack != "" && e.cfg.StacktraceKey != "" {
+		line.AppendByte('\n')
+		line.AppendString(entry.Stack)
+	}
+	line.AppendString(e.cfg.LineEnding)
 
 	if verbose == "" {
-		buf.AppendString(data)
-		return buf, nil
+		return line, nil
+	}
+
+	for bytes.HasSuffix(line.Bytes(), []byte("\n")) {
+		line.TrimNewline()
+	}
+	line.AppendByte('\n')
+	if e.plain {
+		line.AppendString(verbose)
+	} else {
+		line.AppendString(e.theme.colorizeVerbose(verbose))
+	}
+	line.AppendByte('\n')
+	return line, nil
+}
+
+// consoleRewrites reports whether EncodeEntry replaces or drops f.
+func consoleRewrites(f zapcore.Field) bool {
+	return f.Type == zapcore.ErrorType || isStepDepth(f)
+}
+
+// writePrefix writes the time, level, name and caller of entry to line,
+// tab-separated, as zap's console encoder does.
+func (e *consoleEncoder) writePrefix(line *buffer.Buffer, entry zapcore.Entry, s *consoleScratch) {
+	enc := &s.line
+	enc.buf, enc.n = line, 0
+	defer func() { enc.buf = nil }()
+
+	cfg := e.cfg
+	if cfg.TimeKey != "" && cfg.EncodeTime != nil && !entry.Time.IsZero() {
+		cfg.EncodeTime(entry.Time, enc)
+	}
+	if cfg.LevelKey != "" && cfg.EncodeLevel != nil {
+		cfg.EncodeLevel(entry.Level, enc)
+	}
+	if entry.LoggerName != "" && cfg.NameKey != "" {
+		enc.AppendString(entry.LoggerName)
+	}
+	if entry.Caller.Defined && cfg.CallerKey != "" && cfg.EncodeCaller != nil {
+		cfg.EncodeCaller(entry.Caller, enc)
+	}
+	if entry.Caller.Function != "" && cfg.FunctionKey != "" && cfg.FunctionKey != zapcore.OmitKey {
+		enc.AppendString(shortFunction(entry.Caller.Function))
+	}
+}
+
+// shortFunction trims the import path from a qualified function name:
+// github.com/org/svc/billing.(*Service).Charge becomes billing.(*Service).Charge.
+func shortFunction(fn string) string {
+	return fn[strings.LastIndexByte(fn, '/')+1:]
+}
+
+// consoleBufferPool holds console lines. Buffers go to the caller, which
+// frees them after writing.
+var consoleBufferPool = buffer.NewPool()
+
+// consoleScratch is the working memory of one consoleEncoder.EncodeEntry call.
+type consoleScratch struct {
+	line   lineEncoder
+	fields []consoleField
+	value  []byte
+}
+
+var consoleScratchPool = sync.Pool{New: func() any { return new(consoleScratch) }}
+
+// consoleField is a field key and its raw JSON value.
+type consoleField struct {
+	key, val []byte
+}
+
+// writeFields writes the fields of the JSON object obj to line as
+// tab-separated key=value pairs sorted by key, styling the values of
+// highlighted keys. If obj cannot be parsed it is written as is.
+func (s *consoleScratch) writeFields(line *buffer.Buffer, obj []byte, highlight map[string]string, durations bool) {
+	fields, ok := scanJSONObject(obj, s.fields[:0])
+	s.fields = fields[:0]
+	if !ok {
+		line.AppendByte('\t')
+		line.Write(obj)
+		return
+	}
+
+	slices.SortStableFunc(fields, func(a, b consoleField) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	for i, f := range fields {
+		if i+1 < len(fields) && bytes.Equal(f.key, fields[i+1].key) {
+			continue // a later value wins
+		}
+		line.AppendByte('\t')
+		line.Write(f.key)
+		line.AppendByte('=')
+		style := highlight[string(f.key)]
+		if style != "" {
+			line.AppendString("\033[")
+			line.AppendString(style)
+			line.AppendByte('m')
+		}
+		s.value = appendConsoleField(s.value[:0], f.key, f.val, durations)
+		line.Write(s.value)
+		if style != "" {
+			line.AppendString(ansiReset)
+		}
+	}
+	clear(fields)
+}
+
+// scanJSONObject appends the members of the compact JSON object obj, as zap's
+// JSON encoder writes it, to dst. It reports false if obj is malformed.
+func scanJSONObject(obj []byte, dst []consoleField) ([]consoleField, bool) {
+	if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+		return dst, false
+	}
+	for i := 1; i < len(obj)-1; {
+		if obj[i] == ',' {
+			i++
+		}
+		end := skipJSONValue(obj, i)
+		if end < 0 || obj[i] != '"' || end >= len(obj) || obj[end] != ':' {
+			return dst, false
+		}
+		key := obj[i+1 : end-1]
+		if bytes.IndexByte(key, '\\') >= 0 {
+			var k string
+			if json.Unmarshal(obj[i:end], &k) != nil {
+				return dst, false
+			}
+			key = []byte(k)
+		}
+		i = end + 1
+		if end = skipJSONValue(obj, i); end < 0 {
+			return dst, false
+		}
+		dst = append(dst, consoleField{key: key, val: obj[i:end]})
+		i = end
 	}
+	return dst, true
+}
 
-	buf.AppendString(strings.TrimRight(data, "\n"))
-	buf.AppendString("\n")
-	buf.AppendString(colorizeVerbose(verbose))
-	buf.AppendString("\n")
-	return buf, nil
+// skipJSONValue returns the index just past the JSON value starting at
+// data[i], or -1 if it is unterminated.
+func skipJSONValue(data []byte, i int) int {
+	if i >= len(data) {
+		return -1
+	}
+	switch data[i] {
+	case '"':
+		for i++; i < len(data); i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+		return -1
+	case '{', '[':
+		depth := 0
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			case '"':
+				end := skipJSONValue(data, i)
+				if end < 0 {
+					return -1
+				}
+				i = end - 1
+			}
+		}
+		return -1
+	default:
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case ',', ':', '}', ']':
+				return i
+			}
+		}
+		return i
+	}
 }
 
-// reformatJSONFields finds the trailing JSON object in the first line
-// and replaces it with tab-separated key=value pairs.
-func reformatJSONFields(data string) string {
-	// Split first line from the rest (stacktrace etc.)
-	firstLine, rest, hasRest := strings.Cut(data, "\n")
+// appendConsoleField appends the value of a field like appendConsoleValue, or,
+// with durations, a number under a key ending in "_ms" as a duration rounded
+// to three significant digits: latency_ms=1.23ms rather than 1.234567.
+func appendConsoleField(dst, key, val []byte, durations bool) []byte {
+	if durations && bytes.HasSuffix(key, []byte("_ms")) && val[0] != '"' {
+		if ms, err := strconv.ParseFloat(string(val), 64); err == nil && !math.IsInf(ms, 0) && !math.IsNaN(ms) {
+			return appendDuration(dst, roundSignificant(time.Duration(ms*1e6)))
+		}
+	}
+	return appendConsoleValue(dst, val)
+}
 
-	idx := strings.LastIndex(firstLine, "\t{\"")
-	if idx < 0 {
-		return data
+// roundSignificant rounds d to three significant digits.
+func roundSignificant(d time.Duration) time.Duration {
+	p := time.Duration(1)
+	for d/p >= 1000 || d/p <= -1000 {
+		p *= 10
 	}
+	return d.Round(p)
+}
 
-	jsonStr := firstLine[idx+1:]
-	prefix := firstLine[:idx]
+// appendConsoleValue appends the raw JSON value val to dst as fmt.Print
+// prints its decoded Go value: strings unquoted, numbers in %v form, null as
+// <nil>, and objects and arrays as maps and slices.
+func appendConsoleValue(dst, val []byte) []byte {
+	switch val[0] {
+	case '"':
+		if out, ok := appendUnquoted(dst, val); ok {
+			return out
+		}
+	case '{', '[':
+	default:
+		switch string(val) {
+		case "null":
+			return append(dst, "<nil>"...)
+		case "true", "false":
+			return append(dst, val...)
+		}
+		if f, err := strconv.ParseFloat(string(val), 64); err == nil {
+			return strconv.AppendFloat(dst, f, 'g', -1, 64)
+		}
+	}
 
-	var fields map[string]any
-	if err := json.Unmarshal([]byte(jsonStr), &fields); err != nil {
-		return data
+	var v any
+	if err := json.Unmarshal(val, &v); err != nil {
+		return append(dst, val...)
 	}
+	return fmt.Append(dst, v)
+}
 
-	keys := make([]string, 0, len(fields))
-	for k := range fields {
-		keys = append(keys, k)
+// appendUnquoted appends the JSON string quoted to dst without its quotes and
+// escapes. It reports false for escapes it does not decode (surrogate pairs,
+// which zap does not write).
+func appendUnquoted(dst, quoted []byte) ([]byte, bool) {
+	s := quoted[1 : len(quoted)-1]
+	for {
+		i := bytes.IndexByte(s, '\\')
+		if i < 0 {
+			return append(dst, s...), true
+		}
+		dst = append(dst, s[:i]...)
+		if i+1 >= len(s) {
+			return dst, false
+		}
+		switch c := s[i+1]; c {
+		case '"', '\\', '/':
+			dst = append(dst, c)
+		case 'b':
+			dst = append(dst, '\b')
+		case 'f':
+			dst = append(dst, '\f')
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'u':
+			r, ok := unhex4(s[i+2:])
+			if !ok || utf16.IsSurrogate(r) {
+				return dst, false
+			}
+			dst = utf8.AppendRune(dst, r)
+			s = s[i+6:]
+			continue
+		default:
+			return dst, false
+		}
+		s = s[i+2:]
 	}
-	sort.Strings(keys)
+}
 
-	var b strings.Builder
-	b.WriteString(prefix)
-	for _, k := range keys {
-		b.WriteByte('\t')
-		b.WriteString(k)
-		b.WriteByte('=')
-		fmt.Fprint(&b, fields[k])
+// unhex4 decodes the four hex digits at the start of s.
+func unhex4(s []byte) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
 	}
-	b.WriteByte('\n')
+	var r rune
+	for _, c := range s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
 
-	if hasRest {
-		b.WriteString(rest)
+// lineEncoder is the zapcore.PrimitiveArrayEncoder the console time, level
+// and caller encoders write to: it appends elements to a line separated by
+// tabs, formatted as fmt.Print would.
+type lineEncoder struct {
+	buf *buffer.Buffer
+	n   int // elements written
+	num []byte
+}
+
+func (l *lineEncoder) next() {
+	if l.n > 0 {
+		l.buf.AppendByte('\t')
 	}
+	l.n++
+}
 
-	return b.String()
+func (l *lineEncoder) AppendString(v string)         { l.next(); l.buf.AppendString(v) }
+func (l *lineEncoder) AppendByteString(v []byte)     { l.next(); l.buf.AppendBytes(v) }
+func (l *lineEncoder) AppendBool(v bool)             { l.next(); l.buf.AppendBool(v) }
+func (l *lineEncoder) AppendInt(v int)               { l.AppendInt64(int64(v)) }
+func (l *lineEncoder) AppendInt64(v int64)           { l.next(); l.buf.AppendInt(v) }
+func (l *lineEncoder) AppendInt32(v int32)           { l.AppendInt64(int64(v)) }
+func (l *lineEncoder) AppendInt16(v int16)           { l.AppendInt64(int64(v)) }
+func (l *lineEncoder) AppendInt8(v int8)             { l.AppendInt64(int64(v)) }
+func (l *lineEncoder) AppendUint(v uint)             { l.AppendUint64(uint64(v)) }
+func (l *lineEncoder) AppendUint64(v uint64)         { l.next(); l.buf.AppendUint(v) }
+func (l *lineEncoder) AppendUint32(v uint32)         { l.AppendUint64(uint64(v)) }
+func (l *lineEncoder) AppendUint16(v uint16)         { l.AppendUint64(uint64(v)) }
+func (l *lineEncoder) AppendUint8(v uint8)           { l.AppendUint64(uint64(v)) }
+func (l *lineEncoder) AppendUintptr(v uintptr)       { l.AppendUint64(uint64(v)) }
+func (l *lineEncoder) AppendFloat64(v float64)       { l.appendFloat(v, 64) }
+func (l *lineEncoder) AppendFloat32(v float32)       { l.appendFloat(float64(v), 32) }
+func (l *lineEncoder) AppendComplex128(v complex128) { l.next(); fmt.Fprint(l.buf, v) }
+func (l *lineEncoder) AppendComplex64(v complex64)   { l.next(); fmt.Fprint(l.buf, v) }
+
+func (l *lineEncoder) appendFloat(v float64, bitSize int) {
+	l.next()
+	l.num = strconv.AppendFloat(l.num[:0], v, 'g', -1, bitSize)
+	l.buf.AppendBytes(l.num)
 }
 
 // --- Export encoder: strips errorVerbose from JSON output ---
@@ -150,8 +518,13 @@ func (e *exportEncoder) AddString(key, val string) {
 
 func (e *exportEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
 	// Replace ErrorType with plain String to prevent errorVerbose generation.
-	modified := make([]zapcore.Field, 0, len(fields))
-	for _, f := range fields {
+	i := slices.IndexFunc(fields, func(f zapcore.Field) bool { return f.Type == zapcore.ErrorType })
+	if i < 0 {
+		return e.Encoder.EncodeEntry(entry, fields)
+	}
+	modified := make([]zapcore.Field, i, len(fields))
+	copy(modified, fields)
+	for _, f := range fields[i:] {
 		if f.Type == zapcore.ErrorType {
 			if err, ok := f.Interface.(error); ok {
 				modified = append(modified, zap.String(f.Key, err.Error()))
@@ -163,34 +536,79 @@ func (e *exportEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field)
 	return e.Encoder.EncodeEntry(entry, modified)
 }
 
-// --- Formatting helpers ---
+// --- Encoding selection ---
 
+// Encodings for custom writers.
 const (
-	ansiReset   = "\033[0m"
-	ansiBoldRed = "\033[1;31m"
-	ansiDim     = "\033[2m"
+	// EncodingConsole is the human-readable console format with ANSI colors.
+	EncodingConsole = "console"
+	// EncodingPlain is the console format without colors, suited for assertions.
+	EncodingPlain = "plain"
+	// EncodingJSON is the export JSON format.
+	EncodingJSON = "json"
+	// EncodingMsgpack is the export format as one MessagePack map per entry,
+	// for smaller exports. Convert it back with NewMsgpackReader.
+	EncodingMsgpack = "msgpack"
 )
 
-func colorizeVerbose(verbose string) string {
-	lines := strings.Split(verbose, "\n")
-	var b strings.Builder
-	b.Grow(len(verbose) + len(lines)*16)
+var (
+	encodersMu sync.RWMutex
+	encoders   = make(map[string]func(Config) zapcore.Encoder)
+)
 
-	for i, line := range lines {
-		if i > 0 {
-			b.WriteByte('\n')
-		}
-		switch {
-		case i == 0 || strings.HasPrefix(line, "  - "):
-			b.WriteString(ansiBoldRed)
-			b.WriteString(line)
-			b.WriteString(ansiReset)
-		default:
-			b.WriteString(ansiDim)
-			b.WriteString(line)
-			b.WriteString(ansiReset)
-		}
+// RegisterEncoder makes a custom encoder, e.g. for protobuf, msgpack or CBOR
+// log records, available under name wherever an encoding is configured:
+// StdoutEncoding, WriterEncoding and WriterSpec.Encoding. factory is called
+// with the logger's Config for every sink that uses the encoding. Register
+// encoders before creating loggers. RegisterEncoder panics if name is empty,
+// a built-in encoding or already registered, or if factory is nil.
+func RegisterEncoder(name string, factory func(Config) zapcore.Encoder) {
+	if factory == nil {
+		panic("zapang: RegisterEncoder factory is nil")
+	}
+	switch name {
+	case "", EncodingConsole, EncodingPlain, EncodingJSON, EncodingMsgpack:
+		panic("zapang: RegisterEncoder called with reserved name " + strconv.Quote(name))
 	}
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	if _, dup := encoders[name]; dup {
+		panic("zapang: RegisterEncoder called twice for " + strconv.Quote(name))
+	}
+	encoders[name] = factory
+}
 
-	return b.String()
+// encodingNames returns the built-in and registered encoding names.
+func encodingNames() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	names := []string{EncodingConsole, EncodingPlain, EncodingJSON, EncodingMsgpack}
+	return append(names, slices.Sorted(maps.Keys(encoders))...)
 }
+
+// newEncoder returns the encoder for the named encoding, defaulting to console.
+func newEncoder(encoding string, cfg Config) zapcore.Encoder {
+	var enc zapcore.Encoder
+	switch encoding {
+	case EncodingPlain:
+		enc = newPlainEncoder(cfg)
+	case EncodingJSON:
+		enc = newExportEncoder(zapcore.NewJSONEncoder(jsonEncoderConfig(cfg)))
+	case EncodingMsgpack:
+		enc = newMsgpackEncoder(cfg)
+	default:
+		encodersMu.RLock()
+		factory := encoders[encoding]
+		encodersMu.RUnlock()
+		if factory != nil {
+			enc = factory(cfg)
+		} else {
+			enc = newConsoleEncoder(cfg)
+		}
+	}
+	return newLimitEncoder(enc, cfg)
+}
+
+// --- Formatting helpers ---
+
+const ansiReset = "\033[0m"
@@ -0,0 +1,152 @@
+package zapang
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// EncryptionKey is an AES key (16, 24 or 32 bytes) with an ID recorded next to
+// every entry it encrypts, so exports written across key rotations can be read back.
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// EncryptingWriteSyncer encrypts each write, usually one entry, with AES-GCM
+// before passing it on. Every write becomes one line:
+// "<key id>:<base64(nonce|ciphertext)>". The bytes are sealed as written, so
+// binary writes such as gzip members round-trip too. Use DecryptExport to
+// read such a stream back.
+type EncryptingWriteSyncer struct {
+	next zapcore.WriteSyncer
+
+	mu   sync.RWMutex
+	id   string
+	aead cipher.AEAD
+}
+
+// NewEncryptingWriteSyncer returns a WriteSyncer that encrypts entries with key.
+func NewEncryptingWriteSyncer(next zapcore.WriteSyncer, key EncryptionKey) (*EncryptingWriteSyncer, error) {
+	e := &EncryptingWriteSyncer{next: next}
+	return e, e.Rotate(key)
+}
+
+// RotateExportKey switches the export encryption of log, set with
+// Config.ExportEncryption, to key for subsequent entries. Earlier entries stay
+// readable with the previous key. log must derive from a logger built by New.
+func RotateExportKey(log *zap.Logger, key EncryptionKey) error {
+	live := liveOf(log)
+	if live == nil || live.exportKey == nil {
+		return errors.New("zapang: logger has no export encryption")
+	}
+	return live.exportKey.Rotate(key)
+}
+
+// Rotate switches to key for subsequent entries. Earlier entries stay readable
+// with the previous key.
+func (e *EncryptingWriteSyncer) Rotate(key EncryptionKey) error {
+	if key.ID == "" || strings.ContainsAny(key.ID, ":\n") {
+		return fmt.Errorf("zapang: invalid encryption key id %q", key.ID)
+	}
+	aead, err := newAEAD(key.Key)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.id, e.aead = key.ID, aead
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *EncryptingWriteSyncer) Write(p []byte) (int, error) {
+	e.mu.RLock()
+	id, aead := e.id, e.aead
+	e.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(p)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	sealed := aead.Seal(nonce, nonce, p, []byte(id))
+
+	line := make([]byte, 0, len(id)+1+base64.StdEncoding.EncodedLen(len(sealed))+1)
+	line = append(line, id...)
+	line = append(line, ':')
+	line = base64.StdEncoding.AppendEncode(line, sealed)
+	line = append(line, '\n')
+	if _, err := e.next.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *EncryptingWriteSyncer) Sync() error {
+	return e.next.Sync()
+}
+
+// DecryptExport reads a stream written by EncryptingWriteSyncer and writes the
+// plaintext to w as it was written: JSON entries one per line, or the gzip
+// stream of a compressed export. keys maps key IDs to AES keys and must
+// contain every key the stream was written with.
+func DecryptExport(r io.Reader, w io.Writer, keys map[string][]byte) error {
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return fmt.Errorf("zapang: key %q: %w", id, err)
+		}
+		aeads[id] = aead
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		id, payload, ok := bytes.Cut(line, []byte{':'})
+		if !ok {
+			return fmt.Errorf("zapang: line %d: missing key id", n)
+		}
+		aead, ok := aeads[string(id)]
+		if !ok {
+			return fmt.Errorf("zapang: line %d: unknown key %q", n, id)
+		}
+		sealed, err := base64.StdEncoding.AppendDecode(nil, payload)
+		if err != nil {
+			return fmt.Errorf("zapang: line %d: %w", n, err)
+		}
+		if len(sealed) < aead.NonceSize() {
+			return fmt.Errorf("zapang: line %d: truncated entry", n)
+		}
+		plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], id)
+		if err != nil {
+			return fmt.Errorf("zapang: line %d: %w", n, err)
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,71 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestEncryptedExportRoundTrip(t *testing.T) {
+	oldKey := EncryptionKey{ID: "2024-01", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := EncryptionKey{ID: "2024-02", Key: bytes.Repeat([]byte{2}, 32)}
+
+	var stream bytes.Buffer
+	enc, err := NewEncryptingWriteSyncer(zapcore.AddSync(&stream), oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = enc.Write([]byte(`{"message":"before"}` + "\n"))
+	if err := enc.Rotate(newKey); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = enc.Write([]byte(`{"message":"after"}` + "\n"))
+
+	if strings.Contains(stream.String(), "before") || !strings.HasPrefix(stream.String(), "2024-01:") {
+		t.Fatalf("stream not encrypted: %q", stream.String())
+	}
+
+	var plain bytes.Buffer
+	keys := map[string][]byte{oldKey.ID: oldKey.Key, newKey.ID: newKey.Key}
+	if err := DecryptExport(bytes.NewReader(stream.Bytes()), &plain, keys); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"message":"before"}` + "\n" + `{"message":"after"}` + "\n"; plain.String() != want {
+		t.Fatalf("got %q, want %q", plain.String(), want)
+	}
+
+	delete(keys, oldKey.ID)
+	if err := DecryptExport(bytes.NewReader(stream.Bytes()), &plain, keys); err == nil {
+		t.Fatal("expected an error for a missing key")
+	}
+}
+
+func TestRotateExportKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	oldKey := EncryptionKey{ID: "2024-01", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := EncryptionKey{ID: "2024-02", Key: bytes.Repeat([]byte{2}, 32)}
+
+	var stream bytes.Buffer
+	l := New(ctx, "svc", Config{ConsoleLevel: "fatal", ExportWriter: &stream, ExportEncryption: &oldKey}, io.Discard)
+	l.Info("before")
+	if err := RotateExportKey(l.With(UserID("u1")), newKey); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after")
+
+	lines := strings.Split(strings.TrimSpace(stream.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "2024-01:") || !strings.HasPrefix(lines[1], "2024-02:") {
+		t.Fatalf("expected one entry per key, got %q", stream.String())
+	}
+
+	plain := New(ctx, "svc", Config{ConsoleLevel: "fatal"}, io.Discard)
+	if err := RotateExportKey(plain, newKey); err == nil {
+		t.Fatal("expected an error for a logger without export encryption")
+	}
+}
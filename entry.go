@@ -0,0 +1,144 @@
+package zapang
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Entry is a log entry decoded from the JSON export format.
+type Entry struct {
+	Level      zapcore.Level
+	Time       time.Time
+	Logger     string
+	Caller     string
+	Function   string
+	Message    string
+	Stacktrace string
+
+	// Fields holds all remaining keys. Numbers are decoded as json.Number.
+	Fields map[string]any
+}
+
+// ParseEntry decodes a single line of the JSON export format.
+func ParseEntry(data []byte) (Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return Entry{}, fmt.Errorf("zapang: parse entry: %w", err)
+	}
+
+	ec := jsonEncoderConfig(Config{})
+	var e Entry
+	take := func(key string) string {
+		v, _ := raw[key].(string)
+		delete(raw, key)
+		return v
+	}
+
+	if lvl := take(ec.LevelKey); lvl != "" {
+		if err := e.Level.UnmarshalText([]byte(lvl)); err != nil {
+			return Entry{}, fmt.Errorf("zapang: parse entry: %w", err)
+		}
+	}
+	if n, ok := raw[ec.TimeKey].(json.Number); ok {
+		delete(raw, ec.TimeKey)
+		t, err := parseEpoch(n)
+		if err != nil {
+			return Entry{}, fmt.Errorf("zapang: parse entry: %w", err)
+		}
+		e.Time = t
+	} else if ts := take(ec.TimeKey); ts != "" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return Entry{}, fmt.Errorf("zapang: parse entry: %w", err)
+		}
+		e.Time = t
+	}
+	e.Logger = take(ec.NameKey)
+	e.Caller = take(ec.CallerKey)
+	e.Function = take(ec.FunctionKey)
+	e.Message = take(ec.MessageKey)
+	e.Stacktrace = take(ec.StacktraceKey)
+	e.Fields = raw
+
+	return e, nil
+}
+
+// parseEpoch decodes a numeric timestamp written by the epoch, epoch_millis or
+// epoch_nanos time formats, telling the unit apart by magnitude.
+func parseEpoch(n json.Number) (time.Time, error) {
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case f < 1e11:
+		return time.Unix(0, int64(f*1e9)), nil
+	case f < 1e14:
+		return time.Unix(0, int64(f*1e6)), nil
+	default:
+		// Integer nanoseconds do not survive a float64 round trip.
+		ns, err := n.Int64()
+		if err != nil {
+			return time.Unix(0, int64(f)), nil
+		}
+		return time.Unix(0, ns), nil
+	}
+}
+
+// EntryReader reads entries from a stream in the JSON export format,
+// one entry per line. Blank lines are skipped.
+type EntryReader struct {
+	scanner *bufio.Scanner
+	entry   Entry
+	err     error
+	line    int
+}
+
+// NewEntryReader returns a reader over r. Lines up to 16MB are supported.
+func NewEntryReader(r io.Reader) *EntryReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &EntryReader{scanner: s}
+}
+
+// Next advances to the next entry. It returns false at the end of the stream
+// or on the first error, which is then available from Err.
+func (r *EntryReader) Next() bool {
+	for r.err == nil && r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		e, err := ParseEntry(line)
+		if err != nil {
+			r.err = fmt.Errorf("line %d: %w", r.line, err)
+			return false
+		}
+		r.entry = e
+		return true
+	}
+	if r.err == nil {
+		r.err = r.scanner.Err()
+	}
+	return false
+}
+
+// Entry returns the entry read by the last call to Next.
+func (r *EntryReader) Entry() Entry {
+	return r.entry
+}
+
+// Err returns the first error encountered, or nil at a clean end of stream.
+func (r *EntryReader) Err() error {
+	return r.err
+}
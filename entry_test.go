@@ -0,0 +1,148 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestEntryRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	l, _ := NewWithLevel(ctx, "serviceName", Config{Level: "debug", ExportWriter: &buf}, nil)
+	l.Warn("first", UserID("u1"), StatusCode(404))
+	l.Info("second")
+	_ = l.Sync()
+
+	r := NewEntryReader(&buf)
+	var got []Entry
+	for r.Next() {
+		got = append(got, r.Entry())
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	first := got[0]
+	if first.Level != zapcore.WarnLevel || first.Message != "first" || first.Time.IsZero() || first.Caller == "" {
+		t.Fatalf("unexpected entry: %+v", first)
+	}
+	if first.Fields["user_id"] != "u1" || first.Fields["http_status"] != json.Number("404") || first.Fields["service"] != "serviceName" {
+		t.Fatalf("unexpected fields: %v", first.Fields)
+	}
+}
+
+func TestMsgpackExport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var js, mp bytes.Buffer
+	for out, encoding := range map[*bytes.Buffer]string{&js: "", &mp: EncodingMsgpack} {
+		l := New(ctx, "serviceName", Config{
+			Clock:          FixedClock(now),
+			DisableCaller:  true,
+			ExportWriter:   out,
+			ExportEncoding: encoding,
+		}, nil)
+		l.Warn("first", UserID("ü1\t\"x\""), StatusCode(404), zap.Int64("big", -1<<40), zap.Uint64("huge", 1<<63))
+		l.Info("second", zap.Float64("ratio", 0.25), zap.Bools("flags", []bool{true, false}), HTTPGroup("GET", "/", 200, time.Millisecond))
+		l.Error("third", zap.Error(errors.New("boom")), zap.Binary("raw", []byte{0, 1}))
+		_ = l.Sync()
+	}
+
+	if mp.Len() >= js.Len() {
+		t.Fatalf("msgpack export (%d bytes) is not smaller than JSON (%d bytes)", mp.Len(), js.Len())
+	}
+	converted, err := io.ReadAll(NewMsgpackReader(&mp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(converted) != js.String() {
+		t.Fatalf("msgpack export does not convert back to the JSON export:\n%s\nwant:\n%s", converted, js.String())
+	}
+
+	if _, err := io.ReadAll(NewMsgpackReader(strings.NewReader("\x81\x01\x02"))); err == nil {
+		t.Fatal("expected an error for a map with a non-string key")
+	}
+}
+
+func TestCheckContracts(t *testing.T) {
+	entries := []Entry{
+		{Message: "order placed", Fields: map[string]any{
+			"user_id": json.Number("42"),
+			"http":    map[string]any{"status": json.Number("201")},
+		}},
+	}
+
+	violations := CheckContracts(entries,
+		Contract{Message: "order placed", Fields: []FieldExpectation{
+			{Key: "user_id", Type: TypeString},
+			{Key: "http.status", Type: TypeNumber},
+			{Key: "order_id"},
+			{Key: "coupon", Optional: true},
+		}},
+		Contract{Message: "order shipped"},
+	)
+
+	if len(violations) != 3 {
+		t.Fatalf("expected 3 violations, got %v", violations)
+	}
+	if violations[0].Key != "user_id" || violations[1].Key != "order_id" || violations[2].Message != "order shipped" {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+}
+
+func TestQueryEntries(t *testing.T) {
+	export := strings.Join([]string{
+		`{"level":"debug","timestamp":"2024-03-01T12:00:00Z","message":"cache miss","user_id":"u1"}`,
+		`{"level":"warn","timestamp":"2024-03-01T12:00:01Z","logger":"billing","message":"charge retried","user_id":"u1","http":{"status":502}}`,
+		`{"level":"error","timestamp":"2024-03-01T12:00:02Z","logger":"billing","message":"charge failed","user_id":"u2"}`,
+		`{"level":"error","timestamp":"2024-03-01T12:00:03Z","message":"shutdown","user_id":"u1"}`,
+	}, "\n")
+	ts := func(sec int) time.Time { return time.Date(2024, 3, 1, 12, 0, sec, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		q    EntryQuery
+		want []string
+	}{
+		{"all", EntryQuery{}, []string{"cache miss", "charge retried", "charge failed", "shutdown"}},
+		{"level", EntryQuery{MinLevel: "warn"}, []string{"charge retried", "charge failed", "shutdown"}},
+		{"field", EntryQuery{Fields: map[string]any{"user_id": "u1"}, MinLevel: "info"}, []string{"charge retried", "shutdown"}},
+		{"nested number", EntryQuery{Fields: map[string]any{"http.status": 502}}, []string{"charge retried"}},
+		{"has field", EntryQuery{HasFields: []string{"http"}}, []string{"charge retried"}},
+		{"logger and message", EntryQuery{Logger: "billing", MessageContains: "fail"}, []string{"charge failed"}},
+		{"time range", EntryQuery{Since: ts(1), Until: ts(3)}, []string{"charge retried", "charge failed"}},
+	}
+	for _, tt := range tests {
+		entries, err := QueryEntries(strings.NewReader(export), tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Message)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := QueryEntries(strings.NewReader("{not json"), EntryQuery{}); err == nil {
+		t.Error("malformed input should be an error")
+	}
+}
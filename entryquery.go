@@ -0,0 +1,107 @@
+package zapang
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// EntryQuery selects entries decoded from the JSON export format, for
+// integration tests and local tooling. Zero criteria match every entry.
+type EntryQuery struct {
+	// MinLevel selects entries at or above a level: debug, info, warn, error,
+	// dpanic, panic or fatal. Empty matches all levels.
+	MinLevel string
+
+	// Message selects entries with exactly this message.
+	Message string
+
+	// MessageContains selects entries whose message contains the substring.
+	MessageContains string
+
+	// Logger selects entries of a named logger.
+	Logger string
+
+	// Fields selects entries whose fields have these values. Dotted keys
+	// ("http.status") also match nested objects. Values are compared by their
+	// string form, so 404 matches the decoded number 404.
+	Fields map[string]any
+
+	// HasFields selects entries that carry these keys, whatever their value.
+	HasFields []string
+
+	// Since and Until bound the entry time: Since is inclusive, Until
+	// exclusive. Zero values leave the range open.
+	Since, Until time.Time
+}
+
+// Match reports whether e satisfies every criterion of q.
+func (q EntryQuery) Match(e Entry) bool {
+	if q.MinLevel != "" && e.Level < parseLevel(q.MinLevel) {
+		return false
+	}
+	if q.Message != "" && e.Message != q.Message {
+		return false
+	}
+	if q.MessageContains != "" && !strings.Contains(e.Message, q.MessageContains) {
+		return false
+	}
+	if q.Logger != "" && e.Logger != q.Logger {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	for _, key := range q.HasFields {
+		if _, ok := e.Field(key); !ok {
+			return false
+		}
+	}
+	for key, want := range q.Fields {
+		got, ok := e.Field(key)
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the entries matching q, in order.
+func (q EntryQuery) Filter(entries []Entry) []Entry {
+	var matched []Entry
+	for _, e := range entries {
+		if q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// QueryEntries reads the JSON export format from r, such as an export file
+// or a buffer passed as ExportWriter, and returns the entries matching q:
+//
+//	errs, err := zapang.QueryEntries(f, zapang.EntryQuery{
+//		MinLevel: "error",
+//		Fields:   map[string]any{"user_id": "u1"},
+//		Since:    start,
+//	})
+func QueryEntries(r io.Reader, q EntryQuery) ([]Entry, error) {
+	var matched []Entry
+	er := NewEntryReader(r)
+	for er.Next() {
+		if e := er.Entry(); q.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, er.Err()
+}
+
+// Field returns the value of a field of e. Dotted keys ("http.status") also
+// match nested objects.
+func (e Entry) Field(key string) (any, bool) {
+	return lookupField(e.Fields, key)
+}
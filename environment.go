@@ -0,0 +1,71 @@
+package zapang
+
+import "sync"
+
+// EnvironmentPreset holds the defaults an Environment applies. Preset values
+// only fill Config fields that are left empty.
+type EnvironmentPreset struct {
+	// Export enables JSON export to Config.ExportPath (or the preset's ExportPath).
+	Export bool
+
+	// ExportPath is the default export path.
+	ExportPath string
+
+	// Level is the default minimum level.
+	Level string
+
+	// StdoutEncoding is the default stdout encoding: console, plain or json.
+	StdoutEncoding string
+
+	// ConsoleErrors is the default console rendering of Error entries: line or report.
+	ConsoleErrors string
+
+	// Sampling is the default sampling policy.
+	Sampling *SamplingConfig
+}
+
+var (
+	environmentsMu sync.RWMutex
+	environments   = map[string]EnvironmentPreset{
+		EnvLocal: {ConsoleErrors: ConsoleErrorsReport},
+		EnvDev:   {Export: true},
+		EnvProd:  {Export: true},
+	}
+)
+
+// RegisterEnvironment adds or replaces the preset for an environment name,
+// e.g. "staging" or "ci". The built-in local, dev and prod environments can be
+// overridden too. Register presets before creating loggers.
+func RegisterEnvironment(name string, preset EnvironmentPreset) {
+	environmentsMu.Lock()
+	environments[name] = preset
+	environmentsMu.Unlock()
+}
+
+// applyEnvironment fills cfg from its environment's preset and reports whether
+// the environment exports JSON via ExportPath. Unknown environments have no
+// defaults and do not export.
+func applyEnvironment(cfg Config) (Config, bool) {
+	environmentsMu.RLock()
+	preset, ok := environments[cfg.Environment]
+	environmentsMu.RUnlock()
+	if !ok {
+		return cfg, false
+	}
+	if cfg.ExportPath == "" {
+		cfg.ExportPath = preset.ExportPath
+	}
+	if cfg.Level == "" {
+		cfg.Level = preset.Level
+	}
+	if cfg.StdoutEncoding == "" {
+		cfg.StdoutEncoding = preset.StdoutEncoding
+	}
+	if cfg.ConsoleErrors == "" {
+		cfg.ConsoleErrors = preset.ConsoleErrors
+	}
+	if cfg.Sampling == nil {
+		cfg.Sampling = preset.Sampling
+	}
+	return cfg, preset.Export
+}
@@ -0,0 +1,182 @@
+package zapang
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorRateConfig configures the aggregated error-rate summary.
+type ErrorRateConfig struct {
+	// Interval is the summary window. Default: 1m.
+	Interval time.Duration `yaml:"interval" json:"interval" mapstructure:"interval"`
+
+	// MaxPerKey caps the Error entries written per component and error_code in
+	// each window; the rest are only counted. Zero writes every entry. DPanic
+	// and higher are never suppressed.
+	MaxPerKey uint64 `yaml:"max_per_key" json:"max_per_key" mapstructure:"max_per_key"`
+}
+
+// errorRateKey groups errors by their "component" and "error_code" fields.
+type errorRateKey struct {
+	component string
+	code      string
+}
+
+type errorRateCount struct {
+	count      uint64
+	suppressed uint64
+}
+
+// errorRate counts Error+ entries per key over the current window.
+type errorRate struct {
+	maxPerKey uint64
+
+	mu     sync.Mutex
+	counts map[errorRateKey]*errorRateCount
+}
+
+// record counts an entry and reports whether it may be written.
+func (r *errorRate) record(key errorRateKey, lvl zapcore.Level) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.counts[key]
+	if c == nil {
+		c = &errorRateCount{}
+		r.counts[key] = c
+	}
+	c.count++
+	if r.maxPerKey > 0 && lvl == zapcore.ErrorLevel && c.count > r.maxPerKey {
+		c.suppressed++
+		return false
+	}
+	return true
+}
+
+// reset returns the counts of the window that just ended and starts a new one.
+func (r *errorRate) reset() map[errorRateKey]*errorRateCount {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := r.counts
+	r.counts = make(map[errorRateKey]*errorRateCount)
+	return counts
+}
+
+// errorRateCore counts the Error+ entries of its core and drops those beyond
+// the per-key cap. Entries are checked against the core at write time, once
+// their fields are known.
+type errorRateCore struct {
+	zapcore.Core
+	rate *errorRate
+	key  errorRateKey
+}
+
+func newErrorRateCore(core zapcore.Core, rate *errorRate) *errorRateCore {
+	return &errorRateCore{Core: core, rate: rate}
+}
+
+func (c *errorRateCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorRateCore{Core: c.Core.With(fields), rate: c.rate, key: c.key.with(fields)}
+}
+
+func (c *errorRateCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < zapcore.ErrorLevel {
+		return c.Core.Check(ent, ce)
+	}
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *errorRateCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	key := c.key.with(fields)
+	if key.component == "" {
+		key.component = "unknown"
+	}
+	if !c.rate.record(key, ent.Level) {
+		return nil
+	}
+	if ce := c.Core.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+	return nil
+}
+
+// with returns k updated from the component and error_code fields.
+func (k errorRateKey) with(fields []zapcore.Field) errorRateKey {
+	for _, f := range fields {
+		if f.Type != zapcore.StringType {
+			continue
+		}
+		switch f.Key {
+		case "component":
+			k.component = f.String
+		case "error_code":
+			k.code = f.String
+		}
+	}
+	return k
+}
+
+// runErrorRate logs an "error rate" summary every Interval until ctx is done:
+// the window's Error+ entries in total and per component and error_code.
+// The summary is Warn when entries were suppressed and Info otherwise.
+func runErrorRate(ctx context.Context, log *zap.Logger, rate *errorRate, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	log = log.WithOptions(zap.WithCaller(false))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		counts := rate.reset()
+		keys := slices.SortedFunc(maps.Keys(counts), func(a, b errorRateKey) int {
+			return cmp.Or(cmp.Compare(a.component, b.component), cmp.Compare(a.code, b.code))
+		})
+		var total, suppressed uint64
+		for _, c := range counts {
+			total += c.count
+			suppressed += c.suppressed
+		}
+
+		logf := log.Info
+		if suppressed > 0 {
+			logf = log.Warn
+		}
+		logf("error rate",
+			zap.Uint64("errors", total),
+			zap.Uint64("suppressed", suppressed),
+			zap.Duration("window", interval),
+			zap.Array("error_counts", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+				for _, k := range keys {
+					c := counts[k]
+					_ = enc.AppendObject(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+						enc.AddString("component", k.component)
+						if k.code != "" {
+							enc.AddString("error_code", k.code)
+						}
+						enc.AddUint64("count", c.count)
+						if c.suppressed > 0 {
+							enc.AddUint64("suppressed", c.suppressed)
+						}
+						return nil
+					}))
+				}
+				return nil
+			})),
+		)
+	}
+}
@@ -0,0 +1,205 @@
+package zapang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Console renderings of Error and higher entries, for Config.ConsoleErrors.
+const (
+	// ConsoleErrorsLine renders errors as one line, like other entries.
+	ConsoleErrorsLine = "line"
+	// ConsoleErrorsReport renders errors as multi-line error reports.
+	ConsoleErrorsReport = "report"
+)
+
+// reportWidth is the width of error report dividers.
+const reportWidth = 72
+
+// reportTrimmer trims error report stacks to application frames.
+var reportTrimmer = newStackTrimmer(StacktraceTrimConfig{MaxDepth: 16})
+
+// namedError is an error field of an entry.
+type namedError struct {
+	key string
+	err error
+}
+
+// encodeReport renders an entry as an error report:
+//
+//	=== ERROR ==============================================================
+//	2024-05-01T12:00:00.000Z	ERROR	billing/charge.go:42	charge failed
+//	error:
+//	  - charge order 42 (*fmt.wrapError)
+//	  - card declined (*billing.DeclineError)
+//	fields:
+//	  order_id  42
+//	  user      bob
+//	stack:
+//	  billing.Charge
+//	  	./billing/charge.go:42
+//	========================================================================
+//
+// Error fields are shown as their Unwrap chain, each layer with its own part
+// of the message, and left out of the field table. Without an entry stack, a
+// verbose error (%+v differing from the message) is shown as its detail.
+func (e *consoleEncoder) encodeReport(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	verbose := e.verbose
+	e.verbose = ""
+
+	var errs []namedError
+	rest := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		if isStepDepth(f) {
+			continue
+		}
+		if f.Type == zapcore.ErrorType {
+			if err, ok := f.Interface.(error); ok {
+				errs = append(errs, namedError{key: f.Key, err: err})
+				if v := fmt.Sprintf("%+v", err); v != err.Error() {
+					verbose = v
+				}
+				continue
+			}
+		}
+		rest = append(rest, f)
+	}
+
+	js, err := e.Encoder.EncodeEntry(zapcore.Entry{}, rest)
+	if err != nil {
+		return nil, err
+	}
+	defer js.Free()
+
+	s := consoleScratchPool.Get().(*consoleScratch)
+	defer consoleScratchPool.Put(s)
+
+	var levelStyle, messageStyle, stackStyle string
+	if !e.plain {
+		levelStyle = e.theme.Levels[entry.Level.String()]
+		messageStyle, stackStyle = e.theme.ErrorMessage, e.theme.ErrorStack
+	}
+
+	line := consoleBufferPool.Get()
+	label := "=== " + entry.Level.CapitalString() + " "
+	line.AppendString(paint(levelStyle, label+strings.Repeat("=", max(reportWidth-len(label), 3))))
+	line.AppendByte('\n')
+	e.writePrefix(line, entry, s)
+	if line.Len() > 0 {
+		line.AppendByte('\t')
+	}
+	line.AppendString(entry.Message)
+	line.AppendByte('\n')
+
+	for _, ne := range errs {
+		line.AppendString(ne.key)
+		line.AppendString(":\n")
+		writeErrorChain(line, ne.err, 1, messageStyle)
+	}
+
+	if obj := bytes.TrimRight(js.Bytes(), "\n"); len(obj) > 2 {
+		line.AppendString("fields:\n")
+		s.writeFieldTable(line, obj, e.durations)
+	}
+
+	switch {
+	case entry.Stack != "" && e.cfg.StacktraceKey != "":
+		line.AppendString("stack:\n")
+		writeIndented(line, reportTrimmer.trim(entry.Stack), stackStyle)
+	case verbose != "":
+		line.AppendString("detail:\n")
+		detail := verbose
+		if !e.plain {
+			detail = e.theme.colorizeVerbose(verbose)
+		}
+		writeIndented(line, detail, "")
+	}
+
+	line.AppendString(paint(levelStyle, strings.Repeat("=", reportWidth)))
+	line.AppendByte('\n')
+	return line, nil
+}
+
+// writeErrorChain writes err and the errors it wraps as a list, one layer per
+// line with its type. The branches of joined errors are indented a level.
+func writeErrorChain(line *buffer.Buffer, err error, depth int, style string) {
+	msg := err.Error()
+	var causes []error
+	switch u := err.(type) {
+	case interface{ Unwrap() []error }:
+		causes = u.Unwrap()
+	default:
+		if cause := errors.Unwrap(err); cause != nil {
+			causes = []error{cause}
+		}
+	}
+	if len(causes) == 1 {
+		msg = strings.TrimSuffix(msg, ": "+causes[0].Error())
+	}
+
+	line.AppendString(strings.Repeat("  ", depth))
+	line.AppendString("- ")
+	if len(causes) > 1 {
+		line.AppendString(paint(style, fmt.Sprintf("%d errors", len(causes))))
+	} else {
+		line.AppendString(paint(style, msg))
+	}
+	fmt.Fprintf(line, " (%T)\n", err)
+
+	for _, cause := range causes {
+		next := depth
+		if len(causes) > 1 {
+			next++
+		}
+		writeErrorChain(line, cause, next, style)
+	}
+}
+
+// writeFieldTable writes the fields of the JSON object obj to line as an
+// indented two-column table sorted by key, the last value of a repeated key
+// winning. If obj cannot be parsed it is written as is.
+func (s *consoleScratch) writeFieldTable(line *buffer.Buffer, obj []byte, durations bool) {
+	fields, ok := scanJSONObject(obj, s.fields[:0])
+	s.fields = fields[:0]
+	if !ok {
+		line.AppendString("  ")
+		line.Write(obj)
+		line.AppendByte('\n')
+		return
+	}
+
+	slices.SortStableFunc(fields, func(a, b consoleField) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f.key))
+	}
+	for i, f := range fields {
+		if i+1 < len(fields) && bytes.Equal(f.key, fields[i+1].key) {
+			continue // a later value wins
+		}
+		line.AppendString("  ")
+		line.Write(f.key)
+		line.AppendString(strings.Repeat(" ", width-len(f.key)+2))
+		s.value = appendConsoleField(s.value[:0], f.key, f.val, durations)
+		line.Write(s.value)
+		line.AppendByte('\n')
+	}
+	clear(fields)
+}
+
+// writeIndented writes text to line with every line indented, styled.
+func writeIndented(line *buffer.Buffer, text, style string) {
+	for l := range strings.Lines(text) {
+		line.AppendString("  ")
+		line.AppendString(paint(style, strings.TrimRight(l, "\n")))
+		line.AppendByte('\n')
+	}
+}
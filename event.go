@@ -0,0 +1,118 @@
+package zapang
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type eventKey struct{}
+
+// Event accumulates fields and emits them as one canonical log line.
+// Methods are safe for concurrent use and return the event for chaining.
+type Event struct {
+	name string
+
+	mu     sync.Mutex
+	fields []zap.Field
+	err    error
+}
+
+// NewEvent starts a canonical event. The name becomes the entry message.
+func NewEvent(name string) *Event {
+	return &Event{name: name}
+}
+
+// ContextWithEvent returns a new context carrying the event.
+func ContextWithEvent(ctx context.Context, e *Event) context.Context {
+	return context.WithValue(ctx, eventKey{}, e)
+}
+
+// EventFromContext returns the event attached to ctx (by HTTPMiddleware with
+// WithCanonicalEvent), or a new detached event if there is none.
+func EventFromContext(ctx context.Context) *Event {
+	if e, ok := ctx.Value(eventKey{}).(*Event); ok {
+		return e
+	}
+	return NewEvent("event")
+}
+
+// Field appends arbitrary fields.
+func (e *Event) Field(fields ...zap.Field) *Event {
+	e.mu.Lock()
+	e.fields = append(e.fields, fields...)
+	e.mu.Unlock()
+	return e
+}
+
+// Str appends a string field.
+func (e *Event) Str(key, val string) *Event {
+	return e.Field(zap.String(key, val))
+}
+
+// Int appends an int field.
+func (e *Event) Int(key string, val int) *Event {
+	return e.Field(zap.Int(key, val))
+}
+
+// Int64 appends an int64 field.
+func (e *Event) Int64(key string, val int64) *Event {
+	return e.Field(zap.Int64(key, val))
+}
+
+// Float appends a float64 field.
+func (e *Event) Float(key string, val float64) *Event {
+	return e.Field(zap.Float64(key, val))
+}
+
+// Bool appends a bool field.
+func (e *Event) Bool(key string, val bool) *Event {
+	return e.Field(zap.Bool(key, val))
+}
+
+// Dur appends a duration field.
+func (e *Event) Dur(key string, val time.Duration) *Event {
+	return e.Field(zap.Duration(key, val))
+}
+
+// Err records an error; the event is emitted at Error level when set.
+func (e *Event) Err(err error) *Event {
+	e.mu.Lock()
+	e.err = err
+	e.mu.Unlock()
+	return e
+}
+
+// Fields returns a copy of the accumulated fields, including the error if set.
+func (e *Event) Fields() []zap.Field {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fields := make([]zap.Field, len(e.fields), len(e.fields)+1)
+	copy(fields, e.fields)
+	if e.err != nil {
+		fields = append(fields, zap.Error(e.err))
+	}
+	return fields
+}
+
+// level returns Error if an error was recorded, Info otherwise.
+func (e *Event) level() zapcore.Level {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return zapcore.ErrorLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// Emit logs the event through the context logger.
+func (e *Event) Emit(ctx context.Context) {
+	log := WithCallerSkip(FromContext(ctx), 1)
+	if ce := log.Check(e.level(), e.name); ce != nil {
+		ce.Write(e.Fields()...)
+	}
+}
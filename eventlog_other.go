@@ -0,0 +1,13 @@
+//go:build !windows
+
+package zapang
+
+import (
+	"errors"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func openEventLog(string) (zapcore.WriteSyncer, error) {
+	return nil, errors.New("zapang: the Windows Event Log is only available on Windows")
+}
@@ -0,0 +1,73 @@
+package zapang
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	advapi32                 = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSourceW = advapi32.NewProc("RegisterEventSourceW")
+	procReportEventW         = advapi32.NewProc("ReportEventW")
+)
+
+// Event types for ReportEventW.
+const (
+	eventlogErrorType       = 0x0001
+	eventlogWarningType     = 0x0002
+	eventlogInformationType = 0x0004
+)
+
+// eventLogSink writes entries to the Windows Application event log. The event
+// text is the JSON entry, so structured fields stay searchable.
+type eventLogSink struct {
+	handle uintptr
+}
+
+func openEventLog(source string) (zapcore.WriteSyncer, error) {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	h, _, callErr := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return nil, fmt.Errorf("zapang: eventlog: register source %q: %w", source, callErr)
+	}
+	return &eventLogSink{handle: h}, nil
+}
+
+func (s *eventLogSink) Write(p []byte) (int, error) {
+	rec, err := parseNativeRecord(p)
+	if err != nil {
+		return 0, err
+	}
+
+	eventType := uintptr(eventlogInformationType)
+	switch {
+	case rec.level >= zapcore.ErrorLevel:
+		eventType = eventlogErrorType
+	case rec.level == zapcore.WarnLevel:
+		eventType = eventlogWarningType
+	}
+
+	text, err := syscall.UTF16PtrFromString(string(trimNewline(p)))
+	if err != nil {
+		return 0, err
+	}
+	strs := [1]*uint16{text}
+	ok, _, callErr := procReportEventW.Call(
+		s.handle, eventType, 0, 1, 0,
+		1, 0, uintptr(unsafe.Pointer(&strs[0])), 0,
+	)
+	if ok == 0 {
+		return 0, fmt.Errorf("zapang: eventlog: %w", callErr)
+	}
+	return len(p), nil
+}
+
+func (s *eventLogSink) Sync() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package zapang
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.uber.org/zap"
+)
+
+// ContextExtractor derives fields from a context, e.g. a tenant or feature
+// flags stored by upstream middleware. Return nil when ctx carries nothing.
+type ContextExtractor func(ctx context.Context) []zap.Field
+
+// BaggageExtractor adds the given OpenTelemetry baggage members as string
+// fields named after their keys. Missing members are left out.
+func BaggageExtractor(keys ...string) ContextExtractor {
+	return func(ctx context.Context) []zap.Field {
+		bag := baggage.FromContext(ctx)
+		if bag.Len() == 0 {
+			return nil
+		}
+		var fields []zap.Field
+		for _, key := range keys {
+			if m := bag.Member(key); m.Key() != "" {
+				fields = append(fields, zap.String(key, m.Value()))
+			}
+		}
+		return fields
+	}
+}
+
+// ContextKeyExtractor adds ctx.Value(key) as field when it is set.
+func ContextKeyExtractor(key any, field string) ContextExtractor {
+	return func(ctx context.Context) []zap.Field {
+		v := ctx.Value(key)
+		if v == nil {
+			return nil
+		}
+		return []zap.Field{zap.Any(field, v)}
+	}
+}
+
+// extractFields runs the extractors configured for log against ctx.
+func extractFields(ctx context.Context, log *zap.Logger) []zap.Field {
+	cfg := configOf(log)
+	if cfg == nil {
+		return nil
+	}
+	var fields []zap.Field
+	for _, extract := range cfg.ContextExtractors {
+		fields = append(fields, extract(ctx)...)
+	}
+	return fields
+}
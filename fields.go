@@ -2,9 +2,13 @@ package zapang
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Request fields for HTTP request logging.
@@ -20,6 +24,12 @@ func Path(path string) zap.Field {
 	return zap.String("http_path", path)
 }
 
+// HTTPRoute is the route template that served a request, e.g. "/users/{id}",
+// a low-cardinality alternative to Path for indexing and grouping.
+func HTTPRoute(route string) zap.Field {
+	return zap.String("http_route", route)
+}
+
 func StatusCode(code int) zap.Field {
 	return zap.Int("http_status", code)
 }
@@ -32,6 +42,14 @@ func LatencyMs(d time.Duration) zap.Field {
 	return zap.Float64("latency_ms", float64(d.Nanoseconds())/1e6)
 }
 
+// TTFBMs is the time to first byte of a response: until its headers or first
+// bytes were sent.
+func TTFBMs(d time.Duration) zap.Field {
+	return zap.Float64("ttfb_ms", float64(d.Nanoseconds())/1e6)
+}
+
+// ClientIP is the client address. Loggers with Config.AnonymizeClientIP
+// truncate it with AnonymizeIP.
 func ClientIP(ip string) zap.Field {
 	return zap.String("client_ip", ip)
 }
@@ -48,6 +66,22 @@ func ResponseSize(size int) zap.Field {
 	return zap.Int("response_size", size)
 }
 
+// SlowRequest flags a request that exceeded the slow-request threshold.
+func SlowRequest() zap.Field {
+	return zap.Bool("slow_request", true)
+}
+
+// HTTPGroup emits request metadata as a nested "http" object.
+func HTTPGroup(method, path string, status int, latency time.Duration) zap.Field {
+	return zap.Object("http", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("method", method)
+		enc.AddString("path", path)
+		enc.AddInt("status", status)
+		enc.AddFloat64("latency_ms", float64(latency.Nanoseconds())/1e6)
+		return nil
+	}))
+}
+
 // Tracing fields for distributed tracing correlation.
 func TraceID(id string) zap.Field {
 	return zap.String("trace_id", id)
@@ -61,6 +95,20 @@ func ParentSpanID(id string) zap.Field {
 	return zap.String("parent_span_id", id)
 }
 
+func SpanName(name string) zap.Field {
+	return zap.String("span_name", name)
+}
+
+// Mesh nests service mesh headers (Envoy, B3) under a "mesh" object.
+func Mesh(headers map[string]string) zap.Field {
+	return zap.Object("mesh", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		for _, k := range slices.Sorted(maps.Keys(headers)) {
+			enc.AddString(k, headers[k])
+		}
+		return nil
+	}))
+}
+
 // User fields for user context.
 func UserID(id string) zap.Field {
 	return zap.String("user_id", id)
@@ -104,6 +152,34 @@ func RowsAffected(n int64) zap.Field {
 	return zap.Int64("rows_affected", n)
 }
 
+// maxQueryLen caps the logged statement, which may be generated and huge.
+const maxQueryLen = 2048
+
+// DBQuery is the statement text with whitespace collapsed, truncated to 2KB.
+func DBQuery(query string) zap.Field {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxQueryLen {
+		query = truncateUTF8(query, maxQueryLen) + "..."
+	}
+	return zap.String("db_query", query)
+}
+
+// SlowQuery flags a query that exceeded the slow-query threshold.
+func SlowQuery() zap.Field {
+	return zap.Bool("slow_query", true)
+}
+
+// DBGroup emits database operation metadata as a nested "db" object.
+func DBGroup(op, table string, d time.Duration, rows int64) zap.Field {
+	return zap.Object("db", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("operation", op)
+		enc.AddString("table", table)
+		enc.AddDuration("duration", d)
+		enc.AddInt64("rows_affected", rows)
+		return nil
+	}))
+}
+
 // Cache fields for cache operation logging.
 func CacheHit(hit bool) zap.Field {
 	return zap.Bool("cache_hit", hit)
@@ -113,6 +189,11 @@ func CacheKey(key string) zap.Field {
 	return zap.String("cache_key", key)
 }
 
+// RedisCommandName is the Redis command, e.g. "get".
+func RedisCommandName(name string) zap.Field {
+	return zap.String("redis_command", name)
+}
+
 // Queue fields for message queue logging.
 func QueueName(name string) zap.Field {
 	return zap.String("queue_name", name)
@@ -122,6 +203,56 @@ func MessageID(id string) zap.Field {
 	return zap.String("message_id", id)
 }
 
+func Partition(p int32) zap.Field {
+	return zap.Int32("partition", p)
+}
+
+func Offset(o int64) zap.Field {
+	return zap.Int64("offset", o)
+}
+
+func Outcome(outcome string) zap.Field {
+	return zap.String("outcome", outcome)
+}
+
+// Job fields for background job logging.
+func JobName(name string) zap.Field {
+	return zap.String("job_name", name)
+}
+
+func JobID(id string) zap.Field {
+	return zap.String("job_id", id)
+}
+
+func DurationMs(d time.Duration) zap.Field {
+	return zap.Float64("duration_ms", float64(d.Nanoseconds())/1e6)
+}
+
+// Workflow fields for workflow engine (Temporal, Cadence) logging.
+func WorkflowID(id string) zap.Field {
+	return zap.String("workflow_id", id)
+}
+
+func RunID(id string) zap.Field {
+	return zap.String("run_id", id)
+}
+
+func WorkflowType(name string) zap.Field {
+	return zap.String("workflow_type", name)
+}
+
+func ActivityType(name string) zap.Field {
+	return zap.String("activity_type", name)
+}
+
+func ActivityID(id string) zap.Field {
+	return zap.String("activity_id", id)
+}
+
+func Attempt(n int32) zap.Field {
+	return zap.Int32("attempt", n)
+}
+
 // gRPC fields for gRPC request logging.
 func GRPCMethod(method string) zap.Field {
 	return zap.String("grpc_method", method)
@@ -135,6 +266,42 @@ func GRPCCode(code string) zap.Field {
 	return zap.String("grpc_code", code)
 }
 
+// Cloud fields for instance metadata.
+func CloudRegion(region string) zap.Field {
+	return zap.String("cloud_region", region)
+}
+
+func CloudZone(zone string) zap.Field {
+	return zap.String("cloud_zone", zone)
+}
+
+func InstanceID(id string) zap.Field {
+	return zap.String("instance_id", id)
+}
+
+func InstanceType(t string) zap.Field {
+	return zap.String("instance_type", t)
+}
+
+// Container fields for container runtime metadata.
+func ContainerID(id string) zap.Field {
+	return zap.String("container_id", id)
+}
+
+func ContainerImage(image string) zap.Field {
+	return zap.String("container_image", image)
+}
+
+// GRPCGroup emits gRPC call metadata as a nested "grpc" object.
+func GRPCGroup(service, method, code string) zap.Field {
+	return zap.Object("grpc", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("service", service)
+		enc.AddString("method", method)
+		enc.AddString("code", code)
+		return nil
+	}))
+}
+
 // Component identifies the component generating the log.
 func Component(name string) zap.Field {
 	return zap.String("component", name)
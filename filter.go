@@ -0,0 +1,175 @@
+package zapang
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Filter actions.
+const (
+	FilterDeny  = "deny"
+	FilterAllow = "allow"
+)
+
+// FilterRule matches entries by field value.
+//
+// A "deny" rule drops every matching entry. "allow" rules whitelist entries:
+// when at least one allow rule applies to an entry's level, the entry is kept
+// only if it matches one of them.
+type FilterRule struct {
+	// Field is the field key to match, e.g. "http_path".
+	Field string `yaml:"field" json:"field" mapstructure:"field"`
+
+	// Value is the expected field value, compared as a string.
+	Value string `yaml:"value" json:"value" mapstructure:"value"`
+
+	// Action is either "deny" (default) or "allow".
+	Action string `yaml:"action" json:"action" mapstructure:"action"`
+
+	// Level limits the rule to entries at or below this level.
+	// If empty, the rule applies to all levels.
+	Level string `yaml:"level" json:"level" mapstructure:"level"`
+}
+
+type compiledRule struct {
+	field    string
+	value    string
+	allow    bool
+	maxLevel zapcore.Level
+}
+
+func compileFilters(rules []FilterRule) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		maxLevel := zapcore.Level(math.MaxInt8)
+		if r.Level != "" {
+			maxLevel = parseLevel(r.Level)
+		}
+		compiled = append(compiled, compiledRule{
+			field:    r.Field,
+			value:    r.Value,
+			allow:    r.Action == FilterAllow,
+			maxLevel: maxLevel,
+		})
+	}
+	return compiled
+}
+
+// filterCore drops entries according to field-based rules before they reach
+// the sinks' encoders. Rules are shared through liveConfig so they can be
+// replaced at runtime. Entries are checked against the core at write time,
+// once their fields are known.
+type filterCore struct {
+	zapcore.Core
+	live *liveConfig
+	ctx  *filterContext
+}
+
+// filterContext links the fields added with With, so deriving a logger does
+// not copy its parent's fields.
+type filterContext struct {
+	fields []zapcore.Field
+	parent *filterContext
+}
+
+func newFilterCore(core zapcore.Core, live *liveConfig) *filterCore {
+	return &filterCore{Core: core, live: live}
+}
+
+func (c *filterCore) With(fields []zapcore.Field) zapcore.Core {
+	ctx := c.ctx
+	if len(fields) > 0 {
+		ctx = &filterContext{fields: slices.Clone(fields), parent: ctx}
+	}
+	return &filterCore{Core: c.Core.With(fields), live: c.live, ctx: ctx}
+}
+
+func (c *filterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.live.filters.Load() == nil {
+		return c.Core.Check(ent, ce)
+	}
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *filterCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if rules := c.live.filters.Load(); rules != nil && !c.keep(*rules, ent.Level, fields) {
+		return nil
+	}
+	if ce := c.Core.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+	return nil
+}
+
+func (c *filterCore) keep(rules []compiledRule, level zapcore.Level, fields []zapcore.Field) bool {
+	hasAllow, allowed := false, false
+	for _, r := range rules {
+		if level > r.maxLevel {
+			continue
+		}
+		matched := c.match(r, fields)
+		if r.allow {
+			hasAllow = true
+			allowed = allowed || matched
+		} else if matched {
+			return false
+		}
+	}
+	return !hasAllow || allowed
+}
+
+func (c *filterCore) match(r compiledRule, fields []zapcore.Field) bool {
+	for _, f := range fields {
+		if f.Key == r.field && fieldString(f) == r.value {
+			return true
+		}
+	}
+	for ctx := c.ctx; ctx != nil; ctx = ctx.parent {
+		for _, f := range ctx.fields {
+			if f.Key == r.field && fieldString(f) == r.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldString renders a field value as a string for comparison.
+func fieldString(f zapcore.Field) string {
+	switch f.Type {
+	case zapcore.StringType:
+		return f.String
+	case zapcore.BoolType:
+		return strconv.FormatBool(f.Integer == 1)
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		return strconv.FormatInt(f.Integer, 10)
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type, zapcore.UintptrType:
+		return strconv.FormatUint(uint64(f.Integer), 10)
+	case zapcore.Float64Type:
+		return strconv.FormatFloat(math.Float64frombits(uint64(f.Integer)), 'f', -1, 64)
+	case zapcore.Float32Type:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(f.Integer))), 'f', -1, 32)
+	case zapcore.DurationType:
+		return time.Duration(f.Integer).String()
+	case zapcore.StringerType:
+		if s, ok := f.Interface.(fmt.Stringer); ok {
+			return s.String()
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			return err.Error()
+		}
+	}
+	if f.Interface != nil {
+		return fmt.Sprint(f.Interface)
+	}
+	return f.String
+}
@@ -0,0 +1,31 @@
+package zapang
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFilterRules(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	live := newLiveConfig(Config{Filters: []FilterRule{
+		{Field: "http_path", Value: "/healthz", Action: FilterDeny},
+		{Field: "component", Value: "payments", Action: FilterAllow, Level: "debug"},
+	}})
+	l := zap.New(newFilterCore(obs, live))
+
+	l.Info("probe", Path("/healthz"))
+	l.Info("request", Path("/orders"))
+	l.Debug("noise", Component("search"))
+	l.With(Component("payments")).Debug("kept")
+
+	var got []string
+	for _, e := range logs.All() {
+		got = append(got, e.Message)
+	}
+	if len(got) != 2 || got[0] != "request" || got[1] != "kept" {
+		t.Fatalf("unexpected entries: %v", got)
+	}
+}
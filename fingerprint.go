@@ -0,0 +1,106 @@
+package zapang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fingerprintFrames is the number of top stack frames that feed the fingerprint.
+const fingerprintFrames = 3
+
+// ErrorFingerprint returns a stable grouping key for an error logged at a
+// given stack: a hash of the types along its Unwrap chain and the top function
+// names of stack (a zap stacktrace). Messages and line numbers are left out, so
+// identical errors group together across dynamic values and releases.
+func ErrorFingerprint(err error, stack string) string {
+	h := sha256.New()
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		fmt.Fprintf(h, "%T\n", e)
+	}
+	for _, fn := range topFrames(stack, fingerprintFrames) {
+		fmt.Fprintln(h, fn)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// topFrames returns up to n function names from a zap stacktrace, where each
+// frame is a function line followed by a tab-indented file:line.
+func topFrames(stack string, n int) []string {
+	var frames []string
+	for line := range strings.Lines(stack) {
+		if len(frames) == n {
+			break
+		}
+		if line = strings.TrimRight(line, "\n"); line != "" && line[0] != '\t' {
+			frames = append(frames, line)
+		}
+	}
+	return frames
+}
+
+// fingerprintCore adds error_fingerprint to Error and higher entries.
+// err is the first error added with With.
+type fingerprintCore struct {
+	zapcore.Core
+	err error
+}
+
+// applyFingerprint wraps each core with error fingerprinting.
+func applyFingerprint(cores []zapcore.Core) []zapcore.Core {
+	for i, c := range cores {
+		cores[i] = &fingerprintCore{Core: c}
+	}
+	return cores
+}
+
+func (c *fingerprintCore) With(fields []zapcore.Field) zapcore.Core {
+	err := c.err
+	if err == nil {
+		err = firstError(fields)
+	}
+	return &fingerprintCore{Core: c.Core.With(fields), err: err}
+}
+
+func (c *fingerprintCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *fingerprintCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < zapcore.ErrorLevel {
+		return writeChecked(c.Core, ent, fields)
+	}
+	err := firstError(fields)
+	if err == nil {
+		err = c.err
+	}
+	// Without a stacktrace, the logging function stands in for the top frame.
+	stack := ent.Stack
+	if stack == "" {
+		stack = ent.Caller.Function
+	}
+	if err == nil && stack == "" {
+		return writeChecked(c.Core, ent, fields)
+	}
+	return writeChecked(c.Core, ent, append(slices.Clip(fields), zap.String("error_fingerprint", ErrorFingerprint(err, stack))))
+}
+
+func firstError(fields []zapcore.Field) error {
+	for _, f := range fields {
+		if f.Type == zapcore.ErrorType {
+			if err, ok := f.Interface.(error); ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package zapang
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestErrorFingerprint(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	l := zap.New(applyFingerprint([]zapcore.Core{obs})[0], zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+
+	logFailure := func(err error) { l.Error("load failed", zap.Error(err)) }
+	logFailure(fmt.Errorf("load user 1: %w", &fs.PathError{Op: "open", Path: "/a", Err: fs.ErrNotExist}))
+	logFailure(fmt.Errorf("load user 2: %w", &fs.PathError{Op: "open", Path: "/b", Err: fs.ErrNotExist}))
+	logFailure(errors.New("timeout"))
+	l.Info("fine")
+
+	entries := logs.All()
+	fp := func(i int) any { return entries[i].ContextMap()["error_fingerprint"] }
+	if fp(0) == nil || fp(0) != fp(1) {
+		t.Fatalf("expected equal fingerprints for the same error, got %v and %v", fp(0), fp(1))
+	}
+	if fp(2) == fp(0) {
+		t.Fatalf("expected a different fingerprint for a different error type")
+	}
+	if fp(3) != nil {
+		t.Fatalf("info entries must not be fingerprinted")
+	}
+}
+
+func TestStacktraceTrim(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	core := applyStackTrim([]zapcore.Core{obs}, StacktraceTrimConfig{MaxDepth: 1})[0]
+	l := zap.New(core, zap.AddStacktrace(zapcore.ErrorLevel))
+
+	func() { l.Error("failed", zap.Stack("stacktrace")) }()
+
+	ent := logs.All()[0]
+	want := "github.com/s4bb4t/zapang.TestStacktraceTrim.func1\n\t./fingerprint_test.go:"
+	if !strings.HasPrefix(ent.Stack, want) || !strings.HasSuffix(ent.Stack, "\n... 1 more frames") {
+		t.Fatalf("unexpected trimmed stack:\n%s", ent.Stack)
+	}
+	if field := ent.ContextMap()["stacktrace"].(string); !strings.HasPrefix(field, want) || strings.Contains(field, "go.uber.org/zap") {
+		t.Fatalf("unexpected trimmed stack field:\n%s", field)
+	}
+}
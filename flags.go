@@ -0,0 +1,32 @@
+package zapang
+
+import "flag"
+
+// BindFlags registers command-line flags that override c when fs is parsed,
+// so every CLI exposes the same logging switches:
+//
+//	cfg := zapang.DefaultLoggerConfig()
+//	cfg.BindFlags(flag.CommandLine)
+//	flag.Parse()
+//	log := zapang.New(ctx, "mytool", cfg, nil)
+//
+// The flags are -log-level, -log-env, -log-export, -log-export-level,
+// -log-console-level, -log-stdout-encoding, -log-color, -log-console-errors,
+// -log-stacktrace-level, -log-disable-caller and -log-disable-stacktrace.
+// Their defaults are c's current values. A nil fs means flag.CommandLine.
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.StringVar(&c.Level, "log-level", c.Level, "minimum log level: debug, info, warn, error, dpanic, panic, fatal")
+	fs.StringVar(&c.Environment, "log-env", c.Environment, "logging environment: local, dev, prod or a registered preset")
+	fs.StringVar(&c.ExportPath, "log-export", c.ExportPath, "JSON export path: file, stdout, stderr, tcp://, tcps:// or udp:// address")
+	fs.StringVar(&c.ExportLevel, "log-export-level", c.ExportLevel, "fixed minimum level of JSON exporters; empty follows -log-level")
+	fs.StringVar(&c.ConsoleLevel, "log-console-level", c.ConsoleLevel, "fixed minimum level of stdout; empty follows -log-level")
+	fs.StringVar(&c.StdoutEncoding, "log-stdout-encoding", c.StdoutEncoding, "stdout encoding: console, plain or json")
+	fs.StringVar(&c.Color, "log-color", c.Color, "console colors: auto, always or never")
+	fs.StringVar(&c.ConsoleErrors, "log-console-errors", c.ConsoleErrors, "console rendering of errors: line or report")
+	fs.StringVar(&c.StacktraceLevel, "log-stacktrace-level", c.StacktraceLevel, "minimum level that captures stacktraces")
+	fs.BoolVar(&c.DisableCaller, "log-disable-caller", c.DisableCaller, "omit the caller file:line")
+	fs.BoolVar(&c.DisableStacktrace, "log-disable-stacktrace", c.DisableStacktrace, "disable stacktraces")
+}
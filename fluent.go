@@ -0,0 +1,211 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// FluentConfig configures the Fluentd / Fluent Bit forward protocol exporter.
+type FluentConfig struct {
+	// Address is the forward input: "host:port", "tcp://host:port" or
+	// "tcps://host:port" (TLS). Default: localhost:24224.
+	Address string `yaml:"address" json:"address" mapstructure:"address"`
+
+	// Tag routes the records in Fluentd. Default: the service name.
+	Tag string `yaml:"tag" json:"tag" mapstructure:"tag"`
+
+	// RequireAck waits for the server to acknowledge each chunk and resends it
+	// otherwise (at-least-once delivery). Enable require_ack_response on the input.
+	RequireAck bool `yaml:"require_ack" json:"require_ack" mapstructure:"require_ack"`
+
+	// AckTimeout is how long to wait for an ack. Default: 10s.
+	AckTimeout time.Duration `yaml:"ack_timeout" json:"ack_timeout" mapstructure:"ack_timeout"`
+
+	// FlushInterval is how often buffered entries are sent. Default: 1s.
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval" mapstructure:"flush_interval"`
+
+	// MaxBatch is the number of entries that triggers an immediate flush. Default: 1000.
+	MaxBatch int `yaml:"max_batch" json:"max_batch" mapstructure:"max_batch"`
+
+	// BufferLimit is the number of entries kept while the server is unreachable;
+	// the oldest are dropped beyond it. Default: 10000.
+	BufferLimit int `yaml:"buffer_limit" json:"buffer_limit" mapstructure:"buffer_limit"`
+}
+
+// fluentWriter buffers JSON entries and ships them as forward-mode chunks:
+// [tag, [[time, record], ...], {"size": n, "chunk": id}].
+type fluentWriter struct {
+	cfg  FluentConfig
+	sock *socketSink
+	errs *errorOutput
+
+	mu      sync.Mutex
+	pending [][]byte // msgpack-encoded [time, record] pairs
+
+	// sendMu keeps chunks in order.
+	sendMu sync.Mutex
+}
+
+func newFluentWriter(ctx context.Context, cfg FluentConfig) (*fluentWriter, error) {
+	if cfg.Address == "" {
+		cfg.Address = "localhost:24224"
+	}
+	if !strings.Contains(cfg.Address, "://") {
+		cfg.Address = "tcp://" + cfg.Address
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = 10 * time.Second
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 1000
+	}
+	if cfg.BufferLimit <= 0 {
+		cfg.BufferLimit = 10000
+	}
+
+	sock, ok, err := parseSocketURL(cfg.Address)
+	if !ok || sock.network != "tcp" {
+		err = fmt.Errorf("zapang: fluent address %q: want host:port, tcp:// or tcps://", cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fluentWriter{cfg: cfg, sock: sock, errs: internalErrors(ctx)}
+	go func() {
+		ticker := time.NewTicker(cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = w.Sync()
+				return
+			case <-ticker.C:
+				_ = w.Sync()
+			}
+		}
+	}()
+	return w, nil
+}
+
+func (w *fluentWriter) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var record map[string]any
+	if err := dec.Decode(&record); err != nil {
+		return 0, err
+	}
+	ts := time.Now()
+	if s, ok := record["timestamp"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			ts = t
+		}
+	}
+
+	entry := msgpackAppendArrayHeader(nil, 2)
+	entry = msgpackAppendEventTime(entry, ts)
+	entry = msgpackAppend(entry, record)
+
+	w.mu.Lock()
+	w.pending = append(w.pending, entry)
+	full := len(w.pending) >= w.cfg.MaxBatch
+	w.mu.Unlock()
+
+	if full {
+		return len(p), w.Sync()
+	}
+	return len(p), nil
+}
+
+// Sync sends buffered entries as one chunk. On failure they are kept for the
+// next attempt, up to BufferLimit.
+func (w *fluentWriter) Sync() error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.send(batch)
+	if err == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	w.pending = append(batch, w.pending...)
+	if over := len(w.pending) - w.cfg.BufferLimit; over > 0 {
+		w.pending = w.pending[over:]
+		w.errs.report(fmt.Errorf("fluent buffer full, dropped %d oldest entries", over))
+	}
+	w.mu.Unlock()
+	return err
+}
+
+func (w *fluentWriter) send(batch [][]byte) error {
+	var chunk string
+	options := 1
+	if w.cfg.RequireAck {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+		options++
+	}
+
+	msg := msgpackAppendArrayHeader(nil, 3)
+	msg = msgpackAppendString(msg, w.cfg.Tag)
+	msg = msgpackAppendArrayHeader(msg, len(batch))
+	for _, entry := range batch {
+		msg = append(msg, entry...)
+	}
+	msg = msgpackAppendMapHeader(msg, options)
+	msg = msgpackAppendInt(msgpackAppendString(msg, "size"), int64(len(batch)))
+	if chunk != "" {
+		msg = msgpackAppendString(msgpackAppendString(msg, "chunk"), chunk)
+	}
+
+	var readAck func(io.Reader) error
+	if chunk != "" {
+		readAck = func(r io.Reader) error {
+			resp, err := msgpackReadStringMap(r)
+			if err != nil {
+				return fmt.Errorf("fluent ack: %w", err)
+			}
+			if resp["ack"] != chunk {
+				return fmt.Errorf("fluent ack: got %q, want %q", resp["ack"], chunk)
+			}
+			return nil
+		}
+	}
+	return w.sock.roundTrip(msg, w.cfg.AckTimeout, readAck)
+}
+
+// buildFluentCore creates a JSON core that forwards entries to Fluentd or Fluent Bit.
+func buildFluentCore(ctx context.Context, serviceName string, cfg Config, queue sinkQueue) (zapcore.Core, error) {
+	fc := *cfg.Fluent
+	if fc.Tag == "" {
+		fc.Tag = serviceName
+	}
+	w, err := newFluentWriter(ctx, fc)
+	if err != nil {
+		return nil, err
+	}
+	return zapcore.NewCore(newEncoder(EncodingJSON, cfg), queue(w, nil), zapcore.DebugLevel), nil
+}
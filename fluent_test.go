@@ -0,0 +1,62 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestFluentForwardWithAck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	chunks := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 64*1024)
+		n, _ := conn.Read(buf)
+		msg := buf[:n]
+		chunks <- msg
+
+		// Ack with the chunk id: "chunk" followed by a 24-byte fixstr.
+		i := bytes.Index(msg, []byte("\xa5chunk\xb8"))
+		if i < 0 {
+			return
+		}
+		id := string(msg[i+7 : i+31])
+		ack := msgpackAppendMapHeader(nil, 1)
+		ack = msgpackAppendString(msgpackAppendString(ack, "ack"), id)
+		_, _ = conn.Write(ack)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := newFluentWriter(ctx, FluentConfig{Address: ln.Addr().String(), Tag: "app.payments", RequireAck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(`{"level":"info","timestamp":"2024-03-01T12:00:00Z","message":"paid","amount":42}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatalf("sync with ack: %v", err)
+	}
+
+	msg := <-chunks
+	for _, want := range []string{"app.payments", "paid", "amount"} {
+		if !bytes.Contains(msg, []byte(want)) {
+			t.Fatalf("chunk missing %q: %q", want, msg)
+		}
+	}
+	if len(w.pending) != 0 {
+		t.Fatalf("expected acknowledged entries to be released, %d pending", len(w.pending))
+	}
+}
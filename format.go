@@ -0,0 +1,245 @@
+package zapang
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Time formats for FormatConfig.Time. Any other value is used as a Go time layout.
+const (
+	TimeRFC3339     = "rfc3339"
+	TimeRFC3339Nano = "rfc3339nano"
+	TimeISO8601     = "iso8601"
+	// TimeEpoch is seconds since the Unix epoch as a float.
+	TimeEpoch = "epoch"
+	// TimeEpochMillis is milliseconds since the Unix epoch as a float.
+	TimeEpochMillis = "epoch_millis"
+	// TimeEpochNanos is nanoseconds since the Unix epoch as an integer.
+	TimeEpochNanos = "epoch_nanos"
+)
+
+// consoleTimeLayout is the default console timestamp, e.g. "02 Jan 15:04:05 UTC".
+const consoleTimeLayout = "02 Jan 15:04:05 MST"
+
+// FormatConfig overrides how an encoder renders timestamps, durations and
+// levels. Empty fields keep the encoder's defaults.
+type FormatConfig struct {
+	// Time is rfc3339, rfc3339nano, iso8601, epoch, epoch_millis, epoch_nanos,
+	// or a Go time layout such as "2006-01-02 15:04:05.000".
+	Time string `yaml:"time" json:"time" mapstructure:"time"`
+
+	// Duration is the unit for duration fields: string ("1.5s"), s, ms or ns.
+	// The numeric units are written as numbers.
+	Duration string `yaml:"duration" json:"duration" mapstructure:"duration"`
+
+	// Level is the level capitalization: lowercase or uppercase.
+	Level string `yaml:"level" json:"level" mapstructure:"level"`
+}
+
+// formatTime renders t in the given format for the console, where numbers are
+// written as text.
+func formatTime(format string, t time.Time) string {
+	switch format {
+	case "":
+		return t.Format(consoleTimeLayout)
+	case TimeRFC3339:
+		return t.Format(time.RFC3339)
+	case TimeRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case TimeISO8601:
+		return t.Format("2006-01-02T15:04:05.000Z0700")
+	case TimeEpoch:
+		return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+	case TimeEpochMillis:
+		return strconv.FormatFloat(float64(t.UnixNano())/1e6, 'f', -1, 64)
+	case TimeEpochNanos:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	default:
+		return t.Format(format)
+	}
+}
+
+// consoleTimeEncoder writes the console timestamp painted with style and
+// followed by a tab, which keeps messages aligned. Formats without fractional
+// seconds are rendered once per second.
+func consoleTimeEncoder(f *FormatConfig, style string) zapcore.TimeEncoder {
+	var format string
+	if f != nil {
+		format = f.Time
+	}
+	render := func(t time.Time) string {
+		return paint(style, formatTime(format, t)) + "\t"
+	}
+	if format != "" && format != TimeRFC3339 {
+		return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(render(t))
+		}
+	}
+
+	var last atomic.Pointer[renderedTime]
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		sec, loc := t.Unix(), t.Location()
+		r := last.Load()
+		if r == nil || r.sec != sec || r.loc != loc {
+			r = &renderedTime{sec: sec, loc: loc, s: render(t)}
+			last.Store(r)
+		}
+		enc.AppendString(r.s)
+	}
+}
+
+// renderedTime is a timestamp rendered at second precision.
+type renderedTime struct {
+	sec int64
+	loc *time.Location
+	s   string
+}
+
+// consoleLevelEncoder writes the level in uppercase unless f asks for
+// lowercase, painted with the style for the level from styles (may be nil).
+func consoleLevelEncoder(f *FormatConfig, styles map[string]string) zapcore.LevelEncoder {
+	lower := f != nil && strings.EqualFold(f.Level, "lowercase")
+	render := func(l zapcore.Level) string {
+		s := l.CapitalString()
+		if lower {
+			s = l.String()
+		}
+		return paint(styles[l.String()], s)
+	}
+
+	var rendered [zapcore.FatalLevel - zapcore.DebugLevel + 1]string
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		rendered[l-zapcore.DebugLevel] = render(l)
+	}
+	return func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		if l >= zapcore.DebugLevel && l <= zapcore.FatalLevel {
+			enc.AppendString(rendered[l-zapcore.DebugLevel])
+			return
+		}
+		enc.AppendString(render(l))
+	}
+}
+
+// applyFormat overrides the encoders in ec with those selected by f.
+func applyFormat(ec *zapcore.EncoderConfig, f *FormatConfig) {
+	if f == nil {
+		return
+	}
+
+	switch f.Time {
+	case "":
+	case TimeRFC3339:
+		ec.EncodeTime = zapcore.RFC3339TimeEncoder
+	case TimeRFC3339Nano:
+		ec.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	case TimeISO8601:
+		ec.EncodeTime = zapcore.ISO8601TimeEncoder
+	case TimeEpoch:
+		ec.EncodeTime = zapcore.EpochTimeEncoder
+	case TimeEpochMillis:
+		ec.EncodeTime = zapcore.EpochMillisTimeEncoder
+	case TimeEpochNanos:
+		ec.EncodeTime = zapcore.EpochNanosTimeEncoder
+	default:
+		ec.EncodeTime = zapcore.TimeEncoderOfLayout(f.Time)
+	}
+
+	switch strings.ToLower(f.Duration) {
+	case "string":
+		ec.EncodeDuration = stringDurationEncoder
+	case "s":
+		ec.EncodeDuration = zapcore.SecondsDurationEncoder
+	case "ms":
+		ec.EncodeDuration = zapcore.MillisDurationEncoder
+	case "ns":
+		ec.EncodeDuration = zapcore.NanosDurationEncoder
+	}
+
+	switch strings.ToLower(f.Level) {
+	case "lowercase":
+		ec.EncodeLevel = zapcore.LowercaseLevelEncoder
+	case "uppercase":
+		ec.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+}
+
+// humanDurations reports whether a console encoder with format f renders
+// millisecond fields as durations: unless f asks for numeric durations.
+func humanDurations(f *FormatConfig) bool {
+	if f == nil {
+		return true
+	}
+	switch strings.ToLower(f.Duration) {
+	case "s", "ms", "ns":
+		return false
+	}
+	return true
+}
+
+// durationBufferPool holds the scratch buffers of stringDurationEncoder.
+var durationBufferPool = buffer.NewPool()
+
+// stringDurationEncoder writes durations as time.Duration.String does,
+// without allocating the string.
+func stringDurationEncoder(d time.Duration, enc zapcore.PrimitiveArrayEncoder) {
+	buf := durationBufferPool.Get()
+	defer buf.Free()
+
+	var arr [32]byte
+	buf.AppendBytes(appendDuration(arr[:0], d))
+	enc.AppendByteString(buf.Bytes())
+}
+
+// appendDuration appends d formatted as time.Duration.String to dst.
+func appendDuration(dst []byte, d time.Duration) []byte {
+	if d < 0 {
+		dst = append(dst, '-')
+	}
+	u := uint64(d)
+	if d < 0 {
+		u = -u
+	}
+
+	switch {
+	case u == 0:
+		return append(dst, "0s"...)
+	case u < uint64(time.Microsecond):
+		return append(strconv.AppendUint(dst, u, 10), "ns"...)
+	case u < uint64(time.Millisecond):
+		return append(appendFrac(dst, u, 3), "µs"...)
+	case u < uint64(time.Second):
+		return append(appendFrac(dst, u, 6), "ms"...)
+	}
+
+	h, m := u/uint64(time.Hour), u/uint64(time.Minute)%60
+	if h > 0 {
+		dst = append(strconv.AppendUint(dst, h, 10), 'h')
+	}
+	if h > 0 || m > 0 {
+		dst = append(strconv.AppendUint(dst, m, 10), 'm')
+	}
+	return append(appendFrac(dst, u%uint64(time.Minute), 9), 's')
+}
+
+// appendFrac appends v/10^prec in decimal to dst, omitting trailing zeros
+// and a bare decimal point.
+func appendFrac(dst []byte, v uint64, prec int) []byte {
+	var digits [9]byte
+	for i := prec - 1; i >= 0; i-- {
+		digits[i] = byte('0' + v%10)
+		v /= 10
+	}
+	dst = strconv.AppendUint(dst, v, 10)
+	for prec > 0 && digits[prec-1] == '0' {
+		prec--
+	}
+	if prec > 0 {
+		dst = append(append(dst, '.'), digits[:prec]...)
+	}
+	return dst
+}
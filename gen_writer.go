@@ -0,0 +1,74 @@
+//go:build ignore
+
+// gen_writer generates responsewriter_gen.go: wrapResponseWriter, which exposes
+// exactly the optional http.ResponseWriter interfaces the wrapped writer
+// implements. Run it with go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+// optional are the interfaces a ResponseWriter may implement, in mask bit order.
+var optional = []struct{ name, typ string }{
+	{"flusher", "http.Flusher"},
+	{"hijacker", "http.Hijacker"},
+	{"pusher", "http.Pusher"},
+	{"readerFrom", "io.ReaderFrom"},
+	{"closeNotifier", "http.CloseNotifier"},
+}
+
+func main() {
+	var b bytes.Buffer
+	b.WriteString(`// Code generated by gen_writer.go; DO NOT EDIT.
+
+package zapang
+
+import (
+	"io"
+	"net/http"
+)
+
+// wrapResponseWriter returns rw as an http.ResponseWriter that implements
+// those of http.Flusher, http.Hijacker, http.Pusher, io.ReaderFrom and
+// http.CloseNotifier the underlying writer implements, and no others, so
+// handlers' type assertions see the same writer capabilities with and
+// without the middleware.
+func wrapResponseWriter(rw *responseWriter) http.ResponseWriter {
+	var mask int
+`)
+	for i, o := range optional {
+		fmt.Fprintf(&b, "\tif _, ok := rw.ResponseWriter.(%s); ok {\n\t\tmask |= %d\n\t}\n", o.typ, 1<<i)
+	}
+	b.WriteString("\n\tswitch mask {\n")
+	for mask := 0; mask < 1<<len(optional); mask++ {
+		embeds := []string{"http.ResponseWriter", "responseWriterUnwrapper"}
+		values := []string{"rw", "rw"}
+		for i, o := range optional {
+			if mask&(1<<i) != 0 {
+				embeds = append(embeds, o.typ)
+				values = append(values, "rw")
+			}
+		}
+		if mask == 1<<len(optional)-1 {
+			b.WriteString("\tdefault:\n")
+		} else {
+			fmt.Fprintf(&b, "\tcase %d:\n", mask)
+		}
+		fmt.Fprintf(&b, "\t\treturn struct {\n\t\t\t%s\n\t\t}{%s}\n", strings.Join(embeds, "\n\t\t\t"), strings.Join(values, ", "))
+	}
+	b.WriteString("\t}\n}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("responsewriter_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// "goroutine N [" header of its stack trace.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// ProfileLabels nests the pprof labels of ctx (set with pprof.Do or
+// pprof.WithLabels) under a "pprof_labels" object, to correlate entries with
+// CPU profiles. It returns zap.Skip when ctx carries no labels.
+func ProfileLabels(ctx context.Context) zap.Field {
+	labels := make(map[string]string)
+	pprof.ForLabels(ctx, func(k, v string) bool {
+		labels[k] = v
+		return true
+	})
+	if len(labels) == 0 {
+		return zap.Skip()
+	}
+	return zap.Object("pprof_labels", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		for _, k := range slices.Sorted(maps.Keys(labels)) {
+			enc.AddString(k, labels[k])
+		}
+		return nil
+	}))
+}
+
+// profileLabels marks the pprof labels FromContext attaches. It encodes
+// nothing unless a debugCore of the logger turns it into the field.
+type profileLabels struct{ field zapcore.Field }
+
+func profileLabelsField(f zapcore.Field) zapcore.Field {
+	return zapcore.Field{Key: f.Key, Type: zapcore.SkipType, Interface: profileLabels{f}}
+}
+
+// debugCore implements Config.DebugEnrichment for the sinks it wraps: it adds
+// goroutine_id to every entry, reading the stack once per entry, and the pprof
+// labels FromContext attached. Entries are written on the logging goroutine, so
+// the ID is the caller's.
+type debugCore struct {
+	zapcore.Core
+}
+
+func newDebugCore(core zapcore.Core) zapcore.Core {
+	return &debugCore{Core: core}
+}
+
+func (c *debugCore) With(fields []zapcore.Field) zapcore.Core {
+	cloned := false
+	for i, f := range fields {
+		labels, ok := f.Interface.(profileLabels)
+		if !ok || f.Type != zapcore.SkipType {
+			continue
+		}
+		if !cloned {
+			fields, cloned = slices.Clone(fields), true
+		}
+		fields[i] = labels.field
+	}
+	return &debugCore{Core: c.Core.With(fields)}
+}
+
+func (c *debugCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *debugCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ce := c.Core.Check(ent, nil); ce != nil {
+		ce.Write(append(slices.Clip(fields), zap.Uint64("goroutine_id", goroutineID()))...)
+	}
+	return nil
+}
+
+// Go runs fn in a new goroutine with a context whose logger is ctx's logger
+// plus goroutine_parent, the ID of the calling goroutine, so fan-out work
+// stays correlated with the request or job that started it:
+//
+//	zapang.Go(ctx, func(ctx context.Context) {
+//		zapang.FromContext(ctx).Info("warming cache") // request_id, goroutine_parent
+//	})
+//
+// The context keeps ctx's values and cancellation; pass
+// context.WithoutCancel(ctx) for work that outlives the request. A panic in
+// fn is logged as "panic recovered" with its stack, reported to OnPanic hooks
+// and not propagated.
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = WithContext(ctx, contextLogger(ctx).With(zap.Uint64("goroutine_parent", goroutineID())))
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				FromContext(ctx).Error("panic recovered", zap.Any("panic", rec), zap.Stack("stacktrace"))
+				notifyPanic(PanicInfo{
+					Value:   rec,
+					Stack:   debug.Stack(),
+					Time:    time.Now(),
+					Context: ctx,
+				})
+			}
+		}()
+		fn(ctx)
+	}()
+}
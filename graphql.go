@@ -0,0 +1,188 @@
+package zapang
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultRedactedVariables are the GraphQL variable names GraphQLLogger
+// redacts by default. Names match case-insensitively as substrings, so
+// "password" also covers "newPassword".
+var DefaultRedactedVariables = []string{"password", "token", "secret", "authorization", "apikey", "cardnumber"}
+
+// redactedValue replaces redacted variable values.
+const redactedValue = "[REDACTED]"
+
+// GraphQLOperation describes an executed GraphQL operation. Adapt your
+// server's operation context to it, e.g. gqlgen's graphql.GetOperationContext.
+type GraphQLOperation struct {
+	// Name is the operation name; empty for anonymous operations.
+	Name string
+
+	// Type is query, mutation or subscription.
+	Type string
+
+	// Variables are the operation variables. They are logged after redaction.
+	Variables map[string]any
+
+	// Complexity is the computed query complexity, if the server computes one.
+	Complexity int
+
+	// Errors are the resolver and validation errors of the response.
+	Errors []error
+}
+
+// GraphQLOption configures a GraphQLLogger.
+type GraphQLOption func(*GraphQLLogger)
+
+// WithRedactedVariables replaces DefaultRedactedVariables with names.
+func WithRedactedVariables(names ...string) GraphQLOption {
+	return func(g *GraphQLLogger) {
+		g.redact = lowerAll(names)
+	}
+}
+
+// WithoutGraphQLVariables leaves operation variables out of the logs entirely.
+func WithoutGraphQLVariables() GraphQLOption {
+	return func(g *GraphQLLogger) {
+		g.omitVariables = true
+	}
+}
+
+// GraphQLLogger logs one entry per GraphQL operation, the GraphQL counterpart
+// of HTTPMiddleware's request entries.
+type GraphQLLogger struct {
+	redact        []string // lowercase
+	omitVariables bool
+}
+
+// NewGraphQLLogger returns a GraphQLLogger redacting DefaultRedactedVariables.
+func NewGraphQLLogger(opts ...GraphQLOption) *GraphQLLogger {
+	g := &GraphQLLogger{redact: lowerAll(DefaultRedactedVariables)}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Log logs op with the context logger as "graphql operation": graphql_operation,
+// graphql_operation_type, graphql_complexity, latency_ms, the redacted
+// graphql_variables and graphql_errors. Operations with errors are logged at
+// Error, the rest at Info.
+func (g *GraphQLLogger) Log(ctx context.Context, op GraphQLOperation, latency time.Duration) {
+	g.log(WithCallerSkip(FromContext(ctx), 1), op, latency)
+}
+
+func (g *GraphQLLogger) log(log *zap.Logger, op GraphQLOperation, latency time.Duration) {
+	lvl := zapcore.InfoLevel
+	if len(op.Errors) > 0 {
+		lvl = zapcore.ErrorLevel
+	}
+	ce := log.Check(lvl, "graphql operation")
+	if ce == nil {
+		return
+	}
+
+	name := op.Name
+	if name == "" {
+		name = "anonymous"
+	}
+	buf := GetFieldBuffer()
+	defer buf.Release()
+	buf.Add(
+		zap.String("graphql_operation", name),
+		zap.String("graphql_operation_type", op.Type),
+		LatencyMs(latency),
+	)
+	if op.Complexity > 0 {
+		buf.Add(zap.Int("graphql_complexity", op.Complexity))
+	}
+	if !g.omitVariables && len(op.Variables) > 0 {
+		buf.Add(zap.Any("graphql_variables", g.redactValue("", op.Variables)))
+	}
+	if len(op.Errors) > 0 {
+		buf.Add(zap.Errors("graphql_errors", op.Errors))
+	}
+	ce.Write(buf.Fields()...)
+}
+
+// GraphQLExtension logs every operation of a gqlgen server through a
+// GraphQLLogger. It has the shape of a gqlgen graphql.HandlerExtension and
+// graphql.ResponseInterceptor without importing gqlgen: instantiate it with
+// gqlgen's types and add it with srv.Use.
+type GraphQLExtension[S any, R any, H ~func(context.Context) R] struct {
+	log       *GraphQLLogger
+	operation func(ctx context.Context, resp R) GraphQLOperation
+}
+
+// NewGraphQLExtension returns a GraphQLExtension logging through log.
+// operation reads the operation of a response from the server, for gqlgen
+// from graphql.GetOperationContext and the response errors.
+func NewGraphQLExtension[S any, R any, H ~func(context.Context) R](log *GraphQLLogger, operation func(ctx context.Context, resp R) GraphQLOperation) GraphQLExtension[S, R, H] {
+	return GraphQLExtension[S, R, H]{log: log, operation: operation}
+}
+
+// ExtensionName names the extension in gqlgen's extension list.
+func (e GraphQLExtension[S, R, H]) ExtensionName() string {
+	return "zapang.GraphQLExtension"
+}
+
+// Validate accepts every schema.
+func (e GraphQLExtension[S, R, H]) Validate(S) error {
+	return nil
+}
+
+// InterceptResponse times the response and logs its operation with the
+// context logger.
+func (e GraphQLExtension[S, R, H]) InterceptResponse(ctx context.Context, next H) R {
+	start := time.Now()
+	resp := next(ctx)
+	e.log.log(FromContext(ctx), e.operation(ctx, resp), time.Since(start))
+	return resp
+}
+
+// redactValue returns a copy of v with the values of redacted keys replaced,
+// descending into nested input objects and lists.
+func (g *GraphQLLogger) redactValue(key string, v any) any {
+	if key != "" && g.redacted(key) {
+		return redactedValue
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[k] = g.redactValue(k, val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = g.redactValue("", val)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func (g *GraphQLLogger) redacted(key string) bool {
+	key = strings.ToLower(key)
+	for _, name := range g.redact {
+		if strings.Contains(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerAll(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = strings.ToLower(name)
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TaskGroup runs tasks concurrently like errgroup.Group, each with a logger
+// carrying task_name and task_index. Create one with Group.
+type TaskGroup struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	log    *zap.Logger
+
+	wg   sync.WaitGroup
+	sem  chan struct{}
+	next int
+
+	errOnce sync.Once
+	err     error
+}
+
+// Group returns a TaskGroup and a context derived from ctx that is canceled
+// when a task fails or Wait returns:
+//
+//	g, ctx := zapang.Group(ctx)
+//	for _, id := range ids {
+//		g.Go("fetch", func(ctx context.Context) error {
+//			return fetch(ctx, id) // zapang.FromContext(ctx) carries task_name, task_index
+//		})
+//	}
+//	err := g.Wait()
+//
+// A task that returns nil logs "task finished" at Debug with duration_ms; one
+// that fails logs "task failed" at Error with the error, or "task canceled"
+// at Debug if it returned context.Canceled after the group's context was
+// canceled, e.g. by an earlier failure. Panics are recovered, logged with a
+// stack trace, passed to OnPanic hooks and returned as errors.
+func Group(ctx context.Context) (*TaskGroup, context.Context) {
+	log := contextLogger(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &TaskGroup{ctx: ctx, cancel: cancel, log: log}, ctx
+}
+
+// SetLimit limits the group to n tasks running at once, turning it into a
+// worker pool: Go blocks until a slot is free. It must be called before Go.
+// A negative n removes the limit.
+func (g *TaskGroup) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go runs fn in a new goroutine with a context whose logger has task_name
+// and task_index, the number of tasks started before it in the group.
+func (g *TaskGroup) Go(name string, fn func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	index := g.next
+	g.next++
+	log := g.log.With(zap.String("task_name", name), zap.Int("task_index", index))
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+		if err := g.run(log, fn); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// run runs one task and logs its outcome.
+func (g *TaskGroup) run(log *zap.Logger, fn func(ctx context.Context) error) (err error) {
+	ctx := WithContext(g.ctx, log)
+	start := time.Now()
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Error("panic recovered", zap.Any("panic", rec), zap.Stack("stacktrace"))
+			notifyPanic(PanicInfo{
+				Value:   rec,
+				Stack:   debug.Stack(),
+				Time:    time.Now(),
+				Context: ctx,
+			})
+			err = fmt.Errorf("zapang: task panicked: %v", rec)
+		}
+
+		switch {
+		case err == nil:
+			log.Debug("task finished", DurationMs(time.Since(start)))
+		case errors.Is(err, context.Canceled) && g.ctx.Err() != nil:
+			log.Debug("task canceled", DurationMs(time.Since(start)), Error(err))
+		default:
+			log.Error("task failed", DurationMs(time.Since(start)), Error(err))
+		}
+	}()
+	return fn(ctx)
+}
+
+// Wait blocks until every task has returned, cancels the group's context and
+// returns the first error of a task, if any.
+func (g *TaskGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel(context.Canceled)
+	return g.err
+}
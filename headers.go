@@ -0,0 +1,112 @@
+package zapang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultSensitiveHeaders are never logged verbatim by WithHeaders.
+var DefaultSensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// headerPolicy decides which headers are logged and how sensitive ones are masked.
+type headerPolicy struct {
+	enabled   bool
+	nested    bool
+	hash      bool
+	sensitive map[string]bool // canonical header names
+}
+
+// WithHeaders logs request headers as header_<name> fields. Sensitive headers
+// (DefaultSensitiveHeaders, or the WithSensitiveHeaders list) are dropped.
+func WithHeaders() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.headers.enabled = true
+	}
+}
+
+// WithNestedHeaders logs request headers under a nested "headers" object
+// instead of header_<name> fields. It implies WithHeaders.
+func WithNestedHeaders() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.headers.enabled = true
+		c.headers.nested = true
+	}
+}
+
+// WithSensitiveHeaders replaces the DefaultSensitiveHeaders denylist.
+func WithSensitiveHeaders(names ...string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.headers.sensitive = sensitiveSet(names)
+	}
+}
+
+// WithHashedSensitiveHeaders logs sensitive headers as a truncated SHA-256
+// ("sha256:<16 hex>") instead of dropping them, so repeated credentials can be
+// correlated without being exposed.
+func WithHashedSensitiveHeaders() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.headers.hash = true
+	}
+}
+
+func sensitiveSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[http.CanonicalHeaderKey(name)] = true
+	}
+	return set
+}
+
+// values returns the loggable headers keyed by their normalized name,
+// e.g. "Content-Type" becomes "content_type".
+func (p *headerPolicy) values(h http.Header) map[string]string {
+	sensitive := p.sensitive
+	if sensitive == nil {
+		sensitive = sensitiveSet(DefaultSensitiveHeaders)
+	}
+	out := make(map[string]string, len(h))
+	for name, vals := range h {
+		value := strings.Join(vals, ",")
+		if sensitive[http.CanonicalHeaderKey(name)] {
+			if !p.hash {
+				continue
+			}
+			sum := sha256.Sum256([]byte(value))
+			value = "sha256:" + hex.EncodeToString(sum[:8])
+		}
+		out[strings.ReplaceAll(strings.ToLower(name), "-", "_")] = value
+	}
+	return out
+}
+
+// fields renders h according to the policy; nil when header logging is off.
+func (p *headerPolicy) fields(h http.Header) []zap.Field {
+	if !p.enabled {
+		return nil
+	}
+	values := p.values(h)
+	if len(values) == 0 {
+		return nil
+	}
+	keys := slices.Sorted(maps.Keys(values))
+	if p.nested {
+		return []zap.Field{zap.Object("headers", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for _, k := range keys {
+				enc.AddString(k, values[k])
+			}
+			return nil
+		}))}
+	}
+	fields := make([]zap.Field, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, zap.String("header_"+k, values[k]))
+	}
+	return fields
+}
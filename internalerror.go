@@ -0,0 +1,193 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// errorOutput receives a logger's internal errors: its Config.ErrorOutputPaths,
+// or stderr.
+type errorOutput struct {
+	mu    sync.Mutex
+	ws    zapcore.WriteSyncer
+	files []*fileSink
+}
+
+// errorOutputKey carries a logger's errorOutput in the context its sinks are
+// built with, so they report to it.
+type errorOutputKey struct{}
+
+// internalErrors returns the errorOutput of the logger ctx builds, or nil for
+// sinks built outside New, which report to the global logger's.
+func internalErrors(ctx context.Context) *errorOutput {
+	o, _ := ctx.Value(errorOutputKey{}).(*errorOutput)
+	return o
+}
+
+var (
+	internalErrorHooks   []*func(error)
+	internalErrorHooksMu sync.RWMutex
+)
+
+// OnInternalError registers a hook invoked for every error the logger hits
+// internally: failed sink writes, Sync failures at shutdown, export failover,
+// dropped spool and queue entries. The errors are also written to
+// Config.ErrorOutputPaths. Hooks run on the goroutine that hit the error,
+// often in the middle of a write, so they must not block or log through this
+// package; forward to a channel to handle errors elsewhere:
+//
+//	errs := make(chan error, 16)
+//	zapang.OnInternalError(func(err error) {
+//		select {
+//		case errs <- err:
+//		default:
+//		}
+//	})
+//
+// The returned function unregisters the hook.
+func OnInternalError(hook func(error)) (unregister func()) {
+	h := &hook
+	internalErrorHooksMu.Lock()
+	internalErrorHooks = append(slices.Clip(internalErrorHooks), h)
+	internalErrorHooksMu.Unlock()
+	return func() {
+		internalErrorHooksMu.Lock()
+		internalErrorHooks = slices.DeleteFunc(slices.Clone(internalErrorHooks), func(x *func(error)) bool { return x == h })
+		internalErrorHooksMu.Unlock()
+	}
+}
+
+// stderrOutput is the error output without a logger built by New.
+var stderrOutput = &errorOutput{ws: stdSink{os.Stderr}}
+
+// report writes a logger-internal error to the error output, the global
+// logger's if o is nil, and runs OnInternalError hooks. A panicking hook is
+// ignored.
+func (o *errorOutput) report(err error) {
+	if o == nil {
+		o = stderrOutput
+		globalMu.RLock()
+		if globalLive != nil {
+			o = globalLive.errs
+		}
+		globalMu.RUnlock()
+	}
+	o.mu.Lock()
+	fmt.Fprintf(o.ws, "%s zapang: %v\n", time.Now().Format(time.RFC3339), err)
+	o.mu.Unlock()
+
+	internalErrorHooksMu.RLock()
+	hooks := internalErrorHooks
+	internalErrorHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		func() {
+			defer func() { _ = recover() }()
+			(*hook)(err)
+		}()
+	}
+}
+
+// openErrorOutput opens the Config.ErrorOutputPaths sinks, defaulting to
+// stderr. Paths that cannot be opened are left out; if none can, stderr is used.
+// Files are closed by close.
+func openErrorOutput(ctx context.Context, paths []string) (*errorOutput, error) {
+	o := &errorOutput{}
+	var sinks []zapcore.WriteSyncer
+	var errs []error
+	for _, path := range paths {
+		ws, err := openSink(ctx, path)
+		if file, ok := ws.(*fileSink); ok {
+			o.files = append(o.files, file)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("zapang: open error output %q: %w", path, err))
+			continue
+		}
+		sinks = append(sinks, ws)
+	}
+	o.ws = zapcore.NewMultiWriteSyncer(sinks...)
+	if len(sinks) == 0 {
+		o.ws = stdSink{os.Stderr}
+	}
+	return o, errors.Join(errs...)
+}
+
+// close closes the error output's files; later errors go to stderr.
+func (o *errorOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, file := range o.files {
+		_ = file.close()
+	}
+	o.files = nil
+	o.ws = stdSink{os.Stderr}
+}
+
+// zapErrorMarkers start the messages zap writes to its ErrorOutput, after the
+// entry time.
+var zapErrorMarkers = []string{" write error: ", " Logger.check error: "}
+
+// zapErrorOutput is zap's ErrorOutput: it turns the errors zap reports, such
+// as failed core writes, into internal errors of its logger.
+type zapErrorOutput struct {
+	errs *errorOutput
+}
+
+func (o zapErrorOutput) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	for _, marker := range zapErrorMarkers {
+		if i := strings.Index(msg, marker); i >= 0 {
+			msg = msg[i+1:]
+			break
+		}
+	}
+	o.errs.report(errors.New(msg))
+	return len(p), nil
+}
+
+func (zapErrorOutput) Sync() error { return nil }
+
+// writeChecked writes an entry through core's own Check, so wrappers that add
+// themselves to a CheckedEntry keep the levels and sampling of the core they
+// wrap. The write error, which zap reports to the entry's ErrorOutput rather
+// than returning, is returned.
+func writeChecked(core zapcore.Core, ent zapcore.Entry, fields []zapcore.Field) error {
+	ce := core.Check(ent, nil)
+	if ce == nil {
+		return nil
+	}
+	out := writeErrorPool.Get().(*writeErrorOutput)
+	ce.ErrorOutput = out
+	ce.Write(fields...)
+	err := out.err
+	out.err = nil
+	writeErrorPool.Put(out)
+	return err
+}
+
+var writeErrorPool = sync.Pool{New: func() any { return new(writeErrorOutput) }}
+
+// writeErrorOutput keeps the write error zap reports for a checked entry.
+type writeErrorOutput struct {
+	err error
+}
+
+func (o *writeErrorOutput) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if _, after, ok := strings.Cut(msg, zapErrorMarkers[0]); ok {
+		msg = after
+	}
+	o.err = errors.New(msg)
+	return len(p), nil
+}
+
+func (*writeErrorOutput) Sync() error { return nil }
@@ -0,0 +1,44 @@
+package zapang
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WrapJob runs fn as a background job, the cron and worker counterpart of
+// HTTPMiddleware. It derives a job-scoped logger with job_name and a fresh
+// job_id from ctx, injects it into the context passed to fn, and logs the
+// start and the outcome with duration_ms. A panic in fn is recovered, logged
+// with its stack, reported to OnPanic hooks and returned as an error.
+func WrapJob(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	ctx = With(ctx, JobName(name), JobID(NewRequestID()))
+	log := FromContext(ctx)
+
+	start := time.Now()
+	log.Info("job started")
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Error("panic recovered", zap.Any("panic", rec), zap.Stack("stacktrace"))
+			notifyPanic(PanicInfo{
+				Value:   rec,
+				Stack:   debug.Stack(),
+				Time:    time.Now(),
+				Context: ctx,
+			})
+			err = fmt.Errorf("zapang: job %s panicked: %v", name, rec)
+		}
+
+		if err != nil {
+			log.Error("job failed", DurationMs(time.Since(start)), Error(err))
+			return
+		}
+		log.Info("job finished", DurationMs(time.Since(start)))
+	}()
+
+	return fn(ctx)
+}
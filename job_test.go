@@ -0,0 +1,172 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWrapJob(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(obs))
+
+	var recovered PanicInfo
+	defer OnPanic(func(info PanicInfo) { recovered = info })()
+
+	err := WrapJob(ctx, "reindex", func(ctx context.Context) error {
+		FromContext(ctx).Info("working")
+		panic("boom")
+	})
+	if err == nil || recovered.Value != "boom" {
+		t.Fatalf("expected recovered panic, got err=%v hook=%v", err, recovered.Value)
+	}
+
+	var msgs []string
+	for _, e := range logs.All() {
+		if e.ContextMap()["job_name"] != "reindex" || e.ContextMap()["job_id"] == "" {
+			t.Fatalf("missing job fields on %q: %v", e.Message, e.ContextMap())
+		}
+		msgs = append(msgs, e.Message)
+	}
+	if len(msgs) != 4 || msgs[0] != "job started" || msgs[1] != "working" || msgs[3] != "job failed" {
+		t.Fatalf("unexpected entries: %v", msgs)
+	}
+}
+
+func TestGo(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(obs).With(RequestID("r1")))
+
+	done := make(chan any, 1)
+	defer OnPanic(func(info PanicInfo) { done <- info.Value })()
+
+	Go(ctx, func(ctx context.Context) {
+		FromContext(ctx).Info("fanned out")
+		panic("boom")
+	})
+	if v := <-done; v != "boom" {
+		t.Fatalf("expected the panic to be reported, got %v", v)
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 || entries[0].Message != "fanned out" || entries[1].Message != "panic recovered" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	for _, e := range entries {
+		fields := e.ContextMap()
+		if fields["request_id"] != "r1" || fields["goroutine_parent"] != goroutineID() {
+			t.Fatalf("%s: missing parent correlation: %v", e.Message, fields)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	g, ctx := Group(WithContext(context.Background(), zap.New(obs)))
+	g.SetLimit(1)
+
+	errFetch := errors.New("fetch failed")
+	g.Go("ok", func(ctx context.Context) error {
+		FromContext(ctx).Info("working")
+		return nil
+	})
+	g.Go("fail", func(context.Context) error { return errFetch })
+	g.Go("late", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.Go("panic", func(context.Context) error { panic("boom") })
+
+	if err := g.Wait(); err != errFetch {
+		t.Fatalf("expected the first error, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected the group context to be canceled")
+	}
+
+	outcomes := make(map[string]string)
+	for _, e := range logs.All() {
+		fields := e.ContextMap()
+		if e.Message == "working" && fields["task_index"] != int64(0) {
+			t.Fatalf("missing task fields: %v", fields)
+		}
+		if e.Message != "working" && e.Message != "panic recovered" {
+			outcomes[fields["task_name"].(string)] = e.Level.String() + " " + e.Message
+		}
+	}
+	want := map[string]string{
+		"ok":    "debug task finished",
+		"fail":  "error task failed",
+		"late":  "debug task canceled",
+		"panic": "error task failed",
+	}
+	for name, w := range want {
+		if outcomes[name] != w {
+			t.Errorf("task %s: got %q, want %q", name, outcomes[name], w)
+		}
+	}
+}
+
+func TestBatchLogger(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	errMissing := errors.New("missing column")
+
+	batch := NewBatchLogger(zap.New(obs), "import", WithBatchSamples(2))
+	batch.Item("1", nil)
+	batch.Item("2", fmt.Errorf("row 2: %w", errMissing))
+	batch.Item("3", fmt.Errorf("row 3: %w", errMissing))
+	_, parseErr := strconv.Atoi("x")
+	batch.Item("4", parseErr)
+	batch.Finish()
+
+	if logs.Len() != 1 {
+		t.Fatalf("expected a single summary, got %d entries", logs.Len())
+	}
+	e := logs.All()[0]
+	fields := e.ContextMap()
+	byType := fields["errors_by_type"].(map[string]any)
+	if e.Level != zapcore.WarnLevel || fields["items"] != int64(4) || fields["failed"] != int64(3) ||
+		byType["missing column"] != 2 || byType["invalid syntax"] != 1 {
+		t.Fatalf("unexpected summary: %v %v", e.Level, fields)
+	}
+	if samples := fields["error_samples"].([]any); len(samples) != 2 || samples[0] != "2: row 2: missing column" {
+		t.Fatalf("unexpected samples: %v", samples)
+	}
+}
+
+func TestWrapTask(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(obs))
+
+	info := TaskInfo{Kind: TaskActivity, Type: "ChargeCard", WorkflowID: "order-1", RunID: "r1", Attempt: 2}
+	err := WrapTask(ctx, info, func(ctx context.Context) error {
+		FromContext(ctx).Info("charging")
+		return errors.New("card declined")
+	})
+	if err == nil {
+		t.Fatal("expected the task error")
+	}
+	info.Replaying = true
+	_ = WrapTask(ctx, info, func(ctx context.Context) error {
+		FromContext(ctx).Info("replayed")
+		return nil
+	})
+
+	var msgs []string
+	for _, e := range logs.All() {
+		m := e.ContextMap()
+		if m["workflow_id"] != "order-1" || m["run_id"] != "r1" || m["activity_type"] != "ChargeCard" || m["attempt"] != int32(2) {
+			t.Fatalf("missing task fields on %q: %v", e.Message, m)
+		}
+		msgs = append(msgs, e.Message)
+	}
+	if len(msgs) != 3 || msgs[0] != "activity retry" || msgs[1] != "charging" || msgs[2] != "activity failed" {
+		t.Fatalf("unexpected entries: %v", msgs)
+	}
+}
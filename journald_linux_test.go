@@ -0,0 +1,38 @@
+package zapang
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournaldSink(t *testing.T) {
+	journaldSocket = filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ws, err := openSink(context.Background(), "journald://billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Write([]byte(`{"level":"warn","message":"slow query","db.table":"orders","rows":3,"stacktrace":"a\nb"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"MESSAGE=slow query\n", "PRIORITY=4\n", "SYSLOG_IDENTIFIER=billing\n", "DB_TABLE=orders\n", "ROWS=3\n", "STACKTRACE\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package zapang
+
+import (
+	"errors"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func openJournald(string) (zapcore.WriteSyncer, error) {
+	return nil, errors.New("zapang: journald is only available on Linux")
+}
@@ -0,0 +1,173 @@
+package zapang
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// LastWordsConfig keeps recent entries of every level in memory and dumps them
+// when the process crashes, giving debug context without running at debug.
+type LastWordsConfig struct {
+	// Size is the number of entries kept. Default: 256.
+	Size int `yaml:"size" json:"size" mapstructure:"size"`
+
+	// Output receives the dump: "stderr" (default), "stdout" or a file path.
+	Output string `yaml:"output" json:"output" mapstructure:"output"`
+
+	// Level is the lowest level kept: "debug" (default), "info", and so on.
+	// Calls below both it and the logger's level cost no more than without
+	// LastWords.
+	Level string `yaml:"level" json:"level" mapstructure:"level"`
+}
+
+// lastWords is a ring of recent entries. Fields are kept as logged and encoded
+// only when dumped.
+type lastWords struct {
+	enc   zapcore.Encoder
+	out   zapcore.WriteSyncer
+	level zapcore.Level
+
+	mu      sync.Mutex
+	entries []recordedEntry
+	next    int
+	full    bool
+}
+
+type recordedEntry struct {
+	ent    zapcore.Entry
+	fields []zapcore.Field
+}
+
+func newLastWords(ctx context.Context, cfg Config) (*lastWords, error) {
+	lw := cfg.LastWords
+	size := lw.Size
+	if size <= 0 {
+		size = 256
+	}
+	output := lw.Output
+	if output == "" {
+		output = "stderr"
+	}
+	out, err := openSink(ctx, output)
+	if err != nil {
+		return nil, fmt.Errorf("zapang: open last words output: %w", err)
+	}
+	level := zapcore.DebugLevel
+	if lw.Level != "" {
+		level = parseLevel(lw.Level)
+	}
+	return &lastWords{enc: newEncoder(EncodingJSON, cfg), out: out, level: level, entries: make([]recordedEntry, size)}, nil
+}
+
+func (l *lastWords) record(ent zapcore.Entry, fields []zapcore.Field) {
+	l.mu.Lock()
+	l.entries[l.next] = recordedEntry{ent: ent, fields: fields}
+	l.next = (l.next + 1) % len(l.entries)
+	l.full = l.full || l.next == 0
+	l.mu.Unlock()
+}
+
+// dump writes the buffered entries, oldest first, and empties the ring.
+func (l *lastWords) dump() error {
+	l.mu.Lock()
+	var entries []recordedEntry
+	if l.full {
+		entries = append(slices.Clone(l.entries[l.next:]), l.entries[:l.next]...)
+	} else {
+		entries = slices.Clone(l.entries[:l.next])
+	}
+	clear(l.entries)
+	l.next, l.full = 0, false
+	l.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+	fmt.Fprintf(l.out, "zapang: last %d entries before crash:\n", len(entries))
+	for _, e := range entries {
+		buf, err := l.enc.EncodeEntry(e.ent, e.fields)
+		if err != nil {
+			continue
+		}
+		_, _ = l.out.Write(buf.Bytes())
+		buf.Free()
+	}
+	return l.out.Sync()
+}
+
+// DumpLastWords writes the global logger's last-words buffer (see
+// Config.LastWords). Panic and Fatal entries dump it automatically; call it
+// when the process is about to die another way.
+func DumpLastWords() error {
+	globalMu.RLock()
+	live := globalLive
+	globalMu.RUnlock()
+	if live == nil || live.lastWords == nil {
+		return nil
+	}
+	return live.lastWords.dump()
+}
+
+// DumpOnPanic dumps the last-words buffer when the calling goroutine panics,
+// then re-panics. Use it as the first deferred call in main and in goroutines
+// whose panics are not recovered:
+//
+//	defer zapang.DumpOnPanic()
+func DumpOnPanic() {
+	if rec := recover(); rec != nil {
+		_ = DumpLastWords()
+		panic(rec)
+	}
+}
+
+// lastWordsCore records every entry at or above the last words level before the
+// wrapped core checks it, and dumps the buffer ahead of Panic and Fatal entries.
+type lastWordsCore struct {
+	zapcore.Core
+	lw     *lastWords
+	fields []zapcore.Field // context added with With
+}
+
+func (c *lastWordsCore) Enabled(lvl zapcore.Level) bool {
+	return c.Core.Enabled(lvl) || c.lw.level.Enabled(lvl)
+}
+
+func (c *lastWordsCore) unwrap() zapcore.Core { return c.Core }
+
+func (c *lastWordsCore) With(fields []zapcore.Field) zapcore.Core {
+	return &lastWordsCore{Core: c.Core.With(fields), lw: c.lw, fields: append(slices.Clip(c.fields), fields...)}
+}
+
+func (c *lastWordsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.lw.level.Enabled(ent.Level) {
+		ce = ce.AddCore(ent, lastWordsRecorder{c})
+	}
+	if !c.Core.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// lastWordsRecorder is the write side of lastWordsCore.
+type lastWordsRecorder struct {
+	c *lastWordsCore
+}
+
+func (r lastWordsRecorder) Enabled(zapcore.Level) bool        { return true }
+func (r lastWordsRecorder) With([]zapcore.Field) zapcore.Core { return r }
+func (r lastWordsRecorder) Check(_ zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+func (r lastWordsRecorder) Sync() error { return nil }
+
+func (r lastWordsRecorder) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level >= zapcore.PanicLevel {
+		return r.c.lw.dump()
+	}
+	r.c.lw.record(ent, append(slices.Clip(r.c.fields), fields...))
+	return nil
+}
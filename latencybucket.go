@@ -0,0 +1,75 @@
+package zapang
+
+import (
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LatencyBuckets labels durations with the range they fall in, for grouping
+// entries in log backends without histogram support.
+type LatencyBuckets struct {
+	bounds []time.Duration
+	labels []string
+}
+
+// defaultLatencyBuckets are the buckets of LatencyBucket.
+var defaultLatencyBuckets = NewLatencyBuckets(10*time.Millisecond, 100*time.Millisecond, time.Second)
+
+// NewLatencyBuckets returns buckets split at the given ascending bounds. A
+// duration belongs to the first bucket whose upper bound exceeds it:
+// NewLatencyBuckets(10*time.Millisecond, time.Second) labels "<10ms",
+// "10ms-1s" and ">=1s".
+func NewLatencyBuckets(bounds ...time.Duration) *LatencyBuckets {
+	b := &LatencyBuckets{bounds: bounds, labels: make([]string, len(bounds)+1)}
+	for i := range b.labels {
+		switch {
+		case len(bounds) == 0:
+			b.labels[i] = "all"
+		case i == 0:
+			b.labels[i] = "<" + bounds[0].String()
+		case i == len(bounds):
+			b.labels[i] = ">=" + bounds[i-1].String()
+		default:
+			b.labels[i] = bucketRange(bounds[i-1], bounds[i])
+		}
+	}
+	return b
+}
+
+// bucketRange labels [lo, hi), writing a unit shared by both bounds once:
+// "10-100ms", "100ms-1s".
+func bucketRange(lo, hi time.Duration) string {
+	l, h := lo.String(), hi.String()
+	unit := strings.TrimLeft(h, "0123456789.")
+	if num, ok := strings.CutSuffix(l, unit); ok && unit != "" && strings.Trim(num, "0123456789.") == "" {
+		l = num
+	}
+	return l + "-" + h
+}
+
+// Label returns the label of the bucket d falls in.
+func (b *LatencyBuckets) Label(d time.Duration) string {
+	for i, bound := range b.bounds {
+		if d < bound {
+			return b.labels[i]
+		}
+	}
+	return b.labels[len(b.bounds)]
+}
+
+// Field returns a latency_bucket field with the label of d.
+func (b *LatencyBuckets) Field(d time.Duration) zap.Field {
+	return zap.String("latency_bucket", b.Label(d))
+}
+
+// LatencyBucket returns a coarse latency_bucket label for d: "<10ms",
+// "10-100ms", "100ms-1s" or ">=1s". Log it beside the precise latency:
+//
+//	log.Info("request completed", zapang.LatencyMs(d), zapang.LatencyBucket(d))
+//
+// Use NewLatencyBuckets for other bounds.
+func LatencyBucket(d time.Duration) zap.Field {
+	return defaultLatencyBuckets.Field(d)
+}
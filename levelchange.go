@@ -0,0 +1,65 @@
+package zapang
+
+import (
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	levelHooks   []*func(old, new zapcore.Level)
+	levelHooksMu sync.RWMutex
+
+	// levelChangeMu serializes level changes, so hooks see each change's
+	// actual old level.
+	levelChangeMu sync.Mutex
+)
+
+// OnLevelChange registers a hook invoked after a logger's level changes at
+// runtime through SetGlobalLevel, AdminHandler's /loglevel or WatchConfig.
+// Changes made directly on the AtomicLevel from GlobalLevel or NewWithLevel
+// are not seen. Hooks run on the goroutine that made the change and only when
+// the level actually changed; a debug data collector, for example, can start
+// when the level drops to debug:
+//
+//	zapang.OnLevelChange(func(old, new zapcore.Level) {
+//		collector.SetEnabled(new == zapcore.DebugLevel)
+//	})
+//
+// The returned function unregisters the hook.
+func OnLevelChange(hook func(old, new zapcore.Level)) (unregister func()) {
+	h := &hook
+	levelHooksMu.Lock()
+	levelHooks = append(slices.Clip(levelHooks), h)
+	levelHooksMu.Unlock()
+	return func() {
+		levelHooksMu.Lock()
+		levelHooks = slices.DeleteFunc(slices.Clone(levelHooks), func(x *func(old, new zapcore.Level)) bool { return x == h })
+		levelHooksMu.Unlock()
+	}
+}
+
+// setLevel sets level to lvl and runs OnLevelChange hooks if it changed.
+// A panicking hook is ignored.
+func setLevel(level zap.AtomicLevel, lvl zapcore.Level) {
+	levelChangeMu.Lock()
+	old := level.Level()
+	level.SetLevel(lvl)
+	levelChangeMu.Unlock()
+	if old == lvl {
+		return
+	}
+
+	levelHooksMu.RLock()
+	hooks := levelHooks
+	levelHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		func() {
+			defer func() { _ = recover() }()
+			(*hook)(old, lvl)
+		}()
+	}
+}
@@ -5,19 +5,22 @@ package zapang
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// Built-in environments; RegisterEnvironment adds more.
 const (
 	EnvLocal = "local"
 	EnvProd  = "prod"
@@ -29,7 +32,9 @@ type ctxKey struct{}
 var (
 	globalLogger *zap.Logger
 	globalLevel  zap.AtomicLevel
+	globalLive   *liveConfig
 	globalMu     sync.RWMutex
+	undoGlobals  func()
 	projectRoot  string
 )
 
@@ -48,102 +53,442 @@ func init() {
 	}
 }
 
-// humanTimeEncoder formats time as "02 Jan 15:04:05" for readable console output.
-func humanTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-	enc.AppendString(t.Format("02 Jan 15:04:05 MST\t"))
-}
+// Caller path fallbacks for callers outside the project root.
+const (
+	// CallerFallbackPackage renders import-path-qualified paths: github.com/org/repo/pkg/file.go:42.
+	CallerFallbackPackage = "package"
+	// CallerFallbackShort renders the last directory and file: pkg/file.go:42.
+	CallerFallbackShort = "short"
+	// CallerFallbackFull renders the path as recorded in the binary.
+	CallerFallbackFull = "full"
+)
 
-// rootRelativeCallerEncoder encodes caller path relative to project root for clickable terminal links.
-func rootRelativeCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
-	if !caller.Defined {
-		enc.AppendString("undefined")
-		return
+// callerEncoder encodes caller paths relative to the project root for clickable terminal links, using fallback
+// when the path cannot be resolved against it (trimpath builds, binaries run
+// away from their source tree). Rendered paths are cached per call site.
+func callerEncoder(fallback string) zapcore.CallerEncoder {
+	var cache callerCache
+	return func(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+		if !caller.Defined {
+			enc.AppendString("undefined")
+			return
+		}
+		key := callerKey{pc: caller.PC, file: caller.File, line: caller.Line}
+		s, ok := cache.get(key)
+		if !ok {
+			s = callerPath(caller, fallback)
+			cache.put(key, s)
+		}
+		enc.AppendString(s)
 	}
+}
 
+func callerPath(caller zapcore.EntryCaller, fallback string) string {
 	path := caller.File
-	if projectRoot != "" && strings.HasPrefix(path, projectRoot) {
+	switch {
+	case projectRoot != "" && strings.HasPrefix(path, projectRoot):
 		path = "." + strings.TrimPrefix(path, projectRoot)
+	case fallback == CallerFallbackFull:
+	case fallback == CallerFallbackShort:
+		return caller.TrimmedPath()
+	default:
+		path = packageQualifiedPath(caller)
 	}
+	return path + ":" + strconv.Itoa(caller.Line)
+}
 
-	enc.AppendString(path + ":" + strconv.Itoa(caller.Line))
+// maxCallerCache bounds a callerCache; call sites beyond it are rendered on
+// every entry.
+const maxCallerCache = 4096
+
+type callerKey struct {
+	pc   uintptr
+	file string
+	line int
+}
+
+// callerCache maps call sites to their rendered paths.
+type callerCache struct {
+	mu    sync.RWMutex
+	paths map[callerKey]string
+}
+
+func (c *callerCache) get(key callerKey) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, ok := c.paths[key]
+	return s, ok
+}
+
+func (c *callerCache) put(key callerKey, s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paths == nil {
+		c.paths = make(map[callerKey]string)
+	}
+	if len(c.paths) < maxCallerCache {
+		c.paths[key] = s
+	}
+}
+
+// packageQualifiedPath joins the caller's import path (derived from its function name)
+// with the file name, e.g. github.com/org/repo/pkg/file.go.
+func packageQualifiedPath(caller zapcore.EntryCaller) string {
+	fn := caller.Function
+	if fn == "" {
+		if f := runtime.FuncForPC(caller.PC); f != nil {
+			fn = f.Name()
+		}
+	}
+	if fn == "" {
+		return caller.TrimmedPath()
+	}
+
+	// Function names look like github.com/org/repo/pkg.(*T).Method; the package
+	// path ends at the first dot after the last slash. Dots in the last path
+	// element are escaped, as in gopkg.in/yaml%2ev3.(*decoder).unmarshal.
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		fn = fn[:slash+1+dot]
+	}
+	if path, err := url.PathUnescape(fn); err == nil {
+		fn = path
+	}
+	return fn + "/" + filepath.Base(caller.File)
 }
 
 // New creates a new *zap.Logger based on the provided configuration.
 // The serviceName is added as a permanent field to all log entries.
-// If w is provided, logs will also be written to it (useful for testing).
+// If w is provided, logs will also be written to it (useful for testing),
+// encoded according to cfg.WriterEncoding.
+// extraCores are teed in beside the built-in sinks, like cfg.Cores, so metrics,
+// test or vendor cores get the same sampled and filtered entries.
+// With cfg.ReplaceGlobals, zap.L/zap.S and the standard library logger are routed
+// through the new logger as well.
 //
 // Output behavior:
 //   - All environments: Human-readable console output to stdout
 //   - Dev/Prod with ExportPath: Additional JSON output for log aggregation
-func New(ctx context.Context, serviceName string, cfg Config, w io.Writer) *zap.Logger {
-	logger, level := NewWithLevel(ctx, serviceName, cfg, w)
+//
+// Sinks that cannot be opened are reported to stderr and left out; use NewE to
+// fail instead.
+func New(ctx context.Context, serviceName string, cfg Config, w io.Writer, extraCores ...zapcore.Core) *zap.Logger {
+	cfg.Cores = append(slices.Clip(cfg.Cores), extraCores...)
+	logger, live, err := newLogger(ctx, serviceName, cfg, w)
+	if err != nil {
+		live.errs.report(err)
+	}
+	setGlobal(logger, live, cfg)
+	return logger
+}
 
-	// Set as global logger
+// NewE is like New but returns an error, and no logger, when a configured sink
+// cannot be opened (e.g. ExportPath with bad permissions).
+func NewE(ctx context.Context, serviceName string, cfg Config, w io.Writer, extraCores ...zapcore.Core) (logger *zap.Logger, err error) {
+	cfg.Cores = append(slices.Clip(cfg.Cores), extraCores...)
+	// The logger's goroutines and files live until its context is done, so a
+	// logger that is not returned is stopped through its own context.
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+	logger, live, err := newLogger(ctx, serviceName, cfg, w)
+	if err != nil {
+		return nil, err
+	}
+	setGlobal(logger, live, cfg)
+	return logger, nil
+}
+
+// setGlobal installs logger as the package global and, if configured, as zap's
+// global, and applies its named levels.
+func setGlobal(logger *zap.Logger, live *liveConfig, cfg Config) {
 	globalMu.Lock()
+	var oldNamed map[string]string
+	if globalLive != nil {
+		oldNamed = globalLive.config.Load().NamedLevels
+	}
 	globalLogger = logger
-	globalLevel = level
+	globalLevel = live.level
+	globalLive = live
+	globalGen.Add(1)
+	if undoGlobals != nil {
+		undoGlobals()
+		undoGlobals = nil
+	}
+	if cfg.ReplaceGlobals {
+		undoZap := zap.ReplaceGlobals(logger)
+		undoStd := zap.RedirectStdLog(logger)
+		undoGlobals = func() {
+			undoStd()
+			undoZap()
+		}
+	}
 	globalMu.Unlock()
-
-	return logger
+	setNamedLevels(oldNamed, cfg.NamedLevels)
 }
 
 // NewWithLevel creates a new *zap.Logger and returns its AtomicLevel for dynamic level control.
 // Use this when you need to change the log level at runtime.
-func NewWithLevel(ctx context.Context, serviceName string, cfg Config, w io.Writer) (*zap.Logger, zap.AtomicLevel) {
-	level := parseLevel(cfg.Level)
-	atomicLevel := zap.NewAtomicLevelAt(level)
+// Sinks that cannot be opened are reported to stderr and left out.
+func NewWithLevel(ctx context.Context, serviceName string, cfg Config, w io.Writer, extraCores ...zapcore.Core) (*zap.Logger, zap.AtomicLevel) {
+	cfg.Cores = append(slices.Clip(cfg.Cores), extraCores...)
+	logger, live, err := newLogger(ctx, serviceName, cfg, w)
+	if err != nil {
+		live.errs.report(err)
+	}
+	return logger, live.level
+}
 
+// newLogger builds the logger together with its runtime-adjustable configuration.
+// The logger is always usable; err reports sinks that could not be opened and were left out.
+func newLogger(ctx context.Context, serviceName string, cfg Config, w io.Writer) (logger *zap.Logger, live *liveConfig, err error) {
+	cfg, export := applyEnvironment(cfg)
+	if cfg.Pseudonymize != nil {
+		resolved, keyErr := cfg.Pseudonymize.resolve()
+		if keyErr != nil {
+			err = keyErr
+		}
+		cfg.Pseudonymize = &resolved
+	}
+	live = newLiveConfig(cfg)
+	atomicLevel := live.level
+	errs, errOutErr := openErrorOutput(ctx, cfg.ErrorOutputPaths)
+	if errOutErr != nil {
+		err = errOutErr
+	}
+	live.errs = errs
+	ctx = context.WithValue(ctx, errorOutputKey{}, errs)
+	files := &openFiles{}
+	ctx = context.WithValue(ctx, openFilesKey{}, files)
+
+	// queue puts a sink's writer behind its own queue and goroutine when the sink
+	// asks for async delivery or IsolateSinks is set, so a blocked or failing sink
+	// cannot delay the others. addSink records the queue for per-sink stats.
+	var queued *AsyncWriteSyncer
+	queue := func(ws zapcore.WriteSyncer, async *AsyncConfig) zapcore.WriteSyncer {
+		if async == nil && cfg.IsolateSinks {
+			async = &isolatedSinkConfig
+		}
+		if async == nil {
+			return ws
+		}
+		queued = startAsyncWriteSyncer(ctx, ws, *async)
+		return queued
+	}
+
+	// addSink gates a sink at level, or at its own level if level is nil. Sinks
+	// at the global level follow the overrides of tenant, named and route loggers.
 	var cores []zapcore.Core
+	addSink := func(name string, core zapcore.Core, level zapcore.LevelEnabler) {
+		_, global := level.(zap.AtomicLevel)
+		core = newSinkLevelCore(newTimedCore(core, name), level, global)
+		cores = append(cores, core)
+		live.sinks = append(live.sinks, namedSink{name: name, core: core, async: queued})
+		queued = nil
+	}
 
 	// Always add human-readable console output to stdout
-	consoleCore := buildConsoleCore(atomicLevel)
-	cores = append(cores, consoleCore)
+	addSink("console", buildConsoleCore(cfg, queue), sinkLevel(cfg.ConsoleLevel, atomicLevel))
 
-	// Add JSON export core via ExportWriter (any environment) or ExportPath (dev/prod).
+	// JSON exporters share ExportLevel, so they can capture more detail than the console.
+	exportLevel := sinkLevel(cfg.ExportLevel, atomicLevel)
+
+	// Add JSON export core via ExportWriter (any environment) or ExportPath
+	// (environments whose preset exports: dev, prod and registered ones).
 	if cfg.ExportWriter != nil {
-		encoder := newExportEncoder(zapcore.NewJSONEncoder(jsonEncoderConfig()))
-		cores = append(cores, zapcore.NewCore(encoder, zapcore.AddSync(cfg.ExportWriter), atomicLevel))
-	} else if cfg.ExportPath != "" && (cfg.Environment == EnvDev || cfg.Environment == EnvProd) {
-		if exportCore := buildJSONExportCore(cfg.ExportPath, atomicLevel); exportCore != nil {
-			cores = append(cores, exportCore)
+		ws, encErr := wrapExport(ctx, zapcore.AddSync(cfg.ExportWriter), cfg, live)
+		if encErr != nil {
+			err = encErr
+		} else {
+			addSink("export", zapcore.NewCore(newEncoder(exportEncoding(cfg), cfg), queue(ws, nil), zapcore.DebugLevel), exportLevel)
+		}
+	} else if cfg.ExportPath != "" && export {
+		exportCore, exportErr := buildJSONExportCore(ctx, cfg, live, queue)
+		if exportErr != nil {
+			err = exportErr
+		} else {
+			addSink("export", exportCore, exportLevel)
+		}
+	}
+
+	// Add CloudWatch Logs export core if configured.
+	if cfg.CloudWatch != nil {
+		cloudWatchCore, cloudWatchErr := buildCloudWatchCore(ctx, cfg)
+		if cloudWatchErr != nil {
+			err = cloudWatchErr
+		} else {
+			addSink("cloudwatch", cloudWatchCore, exportLevel)
+		}
+	}
+
+	// Add Fluentd forward protocol core if configured.
+	if cfg.Fluent != nil {
+		fluentCore, fluentErr := buildFluentCore(ctx, serviceName, cfg, queue)
+		if fluentErr != nil {
+			err = fluentErr
+		} else {
+			addSink("fluent", fluentCore, exportLevel)
 		}
 	}
 
 	// Add custom writer if provided (useful for testing)
 	if w != nil {
-		encoder := newConsoleEncoder(zapcore.NewConsoleEncoder(consoleEncoderConfig()))
-		core := zapcore.NewCore(encoder, zapcore.AddSync(w), atomicLevel)
-		cores = append(cores, core)
+		addSink("writer", zapcore.NewCore(newEncoder(cfg.WriterEncoding, cfg), queue(zapcore.AddSync(w), nil), zapcore.DebugLevel), atomicLevel)
+	}
+
+	// Add custom writers from config
+	for i, spec := range cfg.Writers {
+		if spec.Writer == nil {
+			continue
+		}
+		writerCore, writerErr := buildWriterCore(ctx, spec, cfg, queue)
+		if writerErr != nil {
+			err = writerErr
+			continue
+		}
+		addSink("writers["+strconv.Itoa(i)+"]", writerCore, sinkLevel(spec.Level, atomicLevel))
 	}
 
-	combinedCore := zapcore.NewTee(cores...)
+	// Add user-supplied cores as they are
+	for i, core := range cfg.Cores {
+		if core != nil {
+			addSink("cores["+strconv.Itoa(i)+"]", core, nil)
+		}
+	}
 
-	// Apply sampling if configured
-	if cfg.Sampling != nil && cfg.Sampling.Initial > 0 {
-		combinedCore = zapcore.NewSamplerWithOptions(
-			combinedCore,
-			time.Second,
-			cfg.Sampling.Initial,
-			cfg.Sampling.Thereafter,
-		)
+	// Filters and sampling read their rules from live so they can change at runtime.
+	// The error counter sits beside the filtered sinks so it sees every emitted
+	// entry; the critical sink is only reached through Critical.
+	if cfg.NestedFields {
+		cores = applyNestedFields(cores)
+	}
+	if cfg.ErrorFingerprint {
+		cores = applyFingerprint(cores)
+	}
+	if cfg.StacktraceTrim != nil {
+		cores = applyStackTrim(cores, *cfg.StacktraceTrim)
+	}
+	if cfg.Schema != nil {
+		cores = applySchema(cores, cfg.Schema, errs)
+	}
+	if cfg.Pseudonymize != nil {
+		cores = applyPseudonymize(cores, *cfg.Pseudonymize)
+	}
+	if cfg.AnonymizeClientIP {
+		cores = applyAnonymizeClientIP(cores)
+	}
+	teed := []zapcore.Core{newFilterCore(zapcore.NewTee(cores...), live)}
+	if cfg.DebugEnrichment {
+		teed = []zapcore.Core{newDebugCore(zapcore.NewTee(teed...))}
+	}
+	var rate *errorRate
+	if cfg.ErrorRate != nil {
+		rate = &errorRate{maxPerKey: cfg.ErrorRate.MaxPerKey, counts: make(map[errorRateKey]*errorRateCount)}
+		teed = []zapcore.Core{newErrorRateCore(zapcore.NewTee(teed...), rate)}
+	}
+	teed = append(teed, &errorCounterCore{level: atomicLevel})
+	sinkCore := zapcore.NewTee(teed...)
+	if cfg.CriticalSink != nil {
+		var ack zapcore.Core = newAckCore(cfg)
+		if cfg.NestedFields {
+			ack = applyNestedFields([]zapcore.Core{ack})[0]
+		}
+		if cfg.Pseudonymize != nil {
+			ack = applyPseudonymize([]zapcore.Core{ack}, *cfg.Pseudonymize)[0]
+		}
+		if cfg.AnonymizeClientIP {
+			ack = applyAnonymizeClientIP([]zapcore.Core{ack})[0]
+		}
+		sinkCore = &criticalCore{Core: sinkCore, ack: ack}
+	}
+	if cfg.Throughput != nil {
+		sinkCore = newThroughputCore(sinkCore, *cfg.Throughput)
+	}
+	var combinedCore zapcore.Core = &sampleCore{
+		Core: sinkCore,
+		live: live,
+	}
+	if cfg.LastWords != nil {
+		lw, lwErr := newLastWords(ctx, cfg)
+		if lwErr != nil {
+			err = lwErr
+		} else {
+			live.lastWords = lw
+			combinedCore = &lastWordsCore{Core: combinedCore, lw: lw}
+		}
 	}
 
 	// Build options
 	opts := buildOptions(cfg, serviceName)
+	if cfg.CloudMetadata {
+		opts = append(opts, zap.Fields(cloudMetadataFields(ctx, cfg.CloudMetadataTimeout)...))
+	}
+	if cfg.ContainerMetadata {
+		opts = append(opts, zap.Fields(containerMetadataFields()...))
+	}
+	if cfg.Schema != nil && cfg.Schema.Version != "" {
+		opts = append(opts, zap.Fields(zap.String("schema_version", cfg.Schema.Version)))
+	}
+
+	opts = append(opts, zap.ErrorOutput(zapErrorOutput{errs: errs}))
+	logger = zap.New(combinedCore, opts...)
 
-	logger := zap.New(combinedCore, opts...)
+	if cfg.ErrorBudget != nil && len(cfg.ErrorBudget.Targets) > 0 {
+		go runErrorBudgets(ctx, logger, *cfg.ErrorBudget)
+	}
+
+	if rate != nil {
+		go runErrorRate(ctx, logger, rate, cfg.ErrorRate.Interval)
+	}
+
+	if cfg.ReopenOnSIGHUP {
+		go reopenOnSIGHUP(ctx)
+	}
 
 	// Register shutdown on context cancellation
 	go func() {
 		<-ctx.Done()
-		_ = logger.Sync()
+		if syncErr := logger.Sync(); syncErr != nil {
+			errs.report(fmt.Errorf("sync: %w", syncErr))
+		}
+		if closeErr := files.close(); closeErr != nil {
+			errs.report(closeErr)
+		}
+		errs.close()
 	}()
 
-	return logger, atomicLevel
+	return logger, live, err
 }
 
 // FromContext retrieves the logger from context, or returns the global logger.
+// Fields from Config.ContextExtractors are attached, the trace_id and span_id
+// of a StartSpan span or else the trace fields of the request or message being
+// handled, and with Config.DebugEnrichment, the context's pprof labels. They
+// are added on each call and never stored, so they are not repeated when
+// loggers derived with With are retrieved again.
 func FromContext(ctx context.Context) *zap.Logger {
+	l := contextLogger(ctx)
+	if fields := extractFields(ctx, l); len(fields) > 0 {
+		l = l.With(fields...)
+	}
+	if s := SpanFromContext(ctx); s != nil {
+		l = l.With(s.fields()...)
+	} else if fields, _ := ctx.Value(traceFieldsKey{}).([]zap.Field); len(fields) > 0 {
+		l = l.With(fields...)
+	}
+	if labels := ProfileLabels(ctx); labels.Type != zapcore.SkipType {
+		l = l.With(profileLabelsField(labels))
+	}
+	return l
+}
+
+// contextLogger returns the logger stored in ctx, or the global logger,
+// without the fields FromContext adds. Loggers stored in a context are
+// derived from it.
+func contextLogger(ctx context.Context) *zap.Logger {
 	if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
 		return l
 	}
@@ -155,6 +500,45 @@ func WithContext(ctx context.Context, l *zap.Logger) context.Context {
 	return context.WithValue(ctx, ctxKey{}, l)
 }
 
+// With derives a child of the context logger with the given fields and
+// returns a new context carrying it.
+func With(ctx context.Context, fields ...zap.Field) context.Context {
+	return WithContext(ctx, contextLogger(ctx).With(fields...))
+}
+
+// WithCallerSkip returns a logger that skips n extra stack frames when
+// reporting the caller. Use it in your own logging wrappers so entries point
+// at the wrapper's call site rather than the wrapper itself.
+func WithCallerSkip(l *zap.Logger, n int) *zap.Logger {
+	return l.WithOptions(zap.AddCallerSkip(n))
+}
+
+// DebugCtx logs at Debug level with the context logger.
+func DebugCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	WithCallerSkip(FromContext(ctx), 1).Debug(msg, fields...)
+}
+
+// InfoCtx logs at Info level with the context logger.
+func InfoCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	WithCallerSkip(FromContext(ctx), 1).Info(msg, fields...)
+}
+
+// WarnCtx logs at Warn level with the context logger.
+func WarnCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	WithCallerSkip(FromContext(ctx), 1).Warn(msg, fields...)
+}
+
+// ErrorCtx logs at Error level with the context logger.
+func ErrorCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	WithCallerSkip(FromContext(ctx), 1).Error(msg, fields...)
+}
+
+// SugarCtx returns the sugared context logger, for printf-style call sites
+// being migrated to structured logging.
+func SugarCtx(ctx context.Context) *zap.SugaredLogger {
+	return FromContext(ctx).Sugar()
+}
+
 // Global returns the global logger instance.
 func Global() *zap.Logger {
 	globalMu.RLock()
@@ -174,9 +558,7 @@ func GlobalLevel() zap.AtomicLevel {
 
 // SetGlobalLevel dynamically changes the global logger's level.
 func SetGlobalLevel(level string) {
-	globalMu.RLock()
-	defer globalMu.RUnlock()
-	globalLevel.SetLevel(parseLevel(level))
+	setLevel(GlobalLevel(), parseLevel(level))
 }
 
 // WithTraceID returns a new logger with trace and span IDs attached.
@@ -192,6 +574,15 @@ func WithError(l *zap.Logger, err error) *zap.Logger {
 	return l.With(zap.Error(err))
 }
 
+// sinkLevel returns the fixed level for a sink, or the logger's dynamic level
+// when level is empty.
+func sinkLevel(level string, dynamic zap.AtomicLevel) zapcore.LevelEnabler {
+	if level == "" {
+		return dynamic
+	}
+	return parseLevel(level)
+}
+
 func parseLevel(level string) zapcore.Level {
 	switch level {
 	case "debug":
@@ -214,8 +605,8 @@ func parseLevel(level string) zapcore.Level {
 }
 
 // consoleEncoderConfig returns encoder config for human-readable output.
-func consoleEncoderConfig() zapcore.EncoderConfig {
-	return zapcore.EncoderConfig{
+func consoleEncoderConfig(cfg Config) zapcore.EncoderConfig {
+	ec := zapcore.EncoderConfig{
 		TimeKey:        "ts",
 		LevelKey:       "level",
 		NameKey:        "logger",
@@ -224,16 +615,22 @@ func consoleEncoderConfig() zapcore.EncoderConfig {
 		MessageKey:     "msg",
 		StacktraceKey:  "stacktrace",
 		LineEnding:     zapcore.DefaultLineEnding,
-		EncodeLevel:    zapcore.CapitalColorLevelEncoder,
-		EncodeTime:     humanTimeEncoder,
-		EncodeDuration: zapcore.StringDurationEncoder,
-		EncodeCaller:   rootRelativeCallerEncoder,
+		EncodeDuration: stringDurationEncoder,
+		EncodeCaller:   callerEncoder(cfg.CallerFallback),
+	}
+	if cfg.ConsoleFunction {
+		ec.FunctionKey = "func"
 	}
+	applyFormat(&ec, cfg.ConsoleFormat)
+	// Console timestamps and levels are text even in numeric formats.
+	ec.EncodeLevel = consoleLevelEncoder(cfg.ConsoleFormat, nil)
+	ec.EncodeTime = consoleTimeEncoder(cfg.ConsoleFormat, "")
+	return ec
 }
 
 // jsonEncoderConfig returns encoder config for JSON export (log aggregation systems).
-func jsonEncoderConfig() zapcore.EncoderConfig {
-	return zapcore.EncoderConfig{
+func jsonEncoderConfig(cfg Config) zapcore.EncoderConfig {
+	ec := zapcore.EncoderConfig{
 		TimeKey:        "timestamp",
 		LevelKey:       "level",
 		NameKey:        "logger",
@@ -245,35 +642,133 @@ func jsonEncoderConfig() zapcore.EncoderConfig {
 		EncodeLevel:    zapcore.LowercaseLevelEncoder,
 		EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
 		EncodeDuration: zapcore.MillisDurationEncoder,
-		EncodeCaller:   rootRelativeCallerEncoder,
+		EncodeCaller:   callerEncoder(cfg.CallerFallback),
 	}
+	applyFormat(&ec, cfg.ExportFormat)
+	return ec
 }
 
-// buildConsoleCore creates a human-readable console core that writes to stdout.
-func buildConsoleCore(level zap.AtomicLevel) zapcore.Core {
-	encoder := newConsoleEncoder(zapcore.NewConsoleEncoder(consoleEncoderConfig()))
-	return zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), level)
+// buildConsoleCore creates the stdout core: human-readable on a terminal, with
+// colors dropped or JSON used when it is not one (see stdoutEncoding). Like the
+// other sink builders, it accepts every level; newLogger gates the sink.
+func buildConsoleCore(cfg Config, queue sinkQueue) zapcore.Core {
+	encoder := newEncoder(stdoutEncoding(cfg, isTerminal(os.Stdout)), cfg)
+	return zapcore.NewCore(encoder, queue(stdSink{os.Stdout}, nil), zapcore.DebugLevel)
 }
 
-// buildJSONExportCore creates a JSON core for log export/aggregation.
-func buildJSONExportCore(path string, level zap.AtomicLevel) zapcore.Core {
-	var ws zapcore.WriteSyncer
-
-	switch path {
-	case "stdout":
-		ws = zapcore.AddSync(os.Stdout)
-	case "stderr":
-		ws = zapcore.AddSync(os.Stderr)
-	default:
-		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// stdoutEncoding picks the stdout encoding: StdoutEncoding if set, JSON when
+// Environment is unset and stdout is not a terminal, otherwise console
+// (plain when colors are off).
+func stdoutEncoding(cfg Config, terminal bool) string {
+	if cfg.StdoutEncoding != "" {
+		return cfg.StdoutEncoding
+	}
+	if cfg.Environment == "" && !terminal {
+		return EncodingJSON
+	}
+	if !colorStdout(cfg.Color) {
+		return EncodingPlain
+	}
+	return EncodingConsole
+}
+
+// buildWriterCore creates a core for a custom writer spec.
+// With Spool set, entries the writer rejects are buffered on disk and replayed.
+// With Async set, writes are queued and delivered by their own workers.
+func buildWriterCore(ctx context.Context, spec WriterSpec, cfg Config, queue sinkQueue) (zapcore.Core, error) {
+	ws := zapcore.AddSync(spec.Writer)
+	if spec.Async != nil && spec.Async.workers() > 1 {
+		// Relaxed ordering writes from several workers at once.
+		ws = zapcore.Lock(ws)
+	}
+	if spec.Spool != nil {
+		spool, err := NewSpoolWriteSyncer(ws, *spec.Spool)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		ws = zapcore.AddSync(file)
+		spool.errs = internalErrors(ctx)
+		ws = spool
 	}
+	return zapcore.NewCore(newEncoder(spec.Encoding, cfg), queue(ws, spec.Async), zapcore.DebugLevel), nil
+}
 
-	encoder := newExportEncoder(zapcore.NewJSONEncoder(jsonEncoderConfig()))
-	return zapcore.NewCore(encoder, ws, level)
+// buildJSONExportCore creates a JSON core for log export/aggregation.
+// With ExportFallback set, writes fail over to the fallback sink when the export
+// path is unavailable or keeps failing, and return once it recovers; an error is
+// returned only if neither can be opened. With Archive set, the export file is
+// rolled and uploaded to object storage.
+func buildJSONExportCore(ctx context.Context, cfg Config, live *liveConfig, queue sinkQueue) (zapcore.Core, error) {
+	ws, err := openSink(ctx, cfg.ExportPath)
+	if err != nil && cfg.ExportFallback == "" {
+		return nil, fmt.Errorf("zapang: open export path: %w", err)
+	}
+	// A file sink is returned even when its file cannot be opened yet.
+	file, _ := ws.(*fileSink)
+	switch {
+	case cfg.Archive == nil:
+	case cfg.Archive.Client == nil:
+		return nil, fmt.Errorf("zapang: archive: no client")
+	case file == nil && err != nil:
+		return nil, fmt.Errorf("zapang: open export path: %w", err)
+	case file == nil:
+		return nil, fmt.Errorf("zapang: archive: export path %q is not a file", cfg.ExportPath)
+	}
+
+	if cfg.ExportFallback != "" {
+		fallback, fbErr := openSink(ctx, cfg.ExportFallback)
+		switch {
+		case fbErr == nil && ws == nil:
+			// Nothing to fail back to, e.g. a malformed socket address.
+			internalErrors(ctx).report(fmt.Errorf("open export path: %w; writing to %s", err, cfg.ExportFallback))
+			ws = fallback
+		case fbErr == nil:
+			failover := NewFailoverWriteSyncer(ws, fallback, FailoverConfig{})
+			failover.errs = internalErrors(ctx)
+			ws = failover
+		case err != nil:
+			return nil, fmt.Errorf("zapang: open export path: %w; fallback: %w", err, fbErr)
+		}
+	}
+
+	ws, err = wrapExport(ctx, ws, cfg, live)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Archive != nil {
+		ws = startArchiver(ctx, cfg, file, ws)
+	}
+	return zapcore.NewCore(newEncoder(exportEncoding(cfg), cfg), queue(ws, nil), zapcore.DebugLevel), nil
+}
+
+// exportEncoding returns the encoding of the export sink: ExportEncoding, or JSON.
+func exportEncoding(cfg Config) string {
+	if cfg.ExportEncoding != "" {
+		return cfg.ExportEncoding
+	}
+	return EncodingJSON
+}
+
+// wrapExport wraps ws with AES-GCM encryption when ExportEncryption is set and
+// with gzip compression when ExportCompression is set. Entries are compressed
+// before they are encrypted, since ciphertext does not compress. The
+// encryption is kept in live for RotateExportKey.
+func wrapExport(ctx context.Context, ws zapcore.WriteSyncer, cfg Config, live *liveConfig) (zapcore.WriteSyncer, error) {
+	if cfg.ExportEncryption != nil {
+		enc, err := NewEncryptingWriteSyncer(ws, *cfg.ExportEncryption)
+		if err != nil {
+			return nil, fmt.Errorf("zapang: export encryption: %w", err)
+		}
+		live.exportKey = enc
+		ws = enc
+	}
+	if cfg.ExportCompression == nil {
+		return ws, nil
+	}
+	gz, err := NewCompressingWriteSyncer(ctx, ws, *cfg.ExportCompression)
+	if err != nil {
+		return nil, fmt.Errorf("zapang: export compression: %w", err)
+	}
+	return gz, nil
 }
 
 func buildOptions(cfg Config, serviceName string) []zap.Option {
@@ -285,6 +780,10 @@ func buildOptions(cfg Config, serviceName string) []zap.Option {
 		opts = append(opts, zap.AddCaller())
 	}
 
+	if cfg.Clock != nil {
+		opts = append(opts, zap.WithClock(cfg.Clock))
+	}
+
 	if !cfg.DisableStacktrace {
 		stackLevel := parseLevel(cfg.StacktraceLevel)
 		if cfg.StacktraceLevel == "" {
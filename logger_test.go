@@ -3,11 +3,26 @@ package zapang
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-faster/errors"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestRealExample(t *testing.T) {
@@ -46,3 +61,914 @@ func TestExportJSON(t *testing.T) {
 	t.Log("=== writer output ===")
 	t.Log(buf.String())
 }
+
+func TestWriterEncodingPlain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	l := New(ctx, "serviceName", Config{
+		Level:          "debug",
+		WriterEncoding: EncodingPlain,
+	}, &buf)
+
+	err := errors.Wrap(errors.New("failed to parse.."), "parse some")
+	l.Error("test error:", zap.Error(err))
+
+	out := buf.String()
+	if strings.Contains(out, "\033[") {
+		t.Fatalf("plain output contains ANSI codes: %q", out)
+	}
+	if !strings.Contains(out, "ERROR") || !strings.Contains(out, "error=parse some: failed to parse..") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestConsoleTheme(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	theme := DefaultTheme()
+	theme.Levels["warn"] = "1;35"
+	theme.Time = "2"
+	theme.Fields = map[string]string{"trace_id": "36"}
+
+	var buf bytes.Buffer
+	l := New(ctx, "serviceName", Config{Level: "debug", Theme: &theme}, &buf)
+	l.Warn("slow", TraceID("abc"))
+
+	out := buf.String()
+	for _, want := range []string{"\033[1;35mWARN\033[0m", "\033[2m", "trace_id=\033[36mabc\033[0m"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in %q", want, out)
+		}
+	}
+}
+
+func TestConsoleEncoderOutput(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 5, 0, time.UTC)
+	enc := newPlainEncoder(Config{}).Clone()
+	zap.String("service", "svc").AddTo(enc)
+	zap.Int("dup", 1).AddTo(enc)
+
+	tests := []struct {
+		ent    zapcore.Entry
+		fields []zap.Field
+		want   string
+	}{
+		{
+			ent:  zapcore.Entry{Level: zapcore.DebugLevel, Time: ts, Message: "bare"},
+			want: "01 Mar 12:30:05 UTC\t\tDEBUG\tbare\tdup=1\tservice=svc\n",
+		},
+		{
+			ent: zapcore.Entry{Level: zapcore.WarnLevel, Time: ts, LoggerName: "api", Message: "fields",
+				Caller: zapcore.NewEntryCaller(1, projectRoot+"/x.go", 3, true)},
+			fields: []zap.Field{
+				zap.Int("b", 2), zap.String("a", "x\ty\"z\x01é"), zap.Float64("f", 1e6), zap.Bool("ok", false),
+				zap.Duration("d", 1500*time.Millisecond), zap.Int("dup", 2), zap.Any("nil", nil),
+				zap.Any("obj", map[string]any{"k": 1, "j": []int{1, 2}}), zap.Int64("big", 1<<62),
+			},
+			want: "01 Mar 12:30:05 UTC\t\tWARN\tapi\t./x.go:3\tfields\ta=x\ty\"z\x01é\tb=2\tbig=4.611686018427388e+18" +
+				"\td=1.5s\tdup=2\tf=1e+06\tnil=<nil>\tobj=map[j:[1 2] k:1]\tok=false\tservice=svc\n",
+		},
+		{
+			ent:    zapcore.Entry{Level: zapcore.ErrorLevel, Time: ts, Message: "err", Stack: "main.f\n\t/x/y.go:1"},
+			fields: []zap.Field{zap.Error(errors.New("boom")), stepDepth(2)},
+			want:   "01 Mar 12:30:05 UTC\t\tERROR\t    err\tdup=1\terror=boom\tservice=svc\nmain.f\n\t/x/y.go:1\n",
+		},
+	}
+	for _, tt := range tests {
+		buf, err := enc.EncodeEntry(tt.ent, tt.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, _ := strings.Cut(buf.String(), "boom:\n") // drop the verbose block
+		buf.Free()
+		if got != tt.want {
+			t.Errorf("got  %q\nwant %q", got, tt.want)
+		}
+	}
+
+	for _, d := range []time.Duration{0, 1, 999, 1500, 2 * time.Millisecond, 1001 * time.Millisecond,
+		90 * time.Second, -3*time.Hour - time.Nanosecond, 1<<63 - 1, -1 << 63} {
+		if got := string(appendDuration(nil, d)); got != d.String() {
+			t.Errorf("appendDuration(%d) = %q, want %q", int64(d), got, d.String())
+		}
+	}
+}
+
+func TestConsoleErrorReport(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 5, 0, time.UTC)
+	enc := newPlainEncoder(Config{ConsoleErrors: ConsoleErrorsReport}).Clone()
+	zap.String("service", "svc").AddTo(enc)
+
+	declined := errors.New("card declined")
+	err := fmt.Errorf("charge order 42: %w", errors.Join(&os.PathError{Op: "open", Path: "/k", Err: os.ErrNotExist}, declined))
+	ent := zapcore.Entry{Level: zapcore.ErrorLevel, Time: ts, Message: "charge failed",
+		Stack: "main.charge\n\t/x/charge.go:7\nruntime.goexit\n\t/go/src/runtime/asm.s:1"}
+	buf, encErr := enc.EncodeEntry(ent, []zap.Field{zap.Int("order_id", 42), zap.Error(err)})
+	if encErr != nil {
+		t.Fatal(encErr)
+	}
+	defer buf.Free()
+
+	want := "=== ERROR " + strings.Repeat("=", 62) + "\n" +
+		"01 Mar 12:30:05 UTC\t\tERROR\tcharge failed\n" +
+		"error:\n" +
+		"  - charge order 42 (*fmt.wrapError)\n" +
+		"  - 2 errors (*errors.joinError)\n" +
+		"    - open /k (*fs.PathError)\n" +
+		"    - file does not exist (*errors.errorString)\n" +
+		"    - card declined (*errors.errorString)\n" +
+		"fields:\n" +
+		"  order_id  42\n" +
+		"  service   svc\n" +
+		"stack:\n" +
+		"  main.charge\n" +
+		"  \t/x/charge.go:7\n" +
+		strings.Repeat("=", 72) + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Below Error, and with the line style, entries stay on one line.
+	for _, tt := range []struct {
+		enc zapcore.Encoder
+		lvl zapcore.Level
+	}{
+		{enc, zapcore.WarnLevel},
+		{newPlainEncoder(Config{ConsoleErrors: ConsoleErrorsLine}), zapcore.ErrorLevel},
+	} {
+		buf, _ := tt.enc.EncodeEntry(zapcore.Entry{Level: tt.lvl, Time: ts, Message: "m"}, []zap.Field{zap.Error(declined)})
+		if strings.HasPrefix(buf.String(), "===") {
+			t.Errorf("%v entry rendered as a report: %q", tt.lvl, buf.String())
+		}
+		buf.Free()
+	}
+
+	if cfg, _ := applyEnvironment(Config{Environment: EnvLocal}); cfg.ConsoleErrors != ConsoleErrorsReport {
+		t.Errorf("local environment ConsoleErrors = %q, want report", cfg.ConsoleErrors)
+	}
+}
+
+func TestConsoleEncoderAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are unreliable under the race detector")
+	}
+	for _, enc := range []zapcore.Encoder{newConsoleEncoder(Config{}), newPlainEncoder(Config{})} {
+		ent, fields := benchEntry(), benchFields()
+		allocs := testing.AllocsPerRun(100, func() {
+			buf, _ := enc.EncodeEntry(ent, fields)
+			buf.Free()
+		})
+		if allocs != 0 {
+			t.Errorf("%d allocations per entry, want 0", int(allocs))
+		}
+	}
+}
+
+func TestConsoleDurations(t *testing.T) {
+	ent := zapcore.Entry{Message: "done"}
+	fields := []zap.Field{LatencyMs(1234567 * time.Nanosecond), zap.Float64("wait_ms", 2500), zap.String("note_ms", "x")}
+	for format, want := range map[*FormatConfig]string{
+		nil:              "latency_ms=1.23ms	note_ms=x	wait_ms=2.5s",
+		{Duration: "ms"}: "latency_ms=1.234567	note_ms=x	wait_ms=2500",
+	} {
+		buf, err := newPlainEncoder(Config{ConsoleFormat: format}).EncodeEntry(ent, fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(buf.String()); !strings.HasSuffix(got, want) {
+			t.Errorf("format %v: got %q, want suffix %q", format, got, want)
+		}
+		buf.Free()
+	}
+}
+
+func TestConsoleFunction(t *testing.T) {
+	ent := zapcore.Entry{Message: "charged", Caller: zapcore.EntryCaller{
+		Defined:  true,
+		File:     "/src/billing/service.go",
+		Line:     42,
+		Function: "github.com/org/svc/billing.(*Service).Charge",
+	}}
+	for on, want := range map[bool]bool{false: false, true: true} {
+		buf, err := newPlainEncoder(Config{ConsoleFunction: on}).EncodeEntry(ent, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(buf.String(), "\tbilling.(*Service).Charge\tcharged"); got != want {
+			t.Errorf("ConsoleFunction=%v: got %q", on, buf.String())
+		}
+		buf.Free()
+	}
+}
+
+// msgOnlyEncoder is a custom encoding for TestRegisterEncoder: the message only.
+type msgOnlyEncoder struct{ zapcore.Encoder }
+
+func (e msgOnlyEncoder) Clone() zapcore.Encoder { return msgOnlyEncoder{e.Encoder.Clone()} }
+
+func (e msgOnlyEncoder) EncodeEntry(ent zapcore.Entry, _ []zapcore.Field) (*buffer.Buffer, error) {
+	buf := buffer.NewPool().Get()
+	buf.AppendString("msg:" + ent.Message + "\n")
+	return buf, nil
+}
+
+func init() {
+	RegisterEncoder("msgonly", func(Config) zapcore.Encoder {
+		return msgOnlyEncoder{zapcore.NewJSONEncoder(zapcore.EncoderConfig{})}
+	})
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out bytes.Buffer
+	l := New(ctx, "serviceName", Config{
+		DisableCaller: true,
+		Writers:       []WriterSpec{{Writer: &out, Encoding: "msgonly"}},
+	}, nil)
+	l.Info("hello", zap.String("k", "v"))
+	if out.String() != "msg:hello\n" {
+		t.Fatalf("expected the registered encoder's output, got %q", out.String())
+	}
+
+	if err := (Config{WriterEncoding: "msgonly"}).Validate(); err != nil {
+		t.Fatalf("registered encodings must validate: %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic for a duplicate registration")
+		}
+	}()
+	RegisterEncoder("msgonly", func(Config) zapcore.Encoder { return nil })
+}
+
+func TestEncoderFormats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	var export, console bytes.Buffer
+	l := New(ctx, "serviceName", Config{
+		Level:         "debug",
+		Clock:         FixedClock(now),
+		ExportWriter:  &export,
+		ExportFormat:  &FormatConfig{Time: TimeEpochMillis, Duration: "s", Level: "uppercase"},
+		ConsoleFormat: &FormatConfig{Time: "15:04", Level: "lowercase"},
+		Writers:       []WriterSpec{{Writer: &console, Encoding: EncodingPlain}},
+	}, nil)
+	l.Info("took", zap.Duration("elapsed", 1500*time.Millisecond))
+	_ = l.Sync()
+
+	var raw map[string]any
+	if err := json.Unmarshal(export.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw["timestamp"] != float64(now.UnixMilli()) || raw["level"] != "INFO" || raw["elapsed"] != 1.5 {
+		t.Fatalf("unexpected export entry: %v", raw)
+	}
+	e, err := ParseEntry(export.Bytes())
+	if err != nil || !e.Time.Equal(now) {
+		t.Fatalf("numeric timestamp not parsed: %v %v", e.Time, err)
+	}
+
+	if want := "12:30\t\tinfo\t"; !strings.HasPrefix(console.String(), want) {
+		t.Fatalf("expected console prefix %q, got %q", want, console.String())
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var export bytes.Buffer
+	l := New(ctx, "serviceName", Config{
+		ExportWriter:   &export,
+		MaxFieldLength: 16,
+		MaxEntrySize:   512,
+	}, nil)
+	decode := func() map[string]any {
+		t.Helper()
+		var raw map[string]any
+		if err := json.Unmarshal(export.Bytes(), &raw); err != nil {
+			t.Fatalf("%v: %s", err, export.String())
+		}
+		export.Reset()
+		return raw
+	}
+
+	l.Info("short", zap.String("name", "ok"))
+	if raw := decode(); raw["truncated"] != nil {
+		t.Fatalf("entries within the limits must not be marked: %v", raw)
+	}
+
+	l.With(zap.String("ctx", strings.Repeat("c", 40))).Info("long field", zap.String("body", "héllo wörld, this is long"))
+	raw := decode()
+	if raw["body"] != "héllo wörld, t..." || raw["ctx"] != strings.Repeat("c", 16)+"..." || raw["truncated"] != true {
+		t.Fatalf("expected truncated fields: %v", raw)
+	}
+
+	l.Info("big payload", zap.Any("payload", map[string]string{"data": strings.Repeat("x", 4096)}), zap.Int("n", 1))
+	if export.Len() > 512 {
+		t.Fatalf("entry of %d bytes exceeds MaxEntrySize", export.Len())
+	}
+	raw = decode()
+	if raw["payload"] != nil || raw["n"] != 1.0 || raw["message"] != "big payload" || raw["truncated"] != true {
+		t.Fatalf("expected the payload to be dropped: %v", raw)
+	}
+	if dropped, _ := raw["truncated_fields"].([]any); len(dropped) != 1 || dropped[0] != "payload" {
+		t.Fatalf("expected truncated_fields [payload], got %v", raw["truncated_fields"])
+	}
+
+	l.Info(strings.Repeat("m", 2048))
+	if export.Len() > 512 {
+		t.Fatalf("entry of %d bytes exceeds MaxEntrySize", export.Len())
+	}
+	if raw = decode(); !strings.HasSuffix(raw["message"].(string), "m...") {
+		t.Fatalf("expected a shortened message: %v", raw)
+	}
+}
+
+func TestPackageQualifiedPath(t *testing.T) {
+	tests := []struct {
+		fn, want string
+	}{
+		{"github.com/org/repo/pkg.(*T).Method", "github.com/org/repo/pkg/file.go"},
+		{"github.com/org/repo/pkg.Func.func1", "github.com/org/repo/pkg/file.go"},
+		{"github.com/org/repo/pkg.(*T[...]).Method", "github.com/org/repo/pkg/file.go"},
+		{"gopkg.in/yaml%2ev3.(*decoder).unmarshal", "gopkg.in/yaml.v3/file.go"},
+		{"go.opentelemetry.io/otel/sdk/trace.(*tracer).Start", "go.opentelemetry.io/otel/sdk/trace/file.go"},
+		{"example.com/v2.Func", "example.com/v2/file.go"},
+		{"main.main", "main/file.go"},
+		{"main.init.0", "main/file.go"},
+	}
+	for _, tt := range tests {
+		got := packageQualifiedPath(zapcore.EntryCaller{Defined: true, Function: tt.fn, File: "/build/src/pkg/file.go"})
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.fn, got, tt.want)
+		}
+	}
+}
+
+func TestNewEReportsUnopenableExportPath(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	l, err := NewE(ctx, "serviceName", Config{
+		Environment: EnvProd,
+		ExportPath:  t.TempDir() + "/missing/dir/out.jsonl",
+		ErrorRate:   &ErrorRateConfig{MaxPerKey: 1},
+	}, nil)
+	if err == nil || l != nil {
+		t.Fatalf("expected error for unopenable export path, got logger=%v err=%v", l, err)
+	}
+
+	// The discarded logger's goroutines stop although ctx is still live.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewEClosesOpenedFiles(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("needs /proc/self/fd")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The export file opens, then the spool of a later writer fails.
+	dir := t.TempDir()
+	export := filepath.Join(dir, "out.jsonl")
+	l, err := NewE(ctx, "serviceName", Config{
+		Environment: EnvProd,
+		ExportPath:  export,
+		Writers:     []WriterSpec{{Writer: io.Discard, Spool: &SpoolConfig{Path: filepath.Join(dir, "missing", "spool")}}},
+	}, nil)
+	if err == nil || l != nil {
+		t.Fatalf("expected spool error, got logger=%v err=%v", l, err)
+	}
+
+	isOpen := func() bool {
+		fds, _ := os.ReadDir("/proc/self/fd")
+		for _, fd := range fds {
+			if target, _ := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); target == export {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for isOpen() {
+		if time.Now().After(deadline) {
+			t.Fatal("export file of the discarded logger is still open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWrappersReportCallSite(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	ctx := WithContext(context.Background(), zap.New(obs, zap.AddCaller()))
+
+	InfoCtx(ctx, "info")
+	ErrorCtx(ctx, "error")
+	SugarCtx(ctx).Infof("sugar %d", 1)
+	NewEvent("event").Emit(ctx)
+	TraceEvent(FromContext(ctx), nil, "trace")
+
+	for _, e := range logs.All() {
+		if !strings.HasSuffix(e.Caller.File, "logger_test.go") {
+			t.Errorf("%q reported caller %s", e.Message, e.Caller.TrimmedPath())
+		}
+	}
+}
+
+func TestStdoutEncoding(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	cases := []struct {
+		cfg      Config
+		terminal bool
+		want     string
+	}{
+		{Config{}, false, EncodingJSON},
+		{Config{}, true, EncodingPlain},
+		{Config{Environment: EnvProd}, false, EncodingPlain},
+		{Config{StdoutEncoding: EncodingConsole}, false, EncodingConsole},
+		{Config{Environment: EnvLocal, StdoutEncoding: EncodingJSON}, true, EncodingJSON},
+	}
+	for _, c := range cases {
+		if got := stdoutEncoding(c.cfg, c.terminal); got != c.want {
+			t.Errorf("%+v terminal=%v: got %s, want %s", c.cfg, c.terminal, got, c.want)
+		}
+	}
+}
+
+func TestDebugEnrichment(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf, plain bytes.Buffer
+	l := New(ctx, "serviceName", Config{Level: "debug", WriterEncoding: EncodingJSON, DebugEnrichment: true}, &buf)
+	other := New(ctx, "serviceName", Config{Level: "debug", WriterEncoding: EncodingJSON}, &plain)
+	pprof.Do(WithContext(ctx, l), pprof.Labels("handler", "checkout"), func(ctx context.Context) {
+		ctx = With(With(ctx, zap.String("a", "1")), zap.String("b", "2"))
+		FromContext(ctx).Info("profiled")
+		FromContext(WithContext(ctx, other)).Info("profiled")
+	})
+
+	out := buf.String()
+	if !strings.Contains(out, `"pprof_labels":{"handler":"checkout"}`) || !strings.Contains(out, fmt.Sprintf(`"goroutine_id":%d`, goroutineID())) {
+		t.Fatalf("missing debug enrichment: %s", out)
+	}
+	if strings.Count(out, "pprof_labels") != 1 || strings.Count(out, "goroutine_id") != 1 {
+		t.Fatalf("debug fields repeated: %s", out)
+	}
+	if strings.Contains(plain.String(), "pprof_labels") || strings.Contains(plain.String(), "goroutine_id") {
+		t.Fatalf("debug enrichment leaked to another logger: %s", plain.String())
+	}
+}
+
+func TestExportLevel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var console, export bytes.Buffer
+	l := New(ctx, "serviceName", Config{
+		Level:        "info",
+		ExportLevel:  "debug",
+		ExportWriter: &export,
+	}, &console)
+	l.Debug("detail")
+	l.Info("summary")
+
+	if strings.Contains(console.String(), "detail") || !strings.Contains(console.String(), "summary") {
+		t.Fatalf("writer should follow Level: %q", console.String())
+	}
+	if !strings.Contains(export.String(), `"message":"detail"`) || !strings.Contains(export.String(), `"message":"summary"`) {
+		t.Fatalf("export should follow ExportLevel: %q", export.String())
+	}
+}
+
+func TestWriters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var alerts, console bytes.Buffer
+	l := New(ctx, "serviceName", Config{Level: "info", Writers: []WriterSpec{
+		{Writer: &alerts, Encoding: EncodingJSON, Level: "warn"},
+		{Writer: &console, Encoding: EncodingPlain},
+		{Writer: nil}, // skipped
+	}}, nil)
+	l.Debug("detail")
+	l.Info("summary")
+	l.Warn("degraded")
+
+	if got := alerts.String(); strings.Contains(got, "summary") || !strings.Contains(got, `"message":"degraded"`) {
+		t.Fatalf("json writer should log warn and above as JSON: %q", got)
+	}
+	got := console.String()
+	if strings.Contains(got, "detail") || !strings.Contains(got, "summary") || !strings.Contains(got, "degraded") {
+		t.Fatalf("writer without a level should follow Level: %q", got)
+	}
+	if strings.Contains(got, "\x1b[") || strings.Contains(got, `"message"`) {
+		t.Fatalf("plain writer should be uncolored key=value: %q", got)
+	}
+}
+
+func TestSamplingDrops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out bytes.Buffer
+	var dropped []string
+	l := New(ctx, "serviceName", Config{Level: "info", WriterEncoding: EncodingJSON, Sampling: &SamplingConfig{
+		Initial: 2,
+		OnDrop:  func(ent zapcore.Entry) { dropped = append(dropped, ent.Message) },
+	}}, &out)
+
+	before := Dropped()
+	for range 5 {
+		l.Info("repeated")
+	}
+	if n := strings.Count(out.String(), "repeated"); n != 2 {
+		t.Fatalf("expected 2 sampled entries, got %d: %s", n, out.String())
+	}
+	if got := Dropped() - before; got != 3 {
+		t.Fatalf("expected 3 drops counted, got %d", got)
+	}
+	if len(dropped) != 3 || dropped[0] != "repeated" {
+		t.Fatalf("OnDrop saw %v", dropped)
+	}
+}
+
+func TestLastWords(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := t.TempDir() + "/last-words.jsonl"
+	var buf bytes.Buffer
+	l := New(ctx, "serviceName", Config{
+		Level:     "info",
+		LastWords: &LastWordsConfig{Size: 2, Output: path},
+	}, &buf)
+	l.Debug("step 1")
+	l.With(zap.Int("attempt", 2)).Debug("step 2")
+	l.Info("step 3")
+
+	func() {
+		defer func() { _ = recover() }()
+		l.Panic("boom")
+	}()
+
+	if strings.Contains(buf.String(), "step 2") {
+		t.Fatalf("debug entry reached the writer: %q", buf.String())
+	}
+	dump, _ := os.ReadFile(path)
+	out := string(dump)
+	if strings.Contains(out, "step 1") || !strings.Contains(out, `"message":"step 2","service":"serviceName","attempt":2`) || !strings.Contains(out, "step 3") {
+		t.Fatalf("unexpected dump: %s", out)
+	}
+
+	// Below both levels, the logger rejects calls before Check.
+	quiet := New(ctx, "serviceName", Config{Level: "warn", LastWords: &LastWordsConfig{Output: path, Level: "info"}}, &buf)
+	if quiet.Core().Enabled(zapcore.DebugLevel) || !quiet.Core().Enabled(zapcore.InfoLevel) {
+		t.Fatal("last words core should be enabled from its own level")
+	}
+}
+
+func TestBindFlags(t *testing.T) {
+	cfg := DefaultLoggerConfig()
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	cfg.BindFlags(fs)
+	if err := fs.Parse([]string{"-log-level=debug", "-log-export", "/tmp/x.jsonl", "-log-disable-caller"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level != "debug" || cfg.ExportPath != "/tmp/x.jsonl" || !cfg.DisableCaller {
+		t.Fatalf("flags were not applied: %+v", cfg)
+	}
+	if cfg.Environment != EnvLocal || cfg.StacktraceLevel != "error" {
+		t.Fatalf("unset flags changed defaults: %+v", cfg)
+	}
+	if f := fs.Lookup("log-env"); f == nil || f.DefValue != EnvLocal {
+		t.Fatalf("log-env default should be the config value: %v", f)
+	}
+}
+
+func TestRegisterEnvironment(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := t.TempDir() + "/ci.jsonl"
+	RegisterEnvironment("ci", EnvironmentPreset{Export: true, ExportPath: path, Level: "debug", StdoutEncoding: EncodingPlain})
+	defer func() {
+		environmentsMu.Lock()
+		delete(environments, "ci")
+		environmentsMu.Unlock()
+	}()
+
+	l := New(ctx, "serviceName", Config{Environment: "ci"}, nil)
+	l.Debug("from ci")
+	_ = l.Sync()
+
+	out, _ := os.ReadFile(path)
+	if !strings.Contains(string(out), `"message":"from ci"`) {
+		t.Fatalf("preset export path and level not applied: %q", out)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	obs, logs := observer.New(zapcore.WarnLevel)
+	var export bytes.Buffer
+	l := NewWithOptions(ctx, "serviceName",
+		WithLevel("debug"),
+		WithExport(&export),
+		WithSampling(0, 0),
+		WithCore(obs),
+	)
+	l.Debug("detail")
+	l.Warn("careful")
+
+	if !strings.Contains(export.String(), `"message":"detail"`) {
+		t.Fatalf("export missing debug entry: %q", export.String())
+	}
+	if logs.Len() != 1 || logs.All()[0].Message != "careful" || logs.All()[0].ContextMap()["service"] != "serviceName" {
+		t.Fatalf("custom core should get warn entries with logger fields: %v", logs.All())
+	}
+}
+
+func TestExtraCores(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	obs, logs := observer.New(zapcore.DebugLevel)
+	l := New(ctx, "serviceName", Config{Level: "info"}, &buf, obs)
+	l.Debug("detail")
+	l.Info("teed")
+
+	// Extra cores keep their own level, independent of the logger's.
+	if logs.Len() != 2 || logs.All()[1].ContextMap()["service"] != "serviceName" {
+		t.Fatalf("extra core did not get the entries: %v", logs.All())
+	}
+	if strings.Contains(buf.String(), "detail") {
+		t.Fatalf("built-in sinks should stay at info: %q", buf.String())
+	}
+
+	// A Tee keeps its branches' levels and a sampler keeps sampling.
+	warnObs, warnLogs := observer.New(zapcore.WarnLevel)
+	infoObs, infoLogs := observer.New(zapcore.InfoLevel)
+	sampledObs, sampledLogs := observer.New(zapcore.DebugLevel)
+	l = New(ctx, "serviceName", Config{Level: "debug", ConsoleLevel: "fatal"}, nil,
+		zapcore.NewTee(warnObs, infoObs),
+		zapcore.NewSamplerWithOptions(sampledObs, time.Hour, 1, 0))
+	for range 3 {
+		l.Info("repeated")
+	}
+	l.Warn("careful")
+
+	if warnLogs.Len() != 1 || infoLogs.Len() != 4 {
+		t.Fatalf("tee branches got %d and %d entries, want 1 and 4", warnLogs.Len(), infoLogs.Len())
+	}
+	if sampledLogs.Len() != 2 {
+		t.Fatalf("sampler let through %v", sampledLogs.All())
+	}
+}
+
+func TestSinksKeepTheirCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Sinks are wrapped to time writes and count failures; the wrapper must
+	// still go through the sink's Check, which is where a Tee's branches and
+	// most cores apply their level.
+	errObs, errLogs := observer.New(zapcore.ErrorLevel)
+	debugObs, debugLogs := observer.New(zapcore.DebugLevel)
+	l := New(ctx, "serviceName", Config{Level: "debug", ConsoleLevel: "fatal"}, io.Discard, zapcore.NewTee(errObs, debugObs))
+	l.Info("hello")
+	l.Error("failed")
+
+	if errLogs.Len() != 1 || errLogs.All()[0].Message != "failed" {
+		t.Fatalf("error branch got %v", errLogs.All())
+	}
+	if debugLogs.Len() != 2 {
+		t.Fatalf("debug branch got %v", debugLogs.All())
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	obs, logs := observer.New(zapcore.InfoLevel)
+	l := New(ctx, "serviceName", Config{
+		Level:     "info",
+		ErrorRate: &ErrorRateConfig{Interval: 50 * time.Millisecond, MaxPerKey: 2},
+	}, nil, obs)
+	db := l.With(Component("db"))
+	for range 4 {
+		db.Error("query failed", ErrorCode("timeout"))
+	}
+	l.Error("unowned")
+
+	if n := logs.FilterMessage("query failed").Len(); n != 2 {
+		t.Fatalf("expected 2 written entries under the cap, got %d", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("error rate").Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	summary := logs.FilterMessage("error rate").All()
+	if len(summary) == 0 {
+		t.Fatal("no error rate summary")
+	}
+	ctxMap := summary[0].ContextMap()
+	if summary[0].Level != zapcore.WarnLevel || ctxMap["errors"] != uint64(5) || ctxMap["suppressed"] != uint64(2) {
+		t.Fatalf("unexpected summary: %v %v", summary[0].Level, ctxMap)
+	}
+	counts := ctxMap["error_counts"].([]any)
+	first := counts[0].(map[string]any)
+	if len(counts) != 2 || first["component"] != "db" || first["error_code"] != "timeout" || first["count"] != uint64(4) {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func TestNamedLoggers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Obtained before New, as a package-level variable would be.
+	log := Get("test.named")
+	if Get("test.named") != log {
+		t.Fatal("Get should cache loggers by name")
+	}
+
+	// The writer follows the global level; the console, the export and the
+	// observer core keep their own.
+	var buf, export bytes.Buffer
+	obs, logs := observer.New(zapcore.InfoLevel)
+	New(ctx, "serviceName", Config{
+		Level:          "info",
+		ConsoleLevel:   "error",
+		ExportLevel:    "error",
+		ExportWriter:   &export,
+		WriterEncoding: EncodingJSON,
+	}, &buf, obs)
+	log.Debug("hidden")
+	SetNamedLevel("test.named", "debug")
+	defer SetNamedLevel("test.named", "")
+	log.With(UserID("u1")).Debug("shown")
+	Get("test.other").Debug("other hidden")
+
+	if strings.Contains(buf.String(), "hidden") {
+		t.Fatalf("entries below the level were written: %s", buf.String())
+	}
+	var shown map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &shown); err != nil {
+		t.Fatalf("want one entry: %v: %s", err, buf.String())
+	}
+	if shown["message"] != "shown" || shown["logger"] != "test.named" || shown["user_id"] != "u1" || shown["service"] != "serviceName" {
+		t.Fatalf("unexpected named entry: %v", shown)
+	}
+	if export.Len() != 0 || logs.Len() != 0 {
+		t.Fatalf("override bypassed fixed sink levels: export %q, observer %v", export.String(), logs.All())
+	}
+
+	SetNamedLevel("test.named", "warn")
+	log.Info("quieted")
+	if strings.Contains(buf.String(), "quieted") {
+		t.Fatalf("entry above the global level but below the override was written: %s", buf.String())
+	}
+}
+
+func TestReplaceGlobals(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	obs, logs := observer.New(zapcore.InfoLevel)
+	New(ctx, "serviceName", Config{Level: "info", ConsoleLevel: "fatal", ReplaceGlobals: true}, io.Discard, obs)
+	zap.L().Info("from zap.L")
+	zap.S().Infow("from zap.S")
+	log.Print("from log")
+
+	var msgs []string
+	for _, e := range logs.All() {
+		msgs = append(msgs, e.Message)
+	}
+	if got := strings.Join(msgs, ","); got != "from zap.L,from zap.S,from log" {
+		t.Fatalf("unexpected entries: %s", got)
+	}
+
+	// A later logger without ReplaceGlobals restores zap's globals and the
+	// standard library logger.
+	New(ctx, "serviceName", Config{Level: "info", ConsoleLevel: "fatal"}, io.Discard)
+	zap.L().Info("after")
+	log.Print("after")
+	if logs.Len() != 3 {
+		t.Fatalf("expected the globals to be restored, got %v", logs.All())
+	}
+}
+
+func TestWith(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	parent := WithContext(context.Background(), zap.New(obs))
+
+	ctx := With(With(parent, zap.String("request_id", "r1")), zap.String("user_id", "u1"))
+	FromContext(ctx).Info("child")
+	FromContext(parent).Info("parent")
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if fields := entries[0].ContextMap(); fields["request_id"] != "r1" || fields["user_id"] != "u1" {
+		t.Fatalf("fields not chained: %v", fields)
+	}
+	if len(entries[1].Context) != 0 {
+		t.Fatalf("parent context changed: %v", entries[1].Context)
+	}
+}
+
+func TestShutdownReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	l := New(ctx, "serviceName", Config{Level: "info", WriterEncoding: EncodingJSON}, &buf)
+	// The totals cover the process, so compare against the counts so far.
+	var before uint64
+	if counter, ok := componentErrors.Load("billing-db"); ok {
+		before = counter.(*atomic.Uint64).Load()
+	}
+	l.Error("query failed", Component("billing-db"))
+	l.With(Component("billing-db")).Error("query failed again")
+	buf.Reset()
+
+	LogShutdownReport()
+	var report struct {
+		Message           string            `json:"message"`
+		Uptime            any               `json:"uptime"`
+		ErrorsByComponent map[string]uint64 `json:"errors_by_component"`
+		EntriesByLevel    map[string]uint64 `json:"entries_by_level"`
+		SinkFlush         map[string]string `json:"sink_flush"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("report is not one JSON entry: %v: %s", err, buf.String())
+	}
+	if report.Message != "shutdown report" || report.Uptime == nil || report.ErrorsByComponent["billing-db"] != before+2 ||
+		report.EntriesByLevel["error"] < 2 || report.SinkFlush["writer"] != "ok" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestErrorBudget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	obs, logs := observer.New(zapcore.InfoLevel)
+	l := New(ctx, "serviceName", Config{Level: "info", ConsoleLevel: "fatal", ErrorBudget: &ErrorBudgetConfig{
+		Targets:        map[string]uint64{"budget-ledger": 2},
+		ReportInterval: 10 * time.Millisecond,
+	}}, io.Discard, obs)
+
+	// waitFor polls until a budget report with used errors is logged.
+	waitFor := func(used uint64) observer.LoggedEntry {
+		timeout := time.After(5 * time.Second)
+		for {
+			for _, e := range logs.FilterMessage("error budget").All() {
+				if e.ContextMap()["budget_errors"] == used {
+					return e
+				}
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("no budget report with %d errors: %v", used, logs.All())
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	// The window starts when the reporter does, so wait for its first report.
+	if e := waitFor(0); e.Level != zapcore.InfoLevel {
+		t.Fatalf("unspent budget reported at %v", e.Level)
+	}
+	l.Error("write failed", Component("budget-ledger"))
+	l.With(Component("budget-ledger")).Error("write failed")
+
+	e := waitFor(2)
+	fields := e.ContextMap()
+	if e.Level != zapcore.WarnLevel || fields["component"] != "budget-ledger" ||
+		fields["budget_target"] != uint64(2) || fields["budget_used"] != "100%" {
+		t.Fatalf("unexpected budget entry: %v %v", e.Level, fields)
+	}
+}
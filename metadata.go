@@ -0,0 +1,224 @@
+package zapang
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Instance metadata endpoints, overridable in tests.
+var (
+	ec2MetadataURL   = "http://169.254.169.254"
+	gceMetadataURL   = "http://metadata.google.internal"
+	azureMetadataURL = "http://169.254.169.254"
+)
+
+// cloudMetadata describes the instance the process runs on.
+type cloudMetadata struct {
+	Region       string
+	Zone         string
+	InstanceID   string
+	InstanceType string
+}
+
+func (m cloudMetadata) fields() []zap.Field {
+	var fields []zap.Field
+	if m.Region != "" {
+		fields = append(fields, CloudRegion(m.Region))
+	}
+	if m.Zone != "" {
+		fields = append(fields, CloudZone(m.Zone))
+	}
+	if m.InstanceID != "" {
+		fields = append(fields, InstanceID(m.InstanceID))
+	}
+	if m.InstanceType != "" {
+		fields = append(fields, InstanceType(m.InstanceType))
+	}
+	return fields
+}
+
+// cloudMetadataFields queries EC2, GCE and Azure metadata services concurrently
+// and returns fields from the first one that answers within timeout.
+func cloudMetadataFields(ctx context.Context, timeout time.Duration) []zap.Field {
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	providers := []func(context.Context) (cloudMetadata, bool){fetchEC2, fetchGCE, fetchAzure}
+	results := make(chan cloudMetadata, len(providers))
+	for _, fetch := range providers {
+		go func() {
+			if md, ok := fetch(ctx); ok {
+				results <- md
+			}
+		}()
+	}
+
+	select {
+	case md := <-results:
+		return md.fields()
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func fetchEC2(ctx context.Context) (cloudMetadata, bool) {
+	// IMDSv2 session token.
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, ec2MetadataURL+"/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, ok := metadataGet(req)
+	if !ok {
+		return cloudMetadata{}, false
+	}
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, ec2MetadataURL+"/latest/dynamic/instance-identity/document", nil)
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	body, ok := metadataGet(req)
+	if !ok {
+		return cloudMetadata{}, false
+	}
+
+	var doc struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil || doc.InstanceID == "" {
+		return cloudMetadata{}, false
+	}
+	return cloudMetadata{
+		Region:       doc.Region,
+		Zone:         doc.AvailabilityZone,
+		InstanceID:   doc.InstanceID,
+		InstanceType: doc.InstanceType,
+	}, true
+}
+
+func fetchGCE(ctx context.Context) (cloudMetadata, bool) {
+	get := func(attr string) (string, bool) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, gceMetadataURL+"/computeMetadata/v1/instance/"+attr, nil)
+		req.Header.Set("Metadata-Flavor", "Google")
+		return metadataGet(req)
+	}
+
+	id, ok := get("id")
+	if !ok {
+		return cloudMetadata{}, false
+	}
+	zone, _ := get("zone")
+	machineType, _ := get("machine-type")
+
+	// Zone and machine type are returned as resource paths: projects/1/zones/us-central1-a.
+	zone = path.Base(zone)
+	region := zone
+	if i := strings.LastIndexByte(zone, '-'); i > 0 {
+		region = zone[:i]
+	}
+	return cloudMetadata{
+		Region:       region,
+		Zone:         zone,
+		InstanceID:   id,
+		InstanceType: path.Base(machineType),
+	}, true
+}
+
+func fetchAzure(ctx context.Context) (cloudMetadata, bool) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, azureMetadataURL+"/metadata/instance/compute?api-version=2021-02-01", nil)
+	req.Header.Set("Metadata", "true")
+	body, ok := metadataGet(req)
+	if !ok {
+		return cloudMetadata{}, false
+	}
+
+	var doc struct {
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+		VMID     string `json:"vmId"`
+		VMSize   string `json:"vmSize"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil || doc.VMID == "" {
+		return cloudMetadata{}, false
+	}
+	return cloudMetadata{
+		Region:       doc.Location,
+		Zone:         doc.Zone,
+		InstanceID:   doc.VMID,
+		InstanceType: doc.VMSize,
+	}, true
+}
+
+func metadataGet(req *http.Request) (string, bool) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(body)), true
+}
+
+// Container detection inputs, overridable in tests.
+var (
+	cgroupPath    = "/proc/self/cgroup"
+	mountInfoPath = "/proc/self/mountinfo"
+)
+
+// containerIDPattern matches the 64-hex container ID used by Docker and containerd.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerMetadataFields detects a Docker/containerd runtime and returns
+// container_id and container_image fields. Image is read from the
+// CONTAINER_IMAGE environment variable, which runtimes do not set by themselves.
+func containerMetadataFields() []zap.Field {
+	var fields []zap.Field
+	if id := detectContainerID(); id != "" {
+		fields = append(fields, ContainerID(id))
+	}
+	if image := os.Getenv("CONTAINER_IMAGE"); image != "" {
+		fields = append(fields, ContainerImage(image))
+	}
+	return fields
+}
+
+func detectContainerID() string {
+	if id := os.Getenv("CONTAINER_ID"); id != "" {
+		return id
+	}
+	// cgroup v1 paths embed the ID, e.g. /docker/<id> or /kubepods/.../cri-containerd-<id>.scope.
+	if data, err := os.ReadFile(cgroupPath); err == nil {
+		if id := containerIDPattern.FindString(string(data)); id != "" {
+			return id
+		}
+	}
+	// cgroup v2 hides it from /proc/self/cgroup; container runtimes mount it under /containers/<id>/.
+	if data, err := os.ReadFile(mountInfoPath); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.Contains(line, "/containers/") && !strings.Contains(line, "/docker/") {
+				continue
+			}
+			if id := containerIDPattern.FindString(line); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeMetadata points the instance metadata URLs at a server where only the
+// provider stored in the returned value answers; the others get 404. Lookups
+// leave stragglers behind, so switch providers through it rather than the URLs.
+func fakeMetadata(t *testing.T) *atomic.Value {
+	t.Helper()
+	var current atomic.Value
+	current.Store("")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch provider := current.Load(); {
+		case provider == "gce" && r.Header.Get("Metadata-Flavor") == "Google":
+			switch r.URL.Path {
+			case "/computeMetadata/v1/instance/id":
+				w.Write([]byte("4520031799277581759\n"))
+			case "/computeMetadata/v1/instance/zone":
+				w.Write([]byte("projects/123/zones/us-central1-a"))
+			case "/computeMetadata/v1/instance/machine-type":
+				w.Write([]byte("projects/123/machineTypes/e2-medium"))
+			default:
+				http.NotFound(w, r)
+			}
+		case provider == "ec2" && r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("token"))
+		case provider == "ec2" && r.Header.Get("X-aws-ec2-metadata-token") == "token":
+			w.Write([]byte(`{"region":"eu-west-1","availabilityZone":"eu-west-1b","instanceId":"i-0abc","instanceType":"t3.micro"}`))
+		case provider == "azure" && r.Header.Get("Metadata") == "true":
+			w.Write([]byte(`{"location":"westeurope","zone":"2","vmId":"vm-1","vmSize":"Standard_B1s"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ec2, gce, azure := ec2MetadataURL, gceMetadataURL, azureMetadataURL
+	t.Cleanup(func() { ec2MetadataURL, gceMetadataURL, azureMetadataURL = ec2, gce, azure })
+	ec2MetadataURL, gceMetadataURL, azureMetadataURL = srv.URL, srv.URL, srv.URL
+	return &current
+}
+
+func TestCloudMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := fakeMetadata(t)
+	provider.Store("gce")
+	var buf bytes.Buffer
+	l := New(ctx, "serviceName", Config{Level: "info", WriterEncoding: EncodingJSON, CloudMetadata: true}, &buf)
+	l.Info("hello")
+	for _, want := range []string{`"cloud_region":"us-central1"`, `"cloud_zone":"us-central1-a"`, `"instance_id":"4520031799277581759"`, `"instance_type":"e2-medium"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %s: %s", want, buf.String())
+		}
+	}
+
+	for name, want := range map[string]cloudMetadata{
+		"ec2":   {Region: "eu-west-1", Zone: "eu-west-1b", InstanceID: "i-0abc", InstanceType: "t3.micro"},
+		"azure": {Region: "westeurope", Zone: "2", InstanceID: "vm-1", InstanceType: "Standard_B1s"},
+	} {
+		provider.Store(name)
+		got := cloudMetadataFields(ctx, time.Second)
+		if len(got) != 4 || got[0].String != want.Region || got[1].String != want.Zone ||
+			got[2].String != want.InstanceID || got[3].String != want.InstanceType {
+			t.Fatalf("%s: unexpected fields %v", name, got)
+		}
+	}
+
+	// Off the cloud nothing answers and no fields are added.
+	provider.Store("")
+	if got := cloudMetadataFields(ctx, 100*time.Millisecond); got != nil {
+		t.Fatalf("unexpected fields without a metadata service: %v", got)
+	}
+}
+
+func TestContainerMetadata(t *testing.T) {
+	const id = "3f4e5d6c7b8a99887766554433221100ffeeddccbbaa00112233445566778899"
+	dir := t.TempDir()
+	cgroupV1 := filepath.Join(dir, "cgroup-v1")
+	cgroupV2 := filepath.Join(dir, "cgroup-v2")
+	mountInfo := filepath.Join(dir, "mountinfo")
+	for path, data := range map[string]string{
+		cgroupV1: "12:pids:/kubepods/burstable/pod1/cri-containerd-" + id + ".scope\n",
+		cgroupV2: "0::/\n",
+		mountInfo: "1 0 0:1 / / rw - overlay overlay rw\n" +
+			"2 1 0:2 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw - ext4 /dev/sda1 rw\n",
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cgroup, mounts := cgroupPath, mountInfoPath
+	t.Cleanup(func() { cgroupPath, mountInfoPath = cgroup, mounts })
+	t.Setenv("CONTAINER_ID", "")
+	t.Setenv("CONTAINER_IMAGE", "registry.example.com/billing:1.4.2")
+
+	for _, c := range []struct {
+		name, cgroup, mountInfo, want string
+	}{
+		{"cgroup v1", cgroupV1, filepath.Join(dir, "missing"), id},
+		{"cgroup v2", cgroupV2, mountInfo, id},
+		{"no container", cgroupV2, cgroupV2, ""},
+	} {
+		cgroupPath, mountInfoPath = c.cgroup, c.mountInfo
+		if got := detectContainerID(); got != c.want {
+			t.Errorf("%s: container ID %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	t.Setenv("CONTAINER_ID", "from-env")
+	fields := containerMetadataFields()
+	if len(fields) != 2 || fields[0].String != "from-env" || fields[1].String != "registry.example.com/billing:1.4.2" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+}
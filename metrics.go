@@ -0,0 +1,125 @@
+package zapang
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap/zapcore"
+)
+
+// writeDuration is the histogram installed by RegisterMetrics, or nil.
+var writeDuration atomic.Pointer[metric.Float64Histogram]
+
+// RegisterMetrics exports the logger statistics as OpenTelemetry metrics
+// through a meter from mp, e.g. an OTLP-exporting SDK provider:
+//
+//   - zapang.entries: entries that passed level and sampling, by level
+//   - zapang.entries.dropped: entries discarded by sampling or throughput shedding
+//   - zapang.write.errors: failed sink writes
+//   - zapang.sink.entries: entries per asynchronous sink, by sink and outcome
+//     (written, failed, dropped)
+//   - zapang.write.duration: seconds spent encoding and writing an entry, by sink
+//
+// The counters are observed from ReadStats at collection time and cover every
+// logger of the process. The histogram is recorded on every write; before
+// RegisterMetrics, writes are not timed.
+func RegisterMetrics(mp metric.MeterProvider) error {
+	meter := mp.Meter(zapangPkg)
+
+	entries, err := meter.Int64ObservableCounter("zapang.entries",
+		metric.WithDescription("Log entries that passed level and sampling checks."),
+		metric.WithUnit("{entry}"))
+	if err != nil {
+		return err
+	}
+	dropped, err := meter.Int64ObservableCounter("zapang.entries.dropped",
+		metric.WithDescription("Log entries discarded by sampling or throughput shedding."),
+		metric.WithUnit("{entry}"))
+	if err != nil {
+		return err
+	}
+	writeErrs, err := meter.Int64ObservableCounter("zapang.write.errors",
+		metric.WithDescription("Failed sink writes."),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return err
+	}
+	sinkEntries, err := meter.Int64ObservableCounter("zapang.sink.entries",
+		metric.WithDescription("Log entries handled by asynchronous sinks, by outcome."),
+		metric.WithUnit("{entry}"))
+	if err != nil {
+		return err
+	}
+	duration, err := meter.Float64Histogram("zapang.write.duration",
+		metric.WithDescription("Time spent encoding and writing a log entry to a sink."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := ReadStats()
+		for level, n := range stats.Emitted {
+			o.ObserveInt64(entries, int64(n), metric.WithAttributes(attribute.String("level", level)))
+		}
+		o.ObserveInt64(dropped, int64(stats.Dropped))
+		o.ObserveInt64(writeErrs, int64(stats.WriteErrors))
+		for name, s := range stats.Sinks {
+			sink := attribute.String("sink", name)
+			o.ObserveInt64(sinkEntries, int64(s.Written), metric.WithAttributes(sink, attribute.String("outcome", "written")))
+			o.ObserveInt64(sinkEntries, int64(s.Failed), metric.WithAttributes(sink, attribute.String("outcome", "failed")))
+			o.ObserveInt64(sinkEntries, int64(s.Dropped), metric.WithAttributes(sink, attribute.String("outcome", "dropped")))
+		}
+		return nil
+	}, entries, dropped, writeErrs, sinkEntries)
+	if err != nil {
+		return err
+	}
+
+	writeDuration.Store(&duration)
+	return nil
+}
+
+// timedCore wraps every sink: it counts the sink's failed writes and records
+// their duration in the zapang.write.duration histogram once RegisterMetrics
+// has installed it.
+type timedCore struct {
+	zapcore.Core
+	attrs metric.RecordOption
+}
+
+func newTimedCore(core zapcore.Core, sink string) *timedCore {
+	return &timedCore{Core: core, attrs: metric.WithAttributeSet(attribute.NewSet(attribute.String("sink", sink)))}
+}
+
+func (c *timedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &timedCore{Core: c.Core.With(fields), attrs: c.attrs}
+}
+
+func (c *timedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *timedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	h := writeDuration.Load()
+	if h == nil {
+		return countWriteError(writeChecked(c.Core, ent, fields))
+	}
+	start := time.Now()
+	err := writeChecked(c.Core, ent, fields)
+	(*h).Record(context.Background(), time.Since(start).Seconds(), c.attrs)
+	return countWriteError(err)
+}
+
+func countWriteError(err error) error {
+	if err != nil {
+		writeErrors.Add(1)
+	}
+	return err
+}
@@ -1,45 +1,249 @@
 package zapang
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-// responseWriter wraps http.ResponseWriter to capture status code and size.
+//go:generate go run gen_writer.go
+
+// responseWriter wraps http.ResponseWriter to capture status code, size and
+// time to first byte. It passes Flush, Hijack, Push, ReadFrom and CloseNotify
+// through, so streaming (SSE), WebSocket and h2c upgrades, HTTP/2 push and
+// sendfile keep working behind the middleware. Handlers get it through
+// wrapResponseWriter, which hides the methods the underlying writer lacks.
 type responseWriter struct {
 	http.ResponseWriter
+	start  time.Time
 	status int
-	size   int
+
+	// writeErr is the first error writing the response, e.g. a client that
+	// went away.
+	writeErr error
+
+	// size and firstByte (nanoseconds after start, 0 until the first byte)
+	// are read concurrently by progress entries.
+	size      atomic.Int64
+	firstByte atomic.Int64
 }
 
-func newResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+func newResponseWriter(w http.ResponseWriter, start time.Time) *responseWriter {
+	return &responseWriter{ResponseWriter: w, start: start, status: http.StatusOK}
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
+	rw.markFirstByte()
 	rw.ResponseWriter.WriteHeader(code)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.markFirstByte()
 	n, err := rw.ResponseWriter.Write(b)
-	rw.size += n
+	rw.size.Add(int64(n))
+	rw.recordWriteErr(err)
+	return n, err
+}
+
+// Flush sends buffered data to the client, if the underlying writer supports it.
+func (rw *responseWriter) Flush() {
+	rw.markFirstByte()
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection, e.g. for a WebSocket upgrade. The request
+// is logged with status 101.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.status = http.StatusSwitchingProtocols
+		rw.markFirstByte()
+	}
+	return conn, brw, err
+}
+
+// Push initiates an HTTP/2 server push.
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	return rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// ReadFrom copies r to the response, letting the server use sendfile for files.
+func (rw *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	rw.markFirstByte()
+	n, err := rw.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	rw.size.Add(n)
+	rw.recordWriteErr(err)
 	return n, err
 }
 
+// CloseNotify passes through the deprecated http.CloseNotifier for handlers
+// that still use it.
+func (rw *responseWriter) CloseNotify() <-chan bool {
+	return rw.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
 func (rw *responseWriter) Unwrap() http.ResponseWriter {
 	return rw.ResponseWriter
 }
 
+// responseWriterUnwrapper keeps Unwrap on wrapResponseWriter's writers, for
+// http.ResponseController.
+type responseWriterUnwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+func (rw *responseWriter) recordWriteErr(err error) {
+	if err != nil && rw.writeErr == nil {
+		rw.writeErr = err
+	}
+}
+
+func (rw *responseWriter) markFirstByte() {
+	if rw.firstByte.Load() == 0 {
+		rw.firstByte.CompareAndSwap(0, max(int64(time.Since(rw.start)), 1))
+	}
+}
+
+// ttfb returns the time to first byte, or false if nothing was sent.
+func (rw *responseWriter) ttfb() (time.Duration, bool) {
+	d := rw.firstByte.Load()
+	return time.Duration(d), d > 0
+}
+
+// progressLogger logs "request in progress" entries at an interval while a
+// long-running response is being written.
+type progressLogger struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+func startProgress(log *zap.Logger, rw *responseWriter, every time.Duration) *progressLogger {
+	p := &progressLogger{}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timer = time.AfterFunc(every, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.stopped {
+			return
+		}
+		log.Info("request in progress", LatencyMs(time.Since(rw.start)), ResponseSize(int(rw.size.Load())))
+		p.timer.Reset(every)
+	})
+	return p
+}
+
+func (p *progressLogger) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	p.timer.Stop()
+}
+
+// MiddlewareOption configures HTTPMiddleware.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	meshHeaders    bool
+	canonicalEvent bool
+	accessLog      *accessLogger
+	headers        headerPolicy
+	trustedProxies []netip.Prefix
+	anonymizeIP    bool                // the logger's Config.AnonymizeClientIP, for the access log
+	pseudonymize   *PseudonymizeConfig // the logger's Config.Pseudonymize, for the access log
+	slowThreshold  time.Duration
+	observeLatency func(r *http.Request, status int, latency time.Duration)
+	tailSampling   bool
+	tailThreshold  time.Duration
+	progressEvery  time.Duration
+	routeExtractor func(r *http.Request) string
+	routeLevels    []routeLevel
+	maxBodySize    int64
+	shadowSize     int
+	probes         *probeSummary
+}
+
+// WithMeshHeaders logs Envoy (x-envoy-*, x-request-id) and B3 (x-b3-*, b3) request
+// headers as a nested "mesh" object, so application logs join up with mesh access logs.
+func WithMeshHeaders() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.meshHeaders = true
+	}
+}
+
+// WithCanonicalEvent attaches an Event to each request context. Handlers append
+// to it via EventFromContext(ctx), and its fields are merged into the single
+// "request completed" entry, producing one canonical line per request.
+func WithCanonicalEvent() MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.canonicalEvent = true
+	}
+}
+
+// WithSlowRequestThreshold logs requests slower than d at Warn (unless their
+// status already calls for Error) with slow_request=true.
+func WithSlowRequestThreshold(d time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.slowThreshold = d
+	}
+}
+
+// WithLatencyObserver calls fn with every completed request's status and
+// latency, e.g. to feed a Prometheus histogram:
+//
+//	WithLatencyObserver(func(r *http.Request, status int, d time.Duration) {
+//		hist.WithLabelValues(r.Method, strconv.Itoa(status)).Observe(d.Seconds())
+//	})
+func WithLatencyObserver(fn func(r *http.Request, status int, latency time.Duration)) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.observeLatency = fn
+	}
+}
+
+// WithStreamProgress logs a "request in progress" entry with the elapsed
+// latency_ms and the response_size so far every d while a request runs, so
+// long-lived streams (SSE, chunked downloads) show up before they complete.
+func WithStreamProgress(d time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.progressEvery = d
+	}
+}
+
 // HTTPMiddleware returns a middleware that logs HTTP requests.
-// It captures method, path, status, latency, and request metadata.
-func HTTPMiddleware(log *zap.Logger) func(http.Handler) http.Handler {
+// It captures method, path, status, latency, time to first byte, and request
+// metadata. When the request context carries an OpenTelemetry span, e.g. from
+// otelhttp, the request logger gets its trace_id and span_id and the span gets
+// the final status as http.response.status_code.
+func HTTPMiddleware(log *zap.Logger, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	var cfg middlewareConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.probes != nil {
+		cfg.probes.log = log
+	}
+	if c := configOf(log); c != nil {
+		cfg.anonymizeIP = c.AnonymizeClientIP
+		cfg.pseudonymize = c.Pseudonymize
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			rw := newResponseWriter(w)
+			rw := newResponseWriter(w, start)
 
 			// Extract trace ID if present
 			traceID := r.Header.Get("X-Trace-ID")
@@ -47,44 +251,169 @@ func HTTPMiddleware(log *zap.Logger) func(http.Handler) http.Handler {
 				traceID = r.Header.Get("X-Request-ID")
 			}
 
+			// Use the incoming request ID or generate one, and echo it back
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" {
+				requestID = NewRequestID()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			clientIP := cfg.clientIP(r)
+
 			// Create request-scoped logger
 			reqLogger := log.With(
+				RequestID(requestID),
 				Method(r.Method),
 				Path(r.URL.Path),
-				ClientIP(getClientIP(r)),
+				ClientIP(clientIP),
 				UserAgent(r.UserAgent()),
 			)
 
-			if traceID != "" {
-				reqLogger = reqLogger.With(TraceID(traceID))
+			// An OpenTelemetry span started by an outer middleware such as
+			// otelhttp takes precedence over trace headers.
+			var traceFields []zap.Field
+			span := trace.SpanFromContext(r.Context())
+			if sc := span.SpanContext(); sc.IsValid() {
+				traceFields = []zap.Field{TraceID(sc.TraceID().String()), SpanID(sc.SpanID().String())}
+				reqLogger = withSpanEvents(reqLogger, span)
+			} else if traceID != "" {
+				traceFields = []zap.Field{TraceID(traceID)}
+			}
+
+			if cfg.meshHeaders {
+				if mesh := meshHeaders(r.Header); len(mesh) > 0 {
+					reqLogger = reqLogger.With(Mesh(mesh))
+				}
+			}
+
+			if headerFields := cfg.headers.fields(r.Header); headerFields != nil {
+				reqLogger = reqLogger.With(headerFields...)
+			}
+			reqLogger = cfg.routeLogger(reqLogger, r)
+
+			// The handler's logger gets the trace fields from the context, so a
+			// StartSpan span in the handler replaces them.
+			handlerLogger := reqLogger
+			reqLogger = reqLogger.With(traceFields...)
+
+			// With tail sampling, the handler logs into a buffer that is written
+			// or discarded once the outcome is known; a panic always writes it.
+			// The panic is not recovered, so it propagates with its own stack.
+			var tail *requestBuffer
+			completed := false
+			if cfg.tailSampling {
+				tail = &requestBuffer{}
+				handlerLogger = tail.logger(handlerLogger)
+				defer func() {
+					if !completed {
+						tail.release(true)
+					}
+				}()
 			}
 
 			// Store logger in context
-			ctx := WithContext(r.Context(), reqLogger)
+			ctx := WithContext(ContextWithRequestID(r.Context(), requestID), handlerLogger)
+			ctx = contextWithTraceFields(ctx, traceFields...)
+			var shadow *shadowBuffer
+			if cfg.shadowSize > 0 {
+				ctx = WithShadowBuffer(ctx, cfg.shadowSize)
+				shadow, _ = ctx.Value(shadowKey{}).(*shadowBuffer)
+			}
+
+			var event *Event
+			if cfg.canonicalEvent {
+				event = NewEvent("request completed")
+				ctx = ContextWithEvent(ctx, event)
+			}
 			r = r.WithContext(ctx)
+			body := wrapBody(w, r, cfg.maxBodySize)
 
 			// Process request
-			next.ServeHTTP(rw, r)
+			if cfg.progressEvery > 0 {
+				progress := startProgress(reqLogger, rw, cfg.progressEvery)
+				defer progress.stop() // also on panic
+				next.ServeHTTP(wrapResponseWriter(rw), r)
+				progress.stop()
+			} else {
+				next.ServeHTTP(wrapResponseWriter(rw), r)
+			}
+			completed = true
 
 			// Calculate latency
 			latency := time.Since(start)
+			requestsServed.Add(1)
 
 			// Build log fields
-			fields := []zap.Field{
+			buf := GetFieldBuffer()
+			defer buf.Release()
+			size := int(rw.size.Load())
+			buf.Add(
 				StatusCode(rw.status),
 				LatencyMs(latency),
-				ResponseSize(rw.size),
+				ResponseSize(size),
+			)
+			if ttfb, ok := rw.ttfb(); ok {
+				buf.Add(TTFBMs(ttfb))
+			}
+			if route := cfg.route(r); route != "" {
+				buf.Add(HTTPRoute(route))
 			}
 
 			if r.ContentLength > 0 {
-				fields = append(fields, RequestSize(r.ContentLength))
+				buf.Add(RequestSize(r.ContentLength))
+			}
+
+			// Body and write problems point at truncating proxies and
+			// clients that went away; they are logged at Warn.
+			problem := body != nil && body.addFields(buf, r.ContentLength)
+			if rw.writeErr != nil {
+				buf.Add(zap.NamedError("response_error", rw.writeErr))
+				problem = true
+			}
+
+			slow := cfg.slowThreshold > 0 && latency > cfg.slowThreshold
+			if slow {
+				buf.Add(SlowRequest())
+			}
+
+			if event != nil {
+				buf.Add(event.Fields()...)
+			}
+
+			if shadow != nil && (rw.status >= 500 || shadow.sawError()) {
+				if replayed := shadow.replay(); replayed > 0 {
+					buf.Add(zap.Int("entries_replayed", replayed))
+				}
+			}
+
+			if tail != nil {
+				keep := rw.status >= 500 || (cfg.tailThreshold > 0 && latency > cfg.tailThreshold)
+				if dropped := tail.release(keep); dropped > 0 {
+					buf.Add(zap.Int("entries_dropped", dropped))
+				}
+			}
+			fields := buf.Fields()
+
+			if span.IsRecording() {
+				span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+			}
+			if cfg.accessLog != nil {
+				addr, user := cfg.accessIdentity(clientIP, requestUser(r))
+				cfg.accessLog.log(r, addr, user, rw.status, size, start, latency)
+			}
+			if cfg.observeLatency != nil {
+				cfg.observeLatency(r, rw.status, latency)
+			}
+			if cfg.probes != nil && cfg.probes.match(r.URL.Path) {
+				cfg.probes.record(r.URL.Path, rw.status, latency)
+				return
 			}
 
 			// Log at appropriate level based on status
 			switch {
 			case rw.status >= 500:
 				reqLogger.Error("request completed", fields...)
-			case rw.status >= 400:
+			case rw.status >= 400 || slow || problem:
 				reqLogger.Warn("request completed", fields...)
 			default:
 				reqLogger.Info("request completed", fields...)
@@ -93,18 +422,61 @@ func HTTPMiddleware(log *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// RecoveryOption configures RecoveryMiddleware.
+type RecoveryOption func(*recoveryConfig)
+
+type recoveryConfig struct {
+	limiter *panicLimiter
+}
+
+// WithPanicRateLimit logs at most burst panics per window for each panic
+// fingerprint (panic value type and panicking functions), so a crash loop in a
+// hot handler does not flood the logs with identical stack traces. When a
+// window with suppressed panics ends, a "panics suppressed" entry reports how
+// many occurred. Panic hooks still run for every panic.
+func WithPanicRateLimit(burst int, window time.Duration) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.limiter = &panicLimiter{burst: burst, window: window, seen: make(map[string]*panicWindow)}
+	}
+}
+
 // RecoveryMiddleware returns a middleware that recovers from panics and logs them.
-func RecoveryMiddleware(log *zap.Logger) func(http.Handler) http.Handler {
+func RecoveryMiddleware(log *zap.Logger, opts ...RecoveryOption) func(http.Handler) http.Handler {
+	var cfg recoveryConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.limiter != nil {
+		cfg.limiter.log = log
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if rec := recover(); rec != nil {
-					log.Error("panic recovered",
-						zap.Any("panic", rec),
-						Method(r.Method),
-						Path(r.URL.Path),
-						zap.Stack("stacktrace"),
-					)
+					if cfg.limiter == nil {
+						log.Error("panic recovered",
+							zap.Any("panic", rec),
+							Method(r.Method),
+							Path(r.URL.Path),
+							zap.Stack("stacktrace"),
+						)
+					} else if fp := panicFingerprint(rec); cfg.limiter.allow(fp) {
+						log.Error("panic recovered",
+							zap.Any("panic", rec),
+							Method(r.Method),
+							Path(r.URL.Path),
+							zap.String("panic_fingerprint", fp),
+							zap.Stack("stacktrace"),
+						)
+					}
+					notifyPanic(PanicInfo{
+						Value:   rec,
+						Stack:   debug.Stack(),
+						Time:    time.Now(),
+						Context: r.Context(),
+						Request: r,
+					})
 					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				}
 			}()
@@ -113,13 +485,21 @@ func RecoveryMiddleware(log *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-func getClientIP(r *http.Request) string {
-	// Check common proxy headers
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+// meshHeaders collects Envoy and B3 headers keyed by their normalized name,
+// e.g. "X-Envoy-Attempt-Count" becomes "envoy_attempt_count".
+func meshHeaders(h http.Header) map[string]string {
+	var mesh map[string]string
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if lower != "x-request-id" && lower != "b3" &&
+			!strings.HasPrefix(lower, "x-envoy-") && !strings.HasPrefix(lower, "x-b3-") {
+			continue
+		}
+		if mesh == nil {
+			mesh = make(map[string]string)
+		}
+		key := strings.ReplaceAll(strings.TrimPrefix(lower, "x-"), "-", "_")
+		mesh[key] = strings.Join(values, ",")
 	}
-	return r.RemoteAddr
+	return mesh
 }
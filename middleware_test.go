@@ -0,0 +1,781 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	h := HTTPMiddleware(zap.NewNop(), WithAccessLogFormat(AccessLogCombined, &buf))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("hello"))
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/items?x=1", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	req.Header.Set("User-Agent", "test-agent")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	re := regexp.MustCompile(`^10\.0\.0\.1 - - \[[^\]]+\] "POST /items\?x=1 HTTP/1\.1" 201 5 "-" "test-agent"\n$`)
+	if !re.MatchString(buf.String()) {
+		t.Fatalf("unexpected combined line: %q", buf.String())
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var fromCtx string
+	h := HTTPMiddleware(zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromCtx = RequestIDFromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	generated := rec.Header().Get(RequestIDHeader)
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(generated) {
+		t.Fatalf("generated ID is not a UUIDv7: %q", generated)
+	}
+	if fromCtx != generated {
+		t.Fatalf("context ID %q != header ID %q", fromCtx, generated)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "incoming")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get(RequestIDHeader) != "incoming" || fromCtx != "incoming" {
+		t.Fatalf("incoming ID not propagated: %q %q", rec.Header().Get(RequestIDHeader), fromCtx)
+	}
+}
+
+func TestSpanReplacesTraceHeader(t *testing.T) {
+	var buf bytes.Buffer
+	log := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zapcore.InfoLevel))
+
+	var span *Span
+	h := HTTPMiddleware(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("before")
+		ctx, s := StartSpan(r.Context(), "charge")
+		span = s
+		ctx = With(ctx, zap.String("order_id", "o-1"))
+		FromContext(ctx).Info("inside")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Trace-ID", "abc")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	if strings.Count(lines[0], `"trace_id":"abc"`) != 1 {
+		t.Fatalf("handler logger lacks the header trace_id: %s", lines[0])
+	}
+	inside := lines[1]
+	if strings.Count(inside, `"trace_id"`) != 1 || strings.Count(inside, `"span_id"`) != 1 ||
+		!strings.Contains(inside, `"trace_id":"`+span.TraceID()+`"`) {
+		t.Fatalf("span did not replace the trace fields: %s", inside)
+	}
+	if strings.Count(lines[2], `"trace_id":"abc"`) != 1 {
+		t.Fatalf("request logger lacks the header trace_id: %s", lines[2])
+	}
+}
+
+func TestCanonicalEvent(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	h := HTTPMiddleware(zap.New(obs), WithCanonicalEvent())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		EventFromContext(r.Context()).Str("order_id", "42").Int("items", 3)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", nil))
+
+	if logs.Len() != 1 {
+		t.Fatalf("expected a single canonical entry, got %d", logs.Len())
+	}
+	ctx := logs.All()[0].ContextMap()
+	if ctx["order_id"] != "42" || ctx["items"] != int64(3) || ctx["http_status"] != int64(200) {
+		t.Fatalf("unexpected fields: %v", ctx)
+	}
+}
+
+func TestHeaderLogging(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("X-Tenant", "acme")
+
+	serve := func(opts ...MiddlewareOption) map[string]any {
+		obs, logs := observer.New(zapcore.InfoLevel)
+		HTTPMiddleware(zap.New(obs), opts...)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+		return logs.All()[0].ContextMap()
+	}
+
+	flat := serve(WithHeaders())
+	if flat["header_x_tenant"] != "acme" || flat["header_authorization"] != nil || flat["header_cookie"] != nil {
+		t.Fatalf("unexpected flat headers: %v", flat)
+	}
+
+	nested := serve(WithNestedHeaders(), WithSensitiveHeaders("X-Tenant"), WithHashedSensitiveHeaders())
+	headers, _ := nested["headers"].(map[string]any)
+	if headers["authorization"] != "Bearer secret" || !regexp.MustCompile(`^sha256:[0-9a-f]{16}$`).MatchString(headers["x_tenant"].(string)) {
+		t.Fatalf("unexpected nested headers: %v", headers)
+	}
+}
+
+func TestMeshHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Envoy-Attempt-Count", "2")
+	req.Header.Set("X-B3-TraceId", "80f198ee56343ba8")
+	req.Header.Add("B3", "a")
+	req.Header.Add("B3", "b")
+	req.Header.Set("X-Tenant", "acme")
+
+	serve := func(opts ...MiddlewareOption) map[string]any {
+		obs, logs := observer.New(zapcore.InfoLevel)
+		HTTPMiddleware(zap.New(obs), opts...)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+		return logs.All()[0].ContextMap()
+	}
+
+	if fields := serve(); fields["mesh"] != nil {
+		t.Fatalf("mesh headers logged without WithMeshHeaders: %v", fields["mesh"])
+	}
+	mesh, _ := serve(WithMeshHeaders())["mesh"].(map[string]any)
+	if len(mesh) != 3 || mesh["envoy_attempt_count"] != "2" || mesh["b3_traceid"] != "80f198ee56343ba8" || mesh["b3"] != "a,b" {
+		t.Fatalf("unexpected mesh headers: %v", mesh)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := middlewareConfig{trustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/64"),
+	}}
+	cases := []struct {
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.1.1.1"}, "198.51.100.7"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.2.2.2, 10.1.1.1"}, "10.2.2.2"},
+		{"10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"[2001:db8::1]:443", map[string]string{
+			"Forwarded":       `for=6.6.6.6, for="[2001:db8:cafe::17]:4711";proto=https, For=10.3.3.3`,
+			"X-Forwarded-For": "7.7.7.7",
+		}, "2001:db8:cafe::17"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.7;by=10.0.0.1, for=unknown"}, "unknown"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		if got := cfg.clientIP(req); got != c.want {
+			t.Errorf("%s %v: got %s, want %s", c.remote, c.headers, got, c.want)
+		}
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.17":        "192.0.2.0",
+		"::ffff:192.0.2.17": "192.0.2.0",
+		"2001:db8:1:2::5":   "2001:db8:1::",
+		"fe80::1%eth0":      "fe80::",
+		"unknown":           "unknown",
+		"2001:db8:cafe::17": "2001:db8:cafe::",
+	}
+	for in, want := range cases {
+		if got := AnonymizeIP(in); got != want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	obs, logs := observer.New(zapcore.InfoLevel)
+	log, _ := NewWithLevel(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", AnonymizeClientIP: true}, nil, obs)
+
+	var access bytes.Buffer
+	handler := HTTPMiddleware(log, WithAccessLogFormat(AccessLogCombined, &access))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.HasPrefix(access.String(), "203.0.113.0 ") {
+		t.Fatalf("expected the access log to anonymize the client IP: %s", access.String())
+	}
+	if got := logs.All()[0].ContextMap()["client_ip"]; got != "203.0.113.0" {
+		t.Fatalf("expected the middleware to anonymize the client IP, got %v", got)
+	}
+
+	log.With(ClientIP("198.51.100.7")).Info("context")
+	log.Info("entry", ClientIP("198.51.100.7"))
+	for _, e := range logs.All()[1:] {
+		if got := e.ContextMap()["client_ip"]; got != "198.51.100.0" {
+			t.Fatalf("expected ClientIP to be anonymized, got %v", got)
+		}
+	}
+
+	// Other loggers keep their addresses.
+	plain, _ := NewWithLevel(ctx, "svc", Config{Level: "info", ConsoleLevel: "error"}, nil, obs)
+	plain.Info("plain", ClientIP("198.51.100.7"))
+	if got := logs.All()[3].ContextMap()["client_ip"]; got != "198.51.100.7" {
+		t.Fatalf("expected a logger without AnonymizeClientIP to keep the address, got %v", got)
+	}
+}
+
+func TestSlowRequest(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	var observed time.Duration
+	h := HTTPMiddleware(zap.New(obs),
+		WithSlowRequestThreshold(5*time.Millisecond),
+		WithLatencyObserver(func(_ *http.Request, status int, d time.Duration) { observed = d }),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	fast, slow := logs.All()[0], logs.All()[1]
+	if fast.Level != zapcore.InfoLevel || fast.ContextMap()["slow_request"] != nil {
+		t.Fatalf("fast request flagged: %v %v", fast.Level, fast.ContextMap())
+	}
+	if slow.Level != zapcore.WarnLevel || slow.ContextMap()["slow_request"] != true {
+		t.Fatalf("slow request not flagged: %v %v", slow.Level, slow.ContextMap())
+	}
+	if observed < 10*time.Millisecond {
+		t.Fatalf("observer got %v", observed)
+	}
+}
+
+func TestStreamingResponse(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	h := HTTPMiddleware(zap.New(obs), WithStreamProgress(10*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/ws" {
+				conn, brw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer conn.Close()
+				_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+				_ = brw.Flush()
+				return
+			}
+
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				t.Error("response writer does not implement http.Flusher")
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			for range 3 {
+				_, _ = w.Write([]byte("data: tick\n\n"))
+				flusher.Flush()
+				time.Sleep(15 * time.Millisecond)
+			}
+		}),
+	)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if !rec.Flushed {
+		t.Fatal("flush did not reach the underlying writer")
+	}
+	entries := logs.All()
+	done := entries[len(entries)-1]
+	if len(logs.FilterMessage("request in progress").All()) == 0 {
+		t.Fatalf("no progress entries: %v", entries)
+	}
+	fields := done.ContextMap()
+	if done.Message != "request completed" || fields["response_size"] != int64(36) || fields["ttfb_ms"].(float64) >= fields["latency_ms"].(float64) {
+		t.Fatalf("unexpected completion entry: %v", fields)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("hijacked response: %d", resp.StatusCode)
+	}
+	// The client can read the hijacked response before the middleware logs.
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterField(StatusCode(http.StatusSwitchingProtocols)).Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("hijacked request not logged with status 101")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// writerCapabilities lists the optional interfaces w implements.
+func writerCapabilities(w http.ResponseWriter) string {
+	var caps []string
+	if _, ok := w.(http.Flusher); ok {
+		caps = append(caps, "flush")
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		caps = append(caps, "hijack")
+	}
+	if _, ok := w.(http.Pusher); ok {
+		caps = append(caps, "push")
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		caps = append(caps, "readfrom")
+	}
+	if _, ok := w.(http.CloseNotifier); ok {
+		caps = append(caps, "closenotify")
+	}
+	return strings.Join(caps, ",")
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	var mu sync.Mutex
+	var inner, outer string
+	logged := HTTPMiddleware(zap.New(obs))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		outer = writerCapabilities(w)
+		mu.Unlock()
+		if rf, ok := w.(io.ReaderFrom); ok {
+			_, _ = rf.ReadFrom(strings.NewReader("hello"))
+		}
+	}))
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inner = writerCapabilities(w)
+		mu.Unlock()
+		logged.ServeHTTP(w, r)
+	})
+
+	check := func(name string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if inner != outer {
+			t.Errorf("%s: middleware changed writer capabilities from %q to %q", name, inner, outer)
+		}
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	check("recorder")
+
+	http1 := httptest.NewServer(h)
+	defer http1.Close()
+	resp, err := http.Get(http1.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	check("HTTP/1.1")
+	if !strings.Contains(outer, "readfrom") || logs.All()[logs.Len()-1].ContextMap()["response_size"] != int64(5) {
+		t.Fatalf("ReadFrom not passed through or not counted: %q", outer)
+	}
+
+	http2 := httptest.NewUnstartedServer(h)
+	http2.EnableHTTP2 = true
+	http2.StartTLS()
+	defer http2.Close()
+	resp, err = http2.Client().Get(http2.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	check("HTTP/2")
+	if resp.ProtoMajor != 2 || !strings.Contains(outer, "push") {
+		t.Fatalf("HTTP/2 push not passed through: %s %q", resp.Proto, outer)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	// Route levels move the logger's global level: the writer follows it, the
+	// observer core keeps its Info level.
+	var buf bytes.Buffer
+	obs, logs := observer.New(zapcore.InfoLevel)
+	log, _ := NewWithLevel(context.Background(), "svc", Config{Level: "info", ConsoleLevel: "error", WriterEncoding: EncodingJSON}, &buf, obs)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/internal/", func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Debug("internal detail")
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	h := HTTPMiddleware(log,
+		WithRouteLevel("/internal/*", "debug"),
+		WithRouteLevel("/healthz", "warn"),
+	)(mux)
+
+	for _, target := range []string{"/users/42", "/internal/vars", "/healthz"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	var got []string
+	for _, e := range logs.All() {
+		route, _ := e.ContextMap()["http_route"].(string)
+		got = append(got, e.Message+" "+route)
+	}
+	want := "request completed /users/{id},request completed /internal/"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("got  %q\nwant %q", strings.Join(got, ","), want)
+	}
+	if !strings.Contains(buf.String(), `"message":"internal detail"`) {
+		t.Fatalf("debug entry of /internal/* not written: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "/healthz") {
+		t.Fatalf("quieted /healthz written: %s", buf.String())
+	}
+}
+
+type failingResponse struct{ *httptest.ResponseRecorder }
+
+func (failingResponse) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestRequestBodyAccounting(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	h := HTTPMiddleware(zap.New(obs), WithMaxBodySize(8))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	serve := func(w http.ResponseWriter, body io.Reader, contentLength int64) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.ContentLength = contentLength
+		h.ServeHTTP(w, req)
+		return logs.All()[logs.Len()-1].ContextMap()
+	}
+
+	if got := serve(httptest.NewRecorder(), strings.NewReader("hello"), 5); got["request_body_bytes"] != int64(5) || got["content_length_mismatch"] != nil {
+		t.Fatalf("clean body: %v", got)
+	}
+	if got := serve(httptest.NewRecorder(), strings.NewReader("hello"), 9); got["content_length_mismatch"] != true {
+		t.Fatalf("short body not flagged: %v", got)
+	}
+	truncated := io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if got := serve(httptest.NewRecorder(), truncated, 5); got["body_truncated"] != true || got["request_body_bytes"] != int64(3) {
+		t.Fatalf("truncated body not flagged: %v", got)
+	}
+	if got := serve(httptest.NewRecorder(), strings.NewReader("far too large"), 13); got["body_too_large"] != true {
+		t.Fatalf("oversized body not flagged: %v", got)
+	}
+	if got := serve(failingResponse{httptest.NewRecorder()}, strings.NewReader("hi"), 2); got["response_error"] != "broken pipe" {
+		t.Fatalf("write error not logged: %v", got)
+	}
+	if e := logs.All()[logs.Len()-1]; e.Level != zapcore.WarnLevel {
+		t.Fatalf("write error logged at %v", e.Level)
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	var got []PanicInfo
+	defer OnPanic(func(PanicInfo) { panic("broken hook") })()
+	unregister := OnPanic(func(info PanicInfo) { got = append(got, info) })
+
+	h := RecoveryMiddleware(zap.NewNop())(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	unregister()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if len(got) != 1 {
+		t.Fatalf("expected one call before unregistering, got %d", len(got))
+	}
+	info := got[0]
+	if info.Value != "boom" || info.Request == nil || info.Request.URL.Path != "/orders" ||
+		info.Context == nil || info.Time.IsZero() || !bytes.Contains(info.Stack, []byte("middleware_test.go")) {
+		t.Fatalf("unexpected panic info: %+v", info)
+	}
+}
+
+func TestPanicRateLimit(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	h := RecoveryMiddleware(zap.New(obs), WithPanicRateLimit(2, 50*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/other" {
+				panic(errors.New("other"))
+			}
+			panic("boom")
+		}),
+	)
+	for range 5 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+
+	if n := logs.FilterMessage("panic recovered").Len(); n != 3 {
+		t.Fatalf("expected 3 logged panics, got %d", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("panics suppressed").Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	summary := logs.FilterMessage("panics suppressed").All()
+	if len(summary) != 1 || summary[0].ContextMap()["suppressed"] != int64(3) || summary[0].ContextMap()["total"] != int64(5) {
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+}
+
+func TestTailSampling(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	h := HTTPMiddleware(zap.New(obs), WithTailSampling(time.Second))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := FromContext(r.Context())
+		log.Debug("loading cart")
+		if r.URL.Path == "/fail" {
+			log.Error("payment declined")
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if logs.Len() != 1 || logs.All()[0].ContextMap()["entries_dropped"] != int64(1) {
+		t.Fatalf("fast successful request should only log its summary: %v", logs.All())
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	var got []string
+	for _, e := range logs.All()[1:] {
+		got = append(got, e.Message)
+	}
+	if len(got) != 3 || got[0] != "loading cart" || got[1] != "payment declined" || got[2] != "request completed" {
+		t.Fatalf("erroring request should flush its entries in order: %v", got)
+	}
+	if logs.All()[1].ContextMap()["http_method"] != http.MethodGet {
+		t.Fatalf("flushed entry lost request fields: %v", logs.All()[1].ContextMap())
+	}
+
+	// A panic propagates as is and writes the buffer.
+	panicking := HTTPMiddleware(zap.New(obs), WithTailSampling(time.Second))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Debug("loading cart")
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Errorf("recovered %v, want the handler's panic", rec)
+			}
+		}()
+		panicking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if last := logs.All()[logs.Len()-1]; last.Message != "loading cart" {
+		t.Fatalf("panicking request should flush its entries: %v", last.Message)
+	}
+}
+
+func TestTailSamplingFatal(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	// The hook runs where os.Exit would: the buffered entries must be out.
+	var atExit []string
+	hook := checkWriteHookFunc(func(ce *zapcore.CheckedEntry, fields []zapcore.Field) {
+		for _, e := range logs.All() {
+			atExit = append(atExit, e.Message)
+		}
+		zapcore.WriteThenPanic.OnWrite(ce, fields)
+	})
+	log := zap.New(obs, zap.WithFatalHook(hook))
+	h := HTTPMiddleware(log, WithTailSampling(time.Second))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := FromContext(r.Context())
+		log.Debug("loading cart")
+		log.Fatal("out of disk")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Fatal did not panic")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if len(atExit) != 2 || atExit[0] != "loading cart" || atExit[1] != "out of disk" {
+		t.Fatalf("entries written before exit: %v", atExit)
+	}
+	if logs.Len() != 2 {
+		t.Fatalf("entries written twice: %v", logs.All())
+	}
+}
+
+type checkWriteHookFunc func(*zapcore.CheckedEntry, []zapcore.Field)
+
+func (f checkWriteHookFunc) OnWrite(ce *zapcore.CheckedEntry, fields []zapcore.Field) { f(ce, fields) }
+
+func TestShadowBuffer(t *testing.T) {
+	// Replay writes to the sinks that follow the logger's level.
+	var buf bytes.Buffer
+	base, _ := NewWithLevel(context.Background(), "svc", Config{Level: "info", ConsoleLevel: "error", WriterEncoding: EncodingJSON}, &buf)
+	entries := func() []Entry {
+		t.Helper()
+		all, err := QueryEntries(bytes.NewReader(buf.Bytes()), EntryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return all
+	}
+
+	ctx := WithShadowBuffer(WithContext(context.Background(), base), 2)
+	log := FromContext(ctx)
+	for _, msg := range []string{"one", "two", "three"} {
+		log.Debug(msg)
+	}
+	log.Info("kept")
+	if got := entries(); len(got) != 1 {
+		t.Fatalf("suppressed entries were written: %v", got)
+	}
+	if n := Replay(ctx); n != 2 {
+		t.Fatalf("Replay = %d, want the last 2 entries", n)
+	}
+	replayed := entries()[1:]
+	if len(replayed) != 2 || replayed[0].Message != "two" || replayed[1].Message != "three" {
+		t.Fatalf("replayed %v, want two and three", replayed)
+	}
+	if replayed[0].Level != zapcore.DebugLevel || replayed[0].Fields["replayed"] != true {
+		t.Fatalf("replayed entry lost its level or mark: %v", replayed[0])
+	}
+	if n := Replay(ctx); n != 0 {
+		t.Fatalf("second Replay = %d, want an emptied buffer", n)
+	}
+	if n := Replay(context.Background()); n != 0 {
+		t.Fatalf("Replay without a buffer = %d", n)
+	}
+
+	buf.Reset()
+	h := HTTPMiddleware(base, WithShadowDebug(8))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Debug("loading cart")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if got := entries(); len(got) != 1 {
+		t.Fatalf("successful request replayed its entries: %v", got)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	got := entries()[1:]
+	if len(got) != 2 || got[0].Message != "loading cart" || got[0].Fields["http_method"] != http.MethodGet {
+		t.Fatalf("failed request should replay its entries with request fields: %v", got)
+	}
+	if got[1].Fields["entries_replayed"] != json.Number("1") {
+		t.Fatalf("completion entry should count replayed entries: %v", got[1].Fields)
+	}
+}
+
+func TestProbeSummary(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	h := HTTPMiddleware(zap.New(obs), WithProbeSummary(20*time.Millisecond))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery == "fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	for _, target := range []string{"/healthz", "/healthz?fail", "/readyz", "/users"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if logs.Len() != 1 || logs.All()[0].ContextMap()["http_path"] != "/users" {
+		t.Fatalf("probes should not be logged individually: %v", logs.All())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("probe summary").Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	summaries := map[any]observer.LoggedEntry{}
+	for _, e := range logs.FilterMessage("probe summary").All() {
+		summaries[e.ContextMap()["http_path"]] = e
+	}
+	health, ready := summaries["/healthz"], summaries["/readyz"]
+	if f := health.ContextMap(); health.Level != zapcore.WarnLevel || f["probes"] != int64(2) || f["probe_failures"] != int64(1) {
+		t.Fatalf("unexpected /healthz summary: %v %v", health.Level, f)
+	}
+	if f := ready.ContextMap(); ready.Level != zapcore.InfoLevel || f["probes"] != int64(1) || f["max_latency_ms"] == nil {
+		t.Fatalf("unexpected /readyz summary: %v %v", ready.Level, f)
+	}
+}
+
+// The gqlgen extension types, mirrored so the test checks GraphQLExtension fits them.
+type (
+	testSchema          interface{ Schema() string }
+	testResponse        struct{ Errors []error }
+	testResponseHandler func(ctx context.Context) *testResponse
+	testExtension       interface {
+		ExtensionName() string
+		Validate(schema testSchema) error
+	}
+	testResponseInterceptor interface {
+		InterceptResponse(ctx context.Context, next testResponseHandler) *testResponse
+	}
+)
+
+func TestGraphQLExtension(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(obs))
+
+	ext := NewGraphQLExtension[testSchema, *testResponse, testResponseHandler](NewGraphQLLogger(),
+		func(ctx context.Context, resp *testResponse) GraphQLOperation {
+			return GraphQLOperation{Name: "Orders", Type: "query", Errors: resp.Errors}
+		})
+	var _ testExtension = ext
+	var interceptor testResponseInterceptor = ext
+
+	want := &testResponse{Errors: []error{errors.New("orders: forbidden")}}
+	got := interceptor.InterceptResponse(ctx, func(context.Context) *testResponse { return want })
+	if got != want {
+		t.Fatal("expected the response to be passed through")
+	}
+	if logs.Len() != 1 {
+		t.Fatalf("expected one operation entry, got %d", logs.Len())
+	}
+	e := logs.All()[0]
+	if m := e.ContextMap(); e.Level != zapcore.ErrorLevel || m["graphql_operation"] != "Orders" || m["latency_ms"] == nil || m["graphql_errors"] == nil {
+		t.Fatalf("unexpected operation entry: %v %v", e.Level, m)
+	}
+}
+
+func TestGraphQLLogger(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(obs))
+
+	NewGraphQLLogger().Log(ctx, GraphQLOperation{
+		Name: "Login",
+		Type: "mutation",
+		Variables: map[string]any{
+			"email": "a@example.com",
+			"input": map[string]any{"newPassword": "hunter2", "tags": []any{"x"}},
+		},
+		Complexity: 12,
+		Errors:     []error{errors.New("input.email: already taken")},
+	}, 3*time.Millisecond)
+	NewGraphQLLogger(WithoutGraphQLVariables()).Log(ctx, GraphQLOperation{Type: "query", Variables: map[string]any{"id": 1}}, time.Millisecond)
+
+	login, anon := logs.All()[0], logs.All()[1]
+	m := login.ContextMap()
+	vars := m["graphql_variables"].(map[string]any)
+	input := vars["input"].(map[string]any)
+	if login.Level != zapcore.ErrorLevel || m["graphql_operation"] != "Login" || m["graphql_complexity"] != int64(12) ||
+		vars["email"] != "a@example.com" || input["newPassword"] != "[REDACTED]" || m["graphql_errors"] == nil {
+		t.Fatalf("unexpected operation entry: %v %v", login.Level, m)
+	}
+	if m := anon.ContextMap(); m["graphql_operation"] != "anonymous" || m["graphql_variables"] != nil {
+		t.Fatalf("unexpected anonymous entry: %v", m)
+	}
+}
@@ -0,0 +1,545 @@
+package zapang
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Minimal MessagePack support for the Fluentd forward protocol and the
+// msgpack export encoding. It encodes values produced by decoding JSON with
+// UseNumber, transcodes zap's JSON output, decodes the flat string maps
+// Fluentd sends as acks, and converts msgpack exports back to JSON lines.
+
+func msgpackAppend(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return msgpackAppendInt(b, i)
+		}
+		f, _ := v.Float64()
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+	case string:
+		return msgpackAppendString(b, v)
+	case []any:
+		b = msgpackAppendArrayHeader(b, len(v))
+		for _, e := range v {
+			b = msgpackAppend(b, e)
+		}
+		return b
+	case map[string]any:
+		b = msgpackAppendMapHeader(b, len(v))
+		for k, e := range v {
+			b = msgpackAppend(msgpackAppendString(b, k), e)
+		}
+		return b
+	default:
+		return append(b, 0xc0)
+	}
+}
+
+func msgpackAppendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return msgpackAppendUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(int8(i)))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(i)))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func msgpackAppendUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func msgpackAppendString[S ~string | ~[]byte](b []byte, s S) []byte {
+	switch n := len(s); {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackAppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func msgpackAppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// msgpackAppendEventTime encodes t as a Fluentd EventTime (ext type 0).
+func msgpackAppendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+var errMsgpackUnsupported = errors.New("msgpack: unsupported type")
+
+// msgpackReadStringMap decodes a map with string keys and string values.
+func msgpackReadStringMap(r io.Reader) (map[string]string, error) {
+	var tag [1]byte
+	if _, err := io.ReadFull(r, tag[:]); err != nil {
+		return nil, err
+	}
+	var n int
+	switch {
+	case tag[0]&0xf0 == 0x80:
+		n = int(tag[0] & 0x0f)
+	case tag[0] == 0xde:
+		var l [2]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(l[:]))
+	default:
+		return nil, errMsgpackUnsupported
+	}
+
+	m := make(map[string]string, n)
+	for range n {
+		k, err := msgpackReadString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := msgpackReadString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func msgpackReadString(r io.Reader) (string, error) {
+	var tag [1]byte
+	if _, err := io.ReadFull(r, tag[:]); err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case tag[0]&0xe0 == 0xa0:
+		n = int(tag[0] & 0x1f)
+	case tag[0] == 0xd9:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return "", err
+		}
+		n = int(l[0])
+	case tag[0] == 0xda:
+		var l [2]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(l[:]))
+	default:
+		return "", errMsgpackUnsupported
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+// msgpackEncoder encodes entries like the JSON export encoder it wraps and
+// transcodes them to one MessagePack map each, keeping the field order.
+type msgpackEncoder struct {
+	zapcore.Encoder
+}
+
+func newMsgpackEncoder(cfg Config) *msgpackEncoder {
+	return &msgpackEncoder{Encoder: newExportEncoder(zapcore.NewJSONEncoder(jsonEncoderConfig(cfg)))}
+}
+
+func (e *msgpackEncoder) Clone() zapcore.Encoder {
+	return &msgpackEncoder{Encoder: e.Encoder.Clone()}
+}
+
+func (e *msgpackEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	js, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, err
+	}
+	defer js.Free()
+
+	out := msgpackBufferPool.Get()
+	b, err := msgpackFromJSON(out.Bytes(), bytes.TrimRight(js.Bytes(), "\n"))
+	if err != nil {
+		out.Free()
+		return nil, err
+	}
+	out.Reset()
+	out.Write(b)
+	return out, nil
+}
+
+// msgpackBufferPool holds msgpack entries. Buffers go to the caller, which
+// frees them after writing.
+var msgpackBufferPool = buffer.NewPool()
+
+var errMsgpackJSON = errors.New("msgpack: malformed JSON")
+
+// msgpackFromJSON appends the compact JSON value data, as zap's JSON encoder
+// writes it, to b as MessagePack. Whole numbers become integers and other
+// numbers float64.
+func msgpackFromJSON(b, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return b, errMsgpackJSON
+	}
+	switch data[0] {
+	case '{':
+		fields, ok := scanJSONObject(data, nil)
+		if !ok {
+			return b, errMsgpackJSON
+		}
+		b = msgpackAppendMapHeader(b, len(fields))
+		for _, f := range fields {
+			b = msgpackAppendString(b, f.key)
+			var err error
+			if b, err = msgpackFromJSON(b, f.val); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case '[':
+		var items [][]byte
+		for i := 1; i < len(data)-1; {
+			if data[i] == ',' {
+				i++
+			}
+			end := skipJSONValue(data, i)
+			if end < 0 {
+				return b, errMsgpackJSON
+			}
+			items = append(items, data[i:end])
+			i = end
+		}
+		b = msgpackAppendArrayHeader(b, len(items))
+		for _, item := range items {
+			var err error
+			if b, err = msgpackFromJSON(b, item); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case '"':
+		s, ok := appendUnquoted(nil, data)
+		if !ok {
+			var str string
+			if json.Unmarshal(data, &str) != nil {
+				return b, errMsgpackJSON
+			}
+			s = []byte(str)
+		}
+		return msgpackAppendString(b, s), nil
+	}
+
+	switch string(data) {
+	case "null":
+		return append(b, 0xc0), nil
+	case "true":
+		return append(b, 0xc3), nil
+	case "false":
+		return append(b, 0xc2), nil
+	}
+	if !bytes.ContainsAny(data, ".eE") {
+		if i, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+			return msgpackAppendInt(b, i), nil
+		}
+		if u, err := strconv.ParseUint(string(data), 10, 64); err == nil {
+			return msgpackAppendUint(b, u), nil
+		}
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return b, errMsgpackJSON
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+}
+
+// NewMsgpackReader returns a reader of JSON lines converted from a stream of
+// msgpack export entries (ExportEncoding "msgpack"), for jq, EntryReader and
+// QueryEntries:
+//
+//	entries, err := zapang.QueryEntries(zapang.NewMsgpackReader(f), q)
+//
+// Reads fail on data that is not msgpack maps with string keys.
+func NewMsgpackReader(r io.Reader) io.Reader {
+	return &msgpackReader{r: bufio.NewReader(r)}
+}
+
+type msgpackReader struct {
+	r   *bufio.Reader
+	out []byte
+	err error
+}
+
+func (m *msgpackReader) Read(p []byte) (int, error) {
+	for len(m.out) == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		if _, err := m.r.Peek(1); err != nil {
+			m.err = err
+			continue
+		}
+		line, err := msgpackToJSON(m.r, nil, 0)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			m.err = err
+			continue
+		}
+		m.out = append(line, '\n')
+	}
+	n := copy(p, m.out)
+	m.out = m.out[n:]
+	return n, nil
+}
+
+// msgpackMaxDepth bounds the nesting msgpackToJSON follows.
+const msgpackMaxDepth = 64
+
+// msgpackToJSON reads one msgpack value from r and appends it to b as JSON.
+func msgpackToJSON(r *bufio.Reader, b []byte, depth int) ([]byte, error) {
+	if depth > msgpackMaxDepth {
+		return b, errMsgpackUnsupported
+	}
+	tag, err := r.ReadByte()
+	if err != nil {
+		return b, err
+	}
+	length := func(size int) (int, error) {
+		var l [4]byte
+		if _, err := io.ReadFull(r, l[4-size:]); err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(l[:])), nil
+	}
+	data := func(n int) ([]byte, error) {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+
+	var n int
+	switch {
+	case tag <= 0x7f:
+		return strconv.AppendUint(b, uint64(tag), 10), nil
+	case tag >= 0xe0:
+		return strconv.AppendInt(b, int64(int8(tag)), 10), nil
+	case tag&0xf0 == 0x80, tag == 0xde, tag == 0xdf:
+		switch tag {
+		case 0xde:
+			n, err = length(2)
+		case 0xdf:
+			n, err = length(4)
+		default:
+			n = int(tag & 0x0f)
+		}
+		if err != nil {
+			return b, err
+		}
+		b = append(b, '{')
+		for i := range n {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if k, err := r.Peek(1); err != nil {
+				return b, err
+			} else if !(k[0]&0xe0 == 0xa0 || k[0] == 0xd9 || k[0] == 0xda || k[0] == 0xdb) {
+				return b, errMsgpackUnsupported
+			}
+			if b, err = msgpackToJSON(r, b, depth+1); err != nil {
+				return b, err
+			}
+			b = append(b, ':')
+			if b, err = msgpackToJSON(r, b, depth+1); err != nil {
+				return b, err
+			}
+		}
+		return append(b, '}'), nil
+	case tag&0xf0 == 0x90, tag == 0xdc, tag == 0xdd:
+		switch tag {
+		case 0xdc:
+			n, err = length(2)
+		case 0xdd:
+			n, err = length(4)
+		default:
+			n = int(tag & 0x0f)
+		}
+		if err != nil {
+			return b, err
+		}
+		b = append(b, '[')
+		for i := range n {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = msgpackToJSON(r, b, depth+1); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case tag&0xe0 == 0xa0, tag == 0xd9, tag == 0xda, tag == 0xdb:
+		switch tag {
+		case 0xd9:
+			n, err = length(1)
+		case 0xda:
+			n, err = length(2)
+		case 0xdb:
+			n, err = length(4)
+		default:
+			n = int(tag & 0x1f)
+		}
+		if err != nil {
+			return b, err
+		}
+		s, err := data(n)
+		if err != nil {
+			return b, err
+		}
+		return appendJSONString(b, s), nil
+	case tag == 0xc4, tag == 0xc5, tag == 0xc6: // bin, as base64
+		n, err = length(1 << (tag - 0xc4))
+		if err != nil {
+			return b, err
+		}
+		s, err := data(n)
+		if err != nil {
+			return b, err
+		}
+		b = append(b, '"')
+		b = base64.StdEncoding.AppendEncode(b, s)
+		return append(b, '"'), nil
+	}
+
+	switch tag {
+	case 0xc0:
+		return append(b, "null"...), nil
+	case 0xc2:
+		return append(b, "false"...), nil
+	case 0xc3:
+		return append(b, "true"...), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := data(1 << (tag - 0xcc))
+		if err != nil {
+			return b, err
+		}
+		var u uint64
+		for _, c := range v {
+			u = u<<8 | uint64(c)
+		}
+		return strconv.AppendUint(b, u, 10), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (tag - 0xd0)
+		v, err := data(size)
+		if err != nil {
+			return b, err
+		}
+		var u uint64
+		for _, c := range v {
+			u = u<<8 | uint64(c)
+		}
+		shift := 64 - 8*size // sign-extend
+		return strconv.AppendInt(b, int64(u<<shift)>>shift, 10), nil
+	case 0xca:
+		v, err := data(4)
+		if err != nil {
+			return b, err
+		}
+		return strconv.AppendFloat(b, float64(math.Float32frombits(binary.BigEndian.Uint32(v))), 'f', -1, 32), nil
+	case 0xcb:
+		v, err := data(8)
+		if err != nil {
+			return b, err
+		}
+		return strconv.AppendFloat(b, math.Float64frombits(binary.BigEndian.Uint64(v)), 'f', -1, 64), nil
+	}
+	return b, errMsgpackUnsupported
+}
+
+// appendJSONString appends s to b as a JSON string, escaping it the way zap's
+// JSON encoder does.
+func appendJSONString(b, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, `\ufffd`...)
+		case r == '"' || r == '\\':
+			b = append(b, '\\', byte(r))
+		case r == '\n':
+			b = append(b, `\n`...)
+		case r == '\r':
+			b = append(b, `\r`...)
+		case r == '\t':
+			b = append(b, `\t`...)
+		case r < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		default:
+			b = append(b, s[:size]...)
+		}
+		s = s[size:]
+	}
+	return append(b, '"')
+}
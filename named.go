@@ -0,0 +1,150 @@
+package zapang
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// globalGen counts global logger installations, so cores bound to the
+// global logger know when to rebind.
+var globalGen atomic.Uint64
+
+// named caches the loggers returned by Get.
+var named = struct {
+	mu      sync.Mutex
+	entries map[string]*namedEntry
+}{entries: make(map[string]*namedEntry)}
+
+// namedEntry is a registered name with its logger and level override.
+type namedEntry struct {
+	logger   *zap.Logger
+	override atomic.Pointer[zapcore.Level]
+}
+
+// namedEntryFor returns the entry for name, creating it if needed.
+// The caller must hold named.mu.
+func namedEntryFor(name string) *namedEntry {
+	e, ok := named.entries[name]
+	if !ok {
+		e = &namedEntry{}
+		named.entries[name] = e
+	}
+	return e
+}
+
+// Get returns the named child of the global logger, creating and caching it
+// on first use; entries carry the name in their "logger" field. It is safe to
+// call from package initialization, before New: the logger resolves the
+// current global logger on every entry, so a package-level
+//
+//	var log = zapang.Get("billing")
+//
+// follows New and later reconfiguration. Caller and stacktrace options are
+// taken from the global logger at the first Get, or DefaultLoggerConfig's
+// before New. See SetNamedLevel for per-name levels.
+func Get(name string) *zap.Logger {
+	named.mu.Lock()
+	defer named.mu.Unlock()
+
+	e := namedEntryFor(name)
+	if e.logger != nil {
+		return e.logger
+	}
+
+	core := &namedCore{entry: e}
+	globalMu.RLock()
+	base := globalLogger
+	globalMu.RUnlock()
+	if base != nil {
+		e.logger = base.Named(name).WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return core }))
+	} else {
+		e.logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)).Named(name)
+	}
+	return e.logger
+}
+
+// SetNamedLevel overrides the level of the logger returned by Get(name), in
+// either direction of the global level: "debug" enables Debug entries for one
+// noisy subsystem under investigation, "error" quiets one. Sinks with a fixed
+// level (ConsoleLevel, ExportLevel, WriterSpec.Level, Cores) keep it. An empty
+// level removes the override. It may be called before the logger is first used.
+func SetNamedLevel(name, level string) {
+	named.mu.Lock()
+	e := namedEntryFor(name)
+	named.mu.Unlock()
+
+	if level == "" {
+		e.override.Store(nil)
+		return
+	}
+	lvl := parseLevel(level)
+	e.override.Store(&lvl)
+}
+
+// namedCore resolves the global logger's core on every call, applying the
+// fields added with With and the entry's level override.
+type namedCore struct {
+	entry  *namedEntry
+	fields []zapcore.Field
+	bound  atomic.Pointer[boundCore]
+}
+
+// boundCore is the global core with a namedCore's fields and level override
+// applied, valid for one global logger installation and override.
+type boundCore struct {
+	gen   uint64
+	level *zapcore.Level
+	core  zapcore.Core
+}
+
+// core returns the current global core, with c's fields and level override.
+func (c *namedCore) core() zapcore.Core {
+	globalMu.RLock()
+	base, gen := globalLogger, globalGen.Load()
+	globalMu.RUnlock()
+	if base == nil {
+		return zapcore.NewNopCore()
+	}
+	lvl := c.entry.override.Load()
+	if len(c.fields) == 0 && lvl == nil {
+		return base.Core()
+	}
+	if b := c.bound.Load(); b != nil && b.gen == gen && b.level == lvl {
+		return b.core
+	}
+	core := base.Core()
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	if lvl != nil {
+		core = newLevelOverrideCore(core, *lvl)
+	}
+	c.bound.Store(&boundCore{gen: gen, level: lvl, core: core})
+	return core
+}
+
+func (c *namedCore) Enabled(lvl zapcore.Level) bool {
+	return c.core().Enabled(lvl)
+}
+
+func (c *namedCore) unwrap() zapcore.Core { return c.core() }
+
+func (c *namedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &namedCore{entry: c.entry, fields: append(slices.Clip(c.fields), fields...)}
+}
+
+func (c *namedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.core().Check(ent, ce)
+}
+
+func (c *namedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.core().Write(ent, fields)
+}
+
+func (c *namedCore) Sync() error {
+	return c.core().Sync()
+}
@@ -0,0 +1,62 @@
+package zapang
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// nativeRecord is a JSON export entry split up for platform log services.
+type nativeRecord struct {
+	level   zapcore.Level
+	message string
+	fields  map[string]any
+}
+
+// parseNativeRecord decodes a JSON export entry. Level and message are
+// removed from fields.
+func parseNativeRecord(p []byte) (nativeRecord, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nativeRecord{}, err
+	}
+
+	rec := nativeRecord{level: zapcore.InfoLevel, fields: fields}
+	if s, ok := fields["level"].(string); ok {
+		_ = rec.level.UnmarshalText([]byte(s))
+	}
+	rec.message, _ = fields["message"].(string)
+	delete(fields, "level")
+	delete(fields, "message")
+	return rec, nil
+}
+
+// nativeSource returns the identifier given in a journald:// or eventlog://
+// path, or the executable name.
+func nativeSource(path, scheme string) string {
+	if id := strings.TrimPrefix(path, scheme); id != "" {
+		return id
+	}
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+}
+
+// openNativeSink opens journald:// and eventlog:// export paths. ok is false
+// for other paths.
+func openNativeSink(path string) (ws zapcore.WriteSyncer, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(path, "journald://"):
+		ws, err = openJournald(nativeSource(path, "journald://"))
+		return ws, true, err
+	case strings.HasPrefix(path, "eventlog://"):
+		ws, err = openEventLog(nativeSource(path, "eventlog://"))
+		return ws, true, err
+	default:
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,132 @@
+package zapang
+
+import (
+	"slices"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// nestedKeys maps the keys of the domain field helpers to their place in the
+// nested objects written under Config.NestedFields.
+var nestedKeys = map[string]string{
+	"http_method":            "http.method",
+	"http_path":              "http.path",
+	"http_route":             "http.route",
+	"http_status":            "http.status",
+	"db_operation":           "db.operation",
+	"db_table":               "db.table",
+	"db_duration":            "db.duration",
+	"rows_affected":          "db.rows_affected",
+	"db_query":               "db.query",
+	"db_args":                "db.args",
+	"cache_hit":              "cache.hit",
+	"cache_key":              "cache.key",
+	"redis_command":          "redis.command",
+	"queue_name":             "queue.name",
+	"message_id":             "queue.message_id",
+	"partition":              "queue.partition",
+	"offset":                 "queue.offset",
+	"job_name":               "job.name",
+	"job_id":                 "job.id",
+	"workflow_id":            "workflow.id",
+	"run_id":                 "workflow.run_id",
+	"workflow_type":          "workflow.type",
+	"activity_type":          "activity.type",
+	"activity_id":            "activity.id",
+	"grpc_method":            "grpc.method",
+	"grpc_service":           "grpc.service",
+	"grpc_code":              "grpc.code",
+	"graphql_operation":      "graphql.operation",
+	"graphql_operation_type": "graphql.operation_type",
+	"graphql_complexity":     "graphql.complexity",
+	"graphql_variables":      "graphql.variables",
+	"graphql_errors":         "graphql.errors",
+}
+
+// nestCore writes the domain helpers' fields, in context added with With and
+// in entry fields, as nested objects: http_method and http_status become
+// "http":{"method":...,"status":...}.
+type nestCore struct {
+	zapcore.Core
+	held []zapcore.Field // nested context fields, written with every entry
+}
+
+// applyNestedFields wraps each core with field nesting.
+func applyNestedFields(cores []zapcore.Core) []zapcore.Core {
+	for i, c := range cores {
+		cores[i] = &nestCore{Core: c}
+	}
+	return cores
+}
+
+func (c *nestCore) With(fields []zapcore.Field) zapcore.Core {
+	flat, nested := splitNested(fields)
+	if len(nested) == 0 {
+		return &nestCore{Core: c.Core.With(fields), held: c.held}
+	}
+	return &nestCore{Core: c.Core.With(flat), held: append(slices.Clip(c.held), nested...)}
+}
+
+func (c *nestCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *nestCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	flat, nested := splitNested(fields)
+	if len(c.held) == 0 && len(nested) == 0 {
+		return writeChecked(c.Core, ent, fields)
+	}
+	return writeChecked(c.Core, ent, append(flat, nestedObjects(slices.Concat(c.held, nested))...))
+}
+
+// splitNested separates the fields with a nestedKeys entry, copying fields
+// only if there is one.
+func splitNested(fields []zapcore.Field) (flat, nested []zapcore.Field) {
+	if !slices.ContainsFunc(fields, isNested) {
+		return fields, nil
+	}
+	for _, f := range fields {
+		if isNested(f) {
+			nested = append(nested, f)
+		} else {
+			flat = append(flat, f)
+		}
+	}
+	return flat, nested
+}
+
+func isNested(f zapcore.Field) bool {
+	_, ok := nestedKeys[f.Key]
+	return ok
+}
+
+// nestedObjects groups fields into one object field per nestedKeys prefix, in
+// order of first appearance, under the key after the dot.
+func nestedObjects(fields []zapcore.Field) []zapcore.Field {
+	var objects []zapcore.Field
+	for _, f := range fields {
+		name, key, _ := strings.Cut(nestedKeys[f.Key], ".")
+		f.Key = key
+		i := slices.IndexFunc(objects, func(o zapcore.Field) bool { return o.Key == name })
+		if i < 0 {
+			objects = append(objects, zapcore.Field{Key: name, Type: zapcore.ObjectMarshalerType, Interface: fieldObject(nil)})
+			i = len(objects) - 1
+		}
+		objects[i].Interface = append(objects[i].Interface.(fieldObject), f)
+	}
+	return objects
+}
+
+// fieldObject encodes fields as an object.
+type fieldObject []zapcore.Field
+
+func (o fieldObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, f := range o {
+		f.AddTo(enc)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNestedFields(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var nested, flat bytes.Buffer
+	log, _ := NewWithLevel(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", WriterEncoding: EncodingJSON, NestedFields: true}, &nested)
+	other, _ := NewWithLevel(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", WriterEncoding: EncodingJSON}, &flat)
+
+	log.With(Method("GET"), RequestID("r1")).Info("handled", StatusCode(200), DBTable("users"))
+	other.Info("handled", Method("GET"))
+
+	var got map[string]any
+	if err := json.Unmarshal(nested.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", nested.String(), err)
+	}
+	if want := map[string]any{"method": "GET", "status": 200.0}; !reflect.DeepEqual(got["http"], want) {
+		t.Fatalf("http = %v, want %v", got["http"], want)
+	}
+	if want := map[string]any{"table": "users"}; !reflect.DeepEqual(got["db"], want) {
+		t.Fatalf("db = %v, want %v", got["db"], want)
+	}
+	if got["request_id"] != "r1" || got["http_method"] != nil {
+		t.Fatalf("unexpected flat fields: %s", nested.String())
+	}
+
+	// Other loggers keep the flat keys.
+	var plain map[string]any
+	if err := json.Unmarshal(flat.Bytes(), &plain); err != nil {
+		t.Fatalf("invalid JSON %q: %v", flat.String(), err)
+	}
+	if plain["http_method"] != "GET" || plain["http"] != nil {
+		t.Fatalf("expected flat fields: %s", flat.String())
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package zapang
+
+const raceEnabled = false
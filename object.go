@@ -0,0 +1,78 @@
+package zapang
+
+import (
+	"encoding"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// objectEncoders holds encoders registered with RegisterObjectEncoder, keyed
+// by reflect.Type.
+var objectEncoders sync.Map
+
+// RegisterObjectEncoder makes Object encode values of type T with fn instead
+// of reflection, for types you cannot add a MarshalLogObject method to.
+// Register encoders at init time.
+func RegisterObjectEncoder[T any](fn func(v T, enc zapcore.ObjectEncoder) error) {
+	objectEncoders.Store(reflect.TypeFor[T](), func(v any, enc zapcore.ObjectEncoder) error {
+		return fn(v.(T), enc)
+	})
+}
+
+// Object is a zap.Any replacement that avoids reflection where it can. In
+// order it uses zapcore.ObjectMarshaler, an encoder registered with
+// RegisterObjectEncoder, string forms of common types (time.Time, net.IP,
+// raw [16]byte UUIDs, fmt.Stringer, encoding.TextMarshaler), and only then
+// zap.Any.
+func Object(key string, v any) zap.Field {
+	switch v := v.(type) {
+	case zapcore.ObjectMarshaler:
+		return zap.Object(key, v)
+	case zapcore.ArrayMarshaler:
+		return zap.Array(key, v)
+	case time.Time:
+		return zap.Time(key, v)
+	case time.Duration:
+		return zap.Duration(key, v)
+	case error:
+		return zap.NamedError(key, v)
+	case net.IP:
+		return zap.Stringer(key, v)
+	case [16]byte:
+		return zap.String(key, formatUUID(v))
+	}
+	if v != nil {
+		if fn, ok := objectEncoders.Load(reflect.TypeOf(v)); ok {
+			encode := fn.(func(any, zapcore.ObjectEncoder) error)
+			return zap.Object(key, zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				return encode(v, enc)
+			}))
+		}
+	}
+	switch v := v.(type) {
+	case fmt.Stringer:
+		return zap.Stringer(key, v)
+	case encoding.TextMarshaler:
+		return zap.Stringer(key, textStringer{v})
+	}
+	return zap.Any(key, v)
+}
+
+// textStringer renders an encoding.TextMarshaler lazily, at encode time.
+type textStringer struct {
+	m encoding.TextMarshaler
+}
+
+func (t textStringer) String() string {
+	b, err := t.m.MarshalText()
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
@@ -0,0 +1,123 @@
+package zapang
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type point struct{ X, Y int }
+
+func init() {
+	RegisterObjectEncoder(func(p point, enc zapcore.ObjectEncoder) error {
+		enc.AddInt("x", p.X)
+		enc.AddInt("y", p.Y)
+		return nil
+	})
+}
+
+func TestObject(t *testing.T) {
+	uuid := [16]byte{0x01, 0x8f, 0x2c, 0x3a, 0x4b, 0x5c, 0x7d, 0x6e, 0x8f, 0x90, 0xa1, 0xb2, 0xc3, 0xd4, 0xe5, 0xf6}
+	cases := []struct {
+		v    any
+		typ  zapcore.FieldType
+		want any
+	}{
+		{point{1, 2}, zapcore.ObjectMarshalerType, map[string]any{"x": 1, "y": 2}},
+		{net.ParseIP("10.0.0.1"), zapcore.StringerType, "10.0.0.1"},
+		{netip.MustParseAddr("::1"), zapcore.StringerType, "::1"},
+		{uuid, zapcore.StringType, "018f2c3a-4b5c-7d6e-8f90-a1b2c3d4e5f6"},
+		{time.Second, zapcore.DurationType, time.Second},
+		{struct{ A int }{1}, zapcore.ReflectType, struct{ A int }{1}},
+	}
+	for _, c := range cases {
+		f := Object("v", c.v)
+		if f.Type != c.typ {
+			t.Errorf("%T: got field type %v, want %v", c.v, f.Type, c.typ)
+			continue
+		}
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		if got := enc.Fields["v"]; !equalAny(got, c.want) {
+			t.Errorf("%T: got %#v, want %#v", c.v, got, c.want)
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	blob := []byte{0x0a, 0x03, 'a', 'b', 'c', 0xff}
+	cases := []struct {
+		field zap.Field
+		want  map[string]any
+	}{
+		{Bytes("v", blob), map[string]any{"len": 6, "sha256": "3c9868ca7006e79f"}},
+		{Bytes("v", blob, HexPreview(4)), map[string]any{"len": 6, "sha256": "3c9868ca7006e79f", "hex": "0a036162"}},
+		{Bytes("v", blob, Base64Preview(64)), map[string]any{"len": 6, "sha256": "3c9868ca7006e79f", "base64": "CgNhYmP/"}},
+		{Bytes("v", nil, HexPreview(4)), map[string]any{"len": 0, "sha256": "e3b0c44298fc1c14", "hex": ""}},
+	}
+	for i, c := range cases {
+		enc := zapcore.NewMapObjectEncoder()
+		c.field.AddTo(enc)
+		if got := enc.Fields["v"]; !equalAny(got, c.want) {
+			t.Errorf("case %d: got %#v, want %#v", i, got, c.want)
+		}
+	}
+}
+
+func TestLatencyBucket(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                      "<10ms",
+		9 * time.Millisecond:   "<10ms",
+		10 * time.Millisecond:  "10-100ms",
+		250 * time.Millisecond: "100ms-1s",
+		time.Second:            ">=1s",
+		time.Minute:            ">=1s",
+	}
+	for d, want := range cases {
+		if got := LatencyBucket(d).String; got != want {
+			t.Errorf("LatencyBucket(%v) = %q, want %q", d, got, want)
+		}
+	}
+	b := NewLatencyBuckets(500*time.Microsecond, 1500*time.Millisecond)
+	if got := b.Label(time.Millisecond); got != "500µs-1.5s" {
+		t.Errorf("got %q, want 500µs-1.5s", got)
+	}
+}
+
+func equalAny(a, b any) bool {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if aok && bok {
+		if len(am) != len(bm) {
+			return false
+		}
+		for k, v := range am {
+			if bm[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func BenchmarkObject(b *testing.B) {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	p := point{1, 2}
+	for name, field := range map[string]func() zap.Field{
+		"Object": func() zap.Field { return Object("p", p) },
+		"Any":    func() zap.Field { return zap.Any("p", p) },
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				buf, _ := enc.EncodeEntry(zapcore.Entry{Message: "m"}, []zap.Field{field()})
+				buf.Free()
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package zapang
+
+import (
+	"context"
+	"io"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Option configures a logger built with NewWithOptions.
+type Option func(*optionsConfig)
+
+type optionsConfig struct {
+	cfg Config
+}
+
+// WithLevel sets the minimum level (debug, info, warn, error, dpanic, panic, fatal).
+func WithLevel(level string) Option {
+	return func(o *optionsConfig) {
+		o.cfg.Level = level
+	}
+}
+
+// WithEnvironment sets the environment: local, dev, prod or a registered preset.
+func WithEnvironment(env string) Option {
+	return func(o *optionsConfig) {
+		o.cfg.Environment = env
+	}
+}
+
+// WithExport sends JSON-encoded entries to w, in any environment.
+func WithExport(w io.Writer) Option {
+	return func(o *optionsConfig) {
+		o.cfg.ExportWriter = w
+	}
+}
+
+// WithExportPath exports JSON entries to a file, "stdout", "stderr" or a
+// collector socket. Like Config.ExportPath, it needs an exporting environment.
+func WithExportPath(path string) Option {
+	return func(o *optionsConfig) {
+		o.cfg.ExportPath = path
+	}
+}
+
+// WithWriter adds a writer with the given encoding (console, plain or json),
+// the counterpart of New's writer argument.
+func WithWriter(w io.Writer, encoding string) Option {
+	return func(o *optionsConfig) {
+		o.cfg.Writers = append(o.cfg.Writers, WriterSpec{Writer: w, Encoding: encoding})
+	}
+}
+
+// WithSampling samples repeated entries: initial per second, then every
+// thereafter-th. Zero initial disables sampling.
+func WithSampling(initial, thereafter int) Option {
+	return func(o *optionsConfig) {
+		if initial <= 0 {
+			o.cfg.Sampling = nil
+			return
+		}
+		o.cfg.Sampling = &SamplingConfig{Initial: initial, Thereafter: thereafter}
+	}
+}
+
+// WithCore adds a user-supplied core beside the built-in sinks. It receives
+// the entries that pass sampling and filters, subject to its own level.
+func WithCore(core zapcore.Core) Option {
+	return func(o *optionsConfig) {
+		o.cfg.Cores = append(o.cfg.Cores, core)
+	}
+}
+
+// WithConfig edits the underlying Config directly, for settings without a
+// dedicated option.
+func WithConfig(fn func(*Config)) Option {
+	return func(o *optionsConfig) {
+		fn(&o.cfg)
+	}
+}
+
+// NewWithOptions builds a logger from DefaultLoggerConfig and opts, as an
+// alternative to filling in a Config. Like New, it installs the logger as the
+// global one and reports sinks that cannot be opened to stderr.
+func NewWithOptions(ctx context.Context, serviceName string, opts ...Option) *zap.Logger {
+	o := optionsConfig{cfg: DefaultLoggerConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return New(ctx, serviceName, o.cfg, nil)
+}
@@ -16,10 +16,10 @@ func WithOtelContext(ctx context.Context, log *zap.Logger) *zap.Logger {
 	}
 
 	sc := span.SpanContext()
-	return log.With(
+	return withSpanEvents(log.With(
 		TraceID(sc.TraceID().String()),
 		SpanID(sc.SpanID().String()),
-	)
+	), span)
 }
 
 // OtelCore is a zapcore.Core wrapper that automatically adds trace context.
@@ -47,15 +47,16 @@ func LoggerWithSpan(log *zap.Logger, span trace.Span) *zap.Logger {
 		return log
 	}
 
-	return log.With(
+	return withSpanEvents(log.With(
 		TraceID(sc.TraceID().String()),
 		SpanID(sc.SpanID().String()),
-	)
+	), span)
 }
 
 // TraceEvent logs a trace event as a zap log entry.
 // This helps correlate application logs with distributed traces.
 func TraceEvent(log *zap.Logger, span trace.Span, msg string, fields ...zap.Field) {
+	log = WithCallerSkip(log, 1)
 	if span == nil {
 		log.Info(msg, fields...)
 		return
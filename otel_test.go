@@ -0,0 +1,413 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/embedded"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// recordingSpan is a recording span that keeps its events.
+type recordingSpan struct {
+	noop.Span
+	sc     trace.SpanContext
+	events []trace.EventConfig
+	names  []string
+	attrs  []attribute.KeyValue
+}
+
+func (s *recordingSpan) IsRecording() bool              { return true }
+func (s *recordingSpan) SpanContext() trace.SpanContext { return s.sc }
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+func (s *recordingSpan) AddEvent(name string, opts ...trace.EventOption) {
+	s.names = append(s.names, name)
+	s.events = append(s.events, trace.NewEventConfig(opts...))
+}
+
+func TestSpanEvents(t *testing.T) {
+	span := &recordingSpan{sc: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+	obs, logs := observer.New(zapcore.InfoLevel)
+	base, _ := NewWithLevel(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", SpanEvents: true}, nil, obs)
+
+	log := WithOtelContext(ctx, base).With(UserID("u1"))
+	log.Info("routine")
+	log.Warn("retrying", zap.Int("attempt", 2))
+
+	// Loggers without SpanEvents leave the span alone.
+	WithOtelContext(ctx, zap.New(obs)).Warn("elsewhere")
+
+	if logs.Len() != 3 {
+		t.Fatalf("entries were not logged: %d", logs.Len())
+	}
+	if len(span.names) != 1 || span.names[0] != "retrying" {
+		t.Fatalf("unexpected span events: %v", span.names)
+	}
+	attrs := attribute.NewSet(span.events[0].Attributes()...)
+	if v, _ := attrs.Value("attempt"); v.AsInt64() != 2 {
+		t.Fatalf("missing attempt attribute: %v", attrs.Encoded(attribute.DefaultEncoder()))
+	}
+	if v, _ := attrs.Value("user_id"); v.AsString() != "u1" {
+		t.Fatalf("missing user_id attribute from With: %v", attrs.Encoded(attribute.DefaultEncoder()))
+	}
+	if v, _ := attrs.Value("level"); v.AsString() != "warn" {
+		t.Fatalf("missing level attribute: %v", attrs.Encoded(attribute.DefaultEncoder()))
+	}
+}
+
+func TestMiddlewareOtelSpan(t *testing.T) {
+	span := &recordingSpan{sc: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})}
+	obs, logs := observer.New(zapcore.InfoLevel)
+	handler := HTTPMiddleware(zap.New(obs))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("handling")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Trace-ID", "from-header")
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(trace.ContextWithSpan(req.Context(), span)))
+
+	for _, e := range logs.All() {
+		fields := e.ContextMap()
+		if fields["trace_id"] != span.sc.TraceID().String() || fields["span_id"] != span.sc.SpanID().String() {
+			t.Fatalf("%s: expected the span's IDs, got %v", e.Message, fields)
+		}
+	}
+	if attrs := attribute.NewSet(span.attrs...); attrs.Len() != 1 {
+		t.Fatalf("unexpected span attributes: %v", span.attrs)
+	} else if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != http.StatusTeapot {
+		t.Fatalf("expected status attribute 418, got %v", v.Emit())
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	ctx := ContextWithTraceparent(WithContext(context.Background(), zap.New(obs)),
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, outer := StartSpan(ctx, "checkout")
+	inner := func(ctx context.Context) *Span {
+		ctx, span := StartSpan(ctx, "charge")
+		defer span.End()
+		FromContext(ctx).Info("charging")
+		span.SetError(context.DeadlineExceeded)
+		return span
+	}(ctx)
+	outer.End()
+	outer.End()
+
+	if outer.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" || inner.TraceID() != outer.TraceID() {
+		t.Fatalf("spans did not continue the remote trace: %s, %s", outer.TraceID(), inner.TraceID())
+	}
+	var got []string
+	for _, e := range logs.All() {
+		got = append(got, e.Message)
+	}
+	want := []string{"span started", "span started", "charging", "span failed", "span ended"}
+	if len(got) != len(want) {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("entries = %v, want %v", got, want)
+		}
+	}
+	entries := logs.All()
+	if f := entries[0].ContextMap(); f["parent_span_id"] != "00f067aa0ba902b7" || f["span_id"] != outer.SpanID() {
+		t.Fatalf("outer span start: %v", f)
+	}
+	if f := entries[1].ContextMap(); f["parent_span_id"] != outer.SpanID() || f["span_name"] != "charge" {
+		t.Fatalf("inner span start: %v", f)
+	}
+	if f := entries[2].ContextMap(); f["trace_id"] != outer.TraceID() || f["span_id"] != inner.SpanID() {
+		t.Fatalf("context logger lacks the span: %v", f)
+	}
+	if entries[3].Level != zapcore.ErrorLevel || entries[4].ContextMap()["duration_ms"] == nil {
+		t.Fatalf("unexpected span end entries: %v", entries[3:])
+	}
+
+	if tp := Traceparent(ctx); tp != "00-"+outer.TraceID()+"-"+outer.SpanID()+"-01" {
+		t.Fatalf("Traceparent = %q", tp)
+	}
+	if Traceparent(context.Background()) != "" {
+		t.Fatal("Traceparent without a span should be empty")
+	}
+	_, root := StartSpan(context.Background(), "job")
+	if len(root.TraceID()) != 32 || root.TraceID()[12] != '7' {
+		t.Fatalf("new trace ID should be a UUIDv7 in hex: %s", root.TraceID())
+	}
+}
+
+func TestContextExtractors(t *testing.T) {
+	type userKey struct{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	obs, logs := observer.New(zapcore.InfoLevel)
+	log, _ := NewWithLevel(ctx, "svc", Config{
+		Level:             "info",
+		ConsoleLevel:      "error",
+		ContextExtractors: []ContextExtractor{BaggageExtractor("tenant_id", "missing"), ContextKeyExtractor(userKey{}, "user_id")},
+	}, nil, obs)
+
+	member, _ := baggage.NewMember("tenant_id", "acme")
+	bag, _ := baggage.New(member)
+	ctx = WithContext(baggage.ContextWithBaggage(ctx, bag), log)
+	ctx = context.WithValue(ctx, userKey{}, "u1")
+
+	FromOtelContext(ctx).Info("hello")
+	fields := logs.All()[0].ContextMap()
+	if fields["tenant_id"] != "acme" || fields["user_id"] != "u1" || len(fields) != 3 {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+
+	// Deriving context loggers must not store the extracted fields.
+	ctx = With(With(ctx, zap.String("a", "1")), zap.String("b", "2"))
+	FromContext(ctx).Info("again")
+	if n := len(logs.All()[1].Context); n != 5 {
+		t.Fatalf("extracted fields repeated: %v", logs.All()[1].Context)
+	}
+
+	// Loggers built without the extractors do not run them.
+	FromContext(WithContext(ctx, zap.New(obs))).Info("plain")
+	if n := len(logs.All()[2].Context); n != 0 {
+		t.Fatalf("unexpected extracted fields: %v", logs.All()[2].Context)
+	}
+}
+
+func TestLoggerProvider(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	logger := NewLoggerProvider(zap.New(obs)).Logger("github.com/acme/lib", otellog.WithInstrumentationVersion("1.2.0"))
+
+	if logger.Enabled(context.Background(), otellog.EnabledParameters{Severity: otellog.SeverityDebug}) {
+		t.Fatal("debug should be disabled at info")
+	}
+
+	var rec otellog.Record
+	rec.SetSeverity(otellog.SeverityWarn2)
+	rec.SetBody(otellog.StringValue("cache degraded"))
+	rec.AddAttributes(
+		otellog.Int("hits", 3),
+		otellog.Map("peer", otellog.String("host", "db-1")),
+	)
+	logger.Emit(context.Background(), rec)
+
+	rec.SetSeverity(otellog.SeverityFatal)
+	rec.SetBody(otellog.StringValue("fatal from library"))
+	logger.Emit(context.Background(), rec) // must not exit
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	fields := e.ContextMap()
+	if e.Level != zapcore.WarnLevel || e.Message != "cache degraded" || e.LoggerName != "github.com/acme/lib" ||
+		fields["hits"] != int64(3) || fields["otel_scope_version"] != "1.2.0" ||
+		fields["peer"].(map[string]any)["host"] != "db-1" {
+		t.Fatalf("unexpected entry: %v %q %q %v", e.Level, e.Message, e.LoggerName, fields)
+	}
+	if entries[1].Level != zapcore.DPanicLevel {
+		t.Fatalf("FATAL should map to DPanic, got %v", entries[1].Level)
+	}
+	for lvl := zapcore.DebugLevel; lvl <= zapcore.FatalLevel; lvl++ {
+		if got := SeverityToLevel(LevelToSeverity(lvl)); got != lvl {
+			t.Errorf("%v round-trips to %v", lvl, got)
+		}
+	}
+}
+
+// fakeLoggerProvider is an OTel Logs provider that keeps the emitted records
+// of its Info and higher loggers.
+type fakeLoggerProvider struct {
+	embedded.LoggerProvider
+	mu      sync.Mutex
+	scope   string
+	records []otellog.Record
+	ctxs    []context.Context
+}
+
+func (p *fakeLoggerProvider) Logger(name string, _ ...otellog.LoggerOption) otellog.Logger {
+	p.scope = name
+	return fakeOtelLogger{p: p}
+}
+
+type fakeOtelLogger struct {
+	embedded.Logger
+	p *fakeLoggerProvider
+}
+
+func (l fakeOtelLogger) Enabled(_ context.Context, param otellog.EnabledParameters) bool {
+	return param.Severity >= otellog.SeverityInfo
+}
+
+func (l fakeOtelLogger) Emit(ctx context.Context, rec otellog.Record) {
+	l.p.mu.Lock()
+	defer l.p.mu.Unlock()
+	l.p.records = append(l.p.records, rec)
+	l.p.ctxs = append(l.p.ctxs, ctx)
+}
+
+func TestOtelLogsCore(t *testing.T) {
+	provider := &fakeLoggerProvider{}
+	log := zap.New(NewOtelLogsCore(provider, "billing"), zap.AddCaller()).Named("invoices")
+	if provider.scope != "billing" {
+		t.Fatalf("scope = %q", provider.scope)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log = log.With(zap.String("tenant", "acme"))
+	log.Debug("dropped")
+	log.Warn("slow invoice", zap.Int("ms", 30), zap.Any("ctx", ctx),
+		zap.Object("peer", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("host", "db-1")
+			return nil
+		})))
+
+	if len(provider.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(provider.records))
+	}
+	rec := provider.records[0]
+	if rec.Severity() != otellog.SeverityWarn || rec.SeverityText() != "warn" ||
+		rec.Body().AsString() != "slow invoice" || rec.Timestamp().IsZero() {
+		t.Fatalf("unexpected record: %v %q %v %v", rec.Severity(), rec.SeverityText(), rec.Body(), rec.Timestamp())
+	}
+	if provider.ctxs[0] != ctx {
+		t.Fatal("record not emitted with the ctx field")
+	}
+	attrs := map[string]otellog.Value{}
+	rec.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	if attrs["tenant"].AsString() != "acme" || attrs["ms"].AsInt64() != 30 || attrs["logger"].AsString() != "invoices" ||
+		attrs["code.lineno"].AsInt64() == 0 {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+	if peer := attrs["peer"].AsMap(); len(peer) != 1 || peer[0].Key != "host" || peer[0].Value.AsString() != "db-1" {
+		t.Fatalf("unexpected peer: %v", attrs["peer"])
+	}
+	if _, ok := attrs["ctx"]; ok {
+		t.Fatal("ctx field logged as an attribute")
+	}
+}
+
+// fakeMeter keeps the instruments and callbacks RegisterMetrics creates.
+type fakeMeter struct {
+	metricnoop.Meter
+	callbacks []metric.Callback
+	hist      fakeHistogram
+}
+
+type fakeCounter struct {
+	metricnoop.Int64ObservableCounter
+	name string
+}
+
+type fakeHistogram struct {
+	metricnoop.Float64Histogram
+	mu    sync.Mutex
+	sinks map[string]int
+}
+
+func (h *fakeHistogram) Record(_ context.Context, _ float64, opts ...metric.RecordOption) {
+	attrs := metric.NewRecordConfig(opts).Attributes()
+	sink, _ := attrs.Value("sink")
+	h.mu.Lock()
+	h.sinks[sink.AsString()]++
+	h.mu.Unlock()
+}
+
+func (m *fakeMeter) Int64ObservableCounter(name string, _ ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	return fakeCounter{name: name}, nil
+}
+
+func (m *fakeMeter) Float64Histogram(string, ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &m.hist, nil
+}
+
+func (m *fakeMeter) RegisterCallback(cb metric.Callback, _ ...metric.Observable) (metric.Registration, error) {
+	m.callbacks = append(m.callbacks, cb)
+	return metricnoop.Registration{}, nil
+}
+
+type fakeMeterProvider struct {
+	metricnoop.MeterProvider
+	meter *fakeMeter
+}
+
+func (p fakeMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter { return p.meter }
+
+// fakeObserver sums observations by instrument name and attributes.
+type fakeObserver struct {
+	metricnoop.Observer
+	values map[string]int64
+}
+
+func (o fakeObserver) ObserveInt64(obsrv metric.Int64Observable, v int64, opts ...metric.ObserveOption) {
+	attrs := metric.NewObserveConfig(opts).Attributes()
+	o.values[obsrv.(fakeCounter).name+"{"+string(attrs.Encoded(attribute.DefaultEncoder()))+"}"] += v
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestRegisterMetrics(t *testing.T) {
+	meter := &fakeMeter{hist: fakeHistogram{sinks: make(map[string]int)}}
+	if err := RegisterMetrics(fakeMeterProvider{meter: meter}); err != nil {
+		t.Fatal(err)
+	}
+	defer writeDuration.Store(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log := New(ctx, "svc", Config{Level: "info", StdoutEncoding: EncodingJSON,
+		ErrorOutputPaths: []string{"/dev/null"}, Writers: []WriterSpec{{Writer: io.Discard}, {Writer: failingWriter{}}}}, nil)
+	before := ReadStats()
+	log.Info("hello")
+	log.Warn("careful")
+
+	meter.hist.mu.Lock()
+	if meter.hist.sinks["writers[0]"] != 2 || meter.hist.sinks["console"] != 2 {
+		t.Errorf("write durations by sink: %v", meter.hist.sinks)
+	}
+	meter.hist.mu.Unlock()
+
+	obs := fakeObserver{values: make(map[string]int64)}
+	for _, cb := range meter.callbacks {
+		if err := cb(context.Background(), obs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := obs.values["zapang.entries{level=warn}"]; got != int64(before.Emitted["warn"])+1 {
+		t.Errorf("zapang.entries{level=warn} = %d, want %d", got, before.Emitted["warn"]+1)
+	}
+	if got := obs.values["zapang.write.errors{}"]; got != int64(before.WriteErrors)+2 {
+		t.Errorf("zapang.write.errors = %d, want %d", got, before.WriteErrors+2)
+	}
+}
@@ -0,0 +1,339 @@
+package zapang
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/embedded"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// This file is the only one importing go.opentelemetry.io/otel/log. That API
+// is still pre-1.0 and may change between minor releases; keep the bridges
+// here so an upgrade touches nothing else.
+
+// LevelToSeverity maps a zap level to its OpenTelemetry severity, following
+// the OTel zap bridge: DPanic, Panic and Fatal become FATAL, FATAL2 and FATAL3.
+func LevelToSeverity(lvl zapcore.Level) otellog.Severity {
+	switch lvl {
+	case zapcore.DebugLevel:
+		return otellog.SeverityDebug
+	case zapcore.InfoLevel:
+		return otellog.SeverityInfo
+	case zapcore.WarnLevel:
+		return otellog.SeverityWarn
+	case zapcore.ErrorLevel:
+		return otellog.SeverityError
+	case zapcore.DPanicLevel:
+		return otellog.SeverityFatal1
+	case zapcore.PanicLevel:
+		return otellog.SeverityFatal2
+	case zapcore.FatalLevel:
+		return otellog.SeverityFatal3
+	}
+	return otellog.SeverityUndefined
+}
+
+// SeverityToLevel maps an OpenTelemetry severity to a zap level, the inverse
+// of LevelToSeverity. TRACE becomes Debug and an undefined severity Info.
+func SeverityToLevel(sev otellog.Severity) zapcore.Level {
+	switch {
+	case sev == otellog.SeverityUndefined:
+		return zapcore.InfoLevel
+	case sev <= otellog.SeverityDebug4:
+		return zapcore.DebugLevel
+	case sev <= otellog.SeverityInfo4:
+		return zapcore.InfoLevel
+	case sev <= otellog.SeverityWarn4:
+		return zapcore.WarnLevel
+	case sev <= otellog.SeverityError4:
+		return zapcore.ErrorLevel
+	case sev == otellog.SeverityFatal1:
+		return zapcore.DPanicLevel
+	case sev == otellog.SeverityFatal2:
+		return zapcore.PanicLevel
+	}
+	return zapcore.FatalLevel
+}
+
+// LoggerProvider is an OpenTelemetry Logs LoggerProvider that writes records
+// into a zap logger's cores, so instrumentation libraries logging through the
+// OTel Logs API share the application's sinks, filters and sampling. Install
+// it with global.SetLoggerProvider or pass it to the library.
+type LoggerProvider struct {
+	embedded.LoggerProvider
+	log *zap.Logger
+}
+
+// NewLoggerProvider returns a LoggerProvider writing to log.
+func NewLoggerProvider(log *zap.Logger) *LoggerProvider {
+	return &LoggerProvider{log: log}
+}
+
+// Logger returns an OTel logger whose records carry name as the zap logger
+// name and, if set, the instrumentation version as otel_scope_version.
+func (p *LoggerProvider) Logger(name string, opts ...otellog.LoggerOption) otellog.Logger {
+	core := p.log.Core()
+	if v := otellog.NewLoggerConfig(opts...).InstrumentationVersion(); v != "" {
+		core = core.With([]zapcore.Field{zap.String("otel_scope_version", v)})
+	}
+	return &otelLogger{core: core, name: name}
+}
+
+// otelLogger writes OTel log records straight to zap cores. It bypasses
+// zap.Logger, so FATAL records are logged without exiting the process.
+type otelLogger struct {
+	embedded.Logger
+	core zapcore.Core
+	name string
+}
+
+func (l *otelLogger) Enabled(_ context.Context, param otellog.EnabledParameters) bool {
+	return l.core.Enabled(SeverityToLevel(param.Severity))
+}
+
+func (l *otelLogger) Emit(ctx context.Context, rec otellog.Record) {
+	ent := zapcore.Entry{
+		Level:      SeverityToLevel(rec.Severity()),
+		Time:       rec.Timestamp(),
+		LoggerName: l.name,
+		Message:    logValueString(rec.Body()),
+	}
+	if ent.Time.IsZero() {
+		ent.Time = time.Now()
+	}
+	ce := l.core.Check(ent, nil)
+	if ce == nil {
+		return
+	}
+
+	fields := make([]zapcore.Field, 0, rec.AttributesLen()+3)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields, TraceID(sc.TraceID().String()), SpanID(sc.SpanID().String()))
+	}
+	if name := rec.EventName(); name != "" {
+		fields = append(fields, zap.String("event_name", name))
+	}
+	rec.WalkAttributes(func(kv otellog.KeyValue) bool {
+		fields = append(fields, logValueField(kv.Key, kv.Value))
+		return true
+	})
+	ce.Write(fields...)
+}
+
+func logValueString(v otellog.Value) string {
+	if v.Kind() == otellog.KindString {
+		return v.AsString()
+	}
+	return v.String()
+}
+
+// logValueField converts an OTel log value, nesting maps as objects and
+// slices as arrays.
+func logValueField(key string, v otellog.Value) zapcore.Field {
+	switch v.Kind() {
+	case otellog.KindString:
+		return zap.String(key, v.AsString())
+	case otellog.KindInt64:
+		return zap.Int64(key, v.AsInt64())
+	case otellog.KindFloat64:
+		return zap.Float64(key, v.AsFloat64())
+	case otellog.KindBool:
+		return zap.Bool(key, v.AsBool())
+	case otellog.KindBytes:
+		return zap.Binary(key, v.AsBytes())
+	case otellog.KindSlice:
+		return zap.Array(key, logSlice(v.AsSlice()))
+	case otellog.KindMap:
+		return zap.Object(key, logMap(v.AsMap()))
+	}
+	return zap.Skip()
+}
+
+type logMap []otellog.KeyValue
+
+func (m logMap) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, kv := range m {
+		logValueField(kv.Key, kv.Value).AddTo(enc)
+	}
+	return nil
+}
+
+type logSlice []otellog.Value
+
+func (s logSlice) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, v := range s {
+		switch v.Kind() {
+		case otellog.KindString:
+			enc.AppendString(v.AsString())
+		case otellog.KindInt64:
+			enc.AppendInt64(v.AsInt64())
+		case otellog.KindFloat64:
+			enc.AppendFloat64(v.AsFloat64())
+		case otellog.KindBool:
+			enc.AppendBool(v.AsBool())
+		case otellog.KindSlice:
+			_ = enc.AppendArray(logSlice(v.AsSlice()))
+		case otellog.KindMap:
+			_ = enc.AppendObject(logMap(v.AsMap()))
+		default:
+			enc.AppendString(v.String())
+		}
+	}
+	return nil
+}
+
+// otelLogsCore emits zap entries as OpenTelemetry log records.
+type otelLogsCore struct {
+	logger otellog.Logger
+	ctx    context.Context
+	attrs  []otellog.KeyValue
+}
+
+// NewOtelLogsCore returns a core that emits entries as OpenTelemetry log
+// records through the provider's logger with the given instrumentation scope
+// name, the other direction of LoggerProvider: pass it in Config.Cores to send
+// the application's logs to an OTel Logs SDK pipeline beside the built-in
+// sinks. Levels map with LevelToSeverity and the logger's Enabled decides
+// which are emitted.
+//
+// Pass a context.Context as a field, e.g. zap.Any("ctx", ctx), to emit the
+// record with it, so the SDK links it to the context's span; the field is not
+// an attribute.
+func NewOtelLogsCore(provider otellog.LoggerProvider, name string) zapcore.Core {
+	return &otelLogsCore{logger: provider.Logger(name), ctx: context.Background()}
+}
+
+func (c *otelLogsCore) Enabled(lvl zapcore.Level) bool {
+	return c.logger.Enabled(c.ctx, otellog.EnabledParameters{Severity: LevelToSeverity(lvl)})
+}
+
+func (c *otelLogsCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.ctx, clone.attrs = c.convert(fields)
+	return &clone
+}
+
+func (c *otelLogsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *otelLogsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ctx, attrs := c.convert(fields)
+
+	var rec otellog.Record
+	rec.SetTimestamp(ent.Time)
+	rec.SetSeverity(LevelToSeverity(ent.Level))
+	rec.SetSeverityText(ent.Level.String())
+	rec.SetBody(otellog.StringValue(ent.Message))
+	if ent.LoggerName != "" {
+		rec.AddAttributes(otellog.String("logger", ent.LoggerName))
+	}
+	if ent.Caller.Defined {
+		rec.AddAttributes(
+			otellog.String("code.filepath", ent.Caller.File),
+			otellog.Int("code.lineno", ent.Caller.Line),
+		)
+		if ent.Caller.Function != "" {
+			rec.AddAttributes(otellog.String("code.function", ent.Caller.Function))
+		}
+	}
+	if ent.Stack != "" {
+		rec.AddAttributes(otellog.String("exception.stacktrace", ent.Stack))
+	}
+	rec.AddAttributes(attrs...)
+	c.logger.Emit(ctx, rec)
+	return nil
+}
+
+// Sync is a no-op: records are handed to the provider, which flushes on its
+// own shutdown.
+func (c *otelLogsCore) Sync() error { return nil }
+
+// convert appends fields to the core's attributes, taking a context.Context
+// field as the emit context instead.
+func (c *otelLogsCore) convert(fields []zapcore.Field) (context.Context, []otellog.KeyValue) {
+	ctx := c.ctx
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		if fctx, ok := f.Interface.(context.Context); ok {
+			ctx = fctx
+			continue
+		}
+		f.AddTo(enc)
+	}
+	attrs := slices.Clip(c.attrs)
+	for _, k := range slices.Sorted(maps.Keys(enc.Fields)) {
+		attrs = append(attrs, otellog.KeyValue{Key: k, Value: anyLogValue(enc.Fields[k])})
+	}
+	return ctx, attrs
+}
+
+// anyLogValue converts a value as zapcore.MapObjectEncoder stores it.
+func anyLogValue(v any) otellog.Value {
+	switch v := v.(type) {
+	case nil:
+		return otellog.Value{}
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case int64:
+		return otellog.Int64Value(v)
+	case int32:
+		return otellog.Int64Value(int64(v))
+	case int16:
+		return otellog.Int64Value(int64(v))
+	case int8:
+		return otellog.Int64Value(int64(v))
+	case int:
+		return otellog.IntValue(v)
+	case uint64:
+		if v > 1<<63-1 {
+			return otellog.StringValue(fmt.Sprint(v))
+		}
+		return otellog.Int64Value(int64(v))
+	case uint32:
+		return otellog.Int64Value(int64(v))
+	case uint16:
+		return otellog.Int64Value(int64(v))
+	case uint8:
+		return otellog.Int64Value(int64(v))
+	case uint:
+		return anyLogValue(uint64(v))
+	case uintptr:
+		return anyLogValue(uint64(v))
+	case float64:
+		return otellog.Float64Value(v)
+	case float32:
+		return otellog.Float64Value(float64(v))
+	case []byte:
+		return otellog.BytesValue(v)
+	case time.Time:
+		return otellog.StringValue(v.Format(time.RFC3339Nano))
+	case time.Duration:
+		return otellog.StringValue(v.String())
+	case []any:
+		vals := make([]otellog.Value, len(v))
+		for i, e := range v {
+			vals[i] = anyLogValue(e)
+		}
+		return otellog.SliceValue(vals...)
+	case map[string]any:
+		kvs := make([]otellog.KeyValue, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			kvs = append(kvs, otellog.KeyValue{Key: k, Value: anyLogValue(v[k])})
+		}
+		return otellog.MapValue(kvs...)
+	}
+	return otellog.StringValue(fmt.Sprint(v))
+}
@@ -0,0 +1,163 @@
+package zapang
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PanicInfo describes a recovered panic.
+type PanicInfo struct {
+	// Value is the value passed to panic.
+	Value any
+
+	// Stack is the goroutine stack at the point of recovery.
+	Stack []byte
+
+	// Time is when the panic was recovered.
+	Time time.Time
+
+	// Context is the context of the request or task that panicked.
+	Context context.Context
+
+	// Request is the HTTP request being served, if any.
+	Request *http.Request
+}
+
+var (
+	panicHooks   []*func(PanicInfo)
+	panicHooksMu sync.RWMutex
+)
+
+// OnPanic registers a hook invoked for every panic recovered by this package
+// (RecoveryMiddleware and task wrappers), before the response is written.
+// Use it to forward panics to a crash-tracking system. The returned function
+// unregisters the hook.
+func OnPanic(hook func(PanicInfo)) (unregister func()) {
+	h := &hook
+	panicHooksMu.Lock()
+	panicHooks = append(slices.Clip(panicHooks), h)
+	panicHooksMu.Unlock()
+	return func() {
+		panicHooksMu.Lock()
+		panicHooks = slices.DeleteFunc(slices.Clone(panicHooks), func(x *func(PanicInfo)) bool { return x == h })
+		panicHooksMu.Unlock()
+	}
+}
+
+// notifyPanic runs registered panic hooks. A panicking hook is ignored.
+func notifyPanic(info PanicInfo) {
+	panicHooksMu.RLock()
+	hooks := panicHooks
+	panicHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		func() {
+			defer func() { _ = recover() }()
+			(*hook)(info)
+		}()
+	}
+}
+
+// panicFingerprintFrames is the number of frames below the panic site that
+// identify a panic.
+const panicFingerprintFrames = 3
+
+// panicFingerprint groups recovered panics by the type of the panic value and
+// the functions that panicked. It must be called from the deferred recover
+// function, while the panicking frames are still on the stack.
+func panicFingerprint(rec any) string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%T\n", rec)
+	seenPanic, n := false, 0
+	for n < panicFingerprintFrames {
+		frame, more := frames.Next()
+		switch {
+		case frame.Function == "runtime.gopanic":
+			seenPanic = true
+		case seenPanic && !strings.HasPrefix(frame.Function, "runtime."):
+			fmt.Fprintln(h, frame.Function)
+			n++
+		}
+		if !more {
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// panicLimiter caps how many panics with the same fingerprint are logged per
+// window. Suppressed panics are reported in one summary entry when the window
+// closes.
+type panicLimiter struct {
+	log    *zap.Logger
+	burst  int
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]*panicWindow
+}
+
+// panicWindow tracks one fingerprint's panics in the current window.
+type panicWindow struct {
+	start      time.Time
+	total      int
+	suppressed int
+}
+
+// allow records a panic and reports whether it should be logged.
+func (l *panicLimiter) allow(fingerprint string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w := l.seen[fingerprint]
+	if w == nil || now.Sub(w.start) >= l.window {
+		if w != nil && w.suppressed > 0 {
+			l.summarize(fingerprint, w)
+		}
+		w = &panicWindow{start: now}
+		l.seen[fingerprint] = w
+	}
+	w.total++
+	if w.total <= l.burst {
+		return true
+	}
+	if w.suppressed == 0 {
+		time.AfterFunc(l.window-now.Sub(w.start), func() { l.flush(fingerprint, w) })
+	}
+	w.suppressed++
+	return false
+}
+
+// flush reports w when its window ends, unless a newer panic already did.
+func (l *panicLimiter) flush(fingerprint string, w *panicWindow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[fingerprint] == w && w.suppressed > 0 {
+		l.summarize(fingerprint, w)
+		delete(l.seen, fingerprint)
+	}
+}
+
+func (l *panicLimiter) summarize(fingerprint string, w *panicWindow) {
+	l.log.Error("panics suppressed",
+		zap.String("panic_fingerprint", fingerprint),
+		zap.Int("suppressed", w.suppressed),
+		zap.Int("total", w.total),
+		zap.Duration("window", l.window),
+	)
+	w.suppressed = 0
+}
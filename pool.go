@@ -0,0 +1,64 @@
+package zapang
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// fieldBufferCap is the initial capacity of pooled buffers; it covers the
+// middleware's completion fields without growing.
+const fieldBufferCap = 16
+
+// maxPooledFieldBuffer caps the capacity of buffers returned to the pool so a
+// single oversized entry does not pin memory.
+const maxPooledFieldBuffer = 256
+
+var fieldBufferPool = sync.Pool{
+	New: func() any {
+		return &FieldBuffer{fields: make([]zap.Field, 0, fieldBufferCap)}
+	},
+}
+
+// FieldBuffer is a reusable field slice for hot paths.
+//
+//	buf := zapang.GetFieldBuffer()
+//	defer buf.Release()
+//	buf.Add(zapang.StatusCode(200), zapang.LatencyMs(d))
+//	log.Info("done", buf.Fields()...)
+//
+// The slice returned by Fields must not be used after Release.
+type FieldBuffer struct {
+	fields []zap.Field
+}
+
+// GetFieldBuffer returns an empty buffer from the pool.
+func GetFieldBuffer() *FieldBuffer {
+	return fieldBufferPool.Get().(*FieldBuffer)
+}
+
+// Add appends fields to the buffer.
+func (b *FieldBuffer) Add(fields ...zap.Field) *FieldBuffer {
+	b.fields = append(b.fields, fields...)
+	return b
+}
+
+// Fields returns the buffered fields.
+func (b *FieldBuffer) Fields() []zap.Field {
+	return b.fields
+}
+
+// Len returns the number of buffered fields.
+func (b *FieldBuffer) Len() int {
+	return len(b.fields)
+}
+
+// Release clears the buffer and returns it to the pool.
+func (b *FieldBuffer) Release() {
+	if cap(b.fields) > maxPooledFieldBuffer {
+		return
+	}
+	clear(b.fields)
+	b.fields = b.fields[:0]
+	fieldBufferPool.Put(b)
+}
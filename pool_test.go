@@ -0,0 +1,43 @@
+package zapang
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func benchLogger() *zap.Logger {
+	return zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(jsonEncoderConfig(Config{})),
+		zapcore.AddSync(discard{}),
+		zapcore.InfoLevel,
+	))
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+
+func BenchmarkFieldsSlice(b *testing.B) {
+	log := benchLogger()
+	b.ReportAllocs()
+	for b.Loop() {
+		fields := []zap.Field{StatusCode(200), LatencyMs(time.Millisecond), ResponseSize(512)}
+		fields = append(fields, RequestSize(128))
+		log.Info("request completed", fields...)
+	}
+}
+
+func BenchmarkFieldBuffer(b *testing.B) {
+	log := benchLogger()
+	b.ReportAllocs()
+	for b.Loop() {
+		buf := GetFieldBuffer()
+		buf.Add(StatusCode(200), LatencyMs(time.Millisecond), ResponseSize(512))
+		buf.Add(RequestSize(128))
+		log.Info("request completed", buf.Fields()...)
+		buf.Release()
+	}
+}
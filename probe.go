@@ -0,0 +1,92 @@
+package zapang
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultProbePaths are the health and readiness probe paths WithProbeSummary
+// matches when given none.
+var DefaultProbePaths = []string{"/healthz", "/readyz", "/livez", "/health", "/ready"}
+
+// WithProbeSummary replaces the "request completed" entries of health and
+// readiness probes with one "probe summary" entry per path every interval:
+// probes (the count), probe_failures (responses other than 200) and
+// max_latency_ms. The summary is logged at Info, or Warn if a probe failed;
+// a window without probes logs nothing. Paths match like WithRouteLevel
+// patterns and default to DefaultProbePaths. Access logs and latency
+// observers still see every probe.
+func WithProbeSummary(interval time.Duration, paths ...string) MiddlewareOption {
+	if len(paths) == 0 {
+		paths = slices.Clone(DefaultProbePaths)
+	}
+	return func(c *middlewareConfig) {
+		c.probes = &probeSummary{interval: interval, paths: paths, windows: make(map[string]*probeWindow)}
+	}
+}
+
+// probeSummary aggregates probe requests per path and window.
+type probeSummary struct {
+	log      *zap.Logger
+	interval time.Duration
+	paths    []string
+
+	mu      sync.Mutex
+	windows map[string]*probeWindow
+}
+
+// probeWindow tracks one path's probes in the current window.
+type probeWindow struct {
+	count      int
+	failures   int
+	maxLatency time.Duration
+}
+
+// match reports whether urlPath is a probe path.
+func (p *probeSummary) match(urlPath string) bool {
+	return slices.ContainsFunc(p.paths, func(pattern string) bool {
+		return matchRoute(pattern, urlPath)
+	})
+}
+
+// record adds a probe to its path's window, starting the window, and the
+// timer that reports it, with the first probe.
+func (p *probeSummary) record(urlPath string, status int, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w := p.windows[urlPath]
+	if w == nil {
+		w = &probeWindow{}
+		p.windows[urlPath] = w
+		time.AfterFunc(p.interval, func() { p.flush(urlPath, w) })
+	}
+	w.count++
+	if status != 200 {
+		w.failures++
+	}
+	w.maxLatency = max(w.maxLatency, latency)
+}
+
+// flush ends w's window and logs its summary.
+func (p *probeSummary) flush(urlPath string, w *probeWindow) {
+	p.mu.Lock()
+	delete(p.windows, urlPath)
+	p.mu.Unlock()
+
+	fields := []zap.Field{
+		Path(urlPath),
+		zap.Int("probes", w.count),
+		zap.Int("probe_failures", w.failures),
+		zap.Float64("max_latency_ms", float64(w.maxLatency.Nanoseconds())/1e6),
+		zap.Duration("window", p.interval),
+	}
+	if w.failures > 0 {
+		p.log.Warn("probe summary", fields...)
+		return
+	}
+	p.log.Info("probe summary", fields...)
+}
@@ -0,0 +1,191 @@
+package zapang
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultPseudonymizedFields are the field keys Config.Pseudonymize hashes
+// when its Fields are empty.
+var DefaultPseudonymizedFields = []string{"user_id", "session_id", "client_ip"}
+
+// PseudonymizeConfig replaces identifying field values with keyed hashes, so
+// entries of one user still correlate without logging who the user is.
+type PseudonymizeConfig struct {
+	// Key is the HMAC-SHA256 key. Keep it secret, and stable across processes
+	// whose logs must correlate. If Key, KeyFile and KeyEnv are empty, a
+	// random per-process key is used.
+	Key []byte `yaml:"-" json:"-" mapstructure:"-"`
+
+	// KeyFile reads the key from a file, e.g. a mounted secret, when Key is
+	// empty. Surrounding whitespace is trimmed.
+	KeyFile string `yaml:"key_file" json:"key_file" mapstructure:"key_file"`
+
+	// KeyEnv reads the key from an environment variable when Key and KeyFile
+	// are empty.
+	KeyEnv string `yaml:"key_env" json:"key_env" mapstructure:"key_env"`
+
+	// Fields lists the keys whose values are hashed. Default:
+	// DefaultPseudonymizedFields.
+	Fields []string `yaml:"fields" json:"fields" mapstructure:"fields"`
+}
+
+// pseudonymPrefix marks hashed values, which are not hashed again.
+const pseudonymPrefix = "hmac:"
+
+// randomPseudonymKey is the key of configurations without one.
+var randomPseudonymKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+// resolve returns c with Key read from KeyFile or KeyEnv if needed. If the
+// key cannot be read, the random key is used and an error returned.
+func (c PseudonymizeConfig) resolve() (PseudonymizeConfig, error) {
+	switch {
+	case len(c.Key) > 0:
+		return c, nil
+	case c.KeyFile != "":
+		key, err := os.ReadFile(c.KeyFile)
+		if key = bytes.TrimSpace(key); err == nil && len(key) == 0 {
+			err = errors.New("empty key")
+		}
+		if err != nil {
+			c.Key = randomPseudonymKey
+			return c, fmt.Errorf("pseudonymize: key file %s: %w", c.KeyFile, err)
+		}
+		c.Key = key
+	case c.KeyEnv != "":
+		key := os.Getenv(c.KeyEnv)
+		if key == "" {
+			c.Key = randomPseudonymKey
+			return c, fmt.Errorf("pseudonymize: key variable %s is not set", c.KeyEnv)
+		}
+		c.Key = []byte(key)
+	default:
+		c.Key = randomPseudonymKey
+	}
+	return c, nil
+}
+
+// fields returns the keys whose values are hashed.
+func (c PseudonymizeConfig) fields() []string {
+	if len(c.Fields) == 0 {
+		return DefaultPseudonymizedFields
+	}
+	return c.Fields
+}
+
+// Pseudonymize returns the keyed hash of an identifier as logged by
+// UserIDHashed and by the global logger's Config.Pseudonymize: "hmac:" and 16
+// hex digits of its HMAC-SHA256. Use it to look up a user's entries during an
+// investigation.
+func Pseudonymize(id string) string {
+	key := randomPseudonymKey
+	if cfg := configOf(Global()); cfg != nil && cfg.Pseudonymize != nil {
+		key = cfg.Pseudonymize.Key
+	}
+	return pseudonymize(key, id)
+}
+
+// pseudonymize returns the hash of id under key, leaving hashes alone.
+func pseudonymize(key []byte, id string) string {
+	if strings.HasPrefix(id, pseudonymPrefix) {
+		return id
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	var sum [sha256.Size]byte
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(sum[:0])[:8])
+}
+
+// UserIDHashed returns a user_id field holding Pseudonymize(id), for call
+// sites that must not log the raw ID even without Config.Pseudonymize.
+func UserIDHashed(id string) zap.Field {
+	return zap.String("user_id", Pseudonymize(id))
+}
+
+// pseudonymCore hashes the values of configured fields, in context added with
+// With and in entry fields, before its sink sees them.
+type pseudonymCore struct {
+	zapcore.Core
+	keys []string
+	key  []byte
+}
+
+// applyPseudonymize wraps each core with field pseudonymization. A cfg
+// without Key uses the random key.
+func applyPseudonymize(cores []zapcore.Core, cfg PseudonymizeConfig) []zapcore.Core {
+	key := cfg.Key
+	if len(key) == 0 {
+		key = randomPseudonymKey
+	}
+	for i, c := range cores {
+		cores[i] = &pseudonymCore{Core: c, keys: cfg.fields(), key: key}
+	}
+	return cores
+}
+
+func (c *pseudonymCore) With(fields []zapcore.Field) zapcore.Core {
+	return &pseudonymCore{Core: c.Core.With(c.hash(fields)), keys: c.keys, key: c.key}
+}
+
+func (c *pseudonymCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *pseudonymCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return writeChecked(c.Core, ent, c.hash(fields))
+}
+
+// hash returns fields with the configured keys' values hashed, copying them
+// only if one needs to be.
+func (c *pseudonymCore) hash(fields []zapcore.Field) []zapcore.Field {
+	i := slices.IndexFunc(fields, func(f zapcore.Field) bool { return slices.Contains(c.keys, f.Key) })
+	if i < 0 {
+		return fields
+	}
+	out := slices.Clone(fields)
+	for j := i; j < len(out); j++ {
+		if !slices.Contains(c.keys, out[j].Key) {
+			continue
+		}
+		if id, ok := fieldText(out[j]); ok {
+			out[j] = zap.String(out[j].Key, pseudonymize(c.key, id))
+		}
+	}
+	return out
+}
+
+// fieldText returns the text of a string, stringer or integer field.
+func fieldText(f zapcore.Field) (string, bool) {
+	switch f.Type {
+	case zapcore.StringType:
+		return f.String, true
+	case zapcore.ByteStringType:
+		return string(f.Interface.([]byte)), true
+	case zapcore.StringerType:
+		return fmt.Sprint(f.Interface), true
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		return strconv.FormatInt(f.Integer, 10), true
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
+		return strconv.FormatUint(uint64(f.Integer), 10), true
+	}
+	return "", false
+}
@@ -0,0 +1,99 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPseudonymize(t *testing.T) {
+	obs, logs := observer.New(zapcore.InfoLevel)
+	core := applyPseudonymize([]zapcore.Core{obs}, PseudonymizeConfig{})[0]
+	l := zap.New(core).With(zap.String("session_id", "s1"))
+
+	l.Info("login", zap.String("user_id", "u1"), zap.String("client_ip", "10.0.0.1"), zap.String("route", "/login"))
+	l.Info("again", zap.String("user_id", "u1"), UserIDHashed("u1"))
+	l.Info("numeric", zap.Int("user_id", 42))
+
+	entries := logs.All()
+	first, second := entries[0].ContextMap(), entries[1].ContextMap()
+	for _, key := range []string{"user_id", "session_id", "client_ip"} {
+		v, _ := first[key].(string)
+		if !strings.HasPrefix(v, "hmac:") || len(v) != len("hmac:")+16 {
+			t.Fatalf("expected %s to be hashed, got %v", key, first[key])
+		}
+	}
+	if first["route"] != "/login" {
+		t.Fatalf("unconfigured fields must be left alone, got %v", first["route"])
+	}
+	if first["user_id"] != second["user_id"] || second["user_id"] != Pseudonymize("u1") {
+		t.Fatalf("expected stable hashes, got %v and %v", first["user_id"], second["user_id"])
+	}
+	if entries[1].Context[2].String != Pseudonymize("u1") {
+		t.Fatalf("UserIDHashed must not be hashed twice, got %v", entries[1].Context[2].String)
+	}
+	if entries[2].ContextMap()["user_id"] != Pseudonymize("42") {
+		t.Fatalf("expected integer IDs to be hashed, got %v", entries[2].ContextMap()["user_id"])
+	}
+}
+
+func TestPseudonymizeKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ZAPANG_TEST_PSEUDONYM_KEY", "env-key")
+
+	obs, logs := observer.New(zapcore.InfoLevel)
+	for _, p := range []PseudonymizeConfig{{KeyFile: keyFile}, {KeyEnv: "ZAPANG_TEST_PSEUDONYM_KEY"}, {Key: []byte("file-key")}} {
+		log, _, err := newLogger(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", Pseudonymize: &p, Cores: []zapcore.Core{obs}}, nil)
+		if err != nil {
+			t.Fatalf("%+v: %v", p, err)
+		}
+		log.Info("login", zap.String("user_id", "u1"))
+	}
+	entries := logs.All()
+	fromFile, fromEnv, fromKey := entries[0].ContextMap()["user_id"], entries[1].ContextMap()["user_id"], entries[2].ContextMap()["user_id"]
+	if fromFile != pseudonymize([]byte("file-key"), "u1") || fromFile != fromKey {
+		t.Fatalf("expected the key file to be used, got %v", fromFile)
+	}
+	if fromEnv != pseudonymize([]byte("env-key"), "u1") {
+		t.Fatalf("expected the key variable to be used, got %v", fromEnv)
+	}
+
+	_, _, err := newLogger(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", Pseudonymize: &PseudonymizeConfig{KeyEnv: "ZAPANG_TEST_UNSET"}}, nil)
+	if err == nil {
+		t.Fatal("expected an error for an unset key variable")
+	}
+}
+
+func TestPseudonymizeAccessLog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key := []byte("access-key")
+	log, _ := NewWithLevel(ctx, "svc", Config{Level: "info", ConsoleLevel: "error", Pseudonymize: &PseudonymizeConfig{Key: key}}, nil)
+
+	var access bytes.Buffer
+	handler := HTTPMiddleware(log, WithAccessLogFormat(AccessLogCombined, &access))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.SetBasicAuth("alice", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := pseudonymize(key, "203.0.113.9") + " - " + pseudonymize(key, "alice") + " ["
+	if !strings.HasPrefix(access.String(), want) {
+		t.Fatalf("expected hashed address and user, got %s", access.String())
+	}
+}
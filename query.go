@@ -0,0 +1,76 @@
+package zapang
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LogQuery logs a database query with the context logger, for database/sql
+// call sites and driver hooks:
+//
+//	start := time.Now()
+//	rows, err := db.QueryContext(ctx, q, args...)
+//	zapang.LogQuery(ctx, q, args, time.Since(start), err)
+//
+// Queries are logged at Debug with db_query and db_duration, and db_args if
+// the logger's Config.QueryArgs is set. Failed queries are logged at Error,
+// except sql.ErrNoRows. Queries slower than Config.SlowQueryThreshold are
+// logged at Warn with slow_query=true, and explain_hint=true for statements
+// EXPLAIN can analyze.
+func LogQuery(ctx context.Context, query string, args []any, d time.Duration, err error) {
+	log := WithCallerSkip(FromContext(ctx), 1)
+	var threshold time.Duration
+	var logArgs bool
+	if cfg := configOf(log); cfg != nil {
+		threshold, logArgs = cfg.SlowQueryThreshold, cfg.QueryArgs
+	}
+	slow := threshold > 0 && d > threshold
+	failed := err != nil && !errors.Is(err, sql.ErrNoRows)
+
+	lvl := zap.DebugLevel
+	switch {
+	case failed:
+		lvl = zap.ErrorLevel
+	case slow:
+		lvl = zap.WarnLevel
+	}
+	ce := log.Check(lvl, "query")
+	if ce == nil {
+		return
+	}
+
+	buf := GetFieldBuffer()
+	defer buf.Release()
+	buf.Add(DBQuery(query), DBDuration(d))
+	if logArgs && args != nil {
+		buf.Add(zap.Any("db_args", args))
+	}
+	if slow {
+		buf.Add(SlowQuery())
+		if explainable(query) {
+			buf.Add(zap.Bool("explain_hint", true))
+		}
+	}
+	if err != nil {
+		buf.Add(Error(err))
+	}
+	ce.Write(buf.Fields()...)
+}
+
+// explainable reports whether EXPLAIN accepts the statement.
+func explainable(query string) bool {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return false
+	}
+	switch strings.ToUpper(words[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "REPLACE", "MERGE":
+		return true
+	}
+	return false
+}
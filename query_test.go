@@ -0,0 +1,66 @@
+package zapang
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	obs, logs := observer.New(zapcore.DebugLevel)
+	log, _ := NewWithLevel(ctx, "svc", Config{Level: "debug", ConsoleLevel: "error", SlowQueryThreshold: 100 * time.Millisecond}, nil, obs)
+	ctx = WithContext(ctx, log)
+
+	LogQuery(ctx, "SELECT *\n\tFROM users WHERE id = $1", []any{42}, time.Millisecond, sql.ErrNoRows)
+	LogQuery(ctx, "select * from orders", nil, time.Second, nil)
+	LogQuery(ctx, "VACUUM", nil, time.Second, nil)
+	LogQuery(ctx, "INSERT INTO t VALUES (1)", nil, time.Millisecond, errors.New("duplicate key"))
+
+	entries := logs.All()
+	levels := []zapcore.Level{zapcore.DebugLevel, zapcore.WarnLevel, zapcore.WarnLevel, zapcore.ErrorLevel}
+	for i, want := range levels {
+		if entries[i].Level != want {
+			t.Errorf("entry %d: level %v, want %v", i, entries[i].Level, want)
+		}
+	}
+	first := entries[0].ContextMap()
+	if first["db_query"] != "SELECT * FROM users WHERE id = $1" || first["slow_query"] != nil || first["db_args"] != nil {
+		t.Fatalf("unexpected fast query fields: %v", first)
+	}
+	if slow := entries[1].ContextMap(); slow["slow_query"] != true || slow["explain_hint"] != true || slow["db_args"] != nil {
+		t.Fatalf("unexpected slow query fields: %v", slow)
+	}
+	if vacuum := entries[2].ContextMap(); vacuum["explain_hint"] != nil {
+		t.Fatalf("VACUUM cannot be explained: %v", vacuum)
+	}
+
+	// The threshold is the logger's: other loggers keep slow queries at Debug.
+	LogQuery(WithContext(ctx, zap.New(obs)), "select 1", nil, time.Second, nil)
+	if e := logs.All()[4]; e.Level != zapcore.DebugLevel {
+		t.Fatalf("slow query promoted without a threshold: %v", e.Level)
+	}
+
+	// Parameters are logged only with QueryArgs.
+	withArgs, _ := NewWithLevel(ctx, "svc", Config{Level: "debug", ConsoleLevel: "error", QueryArgs: true}, nil, obs)
+	LogQuery(WithContext(ctx, withArgs), "SELECT 1 WHERE id = $1", []any{42}, time.Millisecond, nil)
+	if args, _ := logs.All()[5].ContextMap()["db_args"].([]any); len(args) != 1 || args[0] != 42 {
+		t.Fatalf("expected db_args with QueryArgs: %v", logs.All()[5].ContextMap())
+	}
+}
+
+func TestDBQueryTruncation(t *testing.T) {
+	f := DBQuery(strings.Repeat("é", maxQueryLen))
+	if !utf8.ValidString(f.String) || len(f.String) > maxQueryLen+len("...") {
+		t.Fatalf("query not truncated to valid UTF-8: %d bytes", len(f.String))
+	}
+}
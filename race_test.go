@@ -0,0 +1,7 @@
+//go:build race
+
+package zapang
+
+// raceEnabled reports whether the race detector is on; it makes sync.Pool
+// drop items, so allocation counts are meaningless.
+const raceEnabled = true
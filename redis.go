@@ -0,0 +1,214 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedisCmder is the part of a Redis command the hook logs; go-redis's
+// redis.Cmder satisfies it.
+type RedisCmder interface {
+	// Name is the command name, e.g. "get".
+	Name() string
+
+	// Args are the command arguments, starting with the name. Only the key
+	// (the second argument) is logged, as a pattern; values are never logged.
+	Args() []any
+
+	// Err is the command error.
+	Err() error
+}
+
+// RedisHook logs the commands and pipelines of a Redis client with the
+// context logger. It has the shape of a go-redis v9 redis.Hook without
+// importing go-redis: instantiate it with the client's command and hook
+// types and add it to the client.
+//
+//	rdb.AddHook(zapang.NewRedisHook[redis.Cmder, redis.DialHook, redis.ProcessHook, redis.ProcessPipelineHook](redis.Nil))
+type RedisHook[C RedisCmder, D any, P ~func(context.Context, C) error, PP ~func(context.Context, []C) error] struct {
+	nilReply error
+}
+
+// NewRedisHook returns a RedisHook. A command failing with an error that
+// matches nilReply (errors.Is), go-redis's redis.Nil, is a cache miss rather
+// than a failure.
+func NewRedisHook[C RedisCmder, D any, P ~func(context.Context, C) error, PP ~func(context.Context, []C) error](nilReply error) RedisHook[C, D, P, PP] {
+	return RedisHook[C, D, P, PP]{nilReply: nilReply}
+}
+
+// DialHook returns next; connections are not logged.
+func (h RedisHook[C, D, P, PP]) DialHook(next D) D {
+	return next
+}
+
+// ProcessHook logs each command at Debug, or Error when it failed:
+// redis_command, cache_key (as a pattern), duration_ms and, for reads such as
+// GET and HGET, cache_hit.
+func (h RedisHook[C, D, P, PP]) ProcessHook(next P) P {
+	return func(ctx context.Context, cmd C) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.logCommand(ctx, h.command(cmd), time.Since(start))
+		return err
+	}
+}
+
+// ProcessPipelineHook logs a pipeline or transaction as a single entry instead
+// of one per command: redis_commands (the pipeline length),
+// redis_command_counts by name, cache_hits and cache_misses over its reads,
+// failed commands with the first error, and duration_ms. It is logged at
+// Error if any command failed.
+func (h RedisHook[C, D, P, PP]) ProcessPipelineHook(next PP) PP {
+	return func(ctx context.Context, cmds []C) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		batch := make([]redisCommand, len(cmds))
+		for i, cmd := range cmds {
+			batch[i] = h.command(cmd)
+		}
+		h.logPipeline(ctx, batch, time.Since(start))
+		return err
+	}
+}
+
+func (h RedisHook[C, D, P, PP]) command(cmd C) redisCommand {
+	err := cmd.Err()
+	return redisCommand{
+		name: strings.ToLower(cmd.Name()),
+		args: cmd.Args(),
+		err:  err,
+		miss: err != nil && h.nilReply != nil && errors.Is(err, h.nilReply),
+	}
+}
+
+// redisCommand is an executed command as the hook logs it.
+type redisCommand struct {
+	name string
+	args []any
+	err  error
+	miss bool // the command returned a nil reply
+}
+
+// redisReads are the commands whose nil reply means a cache miss.
+var redisReads = map[string]bool{
+	"get": true, "getex": true, "getdel": true, "hget": true,
+	"lindex": true, "zscore": true, "json.get": true,
+}
+
+// failed reports whether the command failed with a real error.
+func (c redisCommand) failed() bool {
+	return c.err != nil && !c.miss
+}
+
+// keyPattern returns the command key with ID-like segments replaced by "*",
+// e.g. "user:42:profile" becomes "user:*:profile".
+func (c redisCommand) keyPattern() string {
+	if len(c.args) < 2 {
+		return ""
+	}
+	parts := strings.Split(fmt.Sprint(c.args[1]), ":")
+	for i, p := range parts {
+		if idLike(p) {
+			parts[i] = "*"
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// idLike reports whether a key segment is a number, a UUID or a long hex string.
+func idLike(s string) bool {
+	if s == "" {
+		return false
+	}
+	digits, hex := true, true
+	for _, r := range s {
+		isDigit := r >= '0' && r <= '9'
+		isHex := isDigit || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F') || r == '-'
+		digits = digits && isDigit
+		hex = hex && isHex
+	}
+	return digits || (hex && len(s) >= 16)
+}
+
+func (h RedisHook[C, D, P, PP]) logCommand(ctx context.Context, cmd redisCommand, d time.Duration) {
+	lvl := zapcore.DebugLevel
+	if cmd.failed() {
+		lvl = zapcore.ErrorLevel
+	}
+	ce := FromContext(ctx).Check(lvl, "redis command")
+	if ce == nil {
+		return
+	}
+
+	buf := GetFieldBuffer()
+	defer buf.Release()
+	buf.Add(RedisCommandName(cmd.name), DurationMs(d))
+	if key := cmd.keyPattern(); key != "" {
+		buf.Add(CacheKey(key))
+	}
+	if redisReads[cmd.name] && !cmd.failed() {
+		buf.Add(CacheHit(!cmd.miss))
+	}
+	if cmd.failed() {
+		buf.Add(Error(cmd.err))
+	}
+	ce.Write(buf.Fields()...)
+}
+
+func (h RedisHook[C, D, P, PP]) logPipeline(ctx context.Context, cmds []redisCommand, d time.Duration) {
+	counts := make(map[string]int)
+	var hits, misses, failed int
+	var firstErr error
+	for _, cmd := range cmds {
+		counts[cmd.name]++
+		switch {
+		case cmd.failed():
+			failed++
+			if firstErr == nil {
+				firstErr = cmd.err
+			}
+		case !redisReads[cmd.name]:
+		case cmd.miss:
+			misses++
+		default:
+			hits++
+		}
+	}
+
+	lvl := zapcore.DebugLevel
+	if failed > 0 {
+		lvl = zapcore.ErrorLevel
+	}
+	ce := FromContext(ctx).Check(lvl, "redis pipeline")
+	if ce == nil {
+		return
+	}
+
+	buf := GetFieldBuffer()
+	defer buf.Release()
+	buf.Add(
+		zap.Int("redis_commands", len(cmds)),
+		zap.Object("redis_command_counts", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for _, name := range slices.Sorted(maps.Keys(counts)) {
+				enc.AddInt(name, counts[name])
+			}
+			return nil
+		})),
+		DurationMs(d),
+	)
+	if hits+misses > 0 {
+		buf.Add(zap.Int("cache_hits", hits), zap.Int("cache_misses", misses))
+	}
+	if failed > 0 {
+		buf.Add(zap.Int("failed", failed), Error(firstErr))
+	}
+	ce.Write(buf.Fields()...)
+}
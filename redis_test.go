@@ -0,0 +1,76 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// The go-redis v9 hook types, mirrored so the test checks RedisHook fits them.
+type (
+	testCmder interface {
+		Name() string
+		Args() []any
+		Err() error
+	}
+	testDialHook            func(ctx context.Context, network, addr string) (net.Conn, error)
+	testProcessHook         func(ctx context.Context, cmd testCmder) error
+	testProcessPipelineHook func(ctx context.Context, cmds []testCmder) error
+	testHook                interface {
+		DialHook(next testDialHook) testDialHook
+		ProcessHook(next testProcessHook) testProcessHook
+		ProcessPipelineHook(next testProcessPipelineHook) testProcessPipelineHook
+	}
+)
+
+type testCmd struct {
+	args []any
+	err  error
+}
+
+func (c *testCmd) Name() string { return fmt.Sprint(c.args[0]) }
+func (c *testCmd) Args() []any  { return c.args }
+func (c *testCmd) Err() error   { return c.err }
+
+func TestRedisHook(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	ctx := WithContext(context.Background(), zap.New(obs))
+	redisNil := errors.New("redis: nil")
+
+	var hook testHook = NewRedisHook[testCmder, testDialHook, testProcessHook, testProcessPipelineHook](redisNil)
+	process := hook.ProcessHook(func(context.Context, testCmder) error { return nil })
+	pipeline := hook.ProcessPipelineHook(func(context.Context, []testCmder) error { return nil })
+
+	// A wrapped nil reply is still a miss; an error that only reads the same is not.
+	_ = process(ctx, &testCmd{args: []any{"GET", "user:42:profile"}, err: fmt.Errorf("cache: %w", redisNil)})
+	_ = process(ctx, &testCmd{args: []any{"set", "session:9f86d081884c7d65", "secret"}})
+	_ = process(ctx, &testCmd{args: []any{"get", "a"}, err: errors.New("redis: nil")})
+	_ = pipeline(ctx, []testCmder{
+		&testCmd{args: []any{"get", "a"}},
+		&testCmd{args: []any{"get", "b"}, err: redisNil},
+		&testCmd{args: []any{"incr", "c"}, err: errors.New("WRONGTYPE")},
+	})
+
+	get, set, lookalike, pipe := logs.All()[0], logs.All()[1], logs.All()[2], logs.All()[3]
+	if m := get.ContextMap(); get.Level != zapcore.DebugLevel || m["redis_command"] != "get" || m["cache_key"] != "user:*:profile" || m["cache_hit"] != false {
+		t.Fatalf("unexpected get entry: %v %v", get.Level, m)
+	}
+	if m := set.ContextMap(); m["cache_key"] != "session:*" || m["cache_hit"] != nil {
+		t.Fatalf("unexpected set entry: %v", m)
+	}
+	if lookalike.Level != zapcore.ErrorLevel {
+		t.Fatalf("expected a failure for an error that is not the nil reply, got %v", lookalike.Level)
+	}
+	m := pipe.ContextMap()
+	counts, _ := m["redis_command_counts"].(map[string]any)
+	if pipe.Level != zapcore.ErrorLevel || m["redis_commands"] != int64(3) || counts["get"] != 2 ||
+		m["cache_hits"] != int64(1) || m["cache_misses"] != int64(1) || m["failed"] != int64(1) {
+		t.Fatalf("unexpected pipeline entry: %v %v", pipe.Level, m)
+	}
+}
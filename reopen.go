@@ -0,0 +1,95 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"weak"
+)
+
+// fileSinks tracks the file sinks opened by openSink, weakly, so ReopenFiles
+// can reach them without keeping discarded loggers' files alive.
+var fileSinks struct {
+	mu    sync.Mutex
+	sinks []registeredFileSink
+}
+
+// registeredFileSink is a file sink and the done channel of its logger's
+// context; ReopenFiles forgets it once either is gone.
+type registeredFileSink struct {
+	sink weak.Pointer[fileSink]
+	done <-chan struct{}
+}
+
+func (r registeredFileSink) live() *fileSink {
+	select {
+	case <-r.done:
+		return nil
+	default:
+		return r.sink.Value()
+	}
+}
+
+func registerFileSink(ctx context.Context, s *fileSink) {
+	fileSinks.mu.Lock()
+	fileSinks.sinks = append(fileSinks.sinks, registeredFileSink{sink: weak.Make(s), done: ctx.Done()})
+	fileSinks.mu.Unlock()
+}
+
+// ReopenFiles closes and reopens every file used as a JSON export sink or
+// fallback by a logger whose context is not done, so writes go to a fresh file
+// after logrotate moved the old one away. Errors are reported per file; failed
+// files are retried on the next write.
+func ReopenFiles() error {
+	fileSinks.mu.Lock()
+	var live []*fileSink
+	sinks := fileSinks.sinks[:0]
+	for _, r := range fileSinks.sinks {
+		if s := r.live(); s != nil {
+			live = append(live, s)
+			sinks = append(sinks, r)
+		}
+	}
+	clear(fileSinks.sinks[len(sinks):])
+	fileSinks.sinks = sinks
+	fileSinks.mu.Unlock()
+
+	var errs []error
+	for _, s := range live {
+		if err := s.reopen(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reopen swaps the file handle for a new one opened at the same path.
+func (s *fileSink) reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	return s.openLocked()
+}
+
+// reopenOnSIGHUP calls ReopenFiles on every SIGHUP until ctx is done.
+func reopenOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := ReopenFiles(); err != nil {
+				internalErrors(ctx).report(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package zapang
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	processStart = time.Now()
+
+	// requestsServed counts requests completed by HTTPMiddleware.
+	requestsServed atomic.Uint64
+
+	// componentErrors counts Error+ entries by their "component" field.
+	componentErrors sync.Map // string -> *atomic.Uint64
+)
+
+// errorCounterCore counts Error+ entries per component. It writes nothing.
+type errorCounterCore struct {
+	level     zapcore.LevelEnabler
+	component string
+}
+
+func (c *errorCounterCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= zapcore.ErrorLevel && c.level.Enabled(lvl)
+}
+
+func (c *errorCounterCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	for _, f := range fields {
+		if f.Key == "component" && f.Type == zapcore.StringType {
+			clone.component = f.String
+		}
+	}
+	return &clone
+}
+
+func (c *errorCounterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *errorCounterCore) Write(_ zapcore.Entry, fields []zapcore.Field) error {
+	component := c.component
+	for _, f := range fields {
+		if f.Key == "component" && f.Type == zapcore.StringType {
+			component = f.String
+		}
+	}
+	if component == "" {
+		component = "unknown"
+	}
+	counter, _ := componentErrors.LoadOrStore(component, new(atomic.Uint64))
+	counter.(*atomic.Uint64).Add(1)
+	return nil
+}
+
+func (c *errorCounterCore) Sync() error {
+	return nil
+}
+
+// LogShutdownReport flushes every sink of the global logger and logs a single
+// summary entry of the process lifetime: uptime, requests served by HTTPMiddleware,
+// error totals per component, entry statistics and per-sink flush results.
+// Call it last during graceful shutdown.
+func LogShutdownReport() {
+	globalMu.RLock()
+	live := globalLive
+	globalMu.RUnlock()
+
+	flush := make(map[string]string)
+	if live != nil {
+		for _, s := range live.sinks {
+			if err := s.core.Sync(); err != nil {
+				flush[s.name] = err.Error()
+			} else {
+				flush[s.name] = "ok"
+			}
+		}
+	}
+
+	errorsByComponent := make(map[string]uint64)
+	componentErrors.Range(func(k, v any) bool {
+		errorsByComponent[k.(string)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+
+	stats := ReadStats()
+	log := Global()
+	log.Info("shutdown report",
+		zap.Duration("uptime", time.Since(processStart)),
+		zap.Uint64("requests_served", requestsServed.Load()),
+		zap.Any("errors_by_component", errorsByComponent),
+		zap.Any("entries_by_level", stats.Emitted),
+		zap.Uint64("entries_dropped", stats.Dropped),
+		zap.Any("sink_flush", flush),
+	)
+	_ = log.Sync()
+}
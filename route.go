@@ -0,0 +1,77 @@
+package zapang
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// WithRouteExtractor sets how the middleware finds a request's route template,
+// logged as http_route. fn runs after the handler, when routers have matched
+// the request; it returns "" if no route matched. Without it, the pattern
+// http.ServeMux matched (Request.Pattern) is used. For chi, with the middleware
+// installed through router.Use:
+//
+//	zapang.WithRouteExtractor(func(r *http.Request) string {
+//		return chi.RouteContext(r.Context()).RoutePattern()
+//	})
+func WithRouteExtractor(fn func(r *http.Request) string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.routeExtractor = fn
+	}
+}
+
+// WithRouteLevel sets the level of the request logger, and so of the
+// "request completed" entry and everything the handler logs through the
+// context, for request paths matching pattern. Patterns use path.Match syntax;
+// a trailing "*" matches the rest of the path, so "/internal/*" covers
+// /internal/debug/vars. The first matching pattern wins. Like tenant levels,
+// the override replaces the logger's global level in either direction: "debug"
+// on /internal/*, "warn" to quiet /healthz. Sinks with a fixed level keep it.
+func WithRouteLevel(pattern, level string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.routeLevels = append(c.routeLevels, routeLevel{pattern: pattern, level: parseLevel(level)})
+	}
+}
+
+type routeLevel struct {
+	pattern string
+	level   zapcore.Level
+}
+
+// matchRoute reports whether urlPath matches a WithRouteLevel pattern.
+func matchRoute(pattern, urlPath string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && !strings.ContainsAny(prefix, "*?[\\") {
+		return strings.HasPrefix(urlPath, prefix)
+	}
+	ok, _ := path.Match(pattern, urlPath)
+	return ok
+}
+
+// routeLogger applies the level of the first WithRouteLevel pattern matching
+// r's path to log.
+func (c *middlewareConfig) routeLogger(log *zap.Logger, r *http.Request) *zap.Logger {
+	for _, rl := range c.routeLevels {
+		if matchRoute(rl.pattern, r.URL.Path) {
+			return log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+				return newLevelOverrideCore(core, rl.level)
+			}))
+		}
+	}
+	return log
+}
+
+// route returns the route template r was served by, without the method and
+// host of ServeMux patterns ("GET example.com/items/{id}" is "/items/{id}").
+func (c *middlewareConfig) route(r *http.Request) string {
+	if c.routeExtractor != nil {
+		return c.routeExtractor(r)
+	}
+	if i := strings.IndexByte(r.Pattern, '/'); i >= 0 {
+		return r.Pattern[i:]
+	}
+	return ""
+}
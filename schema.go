@@ -0,0 +1,195 @@
+package zapang
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Schema actions for entries with mismatched field types.
+const (
+	// SchemaFlag writes the entry with a schema_violations field listing the mismatches.
+	SchemaFlag = "flag"
+
+	// SchemaDrop discards the entry and reports the mismatch to stderr.
+	SchemaDrop = "drop"
+)
+
+// Schema declares the expected JSON type of field keys, so the same key never
+// reaches a log index as both a number and a string. Keys not in Fields are
+// not checked. Intended for dev and CI, where mismatches can still be fixed.
+type Schema struct {
+	// Version is added to every entry as schema_version when set.
+	Version string `yaml:"version" json:"version" mapstructure:"version"`
+
+	// Fields maps field keys to their expected type. See SchemaFromStruct.
+	Fields map[string]FieldType `yaml:"fields" json:"fields" mapstructure:"fields"`
+
+	// Action is SchemaFlag (default) or SchemaDrop.
+	Action string `yaml:"action" json:"action" mapstructure:"action"`
+}
+
+// SchemaFromStruct derives schema fields from a struct's exported fields,
+// keyed by their json tag (or field name). Fields tagged json:"-" are skipped.
+func SchemaFromStruct(v any) map[string]FieldType {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]FieldType, t.NumField())
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		key := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			key = tag
+		}
+		fields[key] = kindType(f.Type)
+	}
+	return fields
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+)
+
+// kindType maps a Go type to the JSON type zap encodes it as.
+func kindType(t reflect.Type) FieldType {
+	switch t {
+	case durationType:
+		return TypeNumber
+	case timeType:
+		return TypeString
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return kindType(t.Elem())
+	case reflect.String:
+		return TypeString
+	case reflect.Bool:
+		return TypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return TypeNumber
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return TypeString
+		}
+		return TypeArray
+	case reflect.Array:
+		return TypeArray
+	case reflect.Struct, reflect.Map:
+		return TypeObject
+	default:
+		return TypeAny
+	}
+}
+
+// zapFieldType returns the JSON type a zap field encodes to, or TypeAny if it
+// depends on the encoder or value.
+func zapFieldType(f zapcore.Field) FieldType {
+	switch f.Type {
+	case zapcore.StringType, zapcore.StringerType, zapcore.ErrorType, zapcore.ByteStringType,
+		zapcore.BinaryType, zapcore.Complex64Type, zapcore.Complex128Type:
+		return TypeString
+	case zapcore.BoolType:
+		return TypeBool
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type,
+		zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type, zapcore.UintptrType,
+		zapcore.Float64Type, zapcore.Float32Type, zapcore.DurationType:
+		return TypeNumber
+	case zapcore.ObjectMarshalerType, zapcore.InlineMarshalerType:
+		return TypeObject
+	case zapcore.ArrayMarshalerType:
+		return TypeArray
+	case zapcore.ReflectType:
+		if f.Interface == nil {
+			return TypeNull
+		}
+		return kindType(reflect.TypeOf(f.Interface))
+	default:
+		return TypeAny
+	}
+}
+
+// schemaReported dedupes mismatch reports on stderr.
+var schemaReported sync.Map
+
+// schemaCore checks field types against a schema before writing.
+// ctxViolations holds mismatches found in fields added with With.
+type schemaCore struct {
+	zapcore.Core
+	schema        *Schema
+	errs          *errorOutput
+	ctxViolations []string
+}
+
+// applySchema wraps each core with schema validation, reporting mismatches to errs.
+func applySchema(cores []zapcore.Core, schema *Schema, errs *errorOutput) []zapcore.Core {
+	for i, c := range cores {
+		cores[i] = &schemaCore{Core: c, schema: schema, errs: errs}
+	}
+	return cores
+}
+
+func (c *schemaCore) violations(fields []zapcore.Field) []string {
+	var out []string
+	for _, f := range fields {
+		want, ok := c.schema.Fields[f.Key]
+		if !ok || want == TypeAny {
+			continue
+		}
+		if got := zapFieldType(f); got != TypeAny && got != want {
+			out = append(out, fmt.Sprintf("%s is %s, want %s", f.Key, got, want))
+		}
+	}
+	return out
+}
+
+func (c *schemaCore) With(fields []zapcore.Field) zapcore.Core {
+	return &schemaCore{
+		Core:          c.Core.With(fields),
+		schema:        c.schema,
+		errs:          c.errs,
+		ctxViolations: slices.Concat(c.ctxViolations, c.violations(fields)),
+	}
+}
+
+func (c *schemaCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *schemaCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	violations := slices.Concat(c.ctxViolations, c.violations(fields))
+	if len(violations) == 0 {
+		return writeChecked(c.Core, ent, fields)
+	}
+
+	for _, v := range violations {
+		if _, seen := schemaReported.LoadOrStore(v, struct{}{}); !seen {
+			c.errs.report(fmt.Errorf("schema violation in %q: %s", ent.Message, v))
+		}
+	}
+	if c.schema.Action == SchemaDrop {
+		return nil
+	}
+	return writeChecked(c.Core, ent, append(slices.Clip(fields), zap.Strings("schema_violations", violations)))
+}
@@ -0,0 +1,54 @@
+package zapang
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSchemaFromStruct(t *testing.T) {
+	type orderLog struct {
+		UserID  string        `json:"user_id"`
+		Amount  float64       `json:"amount"`
+		Latency time.Duration `json:"latency"`
+		Items   []string      `json:"items,omitempty"`
+		Secret  string        `json:"-"`
+	}
+	got := SchemaFromStruct(orderLog{})
+	want := map[string]FieldType{"user_id": TypeString, "amount": TypeNumber, "latency": TypeNumber, "items": TypeArray}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSchemaCore(t *testing.T) {
+	fields := map[string]FieldType{"user_id": TypeString}
+
+	obs, logs := observer.New(zapcore.InfoLevel)
+	l := zap.New(applySchema([]zapcore.Core{obs}, &Schema{Fields: fields}, nil)[0])
+	l.Info("ok", zap.String("user_id", "u1"))
+	l.With(zap.Int("user_id", 7)).Info("flagged")
+
+	entries := logs.All()
+	if len(entries) != 2 || entries[0].ContextMap()["schema_violations"] != nil {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if v, _ := entries[1].ContextMap()["schema_violations"].([]any); len(v) != 1 || v[0] != "user_id is number, want string" {
+		t.Fatalf("expected flagged entry, got %v", entries[1].ContextMap())
+	}
+
+	obs, logs = observer.New(zapcore.InfoLevel)
+	l = zap.New(applySchema([]zapcore.Core{obs}, &Schema{Fields: fields, Action: SchemaDrop}, nil)[0])
+	l.Info("dropped", zap.Int("user_id", 7))
+	if logs.Len() != 0 {
+		t.Fatalf("expected entry to be dropped, got %v", logs.All())
+	}
+}
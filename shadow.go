@@ -0,0 +1,149 @@
+package zapang
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// shadowKey is the context key of a shadowBuffer.
+type shadowKey struct{}
+
+// WithShadowBuffer returns a context whose logger keeps the last n entries it
+// suppresses by level, such as Debug entries under an Info logger, in a shadow
+// buffer instead of discarding them. Call Replay when the work turns out to
+// have failed to write them after the fact. The buffer costs a caller lookup
+// and a field copy per suppressed entry, so scope it to a request or a job.
+func WithShadowBuffer(ctx context.Context, n int) context.Context {
+	if n <= 0 {
+		return ctx
+	}
+	log := contextLogger(ctx)
+	b := &shadowBuffer{entries: make([]bufferedEntry, n)}
+	ctx = context.WithValue(ctx, shadowKey{}, b)
+	return WithContext(ctx, b.logger(log))
+}
+
+// Replay writes the entries the context's shadow buffer holds, oldest first,
+// past the logger level that suppressed them, each with replayed=true, and
+// empties the buffer. Sinks with a fixed level (ConsoleLevel, ExportLevel,
+// WriterSpec.Level, Cores) keep it. It returns the number of entries written; without a shadow
+// buffer it does nothing.
+func Replay(ctx context.Context) int {
+	b, ok := ctx.Value(shadowKey{}).(*shadowBuffer)
+	if !ok {
+		return 0
+	}
+	return b.replay()
+}
+
+// WithShadowDebug gives each request a shadow buffer of the last n entries its
+// logger suppressed by level (see WithShadowBuffer), replayed automatically
+// before "request completed" when the status is 5xx or the handler logged at
+// Error; the completion entry counts them in entries_replayed. Handlers can
+// call Replay themselves for failures they handle.
+func WithShadowDebug(n int) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.shadowSize = n
+	}
+}
+
+// shadowBuffer is a ring of suppressed entries.
+type shadowBuffer struct {
+	mu      sync.Mutex
+	entries []bufferedEntry
+	next    int
+	full    bool
+	errored bool // an Error or higher entry was logged
+}
+
+// logger returns log with its suppressed entries routed into the buffer.
+func (b *shadowBuffer) logger(log *zap.Logger) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &shadowCore{Core: c, buf: b}
+	}))
+}
+
+func (b *shadowBuffer) record(e bufferedEntry) {
+	b.mu.Lock()
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	b.full = b.full || b.next == 0
+	b.mu.Unlock()
+}
+
+func (b *shadowBuffer) sawError() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.errored
+}
+
+func (b *shadowBuffer) replay() int {
+	b.mu.Lock()
+	var entries []bufferedEntry
+	if b.full {
+		entries = append(slices.Clone(b.entries[b.next:]), b.entries[:b.next]...)
+	} else {
+		entries = slices.Clone(b.entries[:b.next])
+	}
+	clear(b.entries)
+	b.next, b.full = 0, false
+	b.mu.Unlock()
+
+	replayed := zap.Bool("replayed", true)
+	for _, e := range entries {
+		core := newLevelOverrideCore(e.core, e.ent.Level)
+		if ce := core.Check(e.ent, nil); ce != nil {
+			ce.Write(append(e.fields, replayed)...)
+		}
+	}
+	return len(entries)
+}
+
+// shadowCore records the entries its core would drop by level into a
+// shadowBuffer. It enables every level, so zap checks, and adds callers and
+// stacks to, the entries it records.
+type shadowCore struct {
+	zapcore.Core
+	buf *shadowBuffer
+}
+
+func (c *shadowCore) Enabled(zapcore.Level) bool { return true }
+
+func (c *shadowCore) unwrap() zapcore.Core { return c.Core }
+
+func (c *shadowCore) With(fields []zapcore.Field) zapcore.Core {
+	return &shadowCore{Core: c.Core.With(fields), buf: c.buf}
+}
+
+func (c *shadowCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Enabled(ent.Level) {
+		if ent.Level >= zapcore.ErrorLevel {
+			c.buf.mu.Lock()
+			c.buf.errored = true
+			c.buf.mu.Unlock()
+		}
+		return c.Core.Check(ent, ce)
+	}
+	return ce.AddCore(ent, shadowRecorder{c})
+}
+
+// shadowRecorder is the write side of shadowCore.
+type shadowRecorder struct {
+	c *shadowCore
+}
+
+func (r shadowRecorder) Enabled(zapcore.Level) bool        { return true }
+func (r shadowRecorder) With([]zapcore.Field) zapcore.Core { return r }
+func (r shadowRecorder) Check(_ zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+func (r shadowRecorder) Sync() error { return nil }
+
+func (r shadowRecorder) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	r.c.buf.record(bufferedEntry{core: r.c.Core, ent: ent, fields: slices.Clone(fields)})
+	return nil
+}
@@ -0,0 +1,252 @@
+package zapang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// openSink resolves "stdout", "stderr", a tcp://, tcps:// or udp:// collector
+// address, journald:// or eventlog://, or a file path to a WriteSyncer. Files are opened eagerly; the
+// returned fileSink reopens them on demand after failures, and ReopenFiles
+// reaches it until ctx is done; the file is closed when the logger ctx builds
+// shuts down. Sockets connect on first write and reconnect with backoff.
+func openSink(ctx context.Context, path string) (zapcore.WriteSyncer, error) {
+	if ws, ok, err := openNativeSink(path); ok {
+		return ws, err
+	}
+	if sock, ok, err := parseSocketURL(path); ok {
+		if err != nil {
+			return nil, err
+		}
+		return sock, nil
+	}
+	switch path {
+	case "stdout":
+		return stdSink{os.Stdout}, nil
+	case "stderr":
+		return stdSink{os.Stderr}, nil
+	default:
+		s := &fileSink{path: path}
+		registerFileSink(ctx, s)
+		if files, ok := ctx.Value(openFilesKey{}).(*openFiles); ok {
+			files.add(s)
+		}
+		return s, s.open()
+	}
+}
+
+// openFiles are the file sinks a logger opened, closed by its shutdown, also
+// when NewE fails after some of them were opened.
+type openFiles struct {
+	mu    sync.Mutex
+	files []*fileSink
+}
+
+// openFilesKey carries a logger's openFiles in the context its sinks are
+// built with.
+type openFilesKey struct{}
+
+func (o *openFiles) add(s *fileSink) {
+	o.mu.Lock()
+	o.files = append(o.files, s)
+	o.mu.Unlock()
+}
+
+// close closes the files; a later write opens its file again.
+func (o *openFiles) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var errs []error
+	for _, s := range o.files {
+		if err := s.close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", s.path, err))
+		}
+	}
+	o.files = nil
+	return errors.Join(errs...)
+}
+
+// fileSink is an append-only file WriteSyncer that (re)opens its file lazily.
+type fileSink struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (s *fileSink) open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openLocked()
+}
+
+func (s *fileSink) openLocked() error {
+	if s.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	return nil
+}
+
+func (s *fileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.openLocked(); err != nil {
+		return 0, err
+	}
+	n, err := s.file.Write(p)
+	if err != nil {
+		// Drop the handle so the next write reopens the file.
+		_ = s.file.Close()
+		s.file = nil
+	}
+	return n, err
+}
+
+// rollTo closes the file and moves it to dst. The next write creates a new
+// file at the original path.
+func (s *fileSink) rollTo(dst string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	return os.Rename(s.path, dst)
+}
+
+// close closes the file. A later write opens it again.
+func (s *fileSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *fileSink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// FailoverConfig configures a FailoverWriteSyncer.
+type FailoverConfig struct {
+	// MaxFailures is the number of consecutive primary write errors before failing over. Default: 3.
+	MaxFailures int
+
+	// ProbeInterval is how often the primary is retried while failed over. Default: 30s.
+	ProbeInterval time.Duration
+}
+
+// FailoverWriteSyncer writes to a primary sink and switches to a fallback after
+// repeated errors. While failed over it periodically probes the primary with a
+// real entry and switches back once it succeeds. Entries that fail on the
+// primary are written to the fallback, so none are lost during the switch.
+type FailoverWriteSyncer struct {
+	primary  zapcore.WriteSyncer
+	fallback zapcore.WriteSyncer
+	cfg      FailoverConfig
+	errs     *errorOutput
+
+	mu         sync.Mutex
+	failures   int
+	failedOver bool
+	lastProbe  time.Time
+}
+
+// NewFailoverWriteSyncer returns a WriteSyncer that fails over from primary to fallback.
+func NewFailoverWriteSyncer(primary, fallback zapcore.WriteSyncer, cfg FailoverConfig) *FailoverWriteSyncer {
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 3
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 30 * time.Second
+	}
+	return &FailoverWriteSyncer{primary: primary, fallback: fallback, cfg: cfg}
+}
+
+// FailedOver reports whether writes currently go to the fallback.
+func (f *FailoverWriteSyncer) FailedOver() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failedOver
+}
+
+func (f *FailoverWriteSyncer) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failedOver {
+		if time.Since(f.lastProbe) < f.cfg.ProbeInterval {
+			return f.fallback.Write(p)
+		}
+		f.lastProbe = time.Now()
+		if _, err := f.primary.Write(p); err != nil {
+			return f.fallback.Write(p)
+		}
+		f.failedOver = false
+		f.failures = 0
+		f.errs.report(fmt.Errorf("export sink recovered, switched back to primary"))
+		return len(p), nil
+	}
+
+	n, err := f.primary.Write(p)
+	if err == nil {
+		f.failures = 0
+		return n, nil
+	}
+
+	f.failures++
+	if f.failures >= f.cfg.MaxFailures {
+		f.failedOver = true
+		f.lastProbe = time.Now()
+		f.errs.report(fmt.Errorf("export sink failed %d times, switched to fallback: %w", f.failures, err))
+	}
+	return f.fallback.Write(p)
+}
+
+func (f *FailoverWriteSyncer) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failedOver {
+		return f.fallback.Sync()
+	}
+	return f.primary.Sync()
+}
+
+// stdSink is stdout or stderr. Syncing them fails on terminals and pipes,
+// which do not support fsync; those errors are dropped so Sync reports real
+// failures only.
+type stdSink struct {
+	*os.File
+}
+
+func (s stdSink) Sync() error {
+	err := s.File.Sync()
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+	return err
+}
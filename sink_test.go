@@ -0,0 +1,663 @@
+package zapang
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type flakySink struct {
+	fail bool
+	buf  bytes.Buffer
+}
+
+func (s *flakySink) Write(p []byte) (int, error) {
+	if s.fail {
+		return 0, errors.New("disk full")
+	}
+	return s.buf.Write(p)
+}
+
+func (s *flakySink) Sync() error { return nil }
+
+func TestFailoverWriteSyncer(t *testing.T) {
+	primary := &flakySink{fail: true}
+	var fallback bytes.Buffer
+	f := NewFailoverWriteSyncer(primary, zapcore.AddSync(&fallback), FailoverConfig{
+		MaxFailures:   2,
+		ProbeInterval: time.Millisecond,
+	})
+
+	for _, line := range []string{"a\n", "b\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !f.FailedOver() || fallback.String() != "a\nb\n" {
+		t.Fatalf("expected failover with entries kept, got %v %q", f.FailedOver(), fallback.String())
+	}
+
+	primary.fail = false
+	time.Sleep(2 * time.Millisecond)
+	_, _ = f.Write([]byte("c\n"))
+	if f.FailedOver() || primary.buf.String() != "c\n" {
+		t.Fatalf("expected recovery to primary, got %v %q", f.FailedOver(), primary.buf.String())
+	}
+}
+
+func TestSpoolWriteSyncer(t *testing.T) {
+	sink := &flakySink{fail: true}
+	path := filepath.Join(t.TempDir(), "spool")
+	s, err := NewSpoolWriteSyncer(sink, SpoolConfig{Path: path, MaxBytes: 6, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		if _, err := s.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Spooled() != 6 || s.Dropped() != 1 {
+		t.Fatalf("expected 3 spooled entries and 1 dropped, got %d bytes, %d dropped", s.Spooled(), s.Dropped())
+	}
+
+	sink.fail = false
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = s.Write([]byte("e\n"))
+	if s.Spooled() != 0 || sink.buf.String() != "b\nc\nd\ne\n" {
+		t.Fatalf("expected in-order replay, got %d spooled, %q", s.Spooled(), sink.buf.String())
+	}
+}
+
+func TestSpoolWriteSyncerRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spool")
+	// A spool file from an earlier version, ending with an entry torn by a crash.
+	if err := os.WriteFile(path, []byte("a\nb"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sink := &flakySink{fail: true}
+	s, err := NewSpoolWriteSyncer(sink, SpoolConfig{Path: path, MaxBytes: 64, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"c\n", "d\n"} {
+		if _, err := s.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Leftovers of a rewrite interrupted by a crash are ignored.
+	if err := os.WriteFile(path+".00000001.tmp", []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSpoolWriteSyncer(sink, SpoolConfig{Path: path, MaxBytes: 64, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Spooled() != 7 {
+		t.Fatalf("expected 7 spooled bytes after restart, got %d", s.Spooled())
+	}
+	sink.fail = false
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Spooled() != 0 || sink.buf.String() != "a\nc\nd\n" {
+		t.Fatalf("expected replay without the torn entry, got %d spooled, %q", s.Spooled(), sink.buf.String())
+	}
+	if left, _ := filepath.Glob(path + "*"); len(left) != 0 {
+		t.Fatalf("expected delivered segments to be removed, got %v", left)
+	}
+}
+
+type countingSink struct {
+	flakySink
+	ok int
+}
+
+func (s *countingSink) Write(p []byte) (int, error) {
+	if s.ok == 0 {
+		return 0, errors.New("unavailable")
+	}
+	s.ok--
+	return s.buf.Write(p)
+}
+
+func TestSpoolWriteSyncerPartialReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool")
+	sink := &countingSink{}
+	s, err := NewSpoolWriteSyncer(sink, SpoolConfig{Path: path, MaxBytes: 64, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		_, _ = s.Write([]byte(line))
+	}
+	sink.ok = 1
+	_ = s.Sync()
+	if s.Spooled() != 4 || sink.buf.String() != "a\n" {
+		t.Fatalf("expected one delivered entry, got %d spooled, %q", s.Spooled(), sink.buf.String())
+	}
+	_ = s.Close()
+
+	// The delivered entry is not replayed again after a restart.
+	s, err = NewSpoolWriteSyncer(sink, SpoolConfig{Path: path, MaxBytes: 64, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	sink.ok = 10
+	_ = s.Sync()
+	if s.Spooled() != 0 || sink.buf.String() != "a\nb\nc\n" {
+		t.Fatalf("expected the rest in order, got %d spooled, %q", s.Spooled(), sink.buf.String())
+	}
+}
+
+func TestAsyncWriteSyncer(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAsyncWriteSyncer(zapcore.AddSync(&buf), AsyncConfig{QueueSize: 2})
+	defer a.Close()
+
+	line := []byte("a\n")
+	for _, c := range "abcde" {
+		line[0] = byte(c) // the caller may reuse its buffer
+		if _, err := a.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "a\nb\nc\nd\ne\n" {
+		t.Fatalf("expected strict ordering, got %q", buf.String())
+	}
+}
+
+// unsafeWriter is a writer that is not safe for concurrent use; the race
+// detector reports concurrent writes.
+type unsafeWriter struct{ lines int }
+
+func (w *unsafeWriter) Write(p []byte) (int, error) {
+	w.lines += bytes.Count(p, []byte("\n"))
+	return len(p), nil
+}
+
+func TestAsyncRelaxedOrdering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var w unsafeWriter
+	l := New(ctx, "svc", Config{
+		Level:   "info",
+		Writers: []WriterSpec{{Writer: &w, Encoding: EncodingJSON, Async: &AsyncConfig{Ordering: OrderingRelaxed, Workers: 4}}},
+	}, nil)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 250 {
+				l.Info("tick")
+			}
+		}()
+	}
+	wg.Wait()
+	_ = l.Sync()
+	if w.lines != 1000 {
+		t.Fatalf("writer got %d of 1000 entries", w.lines)
+	}
+}
+
+func TestAsyncSyncUnderLoad(t *testing.T) {
+	a := NewAsyncWriteSyncer(zapcore.AddSync(io.Discard), AsyncConfig{})
+	defer a.Close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_, _ = a.Write([]byte("tick\n"))
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	// Sync waits for the entries queued before it, not for an empty queue.
+	synced := make(chan error, 1)
+	go func() { synced <- a.Sync() }()
+	select {
+	case err := <-synced:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sync did not return under steady load")
+	}
+}
+
+type blockedWriter struct{ release chan struct{} }
+
+func (w blockedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestIsolateSinks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stuck := blockedWriter{release: make(chan struct{})}
+	defer close(stuck.release)
+	var healthy bytes.Buffer
+	l, live, _ := newLogger(ctx, "svc", Config{
+		Level:        "info",
+		IsolateSinks: true,
+		Writers:      []WriterSpec{{Writer: stuck}, {Writer: &healthy, Encoding: EncodingJSON}},
+	}, nil)
+
+	// More entries than the stuck sink's default queue of 1024 holds: the caller must not block.
+	n := 1124
+	for range n {
+		l.Info("tick")
+	}
+
+	stuckSink, healthySink := live.sinks[1], live.sinks[2]
+	if err := healthySink.core.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := bytes.Count(healthy.Bytes(), []byte("\n")); got != n {
+		t.Fatalf("healthy sink got %d of %d entries", got, n)
+	}
+	if stats := stuckSink.async.Stats(); stats.Dropped == 0 {
+		t.Fatalf("expected the stuck sink to drop entries, got %+v", stats)
+	}
+}
+
+type syncFailSink struct{ bytes.Buffer }
+
+func (s *syncFailSink) Sync() error { return errors.New("fsync failed") }
+
+func TestInternalErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reported := make(chan error, 8)
+	defer OnInternalError(func(err error) {
+		if strings.Contains(err.Error(), "disk full") || strings.Contains(err.Error(), "fsync failed") {
+			reported <- err
+		}
+	})()
+
+	errPath := filepath.Join(t.TempDir(), "errors.log")
+	otherPath := filepath.Join(t.TempDir(), "other.log")
+	_, other, _ := newLogger(ctx, "svc", Config{Level: "info", ErrorOutputPaths: []string{otherPath}}, nil)
+	l, live, err := newLogger(ctx, "svc", Config{
+		Level:            "info",
+		ErrorOutputPaths: []string{errPath},
+		Writers:          []WriterSpec{{Writer: &flakySink{fail: true}}, {Writer: &syncFailSink{}}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("lost")
+	if err := <-reported; !strings.HasPrefix(err.Error(), "write error: ") {
+		t.Fatalf("unexpected write error report: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-reported:
+		if !strings.Contains(err.Error(), "sync: ") {
+			t.Fatalf("unexpected sync error report: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("sync failure at shutdown was not reported")
+	}
+
+	data, err := os.ReadFile(errPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "zapang: write error: ") || !strings.Contains(string(data), "fsync failed") {
+		t.Fatalf("error output missing reports: %q", data)
+	}
+
+	// Each logger reports to its own error output, whose files are closed
+	// with its context.
+	if data, _ := os.ReadFile(otherPath); len(data) > 0 {
+		t.Fatalf("errors reported to another logger's output: %q", data)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for _, errs := range []*errorOutput{live.errs, other.errs} {
+		for {
+			errs.mu.Lock()
+			closed := errs.files == nil
+			errs.mu.Unlock()
+			if closed {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("error output files were not closed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Hooks stop running once unregistered.
+	calls := 0
+	unregister := OnInternalError(func(error) { calls++ })
+	live.errs.report(errors.New("first"))
+	unregister()
+	live.errs.report(errors.New("second"))
+	if calls != 1 {
+		t.Fatalf("hook ran %d times, want 1", calls)
+	}
+}
+
+func TestSocketSinkReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// The collector reads one line per connection and hangs up.
+	received := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			received <- line
+			conn.Close()
+		}
+	}()
+
+	ws, err := openSink(context.Background(), "tcp://"+ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "first\n" {
+		t.Fatalf("got %q", got)
+	}
+
+	// Writes to the closed connection fail, then the sink reconnects.
+	timeout := time.After(5 * time.Second)
+	for {
+		_, _ = ws.Write([]byte("second\n"))
+		select {
+		case got := <-received:
+			if got != "second\n" {
+				t.Fatalf("got %q", got)
+			}
+			return
+		case <-timeout:
+			t.Fatal("sink did not reconnect")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestReopenFiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The file of a logger whose context is done is left alone.
+	deadCtx, deadCancel := context.WithCancel(ctx)
+	deadPath := filepath.Join(t.TempDir(), "gone", "app.jsonl")
+	_ = os.MkdirAll(filepath.Dir(deadPath), 0o755)
+	New(deadCtx, "svc", Config{Environment: EnvProd, ExportPath: deadPath}, nil)
+	deadCancel()
+	if err := os.RemoveAll(filepath.Dir(deadPath)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.jsonl")
+	l := New(ctx, "svc", Config{Environment: EnvProd, ExportPath: path}, nil)
+	l.Info("before rotation")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenFiles(); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after rotation")
+
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if !bytes.Contains(rotated, []byte("before rotation")) || bytes.Contains(rotated, []byte("after rotation")) {
+		t.Fatalf("unexpected rotated file: %s", rotated)
+	}
+	if !bytes.Contains(current, []byte("after rotation")) {
+		t.Fatalf("new file missing entry: %s", current)
+	}
+}
+
+func TestCompressedExport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "app.jsonl.gz")
+	cfg := Config{Environment: EnvProd, ExportPath: path, ExportCompression: &CompressionConfig{FlushInterval: time.Hour}}
+	l := New(ctx, "svc", cfg, nil)
+	l.Info("first")
+	l.Info("second")
+	_ = l.Sync()
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenFiles(); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("third")
+	_ = l.Sync()
+
+	read := func(name string) string {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return string(out)
+	}
+	if got := read(path + ".1"); strings.Count(got, "\n") != 2 || !strings.Contains(got, `"first"`) || !strings.Contains(got, `"second"`) {
+		t.Fatalf("rotated file: %q", got)
+	}
+	if got := read(path); strings.Count(got, "\n") != 1 || !strings.Contains(got, `"third"`) {
+		t.Fatalf("current file: %q", got)
+	}
+
+	if err := (Config{ExportCompression: &CompressionConfig{Algorithm: "zstd"}}).Validate(); err == nil {
+		t.Fatal("zstd accepted")
+	}
+}
+
+func TestCompressedEncryptedExport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key := EncryptionKey{ID: "k1", Key: bytes.Repeat([]byte{7}, 32)}
+	path := filepath.Join(t.TempDir(), "app.jsonl.gz.enc")
+	l := New(ctx, "svc", Config{
+		Environment:       EnvProd,
+		ExportPath:        path,
+		ExportCompression: &CompressionConfig{FlushInterval: time.Hour},
+		ExportEncryption:  &key,
+	}, nil)
+	for range 100 {
+		l.Info("the same entry, over and over")
+	}
+	_ = l.Sync()
+
+	// Compressed before encrypted: the flush is one gzip member, one line.
+	stream, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(stream, []byte("\n")); n != 1 || len(stream) > 2048 {
+		t.Fatalf("expected one small encrypted member, got %d lines, %d bytes", n, len(stream))
+	}
+
+	var gz bytes.Buffer
+	if err := DecryptExport(bytes.NewReader(stream), &gz, map[string][]byte{key.ID: key.Key}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(plain), `"the same entry, over and over"`); n != 100 {
+		t.Fatalf("got %d of 100 entries: %s", n, plain)
+	}
+}
+
+type memArchive struct {
+	mu      sync.Mutex
+	objects map[string]string
+	inputs  []ArchivePutInput
+	deleted []string
+}
+
+func (m *memArchive) PutObject(_ context.Context, in *ArchivePutInput) error {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[in.Key] = string(body)
+	m.inputs = append(m.inputs, *in)
+	return nil
+}
+
+func (m *memArchive) ListObjects(_ context.Context, _, prefix string) ([]ArchiveObject, error) {
+	return []ArchiveObject{
+		{Key: prefix + "app-20200101T000000Z.jsonl", LastModified: time.Now().Add(-48 * time.Hour)},
+		{Key: prefix + "app-20991231T000000Z.jsonl", LastModified: time.Now()},
+	}, nil
+}
+
+func (m *memArchive) DeleteObject(_ context.Context, _, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.jsonl")
+	leftover := filepath.Join(dir, "app-20240101T000000Z.jsonl")
+	if err := os.WriteFile(leftover, []byte("{\"message\":\"earlier run\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memArchive{objects: make(map[string]string)}
+	l := New(ctx, "svc", Config{Environment: EnvProd, ExportPath: path, Archive: &ArchiveConfig{
+		Bucket:               "logs",
+		Prefix:               "billing/",
+		Retention:            24 * time.Hour,
+		ServerSideEncryption: "AES256",
+		Client:               store,
+	}}, nil)
+	l.Info("archived on shutdown")
+	cancel()
+
+	// Sync returns once the last segment is uploaded.
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	store.mu.Lock()
+	n := len(store.objects)
+	store.mu.Unlock()
+	if local, _ := os.ReadDir(dir); n != 2 || len(local) != 0 {
+		t.Fatalf("uploaded %d objects, want 2; local copies left: %v", n, local)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !strings.Contains(store.objects["billing/app-20240101T000000Z.jsonl"], "earlier run") {
+		t.Fatalf("leftover segment not uploaded: %v", store.objects)
+	}
+	var found bool
+	for _, in := range store.inputs {
+		if strings.Contains(store.objects[in.Key], "archived on shutdown") {
+			found = true
+			if in.Bucket != "logs" || in.ServerSideEncryption != "AES256" || in.ContentType != "application/x-ndjson" {
+				t.Fatalf("unexpected put: %+v", in)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("last segment not uploaded: %v", store.objects)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "billing/app-20200101T000000Z.jsonl" {
+		t.Fatalf("deleted %v", store.deleted)
+	}
+}
+
+func TestArchiveExportPathError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := NewE(ctx, "svc", Config{
+		Environment:    EnvProd,
+		ExportPath:     "tcp://no-port",
+		ExportFallback: "stderr",
+		Archive:        &ArchiveConfig{Bucket: "logs", Client: &memArchive{objects: make(map[string]string)}},
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "open export path") {
+		t.Fatalf("expected the export path error, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package zapang
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// limitEncoder enforces Config.MaxFieldLength and Config.MaxEntrySize around
+// a sink's encoder, marking entries it shortened with truncated=true.
+type limitEncoder struct {
+	zapcore.Encoder
+	maxField int
+	maxEntry int
+
+	// truncated records that a context field added with With was shortened.
+	truncated bool
+}
+
+func newLimitEncoder(inner zapcore.Encoder, cfg Config) zapcore.Encoder {
+	if cfg.MaxFieldLength <= 0 && cfg.MaxEntrySize <= 0 {
+		return inner
+	}
+	return &limitEncoder{Encoder: inner, maxField: cfg.MaxFieldLength, maxEntry: cfg.MaxEntrySize}
+}
+
+func (e *limitEncoder) Clone() zapcore.Encoder {
+	return &limitEncoder{Encoder: e.Encoder.Clone(), maxField: e.maxField, maxEntry: e.maxEntry, truncated: e.truncated}
+}
+
+func (e *limitEncoder) AddString(key, val string) {
+	if s, ok := e.truncate(val); ok {
+		val, e.truncated = s, true
+	}
+	e.Encoder.AddString(key, val)
+}
+
+func (e *limitEncoder) AddByteString(key string, val []byte) {
+	if s, ok := e.truncate(string(val)); ok {
+		e.Encoder.AddString(key, s)
+		e.truncated = true
+		return
+	}
+	e.Encoder.AddByteString(key, val)
+}
+
+func (e *limitEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	fields, truncated := e.limitFields(fields)
+	if truncated || e.truncated {
+		fields = append(slices.Clip(fields), zap.Bool("truncated", true))
+	}
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil || e.maxEntry <= 0 || buf.Len() <= e.maxEntry {
+		return buf, err
+	}
+	excess := buf.Len() - e.maxEntry
+	buf.Free()
+	return e.shrink(ent, fields, excess)
+}
+
+// limitFields returns fields with string, byte, stringer and error values
+// longer than maxField shortened, copying them only if one needs to be.
+func (e *limitEncoder) limitFields(fields []zapcore.Field) ([]zapcore.Field, bool) {
+	if e.maxField <= 0 {
+		return fields, false
+	}
+	var out []zapcore.Field
+	for i, f := range fields {
+		var val string
+		switch f.Type {
+		case zapcore.StringType:
+			val = f.String
+		case zapcore.ByteStringType:
+			val = string(f.Interface.([]byte))
+		case zapcore.StringerType:
+			val = fmt.Sprint(f.Interface)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				val = err.Error()
+			}
+		default:
+			continue
+		}
+		s, ok := e.truncate(val)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(fields)
+		}
+		out[i] = zap.String(f.Key, s)
+	}
+	if out == nil {
+		return fields, false
+	}
+	return out, true
+}
+
+// shrink re-encodes an entry that was excess bytes over maxEntry without its
+// largest fields, listed in truncated_fields, and shortens the message if
+// that is not enough. Context fields added with With are kept.
+func (e *limitEncoder) shrink(ent zapcore.Entry, fields []zapcore.Field, excess int) (*buffer.Buffer, error) {
+	type sized struct {
+		index, size int
+	}
+	isMarker := func(f zapcore.Field) bool { return f.Key == "truncated" && f.Type == zapcore.BoolType }
+	measure := zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
+	sizes := make([]sized, 0, len(fields))
+	for i, f := range fields {
+		if isMarker(f) {
+			continue
+		}
+		enc := measure.Clone()
+		f.AddTo(enc)
+		buf, err := enc.EncodeEntry(zapcore.Entry{}, nil)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, sized{i, buf.Len()})
+		buf.Free()
+	}
+	slices.SortStableFunc(sizes, func(a, b sized) int { return cmp.Compare(b.size, a.size) })
+
+	// The markers take room too: truncated_fields lists every dropped key.
+	excess += len(`,"truncated_fields":[]`)
+	if !slices.ContainsFunc(fields, isMarker) {
+		excess += len(`,"truncated":true`)
+	}
+	var dropped []string
+	drop := make(map[int]bool)
+	for _, s := range sizes {
+		if excess <= 0 {
+			break
+		}
+		drop[s.index] = true
+		dropped = append(dropped, fields[s.index].Key)
+		excess -= s.size - len(fields[s.index].Key) - 3
+	}
+
+	kept := make([]zapcore.Field, 0, len(fields)-len(drop)+2)
+	for i, f := range fields {
+		if !drop[i] && !isMarker(f) {
+			kept = append(kept, f)
+		}
+	}
+	kept = append(kept, zap.Bool("truncated", true), zap.Strings("truncated_fields", dropped))
+	if excess > 0 {
+		n := max(len(ent.Message)-excess-len("..."), 0)
+		ent.Message = truncateUTF8(ent.Message, n) + "..."
+	}
+	return e.Encoder.EncodeEntry(ent, kept)
+}
+
+// truncate returns s cut to maxField bytes plus "...", and whether it was.
+func (e *limitEncoder) truncate(s string) (string, bool) {
+	if e.maxField <= 0 || len(s) <= e.maxField {
+		return s, false
+	}
+	return truncateUTF8(s, e.maxField) + "...", true
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,136 @@
+package zapang
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Socket sink timing, overridable in tests.
+var (
+	socketDialTimeout  = 5 * time.Second
+	socketWriteTimeout = 5 * time.Second
+	socketMinBackoff   = 100 * time.Millisecond
+	socketMaxBackoff   = 30 * time.Second
+)
+
+// socketSink writes entries to a TCP, TLS or UDP collector (Logstash, Vector,
+// Fluent Bit) and reconnects with exponential backoff. While disconnected,
+// writes fail fast, so ExportFallback can take over.
+type socketSink struct {
+	network string // "tcp" or "udp"
+	addr    string
+	tls     *tls.Config
+
+	mu        sync.Mutex
+	conn      net.Conn
+	backoff   time.Duration
+	nextRetry time.Time
+}
+
+// parseSocketURL splits tcp://, tcps:// and udp:// export paths.
+// ok is false for anything else.
+func parseSocketURL(path string) (s *socketSink, ok bool, err error) {
+	scheme, addr, found := strings.Cut(path, "://")
+	if !found {
+		return nil, false, nil
+	}
+	s = &socketSink{addr: addr}
+	switch scheme {
+	case "tcp", "udp":
+		s.network = scheme
+	case "tcps":
+		s.network = "tcp"
+		host, _, _ := net.SplitHostPort(addr)
+		s.tls = &tls.Config{ServerName: host}
+	default:
+		return nil, false, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, true, fmt.Errorf("zapang: export path %q: %w", path, err)
+	}
+	return s, true, nil
+}
+
+func (s *socketSink) dialLocked() error {
+	if s.conn != nil {
+		return nil
+	}
+	if time.Now().Before(s.nextRetry) {
+		return fmt.Errorf("%s://%s: reconnecting", s.network, s.addr)
+	}
+
+	dialer := &net.Dialer{Timeout: socketDialTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, s.network, s.addr, s.tls)
+	} else {
+		conn, err = dialer.Dial(s.network, s.addr)
+	}
+	if err != nil {
+		s.failLocked()
+		return err
+	}
+	s.conn = conn
+	s.backoff = 0
+	return nil
+}
+
+// failLocked drops the connection and schedules the next dial.
+func (s *socketSink) failLocked() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	s.backoff = min(max(s.backoff*2, socketMinBackoff), socketMaxBackoff)
+	s.nextRetry = time.Now().Add(s.backoff)
+}
+
+func (s *socketSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.dialLocked(); err != nil {
+		return 0, err
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	n, err := s.conn.Write(p)
+	if err != nil {
+		s.failLocked()
+	}
+	return n, err
+}
+
+// roundTrip writes p and, if read is not nil, lets it read the response from
+// the same connection within timeout. Any failure drops the connection.
+func (s *socketSink) roundTrip(p []byte, timeout time.Duration, read func(io.Reader) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.dialLocked(); err != nil {
+		return err
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	if _, err := s.conn.Write(p); err != nil {
+		s.failLocked()
+		return err
+	}
+	if read == nil {
+		return nil
+	}
+	_ = s.conn.SetReadDeadline(time.Now().Add(timeout))
+	if err := read(s.conn); err != nil {
+		s.failLocked()
+		return err
+	}
+	return nil
+}
+
+func (s *socketSink) Sync() error {
+	return nil
+}
@@ -0,0 +1,164 @@
+package zapang
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// spanKey carries the current Span in a context.
+type spanKey struct{}
+
+// Span is a lightweight span for services without an OpenTelemetry backend:
+// it only correlates logs. Start one with StartSpan and end it with End.
+type Span struct {
+	name   string
+	sc     trace.SpanContext
+	parent trace.SpanID
+	start  time.Time
+	log    *zap.Logger
+
+	mu    sync.Mutex
+	err   error
+	ended bool
+}
+
+// StartSpan starts a span named name and returns a context carrying it.
+// The span continues the trace of the enclosing Span, or of a remote parent
+// (ContextWithTraceparent, WrapMessageHandler); otherwise it starts a trace
+// with a time-ordered UUIDv7 trace ID. Loggers returned by FromContext for the
+// context carry its trace_id and span_id, in place of the trace fields
+// HTTPMiddleware or WrapMessageHandler took from the request or message.
+// StartSpan logs "span started" at Debug with span_name and parent_span_id;
+// End logs the outcome:
+//
+//	ctx, span := zapang.StartSpan(ctx, "charge")
+//	defer span.End()
+//
+// Span IDs are W3C trace context compatible, so Traceparent can pass them on to
+// services that use OpenTelemetry.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	var parent trace.SpanContext
+	if s, ok := ctx.Value(spanKey{}).(*Span); ok {
+		parent = s.sc
+	} else {
+		parent = trace.SpanContextFromContext(ctx)
+	}
+
+	traceID, flags := parent.TraceID(), parent.TraceFlags()
+	if !parent.IsValid() {
+		traceID, flags = trace.TraceID(newUUIDv7()), trace.FlagsSampled
+	}
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+
+	s := &Span{
+		name:   name,
+		sc:     trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags}),
+		parent: parent.SpanID(),
+		start:  time.Now(),
+	}
+	ctx = context.WithValue(ctx, spanKey{}, s)
+	s.log = WithCallerSkip(FromContext(ctx), 1)
+
+	fields := []zap.Field{SpanName(name)}
+	if s.parent.IsValid() {
+		fields = append(fields, ParentSpanID(s.parent.String()))
+	}
+	s.log.Debug("span started", fields...)
+	return ctx, s
+}
+
+// SetError marks the span failed; End then logs err.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// End logs "span ended" at Info with span_name and duration_ms, or "span
+// failed" at Error with the error passed to SetError. Only the first call logs.
+func (s *Span) End() {
+	s.mu.Lock()
+	ended, err := s.ended, s.err
+	s.ended = true
+	s.mu.Unlock()
+	if ended {
+		return
+	}
+
+	d := time.Since(s.start)
+	if err != nil {
+		s.log.Error("span failed", SpanName(s.name), DurationMs(d), Error(err))
+		return
+	}
+	s.log.Info("span ended", SpanName(s.name), DurationMs(d))
+}
+
+// TraceID returns the span's trace ID as 32 hex digits.
+func (s *Span) TraceID() string {
+	return s.sc.TraceID().String()
+}
+
+// SpanID returns the span's ID as 16 hex digits.
+func (s *Span) SpanID() string {
+	return s.sc.SpanID().String()
+}
+
+// fields are the correlation fields FromContext adds for the span.
+func (s *Span) fields() []zap.Field {
+	return []zap.Field{TraceID(s.TraceID()), SpanID(s.SpanID())}
+}
+
+// traceFieldsKey carries the trace fields of the request or message being
+// handled, which FromContext adds unless a Span replaces them.
+type traceFieldsKey struct{}
+
+// contextWithTraceFields returns ctx with the given trace fields. Middleware
+// puts them in the context rather than on the handler's logger, so a span
+// started by the handler replaces them instead of repeating trace_id.
+func contextWithTraceFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, traceFieldsKey{}, fields)
+}
+
+// SpanFromContext returns the Span started by StartSpan, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Traceparent returns the W3C traceparent header value for the context's
+// Span, or "" without one. Set it on outgoing requests and messages:
+//
+//	req.Header.Set("traceparent", zapang.Traceparent(ctx))
+func Traceparent(ctx context.Context) string {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sc.IsSampled() {
+		flags = "01"
+	}
+	return "00-" + s.TraceID() + "-" + s.SpanID() + "-" + flags
+}
+
+// ContextWithTraceparent returns ctx with the remote parent from a W3C
+// traceparent header value, so the next StartSpan continues the caller's
+// trace. Malformed values are ignored.
+//
+//	ctx := zapang.ContextWithTraceparent(r.Context(), r.Header.Get("traceparent"))
+func ContextWithTraceparent(ctx context.Context, header string) context.Context {
+	sc, ok := traceparent(header)
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
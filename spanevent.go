@@ -0,0 +1,127 @@
+package zapang
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// withSpanEvents returns log recording its Warn+ entries as events on span,
+// when log's Config.SpanEvents is enabled and the span is recording.
+func withSpanEvents(log *zap.Logger, span trace.Span) *zap.Logger {
+	if cfg := configOf(log); cfg == nil || !cfg.SpanEvents || !span.IsRecording() {
+		return log
+	}
+	return log.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &spanEventCore{Core: c, span: span}
+	}))
+}
+
+// spanEventCore adds a spanEventRecorder to Warn+ entries the wrapped core
+// enables, with the fields added with With since the logger was bound to the span.
+type spanEventCore struct {
+	zapcore.Core
+	span   trace.Span
+	fields []zapcore.Field
+}
+
+func (c *spanEventCore) unwrap() zapcore.Core { return c.Core }
+
+func (c *spanEventCore) With(fields []zapcore.Field) zapcore.Core {
+	return &spanEventCore{Core: c.Core.With(fields), span: c.span, fields: append(slices.Clip(c.fields), fields...)}
+}
+
+func (c *spanEventCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= zapcore.WarnLevel && c.Enabled(ent.Level) {
+		ce = ce.AddCore(ent, spanEventRecorder{span: c.span, fields: c.fields})
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// spanEventRecorder records entries as span events named after the message,
+// with the level, its context fields and the entry's fields as attributes.
+type spanEventRecorder struct {
+	span   trace.Span
+	fields []zapcore.Field
+}
+
+func (r spanEventRecorder) Enabled(zapcore.Level) bool        { return true }
+func (r spanEventRecorder) With([]zapcore.Field) zapcore.Core { return r }
+func (r spanEventRecorder) Check(_ zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+func (r spanEventRecorder) Sync() error { return nil }
+
+func (r spanEventRecorder) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range r.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	delete(enc.Fields, "errorVerbose")
+
+	attrs := make([]attribute.KeyValue, 0, len(enc.Fields)+1)
+	attrs = append(attrs, attribute.String("level", ent.Level.String()))
+	for k, v := range enc.Fields {
+		attrs = append(attrs, spanAttribute(k, v))
+	}
+	r.span.AddEvent(ent.Message, trace.WithTimestamp(ent.Time), trace.WithAttributes(attrs...))
+	return nil
+}
+
+// spanAttribute converts a value produced by zapcore.MapObjectEncoder.
+// Objects and arrays are stored as JSON strings.
+func spanAttribute(key string, v any) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case int, int32, int16, int8, uint32, uint16, uint8:
+		return attribute.Int64(key, toInt64(v))
+	case float64:
+		return attribute.Float64(key, v)
+	case float32:
+		return attribute.Float64(key, float64(v))
+	case time.Duration:
+		return attribute.String(key, v.String())
+	case time.Time:
+		return attribute.String(key, v.Format(time.RFC3339Nano))
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return attribute.String(key, string(b))
+		}
+	}
+	return attribute.String(key, fmt.Sprint(v))
+}
+
+func toInt64(v any) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,354 @@
+package zapang
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SpoolConfig configures a SpoolWriteSyncer.
+type SpoolConfig struct {
+	// Path names the spool. Entries are kept in segment files next to it,
+	// Path.00000001, Path.00000002, ..., and replayed after a restart.
+	Path string
+
+	// MaxBytes caps the spool size; beyond it the oldest segment, a quarter of
+	// MaxBytes, is dropped. Default: 64MB.
+	MaxBytes int64
+
+	// RetryInterval is how often delivery of spooled entries is retried. Default: 5s.
+	RetryInterval time.Duration
+}
+
+// spoolSegment is one segment file of the spool.
+type spoolSegment struct {
+	path string
+	size int64
+}
+
+// SpoolWriteSyncer buffers entries on disk while a network sink (Loki, Kafka,
+// OTLP, ...) is unavailable. Writes go straight to the sink while it is
+// healthy; once a write fails, that entry and all following ones are appended
+// to the spool and replayed in order when the sink accepts writes again.
+// Replay is attempted on Write and Sync, at most once per RetryInterval.
+// Each entry must end with a newline, as produced by zap encoders.
+//
+// Entries are only ever appended to segment files; a segment is removed once
+// delivered, and a partly delivered one is replaced by its remainder through a
+// temporary file and a rename. A crash can therefore replay an entry twice but
+// does not lose delivered progress or corrupt the spool; an entry torn by a
+// crash mid-append is discarded on replay.
+type SpoolWriteSyncer struct {
+	next zapcore.WriteSyncer
+	cfg  SpoolConfig
+	errs *errorOutput
+
+	mu        sync.Mutex
+	segs      []spoolSegment // oldest first
+	file      *os.File       // the last segment, open for appending; nil starts a new one
+	seq       uint64
+	size      int64
+	lastRetry time.Time
+	dropped   uint64
+}
+
+// NewSpoolWriteSyncer returns a WriteSyncer that spools to cfg.Path while next fails.
+func NewSpoolWriteSyncer(next zapcore.WriteSyncer, cfg SpoolConfig) (*SpoolWriteSyncer, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 64 << 20
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 5 * time.Second
+	}
+	s := &SpoolWriteSyncer{next: next, cfg: cfg}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("zapang: open spool: %w", err)
+	}
+	return s, nil
+}
+
+// load finds the segments left by an earlier run. A spool file at Path, as
+// written by earlier versions, becomes the oldest segment.
+func (s *SpoolWriteSyncer) load() error {
+	if _, err := os.Stat(filepath.Dir(s.cfg.Path)); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.cfg.Path); err == nil && info.Mode().IsRegular() {
+		if err := os.Rename(s.cfg.Path, s.segmentPath(0)); err != nil {
+			return err
+		}
+	}
+	matches, err := filepath.Glob(s.cfg.Path + ".*")
+	if err != nil {
+		return err
+	}
+	slices.Sort(matches)
+	for _, path := range matches {
+		suffix := strings.TrimPrefix(path, s.cfg.Path+".")
+		if strings.HasSuffix(suffix, ".tmp") {
+			_ = os.Remove(path) // an interrupted rewrite; the segment is intact
+			continue
+		}
+		seq, err := strconv.ParseUint(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		s.segs = append(s.segs, spoolSegment{path: path, size: info.Size()})
+		s.size += info.Size()
+		s.seq = seq
+	}
+	return nil
+}
+
+func (s *SpoolWriteSyncer) segmentPath(seq uint64) string {
+	return fmt.Sprintf("%s.%08d", s.cfg.Path, seq)
+}
+
+// segmentBytes is the size at which a new segment is started.
+func (s *SpoolWriteSyncer) segmentBytes() int64 {
+	return max(s.cfg.MaxBytes/4, 1)
+}
+
+// Spooled returns the number of bytes waiting in the spool.
+func (s *SpoolWriteSyncer) Spooled() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Dropped returns the number of spooled entries discarded to respect MaxBytes.
+func (s *SpoolWriteSyncer) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *SpoolWriteSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 {
+		s.replayLocked(false)
+	}
+	// Entries queue behind the spool so the sink sees them in order.
+	if s.size == 0 {
+		if _, err := s.next.Write(p); err == nil {
+			return len(p), nil
+		}
+		s.lastRetry = time.Now()
+	}
+	return s.appendLocked(p)
+}
+
+// Sync retries delivery of spooled entries and syncs the sink and the spool file.
+func (s *SpoolWriteSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 {
+		s.replayLocked(true)
+	}
+	if s.size > 0 {
+		if s.file == nil {
+			return nil
+		}
+		return s.file.Sync()
+	}
+	return s.next.Sync()
+}
+
+// Close releases the spool file. Undelivered entries stay on disk.
+func (s *SpoolWriteSyncer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFileLocked()
+}
+
+func (s *SpoolWriteSyncer) closeFileLocked() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *SpoolWriteSyncer) appendLocked(p []byte) (int, error) {
+	for s.size+int64(len(p)) > s.cfg.MaxBytes && len(s.segs) > 0 {
+		s.dropOldestLocked()
+	}
+	if s.file == nil || s.segs[len(s.segs)-1].size >= s.segmentBytes() {
+		if err := s.closeFileLocked(); err != nil {
+			s.errs.report(fmt.Errorf("close spool segment: %w", err))
+		}
+		s.seq++
+		path := s.segmentPath(s.seq)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+		s.segs = append(s.segs, spoolSegment{path: path})
+	}
+	n, err := s.file.Write(p)
+	s.segs[len(s.segs)-1].size += int64(n)
+	s.size += int64(n)
+	return n, err
+}
+
+// dropOldestLocked discards the oldest segment to make room.
+func (s *SpoolWriteSyncer) dropOldestLocked() {
+	seg := s.segs[0]
+	dropped := countLines(seg.path)
+	s.removeOldestLocked()
+	s.dropped += dropped
+	s.errs.report(fmt.Errorf("spool %s full, dropped %d oldest entries", s.cfg.Path, dropped))
+}
+
+// removeOldestLocked deletes the oldest segment.
+func (s *SpoolWriteSyncer) removeOldestLocked() {
+	seg := s.segs[0]
+	if len(s.segs) == 1 {
+		_ = s.closeFileLocked()
+	}
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.errs.report(fmt.Errorf("remove spool segment: %w", err))
+	}
+	s.segs = s.segs[1:]
+	s.size -= seg.size
+}
+
+// replayLocked sends spooled entries to the sink in order, keeping the rest on
+// the first failure. Unless force is set it runs at most once per RetryInterval.
+func (s *SpoolWriteSyncer) replayLocked(force bool) {
+	if !force && time.Since(s.lastRetry) < s.cfg.RetryInterval {
+		return
+	}
+	s.lastRetry = time.Now()
+
+	for len(s.segs) > 0 {
+		sent, err := s.replaySegment(s.segs[0].path)
+		if err == nil {
+			s.removeOldestLocked()
+			continue
+		}
+		if sent > 0 {
+			if err := s.keepRemainderLocked(sent); err != nil {
+				s.errs.report(fmt.Errorf("rewrite spool %s: %w", s.cfg.Path, err))
+			}
+		}
+		if !errors.Is(err, errSinkWrite) {
+			s.errs.report(fmt.Errorf("read spool %s: %w", s.cfg.Path, err))
+		}
+		return
+	}
+}
+
+// errSinkWrite marks a replay stopped by the sink rather than the spool.
+var errSinkWrite = errors.New("sink write failed")
+
+// replaySegment streams the entries of a segment to the sink and returns the
+// number of bytes delivered. An incomplete last entry, torn by a crash during
+// an append, is discarded.
+func (s *SpoolWriteSyncer) replaySegment(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var sent int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				s.errs.report(fmt.Errorf("spool %s: discarded a torn entry", s.cfg.Path))
+			}
+			return sent, nil
+		}
+		if err != nil {
+			return sent, err
+		}
+		if _, err := s.next.Write(line); err != nil {
+			return sent, errSinkWrite
+		}
+		sent += int64(len(line))
+	}
+}
+
+// keepRemainderLocked replaces the oldest segment with its undelivered tail,
+// written to a temporary file and renamed over the segment so a crash leaves
+// either the old or the new contents.
+func (s *SpoolWriteSyncer) keepRemainderLocked(sent int64) error {
+	seg := &s.segs[0]
+	if len(s.segs) == 1 {
+		// The next append starts a new segment rather than reopening this one.
+		_ = s.closeFileLocked()
+	}
+	src, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(sent, io.SeekStart); err != nil {
+		return err
+	}
+	tmp := seg.path + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, seg.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	s.size -= seg.size - n
+	seg.size = n
+	return nil
+}
+
+// countLines returns the number of entries in a segment file.
+func countLines(path string) uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	var n uint64
+	buf := make([]byte, 32<<10)
+	for {
+		k, err := f.Read(buf)
+		n += uint64(bytes.Count(buf[:k], []byte{'\n'}))
+		if err != nil {
+			return n
+		}
+	}
+}
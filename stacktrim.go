@@ -0,0 +1,140 @@
+package zapang
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// zapangPkg is this package's import path, for matching its own frames.
+var zapangPkg = reflect.TypeFor[Config]().PkgPath()
+
+// DefaultStackSkip lists the function name prefixes that StacktraceTrim drops:
+// the Go runtime, zap, the test runner, net/http and zapang's middleware.
+var DefaultStackSkip = []string{
+	"runtime.",
+	"go.uber.org/zap",
+	"testing.",
+	"net/http.",
+	zapangPkg + ".HTTPMiddleware",
+	zapangPkg + ".RecoveryMiddleware",
+}
+
+// StacktraceTrimConfig trims stacktraces down to application frames.
+type StacktraceTrimConfig struct {
+	// MaxDepth caps the number of frames kept; the rest are summarized in a
+	// "... N more frames" line. Zero keeps every application frame.
+	MaxDepth int `yaml:"max_depth" json:"max_depth" mapstructure:"max_depth"`
+
+	// Skip lists function name prefixes dropped in addition to DefaultStackSkip,
+	// e.g. "github.com/go-chi/chi/v5." for a router's middleware chain.
+	Skip []string `yaml:"skip" json:"skip" mapstructure:"skip"`
+}
+
+// stackTrimmer rewrites zap stacktraces, where each frame is a function line
+// followed by a tab-indented file:line.
+type stackTrimmer struct {
+	skip     []string
+	maxDepth int
+}
+
+func newStackTrimmer(cfg StacktraceTrimConfig) *stackTrimmer {
+	return &stackTrimmer{
+		skip:     append(slices.Clip(DefaultStackSkip), cfg.Skip...),
+		maxDepth: cfg.MaxDepth,
+	}
+}
+
+// trim drops skipped frames, caps the depth and makes file paths under the
+// project root relative. A stack made up only of skipped frames is returned
+// unchanged, since an empty trace would hide where the entry came from.
+func (t *stackTrimmer) trim(stack string) string {
+	var b strings.Builder
+	kept, omitted := 0, 0
+	keep := false
+	for line := range strings.Lines(stack) {
+		line = strings.TrimRight(line, "\n")
+		if strings.HasPrefix(line, "\t") {
+			if keep {
+				b.WriteString(relativeFrame(line))
+				b.WriteByte('\n')
+			}
+			continue
+		}
+		keep = !slices.ContainsFunc(t.skip, func(prefix string) bool {
+			return strings.HasPrefix(line, prefix)
+		})
+		if keep && t.maxDepth > 0 && kept == t.maxDepth {
+			keep = false
+			omitted++
+		}
+		if keep {
+			kept++
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	if kept == 0 {
+		return stack
+	}
+	if omitted > 0 {
+		b.WriteString("... " + strconv.Itoa(omitted) + " more frames\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// relativeFrame rewrites a "\t/abs/path/file.go:42" frame line under the
+// project root as "\t./file.go:42", like caller paths.
+func relativeFrame(line string) string {
+	if projectRoot != "" && strings.HasPrefix(line[1:], projectRoot+"/") {
+		return "\t." + line[1+len(projectRoot):]
+	}
+	return line
+}
+
+// stackTrimCore trims the entry stacktrace and zap.Stack fields before writing.
+type stackTrimCore struct {
+	zapcore.Core
+	trimmer *stackTrimmer
+}
+
+// applyStackTrim wraps each core with stacktrace trimming.
+func applyStackTrim(cores []zapcore.Core, cfg StacktraceTrimConfig) []zapcore.Core {
+	trimmer := newStackTrimmer(cfg)
+	for i, c := range cores {
+		cores[i] = &stackTrimCore{Core: c, trimmer: trimmer}
+	}
+	return cores
+}
+
+func (c *stackTrimCore) With(fields []zapcore.Field) zapcore.Core {
+	return &stackTrimCore{Core: c.Core.With(fields), trimmer: c.trimmer}
+}
+
+func (c *stackTrimCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *stackTrimCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Stack != "" {
+		ent.Stack = c.trimmer.trim(ent.Stack)
+	}
+	copied := false
+	for i, f := range fields {
+		if f.Key != "stacktrace" || f.Type != zapcore.StringType {
+			continue
+		}
+		if !copied {
+			fields = slices.Clone(fields)
+			copied = true
+		}
+		fields[i].String = c.trimmer.trim(f.String)
+	}
+	return writeChecked(c.Core, ent, fields)
+}
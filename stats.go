@@ -0,0 +1,81 @@
+package zapang
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// droppedEntries counts entries discarded by sampling or throughput shedding across all loggers.
+	droppedEntries atomic.Uint64
+
+	// writeErrors counts failed sink writes, see timedCore.
+	writeErrors atomic.Uint64
+
+	// emittedEntries counts entries that passed level and sampling, indexed by level.
+	emittedEntries [zapcore.FatalLevel - zapcore.DebugLevel + 1]atomic.Uint64
+)
+
+// Stats is a snapshot of logger statistics.
+type Stats struct {
+	// Emitted counts entries that passed level and sampling checks, by level name.
+	Emitted map[string]uint64 `json:"emitted"`
+
+	// Dropped counts entries discarded by sampling or throughput shedding.
+	Dropped uint64 `json:"dropped"`
+
+	// WriteErrors counts failed sink writes.
+	WriteErrors uint64 `json:"write_errors"`
+
+	// Sinks reports delivery per asynchronous sink of the global logger, by sink name.
+	Sinks map[string]SinkStats `json:"sinks,omitempty"`
+}
+
+// ReadStats returns a snapshot of statistics for all loggers created by this package.
+func ReadStats() Stats {
+	s := Stats{Emitted: make(map[string]uint64, len(emittedEntries)), Dropped: droppedEntries.Load(), WriteErrors: writeErrors.Load()}
+	for i := range emittedEntries {
+		s.Emitted[(zapcore.DebugLevel + zapcore.Level(i)).String()] = emittedEntries[i].Load()
+	}
+
+	globalMu.RLock()
+	live := globalLive
+	globalMu.RUnlock()
+	if live != nil {
+		for _, sink := range live.sinks {
+			if sink.async == nil {
+				continue
+			}
+			if s.Sinks == nil {
+				s.Sinks = make(map[string]SinkStats)
+			}
+			s.Sinks[sink.name] = sink.async.Stats()
+		}
+	}
+	return s
+}
+
+func countEmitted(lvl zapcore.Level) {
+	if lvl >= zapcore.DebugLevel && lvl <= zapcore.FatalLevel {
+		emittedEntries[lvl-zapcore.DebugLevel].Add(1)
+	}
+}
+
+// Dropped returns the number of entries discarded by sampling or throughput shedding since process start.
+func Dropped() uint64 {
+	return droppedEntries.Load()
+}
+
+// samplerHook counts dropped entries and forwards them to the optional callback.
+func samplerHook(onDrop func(zapcore.Entry)) func(zapcore.Entry, zapcore.SamplingDecision) {
+	return func(ent zapcore.Entry, dec zapcore.SamplingDecision) {
+		if dec&zapcore.LogDropped == 0 {
+			return
+		}
+		droppedEntries.Add(1)
+		if onDrop != nil {
+			onDrop(ent)
+		}
+	}
+}
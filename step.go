@@ -0,0 +1,80 @@
+package zapang
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// stepKey carries the enclosing step in a context.
+type stepKey struct{}
+
+type stepInfo struct {
+	path  string
+	depth int
+}
+
+// Step runs fn as a named step of a command-line tool, logging when it starts
+// and when it is done or failed with duration_ms. Steps nest through ctx: the
+// console encoder indents nested steps, while JSON output carries step,
+// step_path ("migrate/users") and step_depth for machines.
+func Step(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	info := stepInfo{path: name}
+	if parent, ok := ctx.Value(stepKey{}).(stepInfo); ok {
+		info = stepInfo{path: parent.path + "/" + name, depth: parent.depth + 1}
+	}
+	ctx = context.WithValue(ctx, stepKey{}, info)
+	log := WithCallerSkip(FromContext(ctx), 1)
+
+	start := time.Now()
+	log.Info(name, stepFields(name, info, "started")...)
+	if err := fn(ctx); err != nil {
+		log.Error(name+" failed", append(stepFields(name, info, "failed"), DurationMs(time.Since(start)), Error(err))...)
+		return err
+	}
+	log.Info(name+" done", append(stepFields(name, info, "done"), DurationMs(time.Since(start)))...)
+	return nil
+}
+
+// Progress logs progress of the current step as done of total items.
+func Progress(ctx context.Context, done, total int) {
+	info, _ := ctx.Value(stepKey{}).(stepInfo)
+	fields := []zap.Field{zap.Int("done", done), zap.Int("total", total)}
+	if total > 0 {
+		fields = append(fields, zap.Float64("percent", float64(done*100)/float64(total)))
+	}
+	if info.path != "" {
+		fields = append(fields, zap.String("step_path", info.path), stepDepth(info.depth+1))
+	}
+	WithCallerSkip(FromContext(ctx), 1).Info("progress", fields...)
+}
+
+// maxStepIndent caps the console indentation of nested steps.
+const maxStepIndent = 16
+
+// stepDepthMarker marks the step_depth field written by Step and Progress,
+// which the console encoder renders as indentation. A step_depth field logged
+// by the caller is an ordinary field.
+type stepDepthMarker struct{}
+
+// stepDepth returns the step_depth field for depth.
+func stepDepth(depth int) zap.Field {
+	return zap.Field{Key: "step_depth", Type: zapcore.Int64Type, Integer: int64(depth), Interface: stepDepthMarker{}}
+}
+
+// isStepDepth reports whether f is the step_depth field of Step or Progress.
+func isStepDepth(f zapcore.Field) bool {
+	_, ok := f.Interface.(stepDepthMarker)
+	return ok && f.Type == zapcore.Int64Type
+}
+
+func stepFields(name string, info stepInfo, status string) []zap.Field {
+	return []zap.Field{
+		zap.String("step", name),
+		zap.String("step_path", info.path),
+		zap.String("step_status", status),
+		stepDepth(info.depth),
+	}
+}
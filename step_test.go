@@ -0,0 +1,66 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestStep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var console, machine bytes.Buffer
+	l := New(ctx, "cli", Config{Level: "info", Writers: []WriterSpec{
+		{Writer: &console, Encoding: EncodingPlain},
+		{Writer: &machine, Encoding: EncodingJSON},
+	}}, nil)
+	ctx = WithContext(ctx, l)
+
+	errBadRow := errors.New("bad row")
+	err := Step(ctx, "migrate", func(ctx context.Context) error {
+		return Step(ctx, "users", func(ctx context.Context) error {
+			Progress(ctx, 50, 100)
+			return errBadRow
+		})
+	})
+	if !errors.Is(err, errBadRow) {
+		t.Fatalf("step error not returned: %v", err)
+	}
+
+	for _, want := range []string{"\tmigrate\t", "\t  users\t", "\t    progress\t", "\t  users failed\t", "\tmigrate failed\t"} {
+		if !strings.Contains(console.String(), want) {
+			t.Errorf("console output missing %q:\n%s", want, console.String())
+		}
+	}
+	if strings.Contains(console.String(), "step_depth") || !strings.Contains(console.String(), "step_test.go") {
+		t.Errorf("unexpected console output:\n%s", console.String())
+	}
+	if !strings.Contains(machine.String(), `"message":"users failed","service":"cli","step":"users","step_path":"migrate/users","step_status":"failed","step_depth":1`) {
+		t.Errorf("unexpected JSON output:\n%s", machine.String())
+	}
+}
+
+func TestStepDepthField(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var console bytes.Buffer
+	l := New(ctx, "cli", Config{Level: "info", Writers: []WriterSpec{{Writer: &console, Encoding: EncodingPlain}}}, nil)
+
+	// A caller's own step_depth field is an ordinary field.
+	l.Info("imported", zap.Int("step_depth", 3))
+	if !strings.Contains(console.String(), "\timported\t") || !strings.Contains(console.String(), "step_depth") {
+		t.Errorf("expected an unindented entry with its field:\n%s", console.String())
+	}
+
+	console.Reset()
+	l.Info("deep", stepDepth(1<<30))
+	if !strings.Contains(console.String(), "\t"+strings.Repeat("  ", maxStepIndent)+"deep\t") {
+		t.Errorf("expected indentation capped at %d levels:\n%s", maxStepIndent, console.String())
+	}
+}
@@ -0,0 +1,125 @@
+package zapang
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxTailEntries caps the entries buffered per request; later ones are dropped.
+const maxTailEntries = 512
+
+// WithTailSampling buffers the entries a handler logs through the request
+// logger and writes them only if the request turns out interesting: status
+// 5xx, an Error or higher entry, or latency above threshold. Otherwise only the
+// "request completed" line is written, with entries_dropped counting what was
+// discarded. Entries logged after the request completed are written directly,
+// and so are DPanic, Panic and Fatal entries, after the buffered ones.
+func WithTailSampling(threshold time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.tailSampling = true
+		c.tailThreshold = threshold
+	}
+}
+
+// requestBuffer holds a request's entries until the request outcome is known.
+type requestBuffer struct {
+	mu      sync.Mutex
+	entries []bufferedEntry
+	dropped int
+	errored bool
+	done    bool
+}
+
+type bufferedEntry struct {
+	core   zapcore.Core
+	ent    zapcore.Entry
+	fields []zapcore.Field
+}
+
+// logger returns log with its entries routed into the buffer.
+func (b *requestBuffer) logger(log *zap.Logger) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &bufferCore{Core: c, buf: b}
+	}))
+}
+
+// add buffers an entry; it reports false once the buffer was released.
+func (b *requestBuffer) add(e bufferedEntry) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return false
+	}
+	if e.ent.Level >= zapcore.ErrorLevel {
+		b.errored = true
+	}
+	if len(b.entries) == maxTailEntries {
+		b.dropped++
+		return true
+	}
+	b.entries = append(b.entries, e)
+	return true
+}
+
+// release ends buffering, writing the entries if keep or an Error entry was
+// buffered, and returns the number of entries discarded.
+func (b *requestBuffer) release(keep bool) int {
+	b.mu.Lock()
+	entries, dropped := b.entries, b.dropped
+	keep = keep || b.errored
+	b.entries, b.done = nil, true
+	b.mu.Unlock()
+
+	if !keep {
+		return dropped + len(entries)
+	}
+	for _, e := range entries {
+		e.write()
+	}
+	return dropped
+}
+
+// write sends the entry through its core's checks (levels, filters, sampling)
+// as if it had just been logged.
+func (e bufferedEntry) write() {
+	if ce := e.core.Check(e.ent, nil); ce != nil {
+		ce.Write(e.fields...)
+	}
+}
+
+// bufferCore diverts the entries its core enables into a requestBuffer.
+type bufferCore struct {
+	zapcore.Core
+	buf *requestBuffer
+}
+
+func (c *bufferCore) unwrap() zapcore.Core { return c.Core }
+
+func (c *bufferCore) With(fields []zapcore.Field) zapcore.Core {
+	return &bufferCore{Core: c.Core.With(fields), buf: c.buf}
+}
+
+func (c *bufferCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= zapcore.DPanicLevel {
+		// The logger may panic or exit right after writing the entry, so the
+		// buffer is written first and the entry bypasses it.
+		c.buf.release(true)
+		return c.Core.Check(ent, ce)
+	}
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *bufferCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	e := bufferedEntry{core: c.Core, ent: ent, fields: slices.Clone(fields)}
+	if !c.buf.add(e) {
+		e.write()
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package zapang
+
+import (
+	"container/list"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// TenantPlaceholder is replaced with the tenant ID in FactoryConfig.ExportPathPattern.
+const TenantPlaceholder = "{tenant}"
+
+// FactoryConfig configures a LoggerFactory.
+type FactoryConfig struct {
+	// ExportPathPattern is the JSON export file path for tenants with Export enabled.
+	// Must contain TenantPlaceholder, e.g. "/var/log/app/{tenant}.jsonl".
+	ExportPathPattern string `yaml:"export_path_pattern" json:"export_path_pattern" mapstructure:"export_path_pattern"`
+
+	// MaxOpenSinks caps the number of tenant export files kept open.
+	// Least recently used files are closed and reopened on demand. Default: 64.
+	MaxOpenSinks int `yaml:"max_open_sinks" json:"max_open_sinks" mapstructure:"max_open_sinks"`
+}
+
+// TenantConfig holds per-tenant logger settings.
+type TenantConfig struct {
+	// Level overrides the base logger level for this tenant. If empty, the base
+	// level applies. Sinks with a fixed level (ConsoleLevel, ExportLevel,
+	// WriterSpec.Level, Cores) keep it.
+	Level string
+
+	// Fields are added to every entry of the tenant logger.
+	Fields []zap.Field
+
+	// Export writes the tenant's entries to a separate JSON sink built from ExportPathPattern.
+	Export bool
+}
+
+// LoggerFactory creates and caches child loggers keyed by tenant.
+type LoggerFactory struct {
+	base *zap.Logger
+	cfg  FactoryConfig
+
+	mu      sync.Mutex
+	tenants map[string]TenantConfig
+	loggers map[string]*zap.Logger
+
+	sinkMu  sync.Mutex
+	lru     *list.List
+	sinkIdx map[string]*list.Element
+}
+
+type tenantFile struct {
+	tenant string
+	file   *os.File
+}
+
+// NewLoggerFactory returns a factory deriving tenant loggers from base.
+func NewLoggerFactory(base *zap.Logger, cfg FactoryConfig) *LoggerFactory {
+	if cfg.MaxOpenSinks <= 0 {
+		cfg.MaxOpenSinks = 64
+	}
+	return &LoggerFactory{
+		base:    base,
+		cfg:     cfg,
+		tenants: make(map[string]TenantConfig),
+		loggers: make(map[string]*zap.Logger),
+		lru:     list.New(),
+		sinkIdx: make(map[string]*list.Element),
+	}
+}
+
+// SetTenant registers or replaces a tenant's configuration.
+func (f *LoggerFactory) SetTenant(tenantID string, tc TenantConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tenants[tenantID] = tc
+	delete(f.loggers, tenantID)
+}
+
+// Logger returns the logger for a tenant, creating it on first use.
+// Unknown tenants get the base logger with a tenant_id field.
+func (f *LoggerFactory) Logger(tenantID string) *zap.Logger {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if l, ok := f.loggers[tenantID]; ok {
+		return l
+	}
+
+	tc := f.tenants[tenantID]
+	l := f.base.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		var enabler zapcore.LevelEnabler = c
+		if tc.Level != "" {
+			enabler = parseLevel(tc.Level)
+			c = newLevelOverrideCore(c, enabler)
+		}
+		if tc.Export && f.cfg.ExportPathPattern != "" {
+			encoder := newEncoder(EncodingJSON, Config{})
+			c = &tenantExportCore{Core: c, export: zapcore.NewCore(encoder, &tenantSink{factory: f, tenant: tenantID}, enabler)}
+		}
+		return c
+	}))
+	l = l.With(append([]zap.Field{TenantID(tenantID)}, tc.Fields...)...)
+
+	f.loggers[tenantID] = l
+	return l
+}
+
+// Close closes all open tenant sinks.
+func (f *LoggerFactory) Close() error {
+	f.sinkMu.Lock()
+	defer f.sinkMu.Unlock()
+
+	var firstErr error
+	for e := f.lru.Front(); e != nil; e = e.Next() {
+		if err := e.Value.(*tenantFile).file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	f.lru.Init()
+	clear(f.sinkIdx)
+	return firstErr
+}
+
+// withSink runs fn with the tenant's open export file, opening it and
+// evicting the least recently used file if needed.
+func (f *LoggerFactory) withSink(tenant string, fn func(*os.File) error) error {
+	f.sinkMu.Lock()
+	defer f.sinkMu.Unlock()
+
+	if e, ok := f.sinkIdx[tenant]; ok {
+		f.lru.MoveToFront(e)
+		return fn(e.Value.(*tenantFile).file)
+	}
+
+	path := strings.ReplaceAll(f.cfg.ExportPathPattern, TenantPlaceholder, tenant)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	f.sinkIdx[tenant] = f.lru.PushFront(&tenantFile{tenant: tenant, file: file})
+	for f.lru.Len() > f.cfg.MaxOpenSinks {
+		oldest := f.lru.Remove(f.lru.Back()).(*tenantFile)
+		delete(f.sinkIdx, oldest.tenant)
+		_ = oldest.file.Close()
+	}
+
+	return fn(file)
+}
+
+// tenantSink is a WriteSyncer resolving the tenant's file through the factory's LRU.
+type tenantSink struct {
+	factory *LoggerFactory
+	tenant  string
+}
+
+func (s *tenantSink) Write(p []byte) (int, error) {
+	var n int
+	err := s.factory.withSink(s.tenant, func(file *os.File) error {
+		var err error
+		n, err = file.Write(p)
+		return err
+	})
+	return n, err
+}
+
+func (s *tenantSink) Sync() error {
+	f := s.factory
+	f.sinkMu.Lock()
+	defer f.sinkMu.Unlock()
+
+	if e, ok := f.sinkIdx[s.tenant]; ok {
+		return e.Value.(*tenantFile).file.Sync()
+	}
+	return nil
+}
+
+// tenantExportCore tees a tenant logger's entries into the tenant's export file.
+type tenantExportCore struct {
+	zapcore.Core
+	export zapcore.Core
+}
+
+func (c *tenantExportCore) unwrap() zapcore.Core { return c.Core }
+
+func (c *tenantExportCore) Enabled(lvl zapcore.Level) bool {
+	return c.Core.Enabled(lvl) || c.export.Enabled(lvl)
+}
+
+func (c *tenantExportCore) With(fields []zapcore.Field) zapcore.Core {
+	return &tenantExportCore{Core: c.Core.With(fields), export: c.export.With(fields)}
+}
+
+func (c *tenantExportCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.export.Check(ent, c.Core.Check(ent, ce))
+}
+
+func (c *tenantExportCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return errors.Join(c.Core.Write(ent, fields), c.export.Write(ent, fields))
+}
+
+func (c *tenantExportCore) Sync() error {
+	return errors.Join(c.Core.Sync(), c.export.Sync())
+}
+
+// levelOverrideCore replaces the global level of the wrapped core with its
+// own: it gates entries at that level, and passes a levelOverride down to the
+// sink levels, so sinks following the global level use it while sinks with a
+// fixed level, and their sampling, filters and throughput limits, still apply.
+type levelOverrideCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func newLevelOverrideCore(inner zapcore.Core, level zapcore.LevelEnabler) zapcore.Core {
+	override := zapcore.Field{Type: zapcore.SkipType, Interface: levelOverride{level}}
+	return &levelOverrideCore{Core: inner.With([]zapcore.Field{override}), level: level}
+}
+
+func (c *levelOverrideCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl) && c.Core.Enabled(lvl)
+}
+
+func (c *levelOverrideCore) unwrap() zapcore.Core { return c.Core }
+
+func (c *levelOverrideCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelOverrideCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelOverrideCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.level.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	return ce
+}
+
+// levelOverride travels down the core tree as a Skip field in With, so cores
+// that do not know it encode nothing, and replaces the level of the
+// sinkLevelCores that follow the global level.
+type levelOverride struct {
+	level zapcore.LevelEnabler
+}
+
+// sinkLevelCore applies a sink's level: a fixed one such as ConsoleLevel, or
+// the global level, which a levelOverride replaces. A nil level leaves the
+// decision to the sink, as for Config.Cores.
+type sinkLevelCore struct {
+	zapcore.Core
+	level  zapcore.LevelEnabler
+	global bool
+}
+
+func newSinkLevelCore(inner zapcore.Core, level zapcore.LevelEnabler, global bool) *sinkLevelCore {
+	return &sinkLevelCore{Core: inner, level: level, global: global}
+}
+
+func (c *sinkLevelCore) Enabled(lvl zapcore.Level) bool {
+	if c.level == nil {
+		return c.Core.Enabled(lvl)
+	}
+	return c.level.Enabled(lvl)
+}
+
+func (c *sinkLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	level := c.level
+	if slices.ContainsFunc(fields, isLevelOverride) {
+		for _, f := range fields {
+			if o, ok := f.Interface.(levelOverride); ok && f.Type == zapcore.SkipType && c.global {
+				level = o.level
+			}
+		}
+		fields = slices.DeleteFunc(slices.Clone(fields), isLevelOverride)
+	}
+	return &sinkLevelCore{Core: c.Core.With(fields), level: level, global: c.global}
+}
+
+func (c *sinkLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	return ce
+}
+
+func isLevelOverride(f zapcore.Field) bool {
+	_, ok := f.Interface.(levelOverride)
+	return ok && f.Type == zapcore.SkipType
+}
@@ -0,0 +1,47 @@
+package zapang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerFactoryTenantSinks(t *testing.T) {
+	dir := t.TempDir()
+	obs, logs := observer.New(zapcore.InfoLevel)
+
+	f := NewLoggerFactory(zap.New(obs), FactoryConfig{
+		ExportPathPattern: filepath.Join(dir, "{tenant}.jsonl"),
+		MaxOpenSinks:      1,
+	})
+	defer f.Close()
+
+	f.SetTenant("a", TenantConfig{Level: "debug", Export: true})
+	f.SetTenant("b", TenantConfig{Export: true})
+
+	f.Logger("a").Debug("a-debug")
+	f.Logger("b").Info("b-info")
+	f.Logger("a").Info("a-info")
+	f.Logger("b").Debug("b-debug")
+
+	a, _ := os.ReadFile(filepath.Join(dir, "a.jsonl"))
+	b, _ := os.ReadFile(filepath.Join(dir, "b.jsonl"))
+	if !strings.Contains(string(a), "a-debug") || !strings.Contains(string(a), "a-info") {
+		t.Fatalf("tenant a sink missing entries: %s", a)
+	}
+	if !strings.Contains(string(b), "b-info") || strings.Contains(string(b), "b-debug") {
+		t.Fatalf("tenant b sink has wrong entries: %s", b)
+	}
+	if f.lru.Len() != 1 {
+		t.Fatalf("expected 1 open sink, got %d", f.lru.Len())
+	}
+	// The base core keeps its own level; the tenant level only lowers the global one.
+	if logs.FilterField(TenantID("a")).Len() != 1 {
+		t.Fatalf("expected 1 base entry for tenant a, got %d", logs.FilterField(TenantID("a")).Len())
+	}
+}
@@ -0,0 +1,101 @@
+package zapang
+
+import (
+	"os"
+	"strings"
+)
+
+// Console color modes.
+const (
+	// ColorAuto colors stdout only when it is a terminal and NO_COLOR is unset.
+	ColorAuto = "auto"
+	// ColorAlways colors stdout unconditionally.
+	ColorAlways = "always"
+	// ColorNever disables colors on stdout.
+	ColorNever = "never"
+)
+
+// Theme customizes console colors. Styles are ANSI SGR parameters, e.g. "1;31"
+// for bold red or "2" for dim; an empty style leaves the text unstyled.
+type Theme struct {
+	// Levels styles level names by level: debug, info, warn, error, dpanic, panic, fatal.
+	Levels map[string]string `yaml:"levels" json:"levels" mapstructure:"levels"`
+
+	// Time styles the timestamp.
+	Time string `yaml:"time" json:"time" mapstructure:"time"`
+
+	// Fields highlights fields by key, e.g. {"trace_id": "36"}.
+	Fields map[string]string `yaml:"fields" json:"fields" mapstructure:"fields"`
+
+	// ErrorMessage styles the message lines of verbose errors.
+	ErrorMessage string `yaml:"error_message" json:"error_message" mapstructure:"error_message"`
+
+	// ErrorStack styles the stack frame lines of verbose errors.
+	ErrorStack string `yaml:"error_stack" json:"error_stack" mapstructure:"error_stack"`
+}
+
+// DefaultTheme returns the built-in console colors.
+func DefaultTheme() Theme {
+	return Theme{
+		Levels: map[string]string{
+			"debug":  "35",
+			"info":   "34",
+			"warn":   "33",
+			"error":  "31",
+			"dpanic": "31",
+			"panic":  "31",
+			"fatal":  "31",
+		},
+		ErrorMessage: "1;31",
+		ErrorStack:   "2",
+	}
+}
+
+// paint wraps s in the SGR style, or returns it unchanged for an empty style.
+func paint(style, s string) string {
+	if style == "" {
+		return s
+	}
+	return "\033[" + style + "m" + s + ansiReset
+}
+
+// colorStdout reports whether console output on stdout should be colored.
+func colorStdout(mode string) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a character device, i.e. a terminal rather
+// than a file, pipe or journald socket.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorizeVerbose styles a verbose error block: message lines ("  - " wraps)
+// with ErrorMessage, stack frames with ErrorStack.
+func (t *Theme) colorizeVerbose(verbose string) string {
+	lines := strings.Split(verbose, "\n")
+	var b strings.Builder
+	b.Grow(len(verbose) + len(lines)*16)
+
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if i == 0 || strings.HasPrefix(line, "  - ") {
+			b.WriteString(paint(t.ErrorMessage, line))
+		} else {
+			b.WriteString(paint(t.ErrorStack, line))
+		}
+	}
+	return b.String()
+}
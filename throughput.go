@@ -0,0 +1,167 @@
+package zapang
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ThroughputConfig caps how much the logger writes per second across all sinks.
+type ThroughputConfig struct {
+	// BytesPerSecond limits the approximate encoded size of entries per second. 0 disables it.
+	BytesPerSecond int64 `yaml:"bytes_per_second" json:"bytes_per_second" mapstructure:"bytes_per_second"`
+
+	// EntriesPerSecond limits the number of entries per second. 0 disables it.
+	EntriesPerSecond int64 `yaml:"entries_per_second" json:"entries_per_second" mapstructure:"entries_per_second"`
+}
+
+// shedThreshold is the share of the budget a level may use before it is shed,
+// so lower-priority levels go first. DPanic and above are never shed.
+func shedThreshold(lvl zapcore.Level) float64 {
+	switch {
+	case lvl <= zapcore.DebugLevel:
+		return 0.5
+	case lvl == zapcore.InfoLevel:
+		return 0.75
+	case lvl == zapcore.WarnLevel:
+		return 0.9
+	default:
+		return 1
+	}
+}
+
+// throughputBudget tracks usage in one-second windows and sheds entries past
+// their level's threshold.
+type throughputBudget struct {
+	cfg ThroughputConfig
+
+	// out receives the shedding summary; it is the uncapped core without context fields.
+	out zapcore.Core
+
+	mu      sync.Mutex
+	window  time.Time
+	bytes   int64
+	entries int64
+	shed    [zapcore.FatalLevel - zapcore.DebugLevel + 1]uint64
+}
+
+// admit reports whether an entry fits in the current window. Windows follow
+// entry time, so they track the logger's clock. When a window with shed
+// entries ends, it writes a single summary entry to out.
+func (b *throughputBudget) admit(ent zapcore.Entry) bool {
+	now, lvl := ent.Time, ent.Level
+
+	b.mu.Lock()
+	var summary []zap.Field
+	if now.Sub(b.window) >= time.Second {
+		summary = b.summaryLocked()
+		b.window, b.bytes, b.entries = now, 0, 0
+		clear(b.shed[:])
+	}
+
+	ok := lvl >= zapcore.DPanicLevel || b.usageLocked() < shedThreshold(lvl)
+	if ok {
+		b.entries++
+	} else if lvl >= zapcore.DebugLevel {
+		b.shed[lvl-zapcore.DebugLevel]++
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		droppedEntries.Add(1)
+	}
+	if summary != nil {
+		ent := zapcore.Entry{Level: zapcore.WarnLevel, Time: now, Message: "log throughput budget exceeded, entries shed"}
+		if ce := b.out.Check(ent, nil); ce != nil {
+			ce.Write(summary...)
+		}
+	}
+	return ok
+}
+
+func (b *throughputBudget) usageLocked() float64 {
+	var usage float64
+	if b.cfg.BytesPerSecond > 0 {
+		usage = float64(b.bytes) / float64(b.cfg.BytesPerSecond)
+	}
+	if b.cfg.EntriesPerSecond > 0 {
+		usage = max(usage, float64(b.entries)/float64(b.cfg.EntriesPerSecond))
+	}
+	return usage
+}
+
+func (b *throughputBudget) summaryLocked() []zap.Field {
+	var fields []zap.Field
+	for i, n := range b.shed {
+		if n > 0 {
+			fields = append(fields, zap.Uint64("shed_"+(zapcore.DebugLevel+zapcore.Level(i)).String(), n))
+		}
+	}
+	return fields
+}
+
+func (b *throughputBudget) addBytes(n int64) {
+	b.mu.Lock()
+	b.bytes += n
+	b.mu.Unlock()
+}
+
+// throughputCore enforces a throughput budget in front of the sinks.
+// ctxBytes is the estimated size of the fields added with With.
+type throughputCore struct {
+	zapcore.Core
+	budget   *throughputBudget
+	ctxBytes int64
+}
+
+func newThroughputCore(inner zapcore.Core, cfg ThroughputConfig) *throughputCore {
+	return &throughputCore{Core: inner, budget: &throughputBudget{cfg: cfg, out: inner}}
+}
+
+func (c *throughputCore) With(fields []zapcore.Field) zapcore.Core {
+	return &throughputCore{Core: c.Core.With(fields), budget: c.budget, ctxBytes: c.ctxBytes + estimateFieldsSize(fields)}
+}
+
+func (c *throughputCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) || !c.budget.admit(ent) {
+		return ce
+	}
+	return c.Core.Check(ent, ce.AddCore(ent, throughputMeter{c}))
+}
+
+// throughputMeter charges the size of each written entry to the budget.
+type throughputMeter struct {
+	c *throughputCore
+}
+
+func (m throughputMeter) Enabled(zapcore.Level) bool        { return true }
+func (m throughputMeter) With([]zapcore.Field) zapcore.Core { return m }
+func (m throughputMeter) Check(_ zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce
+}
+func (m throughputMeter) Sync() error { return nil }
+
+func (m throughputMeter) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	// Timestamp, level, logger name and caller take roughly this much in either encoding.
+	const entryOverhead = 96
+	m.c.budget.addBytes(entryOverhead + int64(len(ent.Message)+len(ent.Stack)) + m.c.ctxBytes + estimateFieldsSize(fields))
+	return nil
+}
+
+// estimateFieldsSize approximates the encoded size of fields without encoding them.
+func estimateFieldsSize(fields []zapcore.Field) int64 {
+	var n int64
+	for _, f := range fields {
+		n += int64(len(f.Key)) + 6
+		switch f.Type {
+		case zapcore.StringType:
+			n += int64(len(f.String))
+		case zapcore.SkipType:
+		default:
+			n += int64(len(fieldString(f)))
+		}
+	}
+	return n
+}
@@ -0,0 +1,43 @@
+package zapang
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestThroughputShedsLowLevelsFirst(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	core := newThroughputCore(obs, ThroughputConfig{EntriesPerSecond: 4})
+	l := zap.New(core)
+
+	// Debug is shed at 50% of the budget, Info at 75%, Warn at 90%, Error at 100%.
+	for range 3 {
+		l.Debug("d")
+	}
+	l.Info("i")
+	l.Error("e")
+	l.Error("e")
+
+	var got string
+	for _, e := range logs.All() {
+		got += e.Message
+	}
+	if got != "ddie" {
+		t.Fatalf("unexpected admitted entries: %q", got)
+	}
+
+	// The next window starts with a summary of what was shed.
+	core.budget.mu.Lock()
+	core.budget.window = time.Now().Add(-time.Second)
+	core.budget.mu.Unlock()
+	l.Info("after")
+
+	summary := logs.All()[4]
+	if summary.Level != zapcore.WarnLevel || summary.ContextMap()["shed_debug"] != uint64(1) || summary.ContextMap()["shed_error"] != uint64(1) {
+		t.Fatalf("unexpected summary: %s %v", summary.Message, summary.ContextMap())
+	}
+}
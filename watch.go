@@ -0,0 +1,267 @@
+package zapang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// watchInterval is how often WatchConfig polls the config file.
+var watchInterval = time.Second
+
+// liveConfig holds the parts of a logger's configuration that can change at runtime.
+type liveConfig struct {
+	level   zap.AtomicLevel
+	filters atomic.Pointer[[]compiledRule]
+	sampler atomic.Pointer[zapcore.Core]
+	config  atomic.Pointer[Config]
+
+	// sinks are the output cores, kept for per-sink flushing.
+	sinks []namedSink
+
+	// lastWords is the crash buffer, if Config.LastWords is set.
+	lastWords *lastWords
+
+	// errs receives the logger's internal errors.
+	errs *errorOutput
+
+	// exportKey encrypts the export, if Config.ExportEncryption is set.
+	exportKey *EncryptingWriteSyncer
+}
+
+type namedSink struct {
+	name string
+	core zapcore.Core
+
+	// async is the sink's queue, if it is delivered asynchronously.
+	async *AsyncWriteSyncer
+}
+
+func newLiveConfig(cfg Config) *liveConfig {
+	live := &liveConfig{level: zap.NewAtomicLevelAt(parseLevel(cfg.Level))}
+	live.setFilters(cfg.Filters)
+	live.setSampling(cfg.Sampling)
+	live.config.Store(&cfg)
+	return live
+}
+
+// apply updates level, sampling, filters and named levels from cfg, leaving
+// those whose key is not in keys as they are. A new sampling policy keeps the
+// current OnDrop hook unless it sets its own.
+func (l *liveConfig) apply(cfg Config, keys map[string]bool) {
+	effective := *l.config.Load()
+	if keys["level"] {
+		setLevel(l.level, parseLevel(cfg.Level))
+	}
+	if keys["sampling"] {
+		if s := cfg.Sampling; s != nil && s.OnDrop == nil && effective.Sampling != nil {
+			sampling := *s
+			sampling.OnDrop = effective.Sampling.OnDrop
+			cfg.Sampling = &sampling
+		}
+		l.setSampling(cfg.Sampling)
+		effective.Sampling = cfg.Sampling
+	}
+	if keys["filters"] {
+		l.setFilters(cfg.Filters)
+		effective.Filters = cfg.Filters
+	}
+	if keys["named_levels"] {
+		setNamedLevels(effective.NamedLevels, cfg.NamedLevels)
+		effective.NamedLevels = cfg.NamedLevels
+	}
+	l.config.Store(&effective)
+}
+
+// setNamedLevels applies levels with SetNamedLevel and removes the overrides
+// of names in old that levels no longer has.
+func setNamedLevels(old, levels map[string]string) {
+	for name := range old {
+		if _, ok := levels[name]; !ok {
+			SetNamedLevel(name, "")
+		}
+	}
+	for name, level := range levels {
+		SetNamedLevel(name, level)
+	}
+}
+
+// effective returns the configuration currently in force, with the live level.
+func (l *liveConfig) effective() Config {
+	cfg := *l.config.Load()
+	cfg.Level = l.level.Level().String()
+	return cfg
+}
+
+func (l *liveConfig) setFilters(rules []FilterRule) {
+	if len(rules) == 0 {
+		l.filters.Store(nil)
+		return
+	}
+	compiled := compileFilters(rules)
+	l.filters.Store(&compiled)
+}
+
+// setSampling replaces the sampling policy. The sampler is a decision oracle
+// over acceptCore: zap samples by level and message only, so it never needs
+// the real cores or fields.
+func (l *liveConfig) setSampling(s *SamplingConfig) {
+	if s == nil || s.Initial <= 0 {
+		l.sampler.Store(nil)
+		return
+	}
+	sampler := zapcore.NewSamplerWithOptions(
+		acceptCore{},
+		time.Second,
+		s.Initial,
+		s.Thereafter,
+		zapcore.SamplerHook(samplerHook(s.OnDrop)),
+	)
+	l.sampler.Store(&sampler)
+}
+
+// sampleCore drops entries rejected by the live sampling policy.
+type sampleCore struct {
+	zapcore.Core
+	live *liveConfig
+}
+
+func (c *sampleCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sampleCore{Core: c.Core.With(fields), live: c.live}
+}
+
+func (c *sampleCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	if sampler := c.live.sampler.Load(); sampler != nil && (*sampler).Check(ent, nil) == nil {
+		return ce
+	}
+	countEmitted(ent.Level)
+	return c.Core.Check(ent, ce)
+}
+
+// configOf returns the configuration of the logger built by New that l
+// derives from, looking through the package's core wrappers, or nil for
+// loggers built otherwise.
+func configOf(l *zap.Logger) *Config {
+	if live := liveOf(l); live != nil {
+		return live.config.Load()
+	}
+	return nil
+}
+
+// liveOf returns the runtime state of the logger built by New that l derives
+// from, or nil.
+func liveOf(l *zap.Logger) *liveConfig {
+	c := l.Core()
+	for {
+		switch core := c.(type) {
+		case *sampleCore:
+			return core.live
+		case interface{ unwrap() zapcore.Core }:
+			c = core.unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// acceptCore accepts every entry and writes nothing.
+type acceptCore struct{}
+
+func (acceptCore) Enabled(zapcore.Level) bool                 { return true }
+func (c acceptCore) With([]zapcore.Field) zapcore.Core        { return c }
+func (acceptCore) Write(zapcore.Entry, []zapcore.Field) error { return nil }
+func (acceptCore) Sync() error                                { return nil }
+
+func (c acceptCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+// WatchConfig polls a YAML or JSON config file and applies changes to level,
+// sampling, filters and named levels of the global logger without restart.
+// Settings the file leaves out keep their current values. The file is read
+// once immediately; an error is returned if that fails. Later read or parse
+// errors are logged and the previous configuration is kept.
+func WatchConfig(ctx context.Context, path string) error {
+	globalMu.RLock()
+	live := globalLive
+	globalMu.RUnlock()
+	if live == nil {
+		return errors.New("zapang: WatchConfig requires a logger created with New")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, keys, err := parseConfigFile(path, data)
+	if err != nil {
+		return err
+	}
+	live.apply(cfg, keys)
+
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			next, err := os.ReadFile(path)
+			if err != nil {
+				Global().Warn("config watch: read failed", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			if bytes.Equal(next, data) {
+				continue
+			}
+			data = next
+
+			cfg, keys, err := parseConfigFile(path, data)
+			if err != nil {
+				Global().Warn("config watch: parse failed", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			live.apply(cfg, keys)
+			Global().Info("config watch: applied", zap.String("path", path), zap.String("level", live.level.Level().String()))
+		}
+	}()
+
+	return nil
+}
+
+// parseConfigFile decodes JSON for .json files and YAML otherwise, and
+// returns the top-level keys the file sets.
+func parseConfigFile(path string, data []byte) (Config, map[string]bool, error) {
+	unmarshal := yaml.Unmarshal
+	if filepath.Ext(path) == ".json" {
+		unmarshal = json.Unmarshal
+	}
+	var cfg Config
+	var raw map[string]any
+	if err := unmarshal(data, &cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := unmarshal(data, &raw); err != nil {
+		return cfg, nil, err
+	}
+	keys := make(map[string]bool, len(raw))
+	for key := range raw {
+		keys[key] = true
+	}
+	return cfg, keys, nil
+}
@@ -0,0 +1,165 @@
+package zapang
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWatchConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watchInterval = 10 * time.Millisecond
+	New(ctx, "serviceName", Config{Level: "info"}, nil)
+
+	path := filepath.Join(t.TempDir(), "log.yaml")
+	if err := os.WriteFile(path, []byte("level: warn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WatchConfig(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if GlobalLevel().Level() != zapcore.WarnLevel {
+		t.Fatalf("initial config not applied: %s", GlobalLevel().Level())
+	}
+
+	data := "level: debug\nfilters:\n  - field: http_path\n    value: /healthz\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for GlobalLevel().Level() != zapcore.DebugLevel {
+		if time.Now().After(deadline) {
+			t.Fatal("config change not applied")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if rules := globalLive.filters.Load(); rules == nil || len(*rules) != 1 {
+		t.Fatal("filters not applied")
+	}
+}
+
+func TestWatchConfigPartial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer SetNamedLevel("watch-billing", "")
+
+	var dropped atomic.Int32
+	New(ctx, "serviceName", Config{
+		Level:        "warn",
+		ConsoleLevel: "fatal",
+		Sampling:     &SamplingConfig{Initial: 1, Thereafter: 1000, OnDrop: func(zapcore.Entry) { dropped.Add(1) }},
+	}, io.Discard)
+
+	// apply reads the file once before it starts polling.
+	apply := func(data string) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "log.yaml")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		if err := WatchConfig(watchCtx, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply("sampling:\n  initial: 1\n  thereafter: 1000\nnamed_levels:\n  watch-billing: debug\n")
+	if GlobalLevel().Level() != zapcore.WarnLevel {
+		t.Fatalf("a file without level must keep it, got %s", GlobalLevel().Level())
+	}
+	for range 3 {
+		Global().Warn("repeated")
+	}
+	if dropped.Load() != 2 {
+		t.Fatalf("OnDrop was not kept across the reload: %d drops", dropped.Load())
+	}
+	if !Get("watch-billing").Core().Enabled(zapcore.DebugLevel) {
+		t.Fatal("named level not applied")
+	}
+
+	apply("named_levels: {}\n")
+	if Get("watch-billing").Core().Enabled(zapcore.DebugLevel) {
+		t.Fatal("named level removed from the file is still applied")
+	}
+	if s := globalLive.config.Load().Sampling; s == nil || s.Thereafter != 1000 {
+		t.Fatalf("a file without sampling must keep it, got %+v", s)
+	}
+}
+
+// treeGetter resolves dotted keys in a nested map, like koanf, with env
+// overriding leaves by exact key, like viper's AutomaticEnv.
+type treeGetter struct {
+	tree map[string]any
+	env  map[string]string
+}
+
+func (g treeGetter) Get(key string) any {
+	if v, ok := g.env[key]; ok {
+		return v
+	}
+	var cur any = g.tree
+	for part := range strings.SplitSeq(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func TestConfigFromViper(t *testing.T) {
+	g := treeGetter{
+		tree: map[string]any{"logging": map[string]any{
+			"level":       "warn",
+			"Environment": "prod",
+			"sampling":    map[string]any{"initial": 10},
+			"filters":     []any{map[string]any{"field": "path", "value": "/healthz", "action": "drop"}},
+			"error_rate":  map[string]any{"interval": "30s"},
+		}},
+		env: map[string]string{
+			"logging.level":              "debug",
+			"logging.error_output_paths": "stderr, /tmp/zapang.err",
+			"logging.disable_caller":     "true",
+		},
+	}
+
+	cfg, err := ConfigFromViper(g, "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level != "debug" || !cfg.DisableCaller || len(cfg.ErrorOutputPaths) != 2 || cfg.ErrorOutputPaths[1] != "/tmp/zapang.err" {
+		t.Fatalf("environment overrides not applied: %+v", cfg)
+	}
+	if cfg.Environment != EnvProd || cfg.ErrorRate.Interval != 30*time.Second || len(cfg.Filters) != 1 || cfg.Filters[0].Value != "/healthz" {
+		t.Fatalf("file values not decoded: %+v", cfg)
+	}
+	if cfg.Sampling.Initial != 10 || cfg.Sampling.Thereafter != 100 || cfg.StacktraceLevel != "error" {
+		t.Fatalf("defaults not merged: %+v %+v", cfg, cfg.Sampling)
+	}
+
+	if cfg, err := ConfigFromKoanf(g, "logging"); err != nil || cfg.Level != "warn" {
+		t.Fatalf("koanf: level %q, err %v", cfg.Level, err)
+	}
+
+	for _, tree := range []map[string]any{
+		{"levle": "debug"},
+		{"level": "verbose"},
+		{"sampling": map[string]any{"initial": "many"}},
+	} {
+		if _, err := ConfigFromKoanf(treeGetter{tree: map[string]any{"logging": tree}}, "logging"); err == nil {
+			t.Errorf("%v: expected an error", tree)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package zapang
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Task kinds for TaskInfo.Kind.
+const (
+	TaskWorkflow = "workflow"
+	TaskActivity = "activity"
+)
+
+// TaskInfo describes a workflow or activity execution. Adapt your worker
+// framework's execution info to it in an interceptor, e.g. Temporal's
+// activity.GetInfo(ctx) or workflow.GetInfo(ctx).
+type TaskInfo struct {
+	// Kind is TaskWorkflow or TaskActivity.
+	Kind string
+
+	// Type is the workflow or activity type name.
+	Type string
+
+	// WorkflowID and RunID identify the workflow execution.
+	WorkflowID string
+	RunID      string
+
+	// ActivityID identifies the activity within its workflow; empty for workflows.
+	ActivityID string
+
+	// Attempt is the 1-based execution attempt. Attempts after the first are
+	// logged as retries.
+	Attempt int32
+
+	// TaskQueue is the queue the task was polled from.
+	TaskQueue string
+
+	// Replaying suppresses logging while a workflow replays its history, so
+	// each step is logged once. The task still gets a logger, which discards.
+	Replaying bool
+}
+
+// WrapTask runs fn as a workflow or activity task, the worker framework
+// counterpart of WrapJob. It derives a logger with workflow_id, run_id, the
+// task type and attempt from ctx, injects it into the context passed to fn,
+// and logs "<kind> started" (or "<kind> retry" for later attempts) and
+// "<kind> completed" or "<kind> failed" with duration_ms. A panic in fn is
+// recovered, logged with its stack, reported to OnPanic hooks and returned as
+// an error, so the framework can fail and retry the task.
+func WrapTask(ctx context.Context, info TaskInfo, fn func(ctx context.Context) error) (err error) {
+	kind := info.Kind
+	if kind == "" {
+		kind = TaskActivity
+	}
+
+	log := FromContext(ctx)
+	if info.Replaying {
+		log = zap.NewNop()
+	}
+	log = log.With(taskFields(kind, info)...)
+	ctx = WithContext(ctx, log)
+
+	start := time.Now()
+	if info.Attempt > 1 {
+		log.Warn(kind + " retry")
+	} else {
+		log.Info(kind + " started")
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Error("panic recovered", zap.Any("panic", rec), zap.Stack("stacktrace"))
+			notifyPanic(PanicInfo{
+				Value:   rec,
+				Stack:   debug.Stack(),
+				Time:    time.Now(),
+				Context: ctx,
+			})
+			err = fmt.Errorf("zapang: %s %s panicked: %v", kind, info.Type, rec)
+		}
+
+		if err != nil {
+			log.Error(kind+" failed", DurationMs(time.Since(start)), Error(err))
+			return
+		}
+		log.Info(kind+" completed", DurationMs(time.Since(start)))
+	}()
+
+	return fn(ctx)
+}
+
+func taskFields(kind string, info TaskInfo) []zap.Field {
+	fields := []zap.Field{WorkflowID(info.WorkflowID), RunID(info.RunID)}
+	if kind == TaskWorkflow {
+		fields = append(fields, WorkflowType(info.Type))
+	} else {
+		fields = append(fields, ActivityType(info.Type))
+		if info.ActivityID != "" {
+			fields = append(fields, ActivityID(info.ActivityID))
+		}
+	}
+	if info.Attempt > 0 {
+		fields = append(fields, Attempt(info.Attempt))
+	}
+	if info.TaskQueue != "" {
+		fields = append(fields, QueueName(info.TaskQueue))
+	}
+	return fields
+}